@@ -0,0 +1,8 @@
+package main
+
+import "github.com/deepakg86/weather-api-caching/pkg/weather"
+
+// Single binary for both modes: go run . -mode=simulated
+func main() {
+	weather.Run(weather.ModeLive)
+}
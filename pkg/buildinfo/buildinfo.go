@@ -0,0 +1,28 @@
+// Package buildinfo identifies the running build. Release builds set the
+// variables with -ldflags, e.g.
+//
+//	go build -ldflags "-X github.com/deepakg86/weather-api-caching/pkg/buildinfo.Version=v1.4.0
+//	  -X github.com/deepakg86/weather-api-caching/pkg/buildinfo.Commit=$(git rev-parse --short HEAD)
+//	  -X github.com/deepakg86/weather-api-caching/pkg/buildinfo.Date=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// Anything not set reads "dev".
+package buildinfo
+
+import "runtime"
+
+var (
+	Version = "dev"
+	Commit  = "dev"
+	Date    = "dev" // when the binary was built, RFC 3339 by convention
+)
+
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	Date      string `json:"build_date"`
+	GoVersion string `json:"go_version"`
+}
+
+func Get() Info {
+	return Info{Version: Version, Commit: Commit, Date: Date, GoVersion: runtime.Version()}
+}
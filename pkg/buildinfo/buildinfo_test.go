@@ -0,0 +1,44 @@
+package buildinfo
+
+import (
+	"encoding/json"
+	"runtime"
+	"testing"
+)
+
+func TestDefaultsWithoutLdflags(t *testing.T) {
+	got := Get()
+	want := Info{Version: "dev", Commit: "dev", Date: "dev", GoVersion: runtime.Version()}
+	if got != want {
+		t.Errorf("Get() = %+v, want %+v", got, want)
+	}
+}
+
+func TestJSONShape(t *testing.T) {
+	saved := [3]string{Version, Commit, Date}
+	t.Cleanup(func() { Version, Commit, Date = saved[0], saved[1], saved[2] })
+	Version, Commit, Date = "v1.4.0", "b788c19", "2026-03-07T12:00:00Z"
+
+	b, err := json.Marshal(Get())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fields map[string]string
+	if err := json.Unmarshal(b, &fields); err != nil {
+		t.Fatalf("%s: %v", b, err)
+	}
+	want := map[string]string{
+		"version":    "v1.4.0",
+		"commit":     "b788c19",
+		"build_date": "2026-03-07T12:00:00Z",
+		"go_version": runtime.Version(),
+	}
+	if len(fields) != len(want) {
+		t.Errorf("fields %v, want exactly %v", fields, want)
+	}
+	for k, v := range want {
+		if fields[k] != v {
+			t.Errorf("%s = %q, want %q", k, fields[k], v)
+		}
+	}
+}
@@ -0,0 +1,486 @@
+// Package cache is an in-memory LRU cache whose entries expire a fixed
+// time after their value was produced. Entries are spread over shards so
+// lookups of different keys rarely contend; each shard holds its share of
+// the capacity and evicts its own least recently used entries.
+package cache
+
+import (
+	"container/list"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Why an entry left the cache, as passed to Options.OnRemove
+type RemoveReason int
+
+const (
+	Expired  RemoveReason = iota // looked up after its TTL
+	Outdated                     // stored under an older Version and looked up or overwritten
+	Replaced                     // overwritten by Set
+	Evicted                      // pushed out to make room
+	Deleted                      // removed by Delete
+)
+
+func (r RemoveReason) String() string {
+	switch r {
+	case Expired:
+		return "expired"
+	case Outdated:
+		return "outdated"
+	case Replaced:
+		return "replaced"
+	case Evicted:
+		return "evicted"
+	case Deleted:
+		return "deleted"
+	}
+	return fmt.Sprintf("RemoveReason(%d)", int(r))
+}
+
+type Options[V any] struct {
+	MaxSize int // entries in the main lists, split evenly over the shards
+	TTL     time.Duration
+	Shards  int // never more than MaxSize; zero means one
+
+	// LRU-2: first-time entries wait in a FIFO of this many, split over
+	// the shards like MaxSize, until a second lookup promotes them to the
+	// main list, so one-off lookups cannot push hot entries out. Zero
+	// means plain LRU.
+	ProbationSize int
+
+	// When a value was produced; an entry expires TTL after it. Nil means
+	// entries never expire.
+	Stamp func(V) time.Time
+
+	// Recorded on every entry stored; an entry from an older version is
+	// dropped when next looked up, e.g. once the value's shape has changed
+	Version int
+
+	// Called whenever an entry leaves the cache, with its shard locked, so
+	// it must not call back into the cache
+	OnRemove func(key string, value V, reason RemoveReason)
+}
+
+// One slice of the cache, with its own lock, lists and capacity
+type shard struct {
+	index    int
+	mu       sync.RWMutex
+	items    map[string]*list.Element
+	main     *list.List
+	capacity int // entries main may hold; changed by Resize
+	// First-time entries in FIFO order, at most probationCap of them; nil
+	// without LRU-2 or when the shard's share of ProbationSize is zero
+	probation    *list.List
+	probationCap int
+}
+
+type item[V any] struct {
+	key         string
+	value       V
+	version     int
+	onProbation bool
+	accesses    uint64 // lookups since the entry was stored
+	lastUsed    uint64 // Cache.clock when last stored or looked up; on probation, when stored
+}
+
+// Every use stamps an entry from one clock, which orders Entries
+// cache-wide; eviction only looks within the entry's shard
+type Cache[V any] struct {
+	shards   []*shard
+	maxSize  atomic.Int64 // entries in the main lists; changed only by Resize
+	resizeMu sync.Mutex
+	ttl      atomic.Int64 // nanoseconds
+
+	stamp    func(V) time.Time
+	version  int
+	onRemove func(key string, value V, reason RemoveReason)
+
+	clock        atomic.Uint64 // stamps entries as they are used
+	mainLen      atomic.Int64  // entries in every shard's main list
+	probationLen atomic.Int64  // entries in every shard's probation list
+
+	hits            atomic.Uint64
+	misses          atomic.Uint64
+	evictedByExpiry atomic.Uint64
+	evictedBySize   atomic.Uint64
+}
+
+func New[V any](opts Options[V]) (*Cache[V], error) {
+	if err := CheckSize(opts.MaxSize); err != nil {
+		return nil, err
+	}
+	if opts.TTL <= 0 {
+		return nil, fmt.Errorf("cache TTL must be positive, got %v", opts.TTL)
+	}
+	if opts.ProbationSize < 0 {
+		return nil, fmt.Errorf("probation size must not be negative, got %d", opts.ProbationSize)
+	}
+	c := &Cache[V]{
+		shards:   make([]*shard, max(min(opts.Shards, opts.MaxSize), 1)),
+		stamp:    opts.Stamp,
+		version:  opts.Version,
+		onRemove: opts.OnRemove,
+	}
+	c.maxSize.Store(int64(opts.MaxSize))
+	c.ttl.Store(int64(opts.TTL))
+	for i := range c.shards {
+		c.shards[i] = &shard{
+			index:        i,
+			items:        make(map[string]*list.Element),
+			main:         list.New(),
+			capacity:     share(opts.MaxSize, len(c.shards), i),
+			probationCap: share(opts.ProbationSize, len(c.shards), i),
+		}
+		if c.shards[i].probationCap > 0 {
+			c.shards[i].probation = list.New()
+		}
+	}
+	return c, nil
+}
+
+// Shard i's part of total entries split over n shards, the first
+// total%n shards taking one more
+func share(total, n, i int) int {
+	if i < total%n {
+		return total/n + 1
+	}
+	return total / n
+}
+
+// CheckSize reports whether n is usable as a maximum size
+func CheckSize(n int) error {
+	if n <= 0 {
+		return fmt.Errorf("cache size must be positive, got %d", n)
+	}
+	return nil
+}
+
+// How long an entry is served after its value was produced
+func (c *Cache[V]) TTL() time.Duration {
+	return time.Duration(c.ttl.Load())
+}
+
+// Change the TTL at runtime. Freshness is checked on every read, so the
+// new TTL applies to entries already cached: lengthening it makes
+// entries past the old TTL servable again until they are read and
+// dropped.
+func (c *Cache[V]) SetTTL(d time.Duration) error {
+	if d <= 0 {
+		return fmt.Errorf("cache TTL must be positive, got %v", d)
+	}
+	c.ttl.Store(int64(d))
+	return nil
+}
+
+func (c *Cache[V]) MaxSize() int {
+	return int(c.maxSize.Load())
+}
+
+// Grow or shrink the cache to newMax entries at runtime, split over the
+// shards as at New. Shrinking evicts each shard's least recently used
+// entries until its share is left; below the shard count, some shards
+// get no share and stop holding entries.
+func (c *Cache[V]) Resize(newMax int) error {
+	if err := CheckSize(newMax); err != nil {
+		return err
+	}
+	c.resizeMu.Lock()
+	defer c.resizeMu.Unlock()
+	c.maxSize.Store(int64(newMax))
+	for i, sh := range c.shards {
+		sh.mu.Lock()
+		sh.capacity = share(newMax, len(c.shards), i)
+		c.trim(sh)
+		sh.mu.Unlock()
+	}
+	return nil
+}
+
+func (c *Cache[V]) shardFor(key string) *shard {
+	if len(c.shards) == 1 {
+		return c.shards[0]
+	}
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return c.shards[h.Sum32()%uint32(len(c.shards))]
+}
+
+// Entries held in either list, across all shards
+func (c *Cache[V]) Len() int {
+	return int(c.mainLen.Load() + c.probationLen.Load())
+}
+
+// Why an entry can no longer be served, if it cannot
+func (c *Cache[V]) stale(it *item[V]) (RemoveReason, bool) {
+	if it.version < c.version {
+		return Outdated, true
+	}
+	if c.stamp != nil && time.Since(c.stamp(it.value)) >= c.TTL() {
+		return Expired, true
+	}
+	return 0, false
+}
+
+// The value stored under key if it is still fresh, counting a hit or a
+// miss. A hit makes the entry the most recently used, or under LRU-2
+// promotes it from probation; a stale entry is removed.
+func (c *Cache[V]) Get(key string) (V, bool) {
+	var zero V
+	sh := c.shardFor(key)
+	// A full lock, since a lookup reorders the lists
+	sh.mu.Lock()
+	elem, ok := sh.items[key]
+	if !ok {
+		sh.mu.Unlock()
+		c.misses.Add(1)
+		return zero, false
+	}
+	it := elem.Value.(*item[V])
+	if reason, stale := c.stale(it); stale {
+		// Removed before it can be promoted or push a fresh entry out
+		if reason == Expired {
+			c.evictedByExpiry.Add(1)
+		}
+		c.remove(sh, elem, reason)
+		sh.mu.Unlock()
+		c.misses.Add(1)
+		return zero, false
+	}
+
+	it.accesses++
+	if it.onProbation {
+		// Second access: the entry has earned a place in the main list
+		c.unlink(sh, elem)
+		it.onProbation = false
+		c.link(sh, it)
+	} else {
+		it.lastUsed = c.clock.Add(1)
+		sh.main.MoveToFront(elem)
+	}
+	value := it.value
+	c.trim(sh)
+	sh.mu.Unlock()
+	c.hits.Add(1)
+	return value, true
+}
+
+// Store value under key as the most recently used entry, or under LRU-2
+// as the newest on probation, evicting what no longer fits
+func (c *Cache[V]) Set(key string, value V) {
+	sh := c.shardFor(key)
+	sh.mu.Lock()
+	it := &item[V]{key: key, value: value, version: c.version}
+	if elem, exists := sh.items[key]; exists {
+		old := elem.Value.(*item[V])
+		reason := Replaced
+		if old.version < c.version {
+			reason = Outdated
+		}
+		if !old.onProbation {
+			// Keep its place in the main list
+			it.lastUsed = c.clock.Add(1)
+			elem.Value = it
+			sh.main.MoveToFront(elem)
+			c.removed(old, reason)
+			sh.mu.Unlock()
+			return
+		}
+		c.remove(sh, elem, reason)
+	}
+	it.onProbation = sh.probation != nil
+	c.link(sh, it)
+	c.trim(sh)
+	sh.mu.Unlock()
+}
+
+// Remove the entry stored under key, returning its value
+func (c *Cache[V]) Delete(key string) (V, bool) {
+	sh := c.shardFor(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	elem, ok := sh.items[key]
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	it := elem.Value.(*item[V])
+	c.remove(sh, elem, Deleted)
+	return it.value, true
+}
+
+// A copy of one entry, and the shard it is in
+type Entry[V any] struct {
+	Key         string
+	Value       V
+	Shard       int
+	Accesses    uint64 // lookups since the entry was stored
+	OnProbation bool
+	Version     int  // Options.Version when it was stored
+	Expired     bool // older than the TTL
+	Outdated    bool // stored under an older Version
+
+	lastUsed uint64
+}
+
+// Whether the entry would be served by Get
+func (e Entry[V]) Fresh() bool {
+	return !e.Expired && !e.Outdated
+}
+
+func (c *Cache[V]) entry(sh *shard, it *item[V]) Entry[V] {
+	e := Entry[V]{
+		Key:         it.key,
+		Value:       it.value,
+		Shard:       sh.index,
+		Accesses:    it.accesses,
+		OnProbation: it.onProbation,
+		Version:     it.version,
+		Outdated:    it.version < c.version,
+		lastUsed:    it.lastUsed,
+	}
+	e.Expired = c.stamp != nil && time.Since(c.stamp(it.value)) >= c.TTL()
+	return e
+}
+
+// The entry stored under key, fresh or not, without counting as a lookup
+// or reordering the lists
+func (c *Cache[V]) Peek(key string) (Entry[V], bool) {
+	sh := c.shardFor(key)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+	elem, ok := sh.items[key]
+	if !ok {
+		return Entry[V]{}, false
+	}
+	return c.entry(sh, elem.Value.(*item[V])), true
+}
+
+// A copy of every entry in cache-wide LRU order, the most recently used
+// first; under LRU-2 the probationary entries follow, newest first
+func (c *Cache[V]) Entries() []Entry[V] {
+	// Hold every shard so the copy is of one moment
+	for _, sh := range c.shards {
+		sh.mu.RLock()
+		defer sh.mu.RUnlock()
+	}
+	result := []Entry[V]{}
+	for _, sh := range c.shards {
+		for _, elem := range sh.items {
+			result = append(result, c.entry(sh, elem.Value.(*item[V])))
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].OnProbation != result[j].OnProbation {
+			return !result[i].OnProbation
+		}
+		return result[i].lastUsed > result[j].lastUsed
+	})
+	return result
+}
+
+type Stats struct {
+	Hits            uint64
+	Misses          uint64
+	EvictedByExpiry uint64 // found expired on lookup
+	EvictedBySize   uint64 // pushed out to make room
+	Size            int
+	MaxSize         int
+}
+
+func (c *Cache[V]) Stats() Stats {
+	return Stats{
+		Hits:            c.hits.Load(),
+		Misses:          c.misses.Load(),
+		EvictedByExpiry: c.evictedByExpiry.Load(),
+		EvictedBySize:   c.evictedBySize.Load(),
+		Size:            c.Len(),
+		MaxSize:         c.MaxSize(),
+	}
+}
+
+// One shard's bookkeeping. Items should equal Main plus Probation; a
+// mismatch means an entry leaked from the map or a list.
+type ShardStats struct {
+	Shard     int
+	Items     int
+	Main      int
+	Probation int
+	Capacity  int // the shard's share of MaxSize
+}
+
+func (c *Cache[V]) ShardStats() []ShardStats {
+	result := make([]ShardStats, len(c.shards))
+	for i, sh := range c.shards {
+		sh.mu.RLock()
+		result[i] = ShardStats{Shard: i, Items: len(sh.items), Main: sh.main.Len(), Capacity: sh.capacity}
+		if sh.probation != nil {
+			result[i].Probation = sh.probation.Len()
+		}
+		sh.mu.RUnlock()
+	}
+	return result
+}
+
+// The list an entry lives in
+func (sh *shard) listOf(onProbation bool) *list.List {
+	if onProbation {
+		return sh.probation
+	}
+	return sh.main
+}
+
+// Add an entry to the front of its list. The caller holds sh.mu and calls
+// trim before letting go of it.
+func (c *Cache[V]) link(sh *shard, it *item[V]) {
+	it.lastUsed = c.clock.Add(1)
+	sh.items[it.key] = sh.listOf(it.onProbation).PushFront(it)
+	if it.onProbation {
+		c.probationLen.Add(1)
+	} else {
+		c.mainLen.Add(1)
+	}
+}
+
+// Take an entry out of its list and the map
+func (c *Cache[V]) unlink(sh *shard, elem *list.Element) {
+	it := elem.Value.(*item[V])
+	sh.listOf(it.onProbation).Remove(elem)
+	delete(sh.items, it.key)
+	if it.onProbation {
+		c.probationLen.Add(-1)
+	} else {
+		c.mainLen.Add(-1)
+	}
+}
+
+func (c *Cache[V]) remove(sh *shard, elem *list.Element, reason RemoveReason) {
+	c.unlink(sh, elem)
+	c.removed(elem.Value.(*item[V]), reason)
+}
+
+func (c *Cache[V]) removed(it *item[V], reason RemoveReason) {
+	if c.onRemove != nil {
+		c.onRemove(it.key, it.value, reason)
+	}
+}
+
+// Evict entries until both of the shard's lists fit, the least recently
+// used first from main and the longest waiting first from probation. The
+// caller holds sh.mu.
+func (c *Cache[V]) trim(sh *shard) {
+	for sh.main.Len() > sh.capacity {
+		c.evict(sh, sh.main.Back())
+	}
+	for sh.probation != nil && sh.probation.Len() > sh.probationCap {
+		c.evict(sh, sh.probation.Back())
+	}
+}
+
+func (c *Cache[V]) evict(sh *shard, elem *list.Element) {
+	c.remove(sh, elem, Evicted)
+	c.evictedBySize.Add(1)
+}
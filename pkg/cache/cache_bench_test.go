@@ -0,0 +1,67 @@
+package cache
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+// Concurrent reads and writes over a full cache, split over one shard and
+// over sixteen, to show what sharding buys under contention
+func BenchmarkShards(b *testing.B) {
+	const size = 1000
+	names := make([]string, 2*size)
+	for i := range names {
+		names[i] = fmt.Sprintf("city%d", i)
+	}
+	for _, shards := range []int{1, 16} {
+		b.Run(fmt.Sprintf("shards=%d", shards), func(b *testing.B) {
+			c, _ := newTestCache(b, Options[reading]{MaxSize: size, Shards: shards})
+			for _, name := range names[:size] {
+				c.Set(name, fresh(name))
+			}
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				rng := rand.New(rand.NewSource(rand.Int63()))
+				for pb.Next() {
+					name := names[rng.Intn(len(names))]
+					if _, ok := c.Get(name); !ok {
+						c.Set(name, fresh(name))
+					}
+				}
+			})
+		})
+	}
+}
+
+// A skewed workload: a few hot keys take most lookups while a long tail is
+// asked for once in a while, as with real traffic. LRU-2 should keep more
+// of the hot set through the tail's one-off lookups; the hit ratio is
+// reported alongside the time.
+func BenchmarkZipf(b *testing.B) {
+	const (
+		size = 100
+		keys = 10000
+	)
+	names := make([]string, keys)
+	for i := range names {
+		names[i] = fmt.Sprintf("city%d", i)
+	}
+	for _, policy := range []struct {
+		name      string
+		probation int
+	}{{"lru", 0}, {"lru2", size / 4}} {
+		b.Run(policy.name, func(b *testing.B) {
+			c, _ := newTestCache(b, Options[reading]{MaxSize: size, ProbationSize: policy.probation})
+			zipf := rand.NewZipf(rand.New(rand.NewSource(1)), 1.1, 1, keys-1)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				name := names[zipf.Uint64()]
+				if _, ok := c.Get(name); !ok {
+					c.Set(name, fresh(name))
+				}
+			}
+			b.ReportMetric(float64(c.Stats().Hits)/float64(b.N), "hits/op")
+		})
+	}
+}
@@ -0,0 +1,459 @@
+package cache
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// A value stamped with when it was produced
+type reading struct {
+	name string
+	at   time.Time
+}
+
+func fresh(name string) reading { return reading{name: name, at: time.Now()} }
+
+func stale(name string) reading { return reading{name: name, at: time.Now().Add(-2 * time.Hour)} }
+
+type removal struct {
+	key    string
+	reason RemoveReason
+}
+
+// A cache of readings expiring after an hour, recording every removal
+func newTestCache(t testing.TB, opts Options[reading]) (*Cache[reading], *[]removal) {
+	t.Helper()
+	var mu sync.Mutex
+	removed := &[]removal{}
+	if opts.TTL == 0 {
+		opts.TTL = time.Hour
+	}
+	opts.Stamp = func(r reading) time.Time { return r.at }
+	opts.OnRemove = func(key string, _ reading, reason RemoveReason) {
+		mu.Lock()
+		*removed = append(*removed, removal{key, reason})
+		mu.Unlock()
+	}
+	c, err := New(opts)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return c, removed
+}
+
+// Keys of every entry in cache-wide LRU order
+func keys[V any](c *Cache[V]) string {
+	result := []string{}
+	for _, e := range c.Entries() {
+		result = append(result, e.Key)
+	}
+	return fmt.Sprint(result)
+}
+
+func TestNewRejectsBadOptions(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options[int]
+	}{
+		{"zero size", Options[int]{MaxSize: 0, TTL: time.Hour}},
+		{"negative size", Options[int]{MaxSize: -1, TTL: time.Hour}},
+		{"zero TTL", Options[int]{MaxSize: 1}},
+		{"negative probation", Options[int]{MaxSize: 1, TTL: time.Hour, ProbationSize: -1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New(tt.opts); err == nil {
+				t.Error("New succeeded, want an error")
+			}
+		})
+	}
+}
+
+func TestGetAndSet(t *testing.T) {
+	c, _ := newTestCache(t, Options[reading]{MaxSize: 10, Shards: 4})
+	if _, ok := c.Get("a"); ok {
+		t.Fatal("empty cache had a hit")
+	}
+	c.Set("a", fresh("one"))
+	c.Set("a", fresh("two"))
+	got, ok := c.Get("a")
+	if !ok || got.name != "two" {
+		t.Errorf("Get = %v, %v; want the latest value", got, ok)
+	}
+	if st := c.Stats(); st.Hits != 1 || st.Misses != 1 || st.Size != 1 || st.MaxSize != 10 {
+		t.Errorf("stats = %+v", st)
+	}
+}
+
+// n keys that hash to the given shard
+func keysIn(c *Cache[reading], shard, n int) []string {
+	var result []string
+	for i := 0; len(result) < n; i++ {
+		if k := fmt.Sprint(i); c.shardFor(k).index == shard {
+			result = append(result, k)
+		}
+	}
+	return result
+}
+
+// Each shard holding no more than its share, and the shares adding up to
+// MaxSize
+func checkShares(t *testing.T, c *Cache[reading]) {
+	t.Helper()
+	total := 0
+	for _, s := range c.ShardStats() {
+		if s.Main > s.Capacity || s.Items != s.Main+s.Probation {
+			t.Errorf("shard %+v over its capacity or inconsistent", s)
+		}
+		total += s.Capacity
+	}
+	if total != c.MaxSize() {
+		t.Errorf("shard capacities add up to %d, want %d", total, c.MaxSize())
+	}
+}
+
+func TestCapacityIsPerShard(t *testing.T) {
+	c, removed := newTestCache(t, Options[reading]{MaxSize: 100, Shards: 16})
+	// 100 over 16: the first four shards take the remainder
+	if st := c.ShardStats(); st[0].Capacity != 7 || st[3].Capacity != 7 || st[4].Capacity != 6 || st[15].Capacity != 6 {
+		t.Errorf("shard capacities = %+v, want 7 for the first four and 6 after", st)
+	}
+
+	others := keysIn(c, 1, 3)
+	for _, k := range others {
+		c.Set(k, fresh(k))
+	}
+	full := keysIn(c, 0, 8)
+	for _, k := range full[:7] {
+		c.Set(k, fresh(k))
+	}
+	if len(*removed) != 0 {
+		t.Errorf("removed %v below capacity", *removed)
+	}
+
+	// Touch the oldest, so the next store in the shard evicts the second
+	// oldest; the other shard keeps all of its entries
+	c.Get(full[0])
+	c.Set(full[7], fresh(""))
+	if want := []removal{{full[1], Evicted}}; fmt.Sprint(*removed) != fmt.Sprint(want) {
+		t.Errorf("removed %v, want %v", *removed, want)
+	}
+	if n := c.Len(); n != 10 {
+		t.Errorf("Len = %d, want 7 in the full shard and 3 in the other", n)
+	}
+	if n := c.Stats().EvictedBySize; n != 1 {
+		t.Errorf("EvictedBySize = %d, want 1", n)
+	}
+
+	for i := 0; i < 1000; i++ {
+		c.Set(fmt.Sprint(i), fresh(""))
+	}
+	checkShares(t, c)
+}
+
+func TestFewerEntriesThanShards(t *testing.T) {
+	c, _ := newTestCache(t, Options[reading]{MaxSize: 3, Shards: 16})
+	if n := len(c.ShardStats()); n != 3 {
+		t.Errorf("%d shards for 3 entries, want 3", n)
+	}
+	for _, k := range []string{"a", "b", "c", "d", "e"} {
+		c.Set(k, fresh(k))
+	}
+	checkShares(t, c)
+	if _, ok := c.Peek("e"); !ok {
+		t.Error("the last entry stored was evicted")
+	}
+}
+
+func TestEntriesInLRUOrder(t *testing.T) {
+	c, _ := newTestCache(t, Options[reading]{MaxSize: 10, Shards: 4})
+	for _, k := range []string{"a", "b", "c", "d"} {
+		c.Set(k, fresh(k))
+	}
+	c.Get("b")
+	c.Get("d")
+	c.Set("a", fresh("a"))
+	if got, want := keys(c), "[a d b c]"; got != want {
+		t.Errorf("entries = %s, want %s", got, want)
+	}
+	e := c.Entries()[2]
+	if e.Key != "b" || e.Accesses != 1 || e.OnProbation || !e.Fresh() || e.Shard != c.shardFor("b").index {
+		t.Errorf("entry b = %+v", e)
+	}
+}
+
+func TestLRU2(t *testing.T) {
+	c, removed := newTestCache(t, Options[reading]{MaxSize: 2, Shards: 4, ProbationSize: 2})
+	for _, k := range []string{"a", "b", "c"} {
+		c.Set(k, fresh(k))
+	}
+	// Probation holds two, cache-wide; the first in was the first out
+	if got, want := keys(c), "[c b]"; got != want {
+		t.Errorf("entries = %s, want %s", got, want)
+	}
+	if want := []removal{{"a", Evicted}}; fmt.Sprint(*removed) != fmt.Sprint(want) {
+		t.Errorf("removed %v, want %v", *removed, want)
+	}
+
+	c.Get("b")
+	if got, want := keys(c), "[b c]"; got != want {
+		t.Errorf("entries after promoting b = %s, want %s", got, want)
+	}
+	if e := c.Entries(); e[0].OnProbation || !e[1].OnProbation {
+		t.Errorf("b should be in the main list and c on probation: %+v", e)
+	}
+
+	// Overwriting a probationary entry leaves it on probation, newest
+	c.Set("d", fresh("d"))
+	c.Set("c", fresh("c2"))
+	if got, want := keys(c), "[b c d]"; got != want {
+		t.Errorf("entries = %s, want %s", got, want)
+	}
+
+	// Promotions past the main list's size evict its least recently used
+	c.Get("c")
+	c.Get("d")
+	if got, want := keys(c), "[d c]"; got != want {
+		t.Errorf("entries = %s, want %s", got, want)
+	}
+	st := c.ShardStats()
+	total := 0
+	for _, s := range st {
+		if s.Items != s.Main+s.Probation {
+			t.Errorf("shard %+v inconsistent", s)
+		}
+		total += s.Items
+	}
+	if total != 2 {
+		t.Errorf("shards hold %d entries, want 2", total)
+	}
+}
+
+func TestExpiredEntryIsRemovedNotPromoted(t *testing.T) {
+	c, removed := newTestCache(t, Options[reading]{MaxSize: 2, ProbationSize: 4})
+	for _, k := range []string{"a", "b"} {
+		c.Set(k, fresh(k))
+		c.Get(k)
+	}
+	c.Set("c", stale("c"))
+
+	// A second access to an expired entry is a miss, and must not push a
+	// fresh entry out of the full main list to make room for it
+	if _, ok := c.Get("c"); ok {
+		t.Fatal("expired entry served")
+	}
+	if got, want := keys(c), "[b a]"; got != want {
+		t.Errorf("entries = %s, want %s", got, want)
+	}
+	if want := []removal{{"c", Expired}}; fmt.Sprint(*removed) != fmt.Sprint(want) {
+		t.Errorf("removed %v, want %v", *removed, want)
+	}
+	if st := c.Stats(); st.EvictedBySize != 0 || st.EvictedByExpiry != 1 || st.Misses != 1 {
+		t.Errorf("stats = %+v", st)
+	}
+}
+
+func TestExpiredEntryIsNotMovedToFront(t *testing.T) {
+	c, _ := newTestCache(t, Options[reading]{MaxSize: 3})
+	c.Set("a", stale("a"))
+	c.Set("b", fresh("b"))
+	if e, _ := c.Peek("a"); !e.Expired || e.Fresh() {
+		t.Errorf("Peek(a) = %+v, want expired", e)
+	}
+	if _, ok := c.Get("a"); ok {
+		t.Fatal("expired entry served")
+	}
+	if got, want := keys(c), "[b]"; got != want {
+		t.Errorf("entries = %s, want %s", got, want)
+	}
+}
+
+func TestOutdatedVersion(t *testing.T) {
+	c, removed := newTestCache(t, Options[reading]{MaxSize: 3, Version: 1})
+	c.Set("a", fresh("a"))
+	c.Set("b", fresh("b"))
+	c.version = 2
+
+	if e, _ := c.Peek("a"); !e.Outdated || e.Expired || e.Fresh() || e.Version != 1 {
+		t.Errorf("Peek(a) = %+v, want outdated", e)
+	}
+	if _, ok := c.Get("a"); ok {
+		t.Error("outdated entry served")
+	}
+	c.Set("b", fresh("b2"))
+	if e, _ := c.Peek("b"); !e.Fresh() || e.Version != 2 {
+		t.Errorf("Peek(b) = %+v, want fresh at version 2", e)
+	}
+	if want := []removal{{"a", Outdated}, {"b", Outdated}}; fmt.Sprint(*removed) != fmt.Sprint(want) {
+		t.Errorf("removed %v, want %v", *removed, want)
+	}
+	if n := c.Stats().EvictedByExpiry; n != 0 {
+		t.Errorf("EvictedByExpiry = %d; an outdated entry has not expired", n)
+	}
+}
+
+func TestSetReportsReplaced(t *testing.T) {
+	c, removed := newTestCache(t, Options[reading]{MaxSize: 3})
+	c.Set("a", fresh("one"))
+	c.Set("a", fresh("two"))
+	if want := []removal{{"a", Replaced}}; fmt.Sprint(*removed) != fmt.Sprint(want) {
+		t.Errorf("removed %v, want %v", *removed, want)
+	}
+}
+
+func TestPeekDoesNotReorder(t *testing.T) {
+	c, _ := newTestCache(t, Options[reading]{MaxSize: 2})
+	c.Set("a", fresh("a"))
+	c.Set("b", fresh("b"))
+	if e, ok := c.Peek("a"); !ok || e.Value.name != "a" || e.Accesses != 0 {
+		t.Errorf("Peek(a) = %+v, %v", e, ok)
+	}
+	if _, ok := c.Peek("z"); ok {
+		t.Error("Peek found a missing key")
+	}
+	c.Set("c", fresh("c"))
+	if got, want := keys(c), "[c b]"; got != want {
+		t.Errorf("entries = %s, want %s; Peek must not count as a use", got, want)
+	}
+	if st := c.Stats(); st.Hits != 0 || st.Misses != 0 {
+		t.Errorf("Peek counted as a lookup: %+v", st)
+	}
+}
+
+func TestDelete(t *testing.T) {
+	c, removed := newTestCache(t, Options[reading]{MaxSize: 3, ProbationSize: 2})
+	c.Set("a", fresh("a"))
+	if v, ok := c.Delete("a"); !ok || v.name != "a" {
+		t.Errorf("Delete = %v, %v", v, ok)
+	}
+	if _, ok := c.Delete("a"); ok {
+		t.Error("deleted the same key twice")
+	}
+	if n := c.Len(); n != 0 {
+		t.Errorf("Len = %d, want 0", n)
+	}
+	if want := []removal{{"a", Deleted}}; fmt.Sprint(*removed) != fmt.Sprint(want) {
+		t.Errorf("removed %v, want %v", *removed, want)
+	}
+}
+
+func TestResize(t *testing.T) {
+	c, _ := newTestCache(t, Options[reading]{MaxSize: 100})
+	for i := 0; i < 100; i++ {
+		c.Set(fmt.Sprint(i), fresh(""))
+	}
+	for i := 0; i < 5; i++ {
+		c.Get(fmt.Sprint(i))
+	}
+	if err := c.Resize(5); err != nil {
+		t.Fatalf("Resize: %v", err)
+	}
+	if got, want := keys(c), "[4 3 2 1 0]"; got != want {
+		t.Errorf("entries = %s, want %s", got, want)
+	}
+	if st := c.Stats(); st.EvictedBySize != 95 || st.MaxSize != 5 || st.Size != 5 {
+		t.Errorf("stats = %+v, want 95 evicted", st)
+	}
+	if err := c.Resize(0); err == nil {
+		t.Error("Resize(0) succeeded")
+	}
+	if err := c.Resize(50); err != nil || c.MaxSize() != 50 || c.Len() != 5 {
+		t.Errorf("growing: err %v, max %d, len %d", err, c.MaxSize(), c.Len())
+	}
+}
+
+func TestResizeSplitsOverShards(t *testing.T) {
+	c, _ := newTestCache(t, Options[reading]{MaxSize: 100, Shards: 16})
+	for i := 0; i < 100; i++ {
+		c.Set(fmt.Sprint(i), fresh(""))
+	}
+	for _, size := range []int{40, 5, 200} {
+		if err := c.Resize(size); err != nil {
+			t.Fatalf("Resize(%d): %v", size, err)
+		}
+		checkShares(t, c)
+		if st := c.Stats(); st.Size > size || uint64(st.Size)+st.EvictedBySize != 100 {
+			t.Errorf("after Resize(%d): stats = %+v", size, st)
+		}
+		// Below the shard count, the shards past the size hold nothing
+		if st := c.ShardStats(); size == 5 && (st[4].Capacity != 1 || st[5].Capacity != 0 || st[15].Items != 0) {
+			t.Errorf("capacities after shrinking to 5 = %+v", st)
+		}
+	}
+}
+
+func TestSetTTL(t *testing.T) {
+	c, _ := newTestCache(t, Options[reading]{MaxSize: 3})
+	c.Set("a", stale("a"))
+	if err := c.SetTTL(3 * time.Hour); err != nil {
+		t.Fatalf("SetTTL: %v", err)
+	}
+	if c.TTL() != 3*time.Hour {
+		t.Errorf("TTL = %v", c.TTL())
+	}
+	if _, ok := c.Get("a"); !ok {
+		t.Error("entry within the longer TTL not served")
+	}
+	if err := c.SetTTL(0); err == nil {
+		t.Error("SetTTL(0) succeeded")
+	}
+}
+
+func TestNilStampNeverExpires(t *testing.T) {
+	c, err := New(Options[int]{MaxSize: 1, TTL: time.Nanosecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Set("a", 1)
+	time.Sleep(time.Millisecond)
+	if v, ok := c.Get("a"); !ok || v != 1 {
+		t.Errorf("Get = %v, %v", v, ok)
+	}
+}
+
+func TestRemoveReasonString(t *testing.T) {
+	for r, want := range map[RemoveReason]string{
+		Expired: "expired", Outdated: "outdated", Replaced: "replaced", Evicted: "evicted", Deleted: "deleted", 9: "RemoveReason(9)",
+	} {
+		if got := r.String(); got != want {
+			t.Errorf("%d.String() = %q, want %q", int(r), got, want)
+		}
+	}
+}
+
+// Run with -race: the size must hold and the shards stay consistent
+// whatever the interleaving
+func TestConcurrentUse(t *testing.T) {
+	c, _ := newTestCache(t, Options[reading]{MaxSize: 50, Shards: 8, ProbationSize: 10})
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				k := fmt.Sprint((g*7 + i) % 120)
+				if _, ok := c.Get(k); !ok {
+					c.Set(k, fresh(k))
+				}
+				if i%100 == 0 {
+					c.Entries()
+					c.Resize(40 + i%20)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	main, probation := 0, 0
+	for _, s := range c.ShardStats() {
+		if s.Items != s.Main+s.Probation {
+			t.Errorf("shard %+v inconsistent", s)
+		}
+		main += s.Main
+		probation += s.Probation
+	}
+	if main > c.MaxSize() || probation > 10 {
+		t.Errorf("%d main and %d probationary entries, want at most %d and 10", main, probation, c.MaxSize())
+	}
+}
@@ -0,0 +1,53 @@
+package weather
+
+import "strings"
+
+type conditions struct {
+	temp        float64
+	humidity    float64
+	hasHumidity bool
+	desc        string // lowercased weather description
+}
+
+func (c conditions) wet() bool {
+	for _, w := range []string{"rain", "drizzle", "shower", "thunder", "storm"} {
+		if strings.Contains(c.desc, w) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c conditions) snowy() bool {
+	for _, w := range []string{"snow", "sleet", "blizzard", "ice"} {
+		if strings.Contains(c.desc, w) {
+			return true
+		}
+	}
+	return false
+}
+
+// Rules are evaluated in order; the first match wins
+var activityRules = []struct {
+	match    func(c conditions) bool
+	activity string
+}{
+	{func(c conditions) bool { return c.snowy() && c.temp < 5 }, "Stay indoors"},
+	{func(c conditions) bool { return c.wet() }, "Good for a museum or cafe"},
+	{func(c conditions) bool { return c.temp > 25 && (!c.hasHumidity || c.humidity < 60) }, "Great for outdoor sports"},
+	{func(c conditions) bool { return c.temp > 25 }, "Stay hydrated and keep it light"},
+	{func(c conditions) bool { return c.temp >= 10 }, "Good for a walk"},
+	{func(c conditions) bool { return c.temp >= 0 }, "Wrap up warm for a short walk"},
+}
+
+// Recommend an outdoor activity for the given weather. Pass hasHumidity
+// false when the provider did not report humidity.
+func recommendActivity(temp, humidity float64, hasHumidity bool, desc string) string {
+	c := conditions{temp: temp, humidity: humidity, hasHumidity: hasHumidity, desc: strings.ToLower(desc)}
+	for _, rule := range activityRules {
+		if rule.match(c) {
+			return rule.activity
+		}
+	}
+	return "Stay indoors"
+}
@@ -0,0 +1,38 @@
+package weather
+
+import "testing"
+
+func TestRecommendActivity(t *testing.T) {
+	tests := []struct {
+		bucket      string
+		temp        float64
+		humidity    float64
+		hasHumidity bool
+		desc        string
+		want        string
+	}{
+		{"snow and cold", 1, 80, true, "Light snow", "Stay indoors"},
+		{"sleet just below 5°C", 4.9, 0, false, "Sleet", "Stay indoors"},
+		{"rain", 18, 70, true, "Moderate rain", "Good for a museum or cafe"},
+		{"thunder in the heat", 31, 40, true, "Thundery outbreaks", "Good for a museum or cafe"},
+		{"snow at 5°C is only wet", 5, 90, true, "Light snow showers", "Good for a museum or cafe"},
+		{"hot and dry", 28, 45, true, "Sunny", "Great for outdoor sports"},
+		{"hot without humidity", 28, 0, false, "Sunny", "Great for outdoor sports"},
+		{"hot and humid", 28, 75, true, "Sunny", "Stay hydrated and keep it light"},
+		{"hot at the humidity limit", 30, 60, true, "Clear", "Stay hydrated and keep it light"},
+		{"mild", 15, 50, true, "Partly cloudy", "Good for a walk"},
+		{"mild from 10°C", 10, 50, true, "Overcast", "Good for a walk"},
+		{"25°C is still mild", 25, 30, true, "Sunny", "Good for a walk"},
+		{"cold", 3, 50, true, "Overcast", "Wrap up warm for a short walk"},
+		{"cold from 0°C", 0, 50, true, "Clear", "Wrap up warm for a short walk"},
+		{"freezing", -5, 50, true, "Clear", "Stay indoors"},
+		{"snow without the cold", 12, 50, true, "Snow", "Good for a walk"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.bucket, func(t *testing.T) {
+			if got := recommendActivity(tt.temp, tt.humidity, tt.hasHumidity, tt.desc); got != tt.want {
+				t.Errorf("recommendActivity(%v, %v, %v, %q) = %q, want %q", tt.temp, tt.humidity, tt.hasHumidity, tt.desc, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,228 @@
+package weather
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/deepakg86/weather-api-caching/pkg/cache"
+)
+
+// Whether r bears ADMIN_TOKEN; never true when no token is configured
+func (s *Server) isAdmin(r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && s.config.AdminToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(s.config.AdminToken)) == 1
+}
+
+// Only requests bearing ADMIN_TOKEN get through
+func (s *Server) requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !s.isAdmin(r) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeProblem(w, http.StatusUnauthorized, "", "Unauthorized", r.URL.Path)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// Fields a hand-made entry must give, since a zero value would read as a
+// real reading: every field the response always carries, except the
+// greeting, which the server composes, and cache_time, which defaults
+// to now
+var requiredEntryFields = []string{"city", "temp", "desc", "activity", "condition", "precip_prob", "precip_mm", "precip_type"}
+
+var knownConditions = map[string]bool{
+	ConditionClear: true, ConditionClouds: true, ConditionRain: true, ConditionSnow: true,
+	ConditionStorm: true, ConditionFog: true, ConditionUnknown: true,
+}
+
+// Insert or replace a cache entry by hand, e.g. to pin known weather in
+// an integration environment. It is stored under the key /weather would
+// look up for the city, in the language given by ?lang=.
+func (s *Server) cacheEntryHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		w.Header().Set("Allow", http.MethodPut)
+		writeProblem(w, http.StatusMethodNotAllowed, "", "Method not allowed", r.URL.Path)
+		return
+	}
+	lang, err := parseLanguage(r.URL.Query().Get("lang"))
+	if err != nil {
+		writeProblem(w, http.StatusBadRequest, "", fmt.Sprintf("Invalid lang parameter: %v", err), r.URL.Path)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		writeProblem(w, http.StatusBadRequest, "", fmt.Sprintf("Error reading body: %v", err), r.URL.Path)
+		return
+	}
+	// The reading must be given explicitly, not left to zero values
+	var present map[string]json.RawMessage
+	if err := json.Unmarshal(body, &present); err != nil {
+		writeProblem(w, http.StatusBadRequest, "", fmt.Sprintf("Invalid JSON body: %v", err), r.URL.Path)
+		return
+	}
+	for _, field := range requiredEntryFields {
+		if _, ok := present[field]; !ok {
+			writeProblem(w, http.StatusBadRequest, "", fmt.Sprintf("Missing field: %s", field), r.URL.Path)
+			return
+		}
+	}
+	var data CityWeatherData
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&data); err != nil {
+		writeProblem(w, http.StatusBadRequest, "", fmt.Sprintf("Invalid JSON body: %v", err), r.URL.Path)
+		return
+	}
+
+	if strings.TrimSpace(data.City) == "" {
+		writeProblem(w, http.StatusBadRequest, "", "City must not be blank", r.URL.Path)
+		return
+	}
+	if data.City, err = ValidateCity(data.City); err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+	var invalid string
+	switch {
+	case data.Temp < -100 || data.Temp > 100:
+		invalid = "Temp must be between -100 and 100 °C"
+	case strings.TrimSpace(data.Desc) == "":
+		invalid = "Desc must not be blank"
+	case !knownConditions[data.Condition]:
+		invalid = fmt.Sprintf("Unknown condition %q", data.Condition)
+	case data.PrecipProb < 0 || data.PrecipProb > 1:
+		invalid = "Precip_prob must be between 0 and 1"
+	case data.PrecipMM < 0:
+		invalid = "Precip_mm must not be negative"
+	case data.PrecipType != "" && data.PrecipType != "rain" && data.PrecipType != "snow" && data.PrecipType != "sleet":
+		invalid = fmt.Sprintf("Unknown precip_type %q: want \"\", rain, snow or sleet", data.PrecipType)
+	}
+	if invalid != "" {
+		writeProblem(w, http.StatusBadRequest, "", invalid, r.URL.Path)
+		return
+	}
+	if data.CacheTime.IsZero() {
+		data.CacheTime = time.Now()
+	}
+	data.Greeting = s.greet(data)
+
+	// The same key /weather derives, so the entry is what it serves
+	key := languageCacheKey(s.resolveCity(s.aliases.resolve(data.City)), lang)
+	s.cache.updateCache(key, data)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(data)
+}
+
+type cacheConfig struct {
+	MaxSize int `json:"max_size"`
+	Size    int `json:"size"` // entries held after the change
+}
+
+// Resize the cache at runtime, e.g. {"max_size": 500} to ride out a
+// traffic spike; shrinking evicts the least recently used entries
+func (s *Server) cacheConfigHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPatch {
+		w.Header().Set("Allow", http.MethodPatch)
+		writeProblem(w, http.StatusMethodNotAllowed, "", "Method not allowed", r.URL.Path)
+		return
+	}
+
+	var patch struct {
+		MaxSize *int `json:"max_size"`
+	}
+	dec := json.NewDecoder(io.LimitReader(r.Body, 1<<20))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&patch); err != nil {
+		writeProblem(w, http.StatusBadRequest, "", fmt.Sprintf("Invalid JSON body: %v", err), r.URL.Path)
+		return
+	}
+	if patch.MaxSize == nil {
+		writeProblem(w, http.StatusBadRequest, "", "Missing field: max_size", r.URL.Path)
+		return
+	}
+	if err := s.cache.Resize(*patch.MaxSize); err != nil {
+		writeProblem(w, http.StatusBadRequest, "", fmt.Sprintf("Invalid max_size: %v", err), r.URL.Path)
+		return
+	}
+	slog.Info("Cache resized", "max_size", *patch.MaxSize)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(cacheConfig{MaxSize: *patch.MaxSize, Size: s.cache.entries.Len()})
+}
+
+// The cache settings /admin/config reads and writes
+type adminConfig struct {
+	CacheTTL     string `json:"cache_ttl"` // a duration such as "45m"
+	CacheMaxSize int    `json:"cache_max_size"`
+}
+
+func (s *Server) currentAdminConfig() adminConfig {
+	return adminConfig{CacheTTL: s.cache.ttl().String(), CacheMaxSize: s.cache.entries.MaxSize()}
+}
+
+// Read or change the live cache settings. A PUT may give either field or
+// both; both are checked before either is applied, so a bad value leaves
+// the cache untouched.
+func (s *Server) adminConfigHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var body struct {
+			CacheTTL     *string `json:"cache_ttl"`
+			CacheMaxSize *int    `json:"cache_max_size"`
+		}
+		dec := json.NewDecoder(io.LimitReader(r.Body, 1<<20))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&body); err != nil {
+			writeProblem(w, http.StatusBadRequest, "", fmt.Sprintf("Invalid JSON body: %v", err), r.URL.Path)
+			return
+		}
+		if body.CacheTTL == nil && body.CacheMaxSize == nil {
+			writeProblem(w, http.StatusBadRequest, "", "Nothing to change: give cache_ttl and/or cache_max_size", r.URL.Path)
+			return
+		}
+		var ttl time.Duration
+		if body.CacheTTL != nil {
+			d, err := time.ParseDuration(*body.CacheTTL)
+			if err != nil || d <= 0 {
+				writeProblem(w, http.StatusBadRequest, "", fmt.Sprintf("Invalid cache_ttl %q: must be a positive duration such as 45m", *body.CacheTTL), r.URL.Path)
+				return
+			}
+			ttl = d
+		}
+		if body.CacheMaxSize != nil {
+			if err := cache.CheckSize(*body.CacheMaxSize); err != nil {
+				writeProblem(w, http.StatusBadRequest, "", fmt.Sprintf("Invalid cache_max_size: %v", err), r.URL.Path)
+				return
+			}
+		}
+
+		before := s.currentAdminConfig()
+		if body.CacheMaxSize != nil {
+			s.cache.Resize(*body.CacheMaxSize)
+		}
+		if body.CacheTTL != nil {
+			s.cache.SetExpiry(ttl)
+		}
+		after := s.currentAdminConfig()
+		slog.Info("Cache config changed",
+			"cache_ttl_from", before.CacheTTL, "cache_ttl_to", after.CacheTTL,
+			"cache_max_size_from", before.CacheMaxSize, "cache_max_size_to", after.CacheMaxSize)
+	default:
+		w.Header().Set("Allow", "GET, PUT")
+		writeProblem(w, http.StatusMethodNotAllowed, "", "Method not allowed", r.URL.Path)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.currentAdminConfig())
+}
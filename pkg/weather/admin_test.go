@@ -0,0 +1,295 @@
+package weather_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/deepakg86/weather-api-caching/pkg/weather"
+	"github.com/deepakg86/weather-api-caching/pkg/weather/testutil"
+)
+
+const testAdminToken = "test-admin-token"
+
+// Send body as JSON with the admin token and decode the reply into out,
+// when given
+func adminJSON(t *testing.T, ts *httptest.Server, method, path string, body, out interface{}) *http.Response {
+	t.Helper()
+	var b []byte
+	if body != nil {
+		var err error
+		if b, err = json.Marshal(body); err != nil {
+			t.Fatalf("encoding body: %v", err)
+		}
+	}
+	req, err := http.NewRequest(method, ts.URL+path, bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	req.Header.Set("Authorization", "Bearer "+testAdminToken)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatalf("%s %s: decoding body: %v", method, path, err)
+		}
+	}
+	return resp
+}
+
+// n towns the mock knows, named with letters only so they pass validation
+func towns(n int) ([]string, *testutil.MockWeatherProvider) {
+	names := make([]string, n)
+	data := make(map[string]weather.CityWeatherData, n)
+	for i := range names {
+		names[i] = fmt.Sprintf("Town %c%c", 'A'+i/26, 'a'+i%26)
+		data[names[i]] = weather.CityWeatherData{City: names[i], Temp: float64(i), Desc: "Cool", Source: "mock"}
+	}
+	return names, testutil.NewMockWeatherProvider(data, nil)
+}
+
+func withAdmin(config *weather.Config) { config.AdminToken = testAdminToken }
+
+// One shard, so capacity and LRU order are exact across the whole cache
+func withOneShard(config *weather.Config) {
+	withAdmin(config)
+	config.CacheShards = 1
+}
+
+// Request every town once, oldest first, then the last keep again, so
+// those are the most recently used
+func fillCache(t *testing.T, ts *httptest.Server, names []string, keep int) {
+	t.Helper()
+	for _, name := range append(names, names[:keep]...) {
+		if resp := getJSON(t, ts, "/weather?city="+url.QueryEscape(name), nil); resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s: status = %d", name, resp.StatusCode)
+		}
+	}
+}
+
+// Shrinking must leave exactly the most recently used entries
+func checkShrunk(t *testing.T, ts *httptest.Server, mock *testutil.MockWeatherProvider, names []string, keep int) {
+	t.Helper()
+	var stats struct {
+		Size          int    `json:"size"`
+		MaxSize       int    `json:"max_size"`
+		EvictedBySize uint64 `json:"evicted_by_size"`
+	}
+	getJSON(t, ts, "/cache/stats", &stats)
+	if stats.Size != keep || stats.MaxSize != keep || stats.EvictedBySize != uint64(len(names)-keep) {
+		t.Errorf("stats = %+v, want size and max_size %d with %d evicted", stats, keep, len(names)-keep)
+	}
+	for _, name := range names[:keep] {
+		getJSON(t, ts, "/weather?city="+url.QueryEscape(name), nil)
+		if calls := mock.Calls(name); calls != 1 {
+			t.Errorf("%s fetched %d times; a recently used entry was evicted", name, calls)
+		}
+	}
+	getJSON(t, ts, "/weather?city="+url.QueryEscape(names[keep]), nil)
+	if calls := mock.Calls(names[keep]); calls != 2 {
+		t.Errorf("%s fetched %d times; the least recently used entries should be gone", names[keep], calls)
+	}
+}
+
+func TestCacheConfigShrinksToMostRecent(t *testing.T) {
+	names, mock := towns(100)
+	ts := newTestServer(t, mock, withOneShard)
+	fillCache(t, ts, names, 5)
+
+	var got struct {
+		MaxSize int `json:"max_size"`
+		Size    int `json:"size"`
+	}
+	resp := adminJSON(t, ts, http.MethodPatch, "/cache/config", map[string]int{"max_size": 5}, &got)
+	if resp.StatusCode != http.StatusOK || got.MaxSize != 5 || got.Size != 5 {
+		t.Fatalf("PATCH /cache/config: status %d, body %+v", resp.StatusCode, got)
+	}
+	checkShrunk(t, ts, mock, names, 5)
+}
+
+func TestCacheConfigRejectsBadSizes(t *testing.T) {
+	_, mock := towns(1)
+	ts := newTestServer(t, mock, withAdmin)
+	for _, body := range []interface{}{map[string]int{"max_size": 0}, map[string]int{"max_size": -3}, map[string]int{}} {
+		if resp := adminJSON(t, ts, http.MethodPatch, "/cache/config", body, nil); resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%v: status = %d, want 400", body, resp.StatusCode)
+		}
+	}
+}
+
+func TestAdminConfigShrinksToMostRecent(t *testing.T) {
+	names, mock := towns(100)
+	ts := newTestServer(t, mock, withOneShard)
+	fillCache(t, ts, names, 5)
+
+	var got struct {
+		CacheTTL     string `json:"cache_ttl"`
+		CacheMaxSize int    `json:"cache_max_size"`
+	}
+	resp := adminJSON(t, ts, http.MethodPut, "/admin/config", map[string]int{"cache_max_size": 5}, &got)
+	if resp.StatusCode != http.StatusOK || got.CacheMaxSize != 5 {
+		t.Fatalf("PUT /admin/config: status %d, body %+v", resp.StatusCode, got)
+	}
+	checkShrunk(t, ts, mock, names, 5)
+}
+
+func TestAdminConfigLongerTTLServesOlderEntry(t *testing.T) {
+	mock := londonProvider()
+	ts := newTestServer(t, mock, func(config *weather.Config) {
+		withAdmin(config)
+		config.CacheTTL = 50 * time.Millisecond
+	})
+	getJSON(t, ts, "/weather?city=London", nil)
+	time.Sleep(100 * time.Millisecond)
+
+	if resp := adminJSON(t, ts, http.MethodPut, "/admin/config", map[string]string{"cache_ttl": "1h"}, nil); resp.StatusCode != http.StatusOK {
+		t.Fatalf("PUT /admin/config: status %d", resp.StatusCode)
+	}
+	getJSON(t, ts, "/weather?city=London", nil)
+	if calls := mock.Calls("London"); calls != 1 {
+		t.Errorf("provider called %d times; the entry is within the new TTL and should be served", calls)
+	}
+}
+
+func TestAdminConfigValidatesBeforeApplying(t *testing.T) {
+	ts := newTestServer(t, londonProvider(), withAdmin)
+	var before struct {
+		CacheTTL     string `json:"cache_ttl"`
+		CacheMaxSize int    `json:"cache_max_size"`
+	}
+	adminJSON(t, ts, http.MethodGet, "/admin/config", nil, &before)
+
+	body := map[string]interface{}{"cache_ttl": "45m", "cache_max_size": 0}
+	if resp := adminJSON(t, ts, http.MethodPut, "/admin/config", body, nil); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", resp.StatusCode)
+	}
+	after := before
+	adminJSON(t, ts, http.MethodGet, "/admin/config", nil, &after)
+	if after != before {
+		t.Errorf("config changed from %+v to %+v by a rejected PUT", before, after)
+	}
+}
+
+func validEntry() map[string]interface{} {
+	return map[string]interface{}{
+		"city": "Paris", "temp": 21.5, "desc": "Sunny", "activity": "Go for a walk",
+		"condition": "clear", "precip_prob": 0.1, "precip_mm": 0, "precip_type": "",
+	}
+}
+
+func TestCacheEntryIsServedByWeather(t *testing.T) {
+	mock := testutil.NewMockWeatherProvider(nil, nil)
+	ts := newTestServer(t, mock, withAdmin)
+
+	var stored weather.CityWeatherData
+	if resp := adminJSON(t, ts, http.MethodPut, "/cache/entry", validEntry(), &stored); resp.StatusCode != http.StatusOK {
+		t.Fatalf("PUT /cache/entry: status %d", resp.StatusCode)
+	}
+	if stored.CacheTime.IsZero() {
+		t.Error("cache_time not defaulted to now")
+	}
+	french := validEntry()
+	french["desc"] = "Ensoleillé"
+	if resp := adminJSON(t, ts, http.MethodPut, "/cache/entry?lang=fr", french, nil); resp.StatusCode != http.StatusOK {
+		t.Fatalf("PUT /cache/entry?lang=fr: status %d", resp.StatusCode)
+	}
+
+	var got weather.CityWeatherData
+	getJSON(t, ts, "/weather?city=Paris", &got)
+	if got.Temp != 21.5 || got.Desc != "Sunny" {
+		t.Errorf("/weather = %+v, want the injected entry", got)
+	}
+	getJSON(t, ts, "/weather?city=Paris&lang=fr", &got)
+	if got.Desc != "Ensoleillé" {
+		t.Errorf("/weather?lang=fr desc = %q, want the French entry", got.Desc)
+	}
+	if calls := mock.Calls("Paris"); calls != 0 {
+		t.Errorf("provider called %d times", calls)
+	}
+}
+
+func TestCacheEntryUsesGeocodedKey(t *testing.T) {
+	mock := testutil.NewMockWeatherProvider(map[string]weather.CityWeatherData{
+		"NYC": {City: "New York", Temp: 5, Desc: "Cold", Location: &weather.Location{Name: "New York"}},
+	}, nil)
+	ts := newTestServer(t, mock, withAdmin)
+	getJSON(t, ts, "/weather?city=NYC", nil)
+
+	entry := validEntry()
+	entry["city"] = "NYC"
+	if resp := adminJSON(t, ts, http.MethodPut, "/cache/entry", entry, nil); resp.StatusCode != http.StatusOK {
+		t.Fatalf("PUT /cache/entry: status %d", resp.StatusCode)
+	}
+	var got weather.CityWeatherData
+	getJSON(t, ts, "/weather?city=NYC", &got)
+	if got.Temp != 21.5 {
+		t.Errorf("temp = %v, want the injected 21.5 under the geocoded key", got.Temp)
+	}
+}
+
+func TestCacheEntryRejectsIncompleteOrInvalidBodies(t *testing.T) {
+	ts := newTestServer(t, testutil.NewMockWeatherProvider(nil, nil), withAdmin)
+
+	for _, field := range []string{"city", "temp", "desc", "activity", "condition", "precip_prob", "precip_mm", "precip_type"} {
+		t.Run("missing "+field, func(t *testing.T) {
+			body := validEntry()
+			delete(body, field)
+			var p problemBody
+			if resp := adminJSON(t, ts, http.MethodPut, "/cache/entry", body, &p); resp.StatusCode != http.StatusBadRequest || p.Detail != "Missing field: "+field {
+				t.Errorf("status %d, detail %q", resp.StatusCode, p.Detail)
+			}
+		})
+	}
+	invalid := map[string]interface{}{
+		"city":        "  ",
+		"temp":        120,
+		"desc":        "",
+		"condition":   "hail",
+		"precip_prob": 1.5,
+		"precip_mm":   -1,
+		"precip_type": "frogs",
+	}
+	for field, value := range invalid {
+		t.Run(fmt.Sprintf("%s %v", field, value), func(t *testing.T) {
+			body := validEntry()
+			body[field] = value
+			if resp := adminJSON(t, ts, http.MethodPut, "/cache/entry", body, nil); resp.StatusCode != http.StatusBadRequest {
+				t.Errorf("status = %d, want 400", resp.StatusCode)
+			}
+		})
+	}
+	t.Run("city with markup", func(t *testing.T) {
+		body := validEntry()
+		body["city"] = "<script>"
+		if resp := adminJSON(t, ts, http.MethodPut, "/cache/entry", body, nil); resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("status = %d, want 400", resp.StatusCode)
+		}
+	})
+	t.Run("unsupported language", func(t *testing.T) {
+		if resp := adminJSON(t, ts, http.MethodPut, "/cache/entry?lang=xx", validEntry(), nil); resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("status = %d, want 400", resp.StatusCode)
+		}
+	})
+}
+
+func TestCacheEntryRequiresToken(t *testing.T) {
+	ts := newTestServer(t, testutil.NewMockWeatherProvider(nil, nil), withAdmin)
+	b, _ := json.Marshal(validEntry())
+	req, _ := http.NewRequest(http.MethodPut, ts.URL+"/cache/entry", bytes.NewReader(b))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("status = %d, want 401", resp.StatusCode)
+	}
+}
@@ -0,0 +1,288 @@
+package weather
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+const (
+	alertMaxAttempts  = 4
+	alertInitialDelay = time.Second
+
+	// Registered alerts at most, so the store cannot grow without bound
+	maxAlerts = 1000
+)
+
+type alert struct {
+	ID          string  `json:"id"`
+	City        string  `json:"city"`
+	Comparison  string  `json:"comparison"` // "above" or "below"
+	Threshold   float64 `json:"threshold"`
+	CallbackURL string  `json:"callback_url"`
+
+	// Whether the last reading satisfied the condition; a notification is
+	// only sent when this flips from false to true
+	triggered bool
+}
+
+type alertPayload struct {
+	AlertID    string    `json:"alert_id"`
+	City       string    `json:"city"`
+	Comparison string    `json:"comparison"`
+	Threshold  float64   `json:"threshold"`
+	Temp       float64   `json:"temp"`
+	Desc       string    `json:"desc"`
+	Time       time.Time `json:"time"`
+}
+
+type alertStore struct {
+	mu     sync.Mutex
+	alerts map[string]*alert
+	nextID int
+}
+
+func newAlertStore() *alertStore {
+	return &alertStore{alerts: make(map[string]*alert)}
+}
+
+var errCallbackNotPublic = errors.New("callback address is not public")
+
+// Callbacks must not reach into the network the server runs in
+func publicIP(ip net.IP) bool {
+	return !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsLinkLocalUnicast() &&
+		!ip.IsLinkLocalMulticast() && !ip.IsUnspecified()
+}
+
+// Set by tests, whose callbacks are httptest servers on loopback
+var allowLoopbackCallbacks atomic.Bool
+
+// Whether a callback may be delivered to ip
+func callbackIPAllowed(ip net.IP) bool {
+	return publicIP(ip) || (ip.IsLoopback() && allowLoopbackCallbacks.Load())
+}
+
+// Check every address the callback host resolves to now. The dialer checks
+// again on each delivery, since the host may resolve differently by then.
+func checkCallbackHost(ctx context.Context, host string) error {
+	ips, err := net.DefaultResolver.LookupIP(ctx, "ip", host)
+	if err != nil {
+		return fmt.Errorf("cannot resolve %s: %v", host, err)
+	}
+	for _, ip := range ips {
+		if !callbackIPAllowed(ip) {
+			return fmt.Errorf("%s resolves to %s: %w", host, ip, errCallbackNotPublic)
+		}
+	}
+	return nil
+}
+
+// Refuses to connect to an address callbackIPAllowed rejects, whatever
+// the callback's host resolved to and wherever it redirects
+var alertClient = &http.Client{
+	Timeout: 10 * time.Second,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: 5 * time.Second,
+			Control: func(network, address string, _ syscall.RawConn) error {
+				host, _, err := net.SplitHostPort(address)
+				if err != nil {
+					return err
+				}
+				if ip := net.ParseIP(host); ip == nil || !callbackIPAllowed(ip) {
+					return errCallbackNotPublic
+				}
+				return nil
+			},
+		}).DialContext,
+		TLSHandshakeTimeout: 5 * time.Second,
+	},
+}
+
+// Register a, unless maxAlerts are registered already
+func (s *alertStore) add(a *alert) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.alerts) >= maxAlerts {
+		return false
+	}
+	s.nextID++
+	a.ID = strconv.Itoa(s.nextID)
+	s.alerts[a.ID] = a
+	return true
+}
+
+func (s *alertStore) remove(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.alerts[id]; !ok {
+		return false
+	}
+	delete(s.alerts, id)
+	return true
+}
+
+func (s *alertStore) list() []alert {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := make([]alert, 0, len(s.alerts))
+	for _, a := range s.alerts {
+		list = append(list, *a)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		a, _ := strconv.Atoi(list[i].ID)
+		b, _ := strconv.Atoi(list[j].ID)
+		return a < b
+	})
+	return list
+}
+
+// Check every alert registered for the city against a fresh reading and
+// notify the ones whose condition has just become true
+func (s *alertStore) evaluate(data CityWeatherData) {
+	var fired []alertPayload
+	var callbacks []string
+
+	s.mu.Lock()
+	for _, a := range s.alerts {
+		if !strings.EqualFold(a.City, data.City) {
+			continue
+		}
+		met := (a.Comparison == "above" && data.Temp > a.Threshold) ||
+			(a.Comparison == "below" && data.Temp < a.Threshold)
+		if met && !a.triggered {
+			fired = append(fired, alertPayload{
+				AlertID:    a.ID,
+				City:       data.City,
+				Comparison: a.Comparison,
+				Threshold:  a.Threshold,
+				Temp:       data.Temp,
+				Desc:       data.Desc,
+				Time:       data.CacheTime,
+			})
+			callbacks = append(callbacks, a.CallbackURL)
+		}
+		a.triggered = met
+	}
+	s.mu.Unlock()
+
+	for i := range fired {
+		go deliverAlert(callbacks[i], fired[i])
+	}
+}
+
+// POST the payload to the callback, retrying with exponential backoff
+func deliverAlert(callbackURL string, payload alertPayload) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		slog.Error("Error encoding alert", "alert_id", payload.AlertID, "err", err)
+		return
+	}
+
+	delay := alertInitialDelay
+	for attempt := 1; attempt <= alertMaxAttempts; attempt++ {
+		resp, err := alertClient.Post(callbackURL, "application/json", bytes.NewReader(body))
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode < 300 {
+				return
+			}
+			err = fmt.Errorf("callback returned %s", resp.Status)
+		}
+		if errors.Is(err, errCallbackNotPublic) {
+			slog.Error("Refusing to deliver alert", "alert_id", payload.AlertID, "err", err)
+			return
+		}
+		slog.Warn("Alert delivery failed", "alert_id", payload.AlertID, "attempt", attempt, "err", err)
+		if attempt < alertMaxAttempts {
+			time.Sleep(delay)
+			delay *= 2
+		}
+	}
+	slog.Error("Giving up on alert", "alert_id", payload.AlertID, "attempts", alertMaxAttempts)
+}
+
+func (s *Server) alertsHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(s.alerts.list())
+
+	case http.MethodPost:
+		var req struct {
+			City        string   `json:"city"`
+			Comparison  string   `json:"comparison"`
+			Threshold   *float64 `json:"threshold"`
+			CallbackURL string   `json:"callback_url"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeProblem(w, http.StatusBadRequest, "", fmt.Sprintf("Invalid request body: %v", err), r.URL.Path)
+			return
+		}
+		req.City = strings.TrimSpace(req.City)
+		if req.City == "" {
+			writeProblem(w, http.StatusBadRequest, "", "City is required", r.URL.Path)
+			return
+		}
+		if req.Comparison != "above" && req.Comparison != "below" {
+			writeProblem(w, http.StatusBadRequest, "", "Comparison must be \"above\" or \"below\"", r.URL.Path)
+			return
+		}
+		if req.Threshold == nil {
+			writeProblem(w, http.StatusBadRequest, "", "Threshold is required", r.URL.Path)
+			return
+		}
+		u, err := url.Parse(req.CallbackURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			writeProblem(w, http.StatusBadRequest, "", "Callback URL must be an absolute http(s) URL", r.URL.Path)
+			return
+		}
+		if err := checkCallbackHost(r.Context(), u.Hostname()); err != nil {
+			writeProblem(w, http.StatusBadRequest, "", fmt.Sprintf("Invalid callback URL: %v", err), r.URL.Path)
+			return
+		}
+
+		a := &alert{
+			City:        req.City,
+			Comparison:  req.Comparison,
+			Threshold:   *req.Threshold,
+			CallbackURL: req.CallbackURL,
+		}
+		if !s.alerts.add(a) {
+			writeProblem(w, http.StatusConflict, "", fmt.Sprintf("Too many alerts (at most %d); delete some first", maxAlerts), r.URL.Path)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(a)
+
+	case http.MethodDelete:
+		id := r.URL.Query().Get("id")
+		if id == "" {
+			writeProblem(w, http.StatusBadRequest, "", "Id parameter is required", r.URL.Path)
+			return
+		}
+		if !s.alerts.remove(id) {
+			writeProblem(w, http.StatusNotFound, "", "Alert not found", r.URL.Path)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		writeProblem(w, http.StatusMethodNotAllowed, "", "Method not allowed", r.URL.Path)
+	}
+}
@@ -0,0 +1,170 @@
+package weather_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/deepakg86/weather-api-caching/pkg/weather"
+	"github.com/deepakg86/weather-api-caching/pkg/weather/testutil"
+)
+
+type alertNotification struct {
+	AlertID string  `json:"alert_id"`
+	Temp    float64 `json:"temp"`
+}
+
+// A callback server passing on every notification it receives
+func alertReceiver(t *testing.T) (*httptest.Server, <-chan alertNotification) {
+	t.Helper()
+	got := make(chan alertNotification, 16)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var n alertNotification
+		if err := json.NewDecoder(r.Body).Decode(&n); err != nil {
+			t.Errorf("decoding notification: %v", err)
+		}
+		got <- n
+	}))
+	t.Cleanup(ts.Close)
+	return ts, got
+}
+
+// Store a reading of Paris at temp, as a fetch would
+func setParis(t *testing.T, ts *httptest.Server, temp float64) {
+	t.Helper()
+	entry := validEntry()
+	entry["temp"] = temp
+	if resp := adminJSON(t, ts, http.MethodPut, "/cache/entry", entry, nil); resp.StatusCode != http.StatusOK {
+		t.Fatalf("storing Paris at %v: status %d", temp, resp.StatusCode)
+	}
+}
+
+func registerAlert(t *testing.T, ts *httptest.Server, callback string) *http.Response {
+	t.Helper()
+	return adminJSON(t, ts, http.MethodPost, "/alerts", map[string]interface{}{
+		"city": "Paris", "comparison": "above", "threshold": 20, "callback_url": callback,
+	}, nil)
+}
+
+func TestAlertsNeedAdminToken(t *testing.T) {
+	ts := newTestServer(t, testutil.NewMockWeatherProvider(nil, nil), withAdmin)
+	for _, method := range []string{http.MethodGet, http.MethodPost, http.MethodDelete} {
+		req, _ := http.NewRequest(method, ts.URL+"/alerts?id=1", nil)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s: %v", method, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("%s without token: status %d, want 401", method, resp.StatusCode)
+		}
+	}
+
+	open := newTestServer(t, testutil.NewMockWeatherProvider(nil, nil), nil)
+	if resp := getJSON(t, open, "/alerts", nil); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("without ADMIN_TOKEN: status %d, want 404", resp.StatusCode)
+	}
+}
+
+func TestAlertsRejectInternalCallbacks(t *testing.T) {
+	ts := newTestServer(t, testutil.NewMockWeatherProvider(nil, nil), withAdmin)
+	for _, callback := range []string{
+		"http://127.0.0.1:8080/hook",
+		"http://localhost/hook",
+		"http://10.1.2.3/hook",
+		"http://172.16.0.1/hook",
+		"http://192.168.0.10/hook",
+		"http://169.254.169.254/latest/meta-data",
+		"http://0.0.0.0/hook",
+		"http://[::1]/hook",
+		"http://[fe80::1]/hook",
+		"http://[fd00::1]/hook",
+		"http://[::ffff:127.0.0.1]/hook",
+	} {
+		if resp := registerAlert(t, ts, callback); resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", callback, resp.StatusCode)
+		}
+	}
+	var alerts []interface{}
+	adminJSON(t, ts, http.MethodGet, "/alerts", nil, &alerts)
+	if len(alerts) != 0 {
+		t.Errorf("%d alerts registered, want none", len(alerts))
+	}
+}
+
+func TestAlertsAreCapped(t *testing.T) {
+	ts := newTestServer(t, testutil.NewMockWeatherProvider(nil, nil), withAdmin)
+	// A public address, which needs no lookup and is never dialled here
+	const callback = "http://203.0.113.7/hook"
+	for i := 0; i < 1000; i++ {
+		if resp := registerAlert(t, ts, callback); resp.StatusCode != http.StatusCreated {
+			t.Fatalf("alert %d: status %d", i+1, resp.StatusCode)
+		}
+	}
+	if resp := registerAlert(t, ts, callback); resp.StatusCode != http.StatusConflict {
+		t.Errorf("alert 1001: status %d, want 409", resp.StatusCode)
+	}
+	if resp := adminJSON(t, ts, http.MethodDelete, "/alerts?id=1", nil, nil); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("delete: status %d", resp.StatusCode)
+	}
+	if resp := registerAlert(t, ts, callback); resp.StatusCode != http.StatusCreated {
+		t.Errorf("after a delete: status %d, want 201", resp.StatusCode)
+	}
+}
+
+func TestAlertFiresOncePerCrossing(t *testing.T) {
+	weather.AllowLoopbackCallbacks(t)
+	ts := newTestServer(t, testutil.NewMockWeatherProvider(nil, nil), withAdmin)
+	receiver, got := alertReceiver(t)
+	if resp := registerAlert(t, ts, receiver.URL); resp.StatusCode != http.StatusCreated {
+		t.Fatalf("register: status %d", resp.StatusCode)
+	}
+
+	// Two crossings above 20, with readings staying above and below between
+	for _, temp := range []float64{15, 25, 26, 27, 18, 10, 22, 30} {
+		setParis(t, ts, temp)
+	}
+	var temps []float64
+	for len(temps) < 2 {
+		select {
+		case n := <-got:
+			temps = append(temps, n.Temp)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("notifications = %v, want 2", temps)
+		}
+	}
+	select {
+	case n := <-got:
+		t.Errorf("extra notification at %v", n.Temp)
+	case <-time.After(200 * time.Millisecond):
+	}
+	sort.Float64s(temps)
+	if fmt.Sprint(temps) != "[22 25]" {
+		t.Errorf("notified at %v, want the crossings at 22 and 25", temps)
+	}
+}
+
+func TestAlertDeliveryRechecksAddress(t *testing.T) {
+	ts := newTestServer(t, testutil.NewMockWeatherProvider(nil, nil), withAdmin)
+	receiver, got := alertReceiver(t)
+	// Registered while loopback was allowed, as a host could resolve to a
+	// public address then and to an internal one by delivery
+	t.Run("register", func(t *testing.T) {
+		weather.AllowLoopbackCallbacks(t)
+		if resp := registerAlert(t, ts, receiver.URL); resp.StatusCode != http.StatusCreated {
+			t.Fatalf("register: status %d", resp.StatusCode)
+		}
+	})
+
+	setParis(t, ts, 15)
+	setParis(t, ts, 25)
+	select {
+	case <-got:
+		t.Error("alert delivered to loopback")
+	case <-time.After(300 * time.Millisecond):
+	}
+}
@@ -0,0 +1,119 @@
+package weather
+
+import (
+	"bufio"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Pause after a change to the alias file before re-reading it, so an
+// editor's truncate-then-write is seen once, complete
+const aliasReloadDelay = 100 * time.Millisecond
+
+// Alternative names for cities, e.g. "NYC" for "New York City", read from
+// CITY_ALIASES_FILE and swapped whole whenever the file changes
+type cityAliases struct {
+	mu    sync.RWMutex
+	names map[string]string // normalized alias to canonical name
+}
+
+// Parse "alias = city" lines; blank lines and lines starting with # are
+// skipped
+func loadAliases(path string) (map[string]string, error) {
+	names := make(map[string]string)
+	if path == "" {
+		return names, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		alias, city, ok := strings.Cut(text, "=")
+		alias, city = normalizeCity(alias), strings.Join(strings.Fields(city), " ")
+		if !ok || alias == "" || city == "" {
+			return nil, fmt.Errorf("line %d: want alias = city, got %q", line, text)
+		}
+		names[alias] = city
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return names, nil
+}
+
+func (a *cityAliases) resolve(city string) string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if canonical, ok := a.names[normalizeCity(city)]; ok {
+		return canonical
+	}
+	return city
+}
+
+func (a *cityAliases) swap(names map[string]string) {
+	a.mu.Lock()
+	a.names = names
+	a.mu.Unlock()
+}
+
+// Reload the aliases whenever path changes. The directory is watched
+// rather than the file, since editors often save by replacing it. A file
+// that fails to parse leaves the previous aliases in place.
+func (a *cityAliases) watch(path string) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	if err := watcher.Add(filepath.Dir(path)); err != nil {
+		watcher.Close()
+		return err
+	}
+	name := filepath.Clean(path)
+
+	reload := func() {
+		names, err := loadAliases(path)
+		if err != nil {
+			slog.Error("Reloading city aliases failed, keeping the previous ones", "file", path, "err", err)
+			return
+		}
+		a.swap(names)
+		slog.Info("City aliases reloaded", "file", path, "aliases", len(names))
+	}
+	go func() {
+		var pending <-chan time.Time
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if filepath.Clean(event.Name) == name && event.Has(fsnotify.Write|fsnotify.Create) {
+					pending = time.After(aliasReloadDelay)
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				slog.Warn("Error watching city aliases", "file", path, "err", err)
+			case <-pending:
+				pending = nil
+				reload()
+			}
+		}
+	}()
+	return nil
+}
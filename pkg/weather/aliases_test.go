@@ -0,0 +1,98 @@
+package weather
+
+import (
+	"context"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Answers with the city it was asked for, to show what an alias became
+type echoProvider struct{}
+
+func (echoProvider) Timeout() time.Duration { return 0 }
+
+func (echoProvider) Current(ctx context.Context, city string) (CityWeatherData, error) {
+	return CityWeatherData{City: city, Temp: 20, Desc: "Sunny", CacheTime: time.Now()}, nil
+}
+
+func TestLoadAliases(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "aliases.txt")
+	os.WriteFile(path, []byte("# nicknames\n\n NYC =  New   York City\nBig Apple=New York City\n"), 0o644)
+	names, err := loadAliases(path)
+	if err != nil {
+		t.Fatalf("loadAliases: %v", err)
+	}
+	if len(names) != 2 || names["nyc"] != "New York City" || names["big apple"] != "New York City" {
+		t.Errorf("aliases = %v", names)
+	}
+
+	os.WriteFile(path, []byte("NYC = New York City\njust a city\n"), 0o644)
+	if _, err := loadAliases(path); err == nil {
+		t.Error("loadAliases accepted a line without =")
+	}
+}
+
+func TestAliasFileReloadedWithinASecond(t *testing.T) {
+	captureLogs(t)
+	path := filepath.Join(t.TempDir(), "aliases.txt")
+	if err := os.WriteFile(path, []byte("LA = Los Angeles\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	config := DefaultConfig()
+	config.CityAliasesFile = path
+	srv, err := NewServer(echoProvider{}, config)
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	if err := srv.aliases.watch(path); err != nil {
+		t.Fatalf("watch: %v", err)
+	}
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	// Waits up to a second for alias to resolve to want
+	resolvesWithin := func(alias, want string) bool {
+		deadline := time.Now().Add(time.Second)
+		for time.Now().Before(deadline) {
+			if srv.aliases.resolve(alias) == want {
+				return true
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		return false
+	}
+
+	if err := os.WriteFile(path, []byte("LA = Los Angeles\nNYC = New York City\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if !resolvesWithin("NYC", "New York City") {
+		t.Fatal("NYC not picked up within 1s of the write")
+	}
+	var data CityWeatherData
+	if getBody(t, ts, "/weather?city=NYC", &data); data.City != "New York City" {
+		t.Errorf("/weather?city=NYC served %q, want New York City", data.City)
+	}
+
+	// A file that fails to parse leaves the aliases as they were
+	os.WriteFile(path, []byte("NYC\n"), 0o644)
+	time.Sleep(3 * aliasReloadDelay)
+	if got := srv.aliases.resolve("NYC"); got != "New York City" {
+		t.Errorf("after a bad file NYC = %q, want the previous alias", got)
+	}
+
+	// Saved the way editors do, by renaming a new file over it
+	tmp := path + ".tmp"
+	os.WriteFile(tmp, []byte("NYC = New York\n"), 0o644)
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatal(err)
+	}
+	if !resolvesWithin("NYC", "New York") {
+		t.Error("replaced file not picked up within 1s")
+	}
+	if got := srv.aliases.resolve("LA"); got != "LA" {
+		t.Errorf("LA = %q after it was dropped from the file", got)
+	}
+}
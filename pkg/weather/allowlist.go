@@ -0,0 +1,54 @@
+package weather
+
+import (
+	"bufio"
+	"os"
+	"strings"
+)
+
+// Cities a deployment is willing to serve; nil permits every city
+type cityAllowlist map[string]bool
+
+// Lowercased with runs of whitespace collapsed, so "new  York " matches
+// "New York"
+func normalizeCity(city string) string {
+	return strings.ToLower(strings.Join(strings.Fields(city), " "))
+}
+
+// Build the allowlist from a newline-delimited file and/or a list of
+// names. Returns nil when both are empty.
+func loadAllowlist(path string, names []string) (cityAllowlist, error) {
+	var allowed cityAllowlist
+	add := func(name string) {
+		if name = normalizeCity(name); name == "" {
+			return
+		}
+		if allowed == nil {
+			allowed = make(cityAllowlist)
+		}
+		allowed[name] = true
+	}
+
+	for _, name := range names {
+		add(name)
+	}
+	if path != "" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			add(scanner.Text())
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return allowed, nil
+}
+
+func (a cityAllowlist) allows(city string) bool {
+	return a == nil || a[normalizeCity(city)]
+}
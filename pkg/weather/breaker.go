@@ -0,0 +1,118 @@
+package weather
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// Returned without calling upstream while the circuit is open
+var errCircuitOpen = errors.New("upstream unavailable: circuit open")
+
+const (
+	circuitClosed   = "closed"
+	circuitOpen     = "open"
+	circuitHalfOpen = "half-open"
+)
+
+// Stops calling a failing upstream after threshold consecutive outage
+// errors, then lets a single probe through once the cooldown has passed
+type circuitBreaker struct {
+	next      WeatherProvider
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+func newCircuitBreaker(next WeatherProvider, threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{next: next, threshold: threshold, cooldown: cooldown, state: circuitClosed}
+}
+
+func (b *circuitBreaker) Timeout() time.Duration { return b.next.Timeout() }
+
+func (b *circuitBreaker) Current(ctx context.Context, city string) (CityWeatherData, error) {
+	if !b.allow() {
+		return CityWeatherData{}, errCircuitOpen
+	}
+	data, err := b.next.Current(ctx, city)
+	if ctx.Err() != nil {
+		// The client gave up; that says nothing about upstream health
+		b.release()
+		return data, err
+	}
+	// Only outages count; an unknown city still proves upstream is answering
+	b.done(err != nil && retriable(err))
+	return data, err
+}
+
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case circuitOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.state = circuitHalfOpen
+		b.probing = true
+		return true
+	case circuitHalfOpen:
+		// Everyone else waits for the probe's verdict
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	}
+	return true
+}
+
+func (b *circuitBreaker) done(failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !failed {
+		b.state = circuitClosed
+		b.failures = 0
+		b.probing = false
+		return
+	}
+	b.failures++
+	if b.state == circuitHalfOpen || b.failures >= b.threshold {
+		b.state = circuitOpen
+		b.openedAt = time.Now()
+		b.probing = false
+	}
+}
+
+func (b *circuitBreaker) release() {
+	b.mu.Lock()
+	b.probing = false
+	b.mu.Unlock()
+}
+
+func (b *circuitBreaker) currentState() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == circuitOpen && time.Since(b.openedAt) >= b.cooldown {
+		return circuitHalfOpen
+	}
+	return b.state
+}
+
+// Time left before a probe is allowed, for Retry-After
+func (b *circuitBreaker) retryAfter() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state != circuitOpen {
+		return 0
+	}
+	return b.cooldown - time.Since(b.openedAt)
+}
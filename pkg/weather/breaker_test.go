@@ -0,0 +1,151 @@
+package weather
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// A provider blocking until released, to hold a half-open probe in flight
+type heldProvider struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (p *heldProvider) Timeout() time.Duration { return 0 }
+
+func (p *heldProvider) Current(ctx context.Context, city string) (CityWeatherData, error) {
+	p.started <- struct{}{}
+	<-p.release
+	return CityWeatherData{City: city}, nil
+}
+
+func TestCircuitBreakerTransitions(t *testing.T) {
+	const cooldown = 50 * time.Millisecond
+	upstream := &stubProvider{err: &StatusError{Code: 503, Status: "503 Service Unavailable"}}
+	b := newCircuitBreaker(upstream, 3, cooldown)
+	call := func() error {
+		_, err := b.Current(context.Background(), "London")
+		return err
+	}
+
+	// Unknown cities are answers, not outages, and reset nothing
+	upstream.err = fmt.Errorf("%w: Atlantis", ErrCityNotFound)
+	for i := 0; i < 5; i++ {
+		call()
+	}
+	upstream.err = &StatusError{Code: 503, Status: "503 Service Unavailable"}
+	for i := 0; i < 2; i++ {
+		call()
+	}
+	if state := b.currentState(); state != circuitClosed {
+		t.Fatalf("after 2 outages: %s, want closed", state)
+	}
+	call()
+	if state := b.currentState(); state != circuitOpen {
+		t.Fatalf("after 3 outages: %s, want open", state)
+	}
+	if err := call(); !errors.Is(err, errCircuitOpen) || upstream.calls != 8 {
+		t.Errorf("open circuit: err %v after %d upstream calls, want errCircuitOpen without a call", err, upstream.calls)
+	}
+	if wait := b.retryAfter(); wait <= 0 || wait > cooldown {
+		t.Errorf("retryAfter = %v, want within the cooldown", wait)
+	}
+
+	// A failed probe opens it again for another cooldown
+	time.Sleep(cooldown)
+	if state := b.currentState(); state != circuitHalfOpen {
+		t.Fatalf("after the cooldown: %s, want half-open", state)
+	}
+	if err := call(); errors.Is(err, errCircuitOpen) || upstream.calls != 9 {
+		t.Fatalf("probe: err %v, %d upstream calls, want the probe let through", err, upstream.calls)
+	}
+	if state := b.currentState(); state != circuitOpen {
+		t.Fatalf("after a failed probe: %s, want open", state)
+	}
+
+	// A successful probe closes it
+	time.Sleep(cooldown)
+	upstream.err = nil
+	if err := call(); err != nil {
+		t.Fatalf("probe: %v", err)
+	}
+	if state := b.currentState(); state != circuitClosed {
+		t.Errorf("after a successful probe: %s, want closed", state)
+	}
+	if err := call(); err != nil {
+		t.Errorf("closed circuit: %v", err)
+	}
+}
+
+func TestCircuitBreakerSendsOneProbe(t *testing.T) {
+	held := &heldProvider{started: make(chan struct{}, 1), release: make(chan struct{})}
+	b := newCircuitBreaker(held, 1, time.Millisecond)
+	b.done(true)
+	time.Sleep(time.Millisecond)
+
+	probe := make(chan error)
+	go func() {
+		_, err := b.Current(context.Background(), "London")
+		probe <- err
+	}()
+	<-held.started
+	if _, err := b.Current(context.Background(), "Paris"); !errors.Is(err, errCircuitOpen) {
+		t.Errorf("during the probe: err = %v, want errCircuitOpen", err)
+	}
+	close(held.release)
+	if err := <-probe; err != nil {
+		t.Fatalf("probe: %v", err)
+	}
+	if state := b.currentState(); state != circuitClosed {
+		t.Errorf("after the probe: %s, want closed", state)
+	}
+}
+
+func TestOpenCircuitAnswers503(t *testing.T) {
+	upstream := &stubProvider{err: &StatusError{Code: 500, Status: "500 Internal Server Error"}}
+	config := DefaultConfig()
+	config.RetryAttempts = 1
+	config.BreakerThreshold = 2
+	config.BreakerCooldown = time.Minute
+	srv, err := NewServer(upstream, config)
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	var last *http.Response
+	for _, city := range []string{"London", "Paris", "Tokyo"} {
+		resp, err := http.Get(ts.URL + "/weather?city=" + city)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		last = resp
+	}
+	if last.StatusCode != http.StatusServiceUnavailable || last.Header.Get("Retry-After") == "" {
+		t.Errorf("open circuit: status %d, Retry-After %q, want 503 with a Retry-After", last.StatusCode, last.Header.Get("Retry-After"))
+	}
+	if upstream.calls != 2 {
+		t.Errorf("upstream called %d times, want 2", upstream.calls)
+	}
+
+	resp, err := http.Get(ts.URL + "/cache/stats")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var stats struct {
+		CircuitState string `json:"circuit_state"`
+	}
+	json.NewDecoder(resp.Body).Decode(&stats)
+	if stats.CircuitState != circuitOpen {
+		t.Errorf("circuit_state = %q, want open", stats.CircuitState)
+	}
+}
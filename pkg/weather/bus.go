@@ -0,0 +1,65 @@
+package weather
+
+import (
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Published after every cache store, with the stored reading
+const TopicWeatherUpdated = "weather:updated"
+
+// How many messages a subscriber may fall behind before it misses some
+const busBuffer = 256
+
+// In-process publish/subscribe, so components react to weather updates
+// without the cache knowing about them
+type Bus struct {
+	mu   sync.Mutex
+	subs map[string][]chan CityWeatherData
+
+	dropped      atomic.Uint64 // messages a slow subscriber missed
+	lastDropWarn atomic.Int64  // unix second of the last drop warning
+}
+
+func NewBus() *Bus {
+	return &Bus{subs: make(map[string][]chan CityWeatherData)}
+}
+
+// A channel receiving everything published to topic from now on
+func (b *Bus) Subscribe(topic string) <-chan CityWeatherData {
+	ch := make(chan CityWeatherData, busBuffer)
+	b.mu.Lock()
+	b.subs[topic] = append(b.subs[topic], ch)
+	b.mu.Unlock()
+	return ch
+}
+
+// Deliver to every subscriber of topic without blocking the publisher;
+// a subscriber whose buffer is full misses the message, which is counted
+// and logged at most once a second
+func (b *Bus) Publish(topic string, data CityWeatherData) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, ch := range b.subs[topic] {
+		select {
+		case ch <- data:
+		default:
+			dropped := b.dropped.Add(1)
+			if now := time.Now().Unix(); b.lastDropWarn.Swap(now) != now {
+				slog.Warn("Bus subscriber too slow, dropping messages", "topic", topic, "city", data.City, "dropped_total", dropped)
+			}
+		}
+	}
+}
+
+// Run handle for each message on topic in its own goroutine
+func (b *Bus) handle(topic string, handle func(CityWeatherData)) {
+	ch := b.Subscribe(topic)
+	go func() {
+		for data := range ch {
+			handle(data)
+		}
+	}()
+}
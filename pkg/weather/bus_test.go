@@ -0,0 +1,17 @@
+package weather
+
+import "testing"
+
+func TestBusCountsDrops(t *testing.T) {
+	b := NewBus()
+	ch := b.Subscribe(TopicWeatherUpdated)
+	for i := 0; i < busBuffer+5; i++ {
+		b.Publish(TopicWeatherUpdated, CityWeatherData{City: "London"})
+	}
+	if got := b.dropped.Load(); got != 5 {
+		t.Errorf("dropped = %d, want 5", got)
+	}
+	if len(ch) != busBuffer {
+		t.Errorf("subscriber holds %d messages, want %d", len(ch), busBuffer)
+	}
+}
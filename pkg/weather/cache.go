@@ -0,0 +1,271 @@
+package weather
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/singleflight"
+
+	"github.com/deepakg86/weather-api-caching/pkg/cache"
+)
+
+const (
+	EvictionLRU  = "lru"
+	EvictionLRU2 = "lru2"
+)
+
+// Weather readings by cache key, on top of the generic LRU in pkg/cache:
+// concurrent misses share one fetch, failures are remembered briefly,
+// nearly expired hits are refreshed ahead, and every store is announced.
+type Cache struct {
+	entries *cache.Cache[CityWeatherData]
+
+	// The reading each cached city had before its latest write, for
+	// /weather/diff; dropped with the entry when it is evicted for room
+	previousMu sync.Mutex
+	previous   map[string]CityWeatherData
+
+	// Recent upstream failures, so a struggling upstream is not hit again
+	// by every request for the same city
+	errMu      sync.Mutex
+	errorCache map[string]errorEntry
+	errorTTL   time.Duration
+
+	group singleflight.Group
+
+	// Hits older than this fraction of expiry start a background refresh
+	staleThreshold float64
+	refreshedAhead atomic.Uint64
+
+	// Called after every store, outside the lock, with the cache key
+	onUpdate func(city string, data CityWeatherData)
+
+	// Gets TopicWeatherUpdated after every store, when set
+	bus *Bus
+}
+
+// Bump whenever CityWeatherData gains or changes fields, so entries
+// stored in the old shape are refetched instead of served with zero values
+const currentSchemaVersion = 7
+
+type errorEntry struct {
+	err     error
+	expires time.Time
+}
+
+// A failure served from the error cache instead of a fresh fetch
+type cachedError struct {
+	err        error
+	retryAfter time.Duration
+}
+
+func (e *cachedError) Error() string { return e.err.Error() }
+func (e *cachedError) Unwrap() error { return e.err }
+
+// A cache of maxSize entries split over the given number of shards. With
+// a positive probationSize it evicts by LRU-2, so one-off lookups such as
+// a sweep over every city cannot push hot entries out of the main list.
+func NewCache(maxSize int, expiry time.Duration, shards, probationSize int) (*Cache, error) {
+	c := &Cache{
+		previous:   make(map[string]CityWeatherData),
+		errorCache: make(map[string]errorEntry),
+		errorTTL:   30 * time.Second,
+	}
+	entries, err := cache.New(cache.Options[CityWeatherData]{
+		MaxSize:       maxSize,
+		TTL:           expiry,
+		Shards:        shards,
+		ProbationSize: probationSize,
+		Stamp:         func(data CityWeatherData) time.Time { return data.CacheTime },
+		Version:       currentSchemaVersion,
+		OnRemove:      c.forget,
+	})
+	if err != nil {
+		return nil, err
+	}
+	c.entries = entries
+	return c, nil
+}
+
+// Remember the reading an entry held when it expires or is overwritten,
+// so its successor can be compared with it; an entry evicted for room
+// takes its history with it
+func (c *Cache) forget(city string, data CityWeatherData, reason cache.RemoveReason) {
+	c.previousMu.Lock()
+	defer c.previousMu.Unlock()
+	switch reason {
+	case cache.Expired, cache.Replaced:
+		c.previous[city] = data
+	case cache.Evicted:
+		delete(c.previous, city)
+	}
+}
+
+// The reading city had before its latest write
+func (c *Cache) previousReading(city string) (CityWeatherData, bool) {
+	c.previousMu.Lock()
+	defer c.previousMu.Unlock()
+	data, ok := c.previous[city]
+	return data, ok
+}
+
+// How long an entry is served after it was fetched
+func (c *Cache) ttl() time.Duration {
+	return c.entries.TTL()
+}
+
+// Change the TTL at runtime; it applies to entries already cached
+func (c *Cache) SetExpiry(d time.Duration) error {
+	return c.entries.SetTTL(d)
+}
+
+// Grow or shrink the cache to newMax entries at runtime, split over the
+// shards. Shrinking evicts each shard's least recently used entries.
+func (c *Cache) Resize(newMax int) error {
+	return c.entries.Resize(newMax)
+}
+
+func (c *Cache) getCachedWeatherData(city string) (CityWeatherData, bool) {
+	return c.entries.Get(city)
+}
+
+func (c *Cache) updateCache(city string, data CityWeatherData) {
+	c.entries.Set(city, data)
+	c.notify(city, data)
+	if c.bus != nil {
+		c.bus.Publish(TopicWeatherUpdated, data)
+	}
+}
+
+// Re-key an entry without notifying anyone, since the reading is unchanged
+func (c *Cache) move(from, to string) {
+	data, ok := c.entries.Delete(from)
+	c.previousMu.Lock()
+	prev, hasPrev := c.previous[from]
+	delete(c.previous, from)
+	c.previousMu.Unlock()
+	if !ok {
+		return
+	}
+	c.entries.Set(to, data)
+	if hasPrev {
+		c.previousMu.Lock()
+		if _, exists := c.previous[to]; !exists {
+			c.previous[to] = prev
+		}
+		c.previousMu.Unlock()
+	}
+}
+
+func (c *Cache) notify(city string, data CityWeatherData) {
+	if c.onUpdate != nil {
+		c.onUpdate(city, data)
+	}
+}
+
+// Read-through lookup: serve the cached entry if it is still valid,
+// otherwise fetch, store and return fresh data. Concurrent misses for the
+// same city share a single fetch.
+func (c *Cache) GetOrFetch(ctx context.Context, city string, fetcher func(ctx context.Context, city string) (CityWeatherData, error)) (CityWeatherData, error) {
+	_, span := tracer.Start(ctx, "cache lookup", trace.WithAttributes(attribute.String("cache.key", city)))
+	lookupStart := time.Now()
+	data, found := c.getCachedWeatherData(city)
+	lookup := time.Since(lookupStart)
+	span.SetAttributes(attribute.Bool("cache.hit", found))
+	span.End()
+	if info := requestInfoFrom(ctx); info != nil {
+		info.cacheLookup.Add(int64(lookup))
+		result := "miss"
+		if found {
+			result = "hit"
+		}
+		info.cache.Store(&result)
+	}
+	if found {
+		if c.dueForRefresh(data) {
+			c.refreshAhead(city, fetcher)
+		}
+		return data, nil
+	}
+	if err := c.cachedError(city); err != nil {
+		return CityWeatherData{}, err
+	}
+
+	v, err, _ := c.group.Do(city, func() (interface{}, error) {
+		return c.fetchAndStore(ctx, city, fetcher)
+	})
+	if err != nil {
+		return CityWeatherData{}, err
+	}
+	return v.(CityWeatherData), nil
+}
+
+func (c *Cache) fetchAndStore(ctx context.Context, city string, fetcher func(ctx context.Context, city string) (CityWeatherData, error)) (CityWeatherData, error) {
+	data, err := fetcher(ctx, city)
+	if err != nil {
+		c.storeError(city, err)
+		return CityWeatherData{}, err
+	}
+	c.clearError(city)
+	c.updateCache(city, data)
+	return data, nil
+}
+
+// Whether a cached reading is old enough to be refreshed ahead of expiry
+func (c *Cache) dueForRefresh(data CityWeatherData) bool {
+	return c.staleThreshold > 0 && time.Since(data.CacheTime) > time.Duration(c.staleThreshold*float64(c.ttl()))
+}
+
+// Refetch a hit that is nearly due in the background, restarting its
+// expiry. It shares the city's singleflight key, so there is at most one
+// refresh in flight and a miss meanwhile waits for it rather than
+// fetching again. The fetch outlives the request that triggered it.
+func (c *Cache) refreshAhead(city string, fetcher func(ctx context.Context, city string) (CityWeatherData, error)) {
+	c.group.DoChan(city, func() (interface{}, error) {
+		slog.Debug("Refreshing cache entry ahead of expiry", "city", city)
+		data, err := c.fetchAndStore(context.Background(), city, fetcher)
+		if err != nil {
+			slog.Warn("Refresh ahead failed, serving the cached entry until it expires", "city", city, "err", err)
+			return nil, err
+		}
+		c.refreshedAhead.Add(1)
+		return data, nil
+	})
+}
+
+func (c *Cache) cachedError(city string) error {
+	c.errMu.Lock()
+	defer c.errMu.Unlock()
+	entry, ok := c.errorCache[city]
+	if !ok {
+		return nil
+	}
+	if remaining := time.Until(entry.expires); remaining > 0 {
+		return &cachedError{err: entry.err, retryAfter: remaining}
+	}
+	delete(c.errorCache, city)
+	return nil
+}
+
+// Remember upstream outages only: an unknown city is a definitive answer,
+// and a cancelled request, open circuit or spent quota says nothing new
+func (c *Cache) storeError(city string, err error) {
+	if !canFallBack(err) || errors.Is(err, errCircuitOpen) || errors.Is(err, errQuotaExhausted) {
+		return
+	}
+	c.errMu.Lock()
+	c.errorCache[city] = errorEntry{err: err, expires: time.Now().Add(c.errorTTL)}
+	c.errMu.Unlock()
+}
+
+func (c *Cache) clearError(city string) {
+	c.errMu.Lock()
+	delete(c.errorCache, city)
+	c.errMu.Unlock()
+}
@@ -0,0 +1,74 @@
+package weather
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+// A cache of n entries filled to capacity, and twice as many city names:
+// the first n are cached, the rest are not, so writing them evicts
+func benchCache(b *testing.B, n int) (*Cache, []string) {
+	b.Helper()
+	c := newTestCache(b, n, 16, 0)
+	cities := make([]string, 2*n)
+	for i := range cities {
+		cities[i] = fmt.Sprintf("city%d", i)
+	}
+	for _, city := range cities[:n] {
+		c.updateCache(city, reading(city))
+	}
+	return c, cities
+}
+
+func BenchmarkGetCachedWeatherData(b *testing.B) {
+	c, cities := benchCache(b, 1000)
+	cached := cities[:1000]
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, ok := c.getCachedWeatherData(cached[i%len(cached)]); !ok {
+			b.Fatal("miss on a pre-populated cache")
+		}
+	}
+}
+
+// Writes cycle through twice the capacity, so every other one replaces
+// an entry and the rest evict one
+func BenchmarkUpdateCache(b *testing.B) {
+	c, cities := benchCache(b, 1000)
+	data := reading("city")
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.updateCache(cities[i%len(cities)], data)
+	}
+	b.StopTimer()
+	if c.entries.Stats().EvictedBySize == 0 && b.N > len(cities) {
+		b.Fatal("no evictions")
+	}
+}
+
+// Parallel traffic over a full cache of N entries at several read
+// percentages. Keys come from twice the capacity, so reads miss and
+// writes evict as they would with more cities than fit.
+func BenchmarkConcurrentMixed(b *testing.B) {
+	for _, reads := range []int{50, 80, 95} {
+		for _, n := range []int{100, 1000, 10000} {
+			b.Run(fmt.Sprintf("reads=%d%%/N=%d", reads, n), func(b *testing.B) {
+				c, cities := benchCache(b, n)
+				data := reading("city")
+				b.ResetTimer()
+				b.RunParallel(func(pb *testing.PB) {
+					rng := rand.New(rand.NewSource(rand.Int63()))
+					for pb.Next() {
+						city := cities[rng.Intn(len(cities))]
+						if rng.Intn(100) < reads {
+							c.getCachedWeatherData(city)
+						} else {
+							c.updateCache(city, data)
+						}
+					}
+				})
+			})
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package weather
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func reading(city string) CityWeatherData {
+	return CityWeatherData{City: city, Temp: 10, Desc: "Cool", CacheTime: time.Now()}
+}
+
+func newTestCache(t testing.TB, maxSize, shards, probationSize int) *Cache {
+	t.Helper()
+	c, err := NewCache(maxSize, time.Hour, shards, probationSize)
+	if err != nil {
+		t.Fatalf("NewCache: %v", err)
+	}
+	return c
+}
+
+func TestCacheRemembersPreviousReading(t *testing.T) {
+	c := newTestCache(t, 2, 1, 0)
+	first := reading("a")
+	c.updateCache("a", first)
+	if _, ok := c.previousReading("a"); ok {
+		t.Error("a new entry has a previous reading")
+	}
+
+	second := reading("a")
+	second.Temp = 12
+	c.updateCache("a", second)
+	if prev, ok := c.previousReading("a"); !ok || prev.Temp != first.Temp {
+		t.Errorf("after an overwrite previous = %+v, %v; want the first reading", prev, ok)
+	}
+
+	// An expired entry is remembered too, so its refetch can be compared
+	expired := reading("b")
+	expired.CacheTime = time.Now().Add(-2 * time.Hour)
+	c.updateCache("b", expired)
+	if _, ok := c.getCachedWeatherData("b"); ok {
+		t.Fatal("expired entry served")
+	}
+	if _, ok := c.previousReading("b"); !ok {
+		t.Error("expired reading not remembered")
+	}
+
+	// Eviction for room forgets it
+	c.updateCache("b", reading("b"))
+	c.updateCache("c", reading("c"))
+	if _, ok := c.previousReading("a"); ok {
+		t.Error("evicted entry's previous reading kept")
+	}
+}
+
+func TestCacheMoveCarriesPreviousReading(t *testing.T) {
+	c := newTestCache(t, 4, 4, 0)
+	c.updateCache("nyc", reading("New York"))
+	c.updateCache("nyc", reading("New York"))
+	c.move("nyc", "New York")
+
+	if _, ok := c.entries.Peek("nyc"); ok {
+		t.Error("old key still cached")
+	}
+	if _, ok := c.getCachedWeatherData("New York"); !ok {
+		t.Error("new key not cached")
+	}
+	if _, ok := c.previousReading("New York"); !ok {
+		t.Error("previous reading not moved")
+	}
+	if _, ok := c.previousReading("nyc"); ok {
+		t.Error("previous reading left under the old key")
+	}
+	c.move("nowhere", "Somewhere")
+	if _, ok := c.entries.Peek("Somewhere"); ok {
+		t.Error("moving a missing key created one")
+	}
+}
+
+func TestCacheDumpAndDebugInLRUOrder(t *testing.T) {
+	c := newTestCache(t, 10, 4, 0)
+	for _, city := range []string{"a", "b", "c", "d"} {
+		c.updateCache(city, reading(city))
+	}
+	c.getCachedWeatherData("b")
+	c.getCachedWeatherData("d")
+	c.updateCache("a", reading("a"))
+
+	d := c.dump(1, 3)
+	if d.TotalEntries != 4 || d.TotalPages != 2 || len(d.Entries) != 3 || d.Entries[0].Key != "a" || d.Entries[2].Key != "b" {
+		t.Errorf("dump page 1 = %+v", d)
+	}
+	if d := c.dump(2, 3); len(d.Entries) != 1 || d.Entries[0].Key != "c" {
+		t.Errorf("dump page 2 = %+v", d)
+	}
+	if d := c.dump(3, 3); len(d.Entries) != 0 {
+		t.Errorf("dump past the end = %+v", d)
+	}
+
+	snapshot := c.debugSnapshot()
+	order := []string{}
+	for _, e := range snapshot.Entries {
+		order = append(order, e.Key)
+	}
+	if got, want := fmt.Sprint(order), "[a d b c]"; got != want {
+		t.Errorf("debug entries = %s, want %s", got, want)
+	}
+	if snapshot.MaxSize != 10 || len(snapshot.Shards) != 4 {
+		t.Errorf("debug snapshot = %+v", snapshot)
+	}
+	for _, s := range snapshot.Shards {
+		if !s.Consistent {
+			t.Errorf("shard %+v inconsistent", s)
+		}
+	}
+}
+
+func TestCacheRemembersOutagesOnly(t *testing.T) {
+	c := newTestCache(t, 10, 1, 0)
+	outage := fmt.Errorf("%w: after 10s", ErrUpstreamTimeout)
+	calls := 0
+	fetch := func(ctx context.Context, city string) (CityWeatherData, error) {
+		calls++
+		if city == "Nowhere" {
+			return CityWeatherData{}, fmt.Errorf("%w: %s", ErrCityNotFound, city)
+		}
+		return CityWeatherData{}, outage
+	}
+
+	for i := 0; i < 2; i++ {
+		_, err := c.GetOrFetch(context.Background(), "Paris", fetch)
+		if !errors.Is(err, ErrUpstreamTimeout) {
+			t.Fatalf("err = %v, want a timeout", err)
+		}
+		var cached *cachedError
+		if isCached := errors.As(err, &cached); isCached != (i == 1) {
+			t.Errorf("request %d: served from the error cache = %v", i+1, isCached)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		c.GetOrFetch(context.Background(), "Nowhere", fetch)
+	}
+	if calls != 3 {
+		t.Errorf("fetched %d times, want 3: once for the outage, twice for the unknown city", calls)
+	}
+}
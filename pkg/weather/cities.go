@@ -0,0 +1,147 @@
+package weather
+
+import (
+	_ "embed"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// List of the largest world cities, ordered roughly by population
+//
+//go:embed cities.csv
+var citiesCSV string
+
+type City struct {
+	Name    string `json:"name"`
+	Country string `json:"country"`
+}
+
+// The index is built once at startup and never modified afterwards,
+// so concurrent searches need no locking
+type cityIndex struct {
+	cities []City
+	names  []string // lowercased names, parallel to cities
+}
+
+func loadCityIndex() (*cityIndex, error) {
+	records, err := csv.NewReader(strings.NewReader(citiesCSV)).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) < 2 {
+		return nil, fmt.Errorf("city list is empty")
+	}
+
+	idx := &cityIndex{}
+	// Skip the header row
+	for _, rec := range records[1:] {
+		idx.cities = append(idx.cities, City{Name: rec[0], Country: rec[1]})
+		idx.names = append(idx.names, strings.ToLower(rec[0]))
+	}
+	return idx, nil
+}
+
+// Return cities matching the query: exact matches first, then prefix
+// matches, then names within an edit distance of 2
+func (idx *cityIndex) search(query string, limit int) []City {
+	q := strings.ToLower(strings.TrimSpace(query))
+	if q == "" {
+		return nil
+	}
+
+	type match struct {
+		pos  int
+		rank int
+	}
+	var matches []match
+	for i, name := range idx.names {
+		switch {
+		case name == q:
+			matches = append(matches, match{i, 0})
+		case strings.HasPrefix(name, q):
+			matches = append(matches, match{i, 1})
+		default:
+			if d := levenshtein(q, name, 2); d <= 2 {
+				matches = append(matches, match{i, 1 + d})
+			}
+		}
+	}
+
+	// Lower rank wins; ties keep the population order of the list
+	sort.SliceStable(matches, func(a, b int) bool {
+		return matches[a].rank < matches[b].rank
+	})
+
+	result := []City{}
+	for _, m := range matches {
+		if len(result) == limit {
+			break
+		}
+		result = append(result, idx.cities[m.pos])
+	}
+	return result
+}
+
+// Up to n distinct city names for a "did you mean" hint
+func (idx *cityIndex) suggest(query string, n int) []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, c := range idx.search(query, len(idx.cities)) {
+		if seen[c.Name] || strings.EqualFold(c.Name, query) {
+			continue
+		}
+		seen[c.Name] = true
+		names = append(names, c.Name)
+		if len(names) == n {
+			break
+		}
+	}
+	return names
+}
+
+// Edit distance between a and b; gives up early and returns max+1 once
+// the distance is known to exceed max
+func levenshtein(a, b string, max int) int {
+	ra, rb := []rune(a), []rune(b)
+	if diff := len(ra) - len(rb); diff > max || -diff > max {
+		return max + 1
+	}
+
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		rowMin := curr[0]
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+			rowMin = min(rowMin, curr[j])
+		}
+		if rowMin > max {
+			return max + 1
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
+
+func (s *Server) citySearchHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query().Get("q")
+	if strings.TrimSpace(q) == "" {
+		writeProblem(w, http.StatusBadRequest, "", "Query parameter q is required", r.URL.Path)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.cities.search(q, 10))
+}
@@ -0,0 +1,77 @@
+package weather_test
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/deepakg86/weather-api-caching/pkg/weather"
+)
+
+func TestCitySearch(t *testing.T) {
+	ts := newTestServer(t, londonProvider(), nil)
+	search := func(q string) []weather.City {
+		t.Helper()
+		var cities []weather.City
+		if resp := getJSON(t, ts, "/cities/search?q="+url.QueryEscape(q), &cities); resp.StatusCode != http.StatusOK {
+			t.Fatalf("q=%s: status %d", q, resp.StatusCode)
+		}
+		return cities
+	}
+
+	t.Run("exact", func(t *testing.T) {
+		// Both Londons, the larger first, ahead of any near miss
+		got := search("london")
+		if len(got) < 2 || got[0] != (weather.City{Name: "London", Country: "United Kingdom"}) ||
+			got[1] != (weather.City{Name: "London", Country: "Canada"}) {
+			t.Errorf("got %v, want London, United Kingdom then London, Canada", got)
+		}
+	})
+
+	t.Run("prefix", func(t *testing.T) {
+		got := search("san")
+		if len(got) != 10 {
+			t.Fatalf("got %d cities, want the limit of 10", len(got))
+		}
+		for _, c := range got {
+			if !strings.HasPrefix(c.Name, "San") {
+				t.Errorf("%s does not start with San", c.Name)
+			}
+		}
+	})
+
+	t.Run("prefix before fuzzy", func(t *testing.T) {
+		got := search("Pari")
+		if len(got) == 0 || got[0].Name != "Paris" {
+			t.Errorf("got %v, want Paris first", got)
+		}
+	})
+
+	t.Run("fuzzy", func(t *testing.T) {
+		for _, typo := range []string{"Londn", "Lodnon", "Parsi"} {
+			got := search(typo)
+			if len(got) == 0 {
+				t.Errorf("%s: no suggestions", typo)
+				continue
+			}
+			if want := map[string]string{"Londn": "London", "Lodnon": "London", "Parsi": "Paris"}[typo]; got[0].Name != want {
+				t.Errorf("%s: got %v first, want %s", typo, got[0], want)
+			}
+		}
+	})
+
+	t.Run("no match", func(t *testing.T) {
+		var raw []interface{}
+		getJSON(t, ts, "/cities/search?q=Xqzzyvw", &raw)
+		if raw == nil || len(raw) != 0 {
+			t.Errorf("got %v, want an empty list", raw)
+		}
+	})
+
+	t.Run("missing query", func(t *testing.T) {
+		if resp := getJSON(t, ts, "/cities/search?q=%20", nil); resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("status %d, want 400", resp.StatusCode)
+		}
+	})
+}
@@ -0,0 +1,93 @@
+package weather
+
+// Normalized weather conditions, so clients can pick an icon without
+// parsing each provider's free-text description
+const (
+	ConditionClear   = "clear"
+	ConditionClouds  = "clouds"
+	ConditionRain    = "rain"
+	ConditionSnow    = "snow"
+	ConditionStorm   = "storm"
+	ConditionFog     = "fog"
+	ConditionUnknown = "unknown"
+)
+
+// Weatherstack (WorldWeatherOnline) condition codes. Sleet and ice pellets
+// count as snow, freezing drizzle and rain as rain.
+var weatherstackConditions = map[int]string{
+	113: ConditionClear,  // Sunny / Clear
+	116: ConditionClouds, // Partly cloudy
+	119: ConditionClouds, // Cloudy
+	122: ConditionClouds, // Overcast
+	143: ConditionFog,    // Mist
+	176: ConditionRain,   // Patchy rain possible
+	179: ConditionSnow,   // Patchy snow possible
+	182: ConditionSnow,   // Patchy sleet possible
+	185: ConditionRain,   // Patchy freezing drizzle possible
+	200: ConditionStorm,  // Thundery outbreaks possible
+	227: ConditionSnow,   // Blowing snow
+	230: ConditionSnow,   // Blizzard
+	248: ConditionFog,    // Fog
+	260: ConditionFog,    // Freezing fog
+	263: ConditionRain,   // Patchy light drizzle
+	266: ConditionRain,   // Light drizzle
+	281: ConditionRain,   // Freezing drizzle
+	284: ConditionRain,   // Heavy freezing drizzle
+	293: ConditionRain,   // Patchy light rain
+	296: ConditionRain,   // Light rain
+	299: ConditionRain,   // Moderate rain at times
+	302: ConditionRain,   // Moderate rain
+	305: ConditionRain,   // Heavy rain at times
+	308: ConditionRain,   // Heavy rain
+	311: ConditionRain,   // Light freezing rain
+	314: ConditionRain,   // Moderate or heavy freezing rain
+	317: ConditionSnow,   // Light sleet
+	320: ConditionSnow,   // Moderate or heavy sleet
+	323: ConditionSnow,   // Patchy light snow
+	326: ConditionSnow,   // Light snow
+	329: ConditionSnow,   // Patchy moderate snow
+	332: ConditionSnow,   // Moderate snow
+	335: ConditionSnow,   // Patchy heavy snow
+	338: ConditionSnow,   // Heavy snow
+	350: ConditionSnow,   // Ice pellets
+	353: ConditionRain,   // Light rain shower
+	356: ConditionRain,   // Moderate or heavy rain shower
+	359: ConditionRain,   // Torrential rain shower
+	362: ConditionSnow,   // Light sleet showers
+	365: ConditionSnow,   // Moderate or heavy sleet showers
+	368: ConditionSnow,   // Light snow showers
+	371: ConditionSnow,   // Moderate or heavy snow showers
+	374: ConditionSnow,   // Light showers of ice pellets
+	377: ConditionSnow,   // Moderate or heavy showers of ice pellets
+	386: ConditionStorm,  // Patchy light rain with thunder
+	389: ConditionStorm,  // Moderate or heavy rain with thunder
+	392: ConditionStorm,  // Patchy light snow with thunder
+	395: ConditionStorm,  // Moderate or heavy snow with thunder
+}
+
+func weatherstackCondition(code int) string {
+	if c, ok := weatherstackConditions[code]; ok {
+		return c
+	}
+	return ConditionUnknown
+}
+
+// OpenWeatherMap groups its ids by hundreds:
+// https://openweathermap.org/weather-conditions
+func openWeatherMapCondition(id int) string {
+	switch {
+	case id >= 200 && id < 300, id == 771, id == 781: // thunderstorms, squalls, tornado
+		return ConditionStorm
+	case id >= 300 && id < 600:
+		return ConditionRain
+	case id >= 600 && id < 700:
+		return ConditionSnow
+	case id >= 700 && id < 800:
+		return ConditionFog
+	case id == 800:
+		return ConditionClear
+	case id > 800 && id < 900:
+		return ConditionClouds
+	}
+	return ConditionUnknown
+}
@@ -0,0 +1,58 @@
+package weather
+
+import "testing"
+
+func TestWeatherstackConditions(t *testing.T) {
+	// Every code the mapping claims to handle, listed by hand
+	want := map[string][]int{
+		ConditionClear:  {113},
+		ConditionClouds: {116, 119, 122},
+		ConditionFog:    {143, 248, 260},
+		ConditionRain: {
+			176, 185, 263, 266, 281, 284, 293, 296, 299, 302, 305, 308,
+			311, 314, 353, 356, 359,
+		},
+		ConditionSnow: {
+			179, 182, 227, 230, 317, 320, 323, 326, 329, 332, 335, 338,
+			350, 362, 365, 368, 371, 374, 377,
+		},
+		ConditionStorm: {200, 386, 389, 392, 395},
+	}
+	covered := 0
+	for condition, codes := range want {
+		for _, code := range codes {
+			covered++
+			if got := weatherstackCondition(code); got != condition {
+				t.Errorf("code %d: %s, want %s", code, got, condition)
+			}
+		}
+	}
+	if covered != len(weatherstackConditions) {
+		t.Errorf("tested %d codes, but %d are mapped", covered, len(weatherstackConditions))
+	}
+	for _, code := range []int{0, -1, 114, 400, 999} {
+		if got := weatherstackCondition(code); got != ConditionUnknown {
+			t.Errorf("unmapped code %d: %s, want unknown", code, got)
+		}
+	}
+}
+
+func TestOpenWeatherMapConditions(t *testing.T) {
+	tests := []struct {
+		id   int
+		want string
+	}{
+		{200, ConditionStorm}, {232, ConditionStorm}, {771, ConditionStorm}, {781, ConditionStorm},
+		{300, ConditionRain}, {321, ConditionRain}, {500, ConditionRain}, {511, ConditionRain}, {531, ConditionRain},
+		{600, ConditionSnow}, {611, ConditionSnow}, {622, ConditionSnow},
+		{701, ConditionFog}, {741, ConditionFog}, {762, ConditionFog},
+		{800, ConditionClear},
+		{801, ConditionClouds}, {804, ConditionClouds},
+		{0, ConditionUnknown}, {199, ConditionUnknown}, {900, ConditionUnknown},
+	}
+	for _, tt := range tests {
+		if got := openWeatherMapCondition(tt.id); got != tt.want {
+			t.Errorf("id %d: %s, want %s", tt.id, got, tt.want)
+		}
+	}
+}
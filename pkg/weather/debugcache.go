@@ -0,0 +1,79 @@
+package weather
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+type debugCacheEntry struct {
+	Key          string    `json:"key"`
+	Shard        int       `json:"shard"`
+	City         string    `json:"city"`
+	Temp         float64   `json:"temp"`
+	CacheTime    time.Time `json:"cache_time"`
+	AgeSeconds   float64   `json:"age_seconds"`
+	TTLRemaining float64   `json:"ttl_remaining_seconds"` // negative once expired
+	Accesses     uint64    `json:"accesses"`
+	OnProbation  bool      `json:"on_probation,omitempty"`
+	Schema       int       `json:"schema_version"`
+}
+
+// One shard's bookkeeping. The map and list lengths should agree; a
+// mismatch means an entry leaked from one of them.
+type debugCacheShard struct {
+	Shard        int  `json:"shard"`
+	MapLen       int  `json:"map_len"`
+	ListLen      int  `json:"list_len"`
+	ProbationLen int  `json:"probation_len,omitempty"`
+	Capacity     int  `json:"capacity"`
+	Consistent   bool `json:"consistent"`
+}
+
+type debugCache struct {
+	TTL     string            `json:"ttl"`
+	MaxSize int               `json:"max_size"`
+	Entries []debugCacheEntry `json:"entries"` // cache-wide LRU order, most recently used first
+	Shards  []debugCacheShard `json:"shards"`
+}
+
+// Every entry in LRU order with its metadata, copied so the handler can
+// encode without holding any lock
+func (c *Cache) debugSnapshot() debugCache {
+	ttl := c.ttl()
+	now := time.Now()
+	d := debugCache{TTL: ttl.String(), MaxSize: c.entries.MaxSize(), Entries: []debugCacheEntry{}, Shards: []debugCacheShard{}}
+	for _, sh := range c.entries.ShardStats() {
+		d.Shards = append(d.Shards, debugCacheShard{
+			Shard:        sh.Shard,
+			MapLen:       sh.Items,
+			ListLen:      sh.Main,
+			ProbationLen: sh.Probation,
+			Capacity:     sh.Capacity,
+			Consistent:   sh.Items == sh.Main+sh.Probation,
+		})
+	}
+	for _, e := range c.entries.Entries() {
+		age := now.Sub(e.Value.CacheTime)
+		d.Entries = append(d.Entries, debugCacheEntry{
+			Key:          e.Key,
+			Shard:        e.Shard,
+			City:         e.Value.City,
+			Temp:         e.Value.Temp,
+			CacheTime:    e.Value.CacheTime,
+			AgeSeconds:   age.Seconds(),
+			TTLRemaining: (ttl - age).Seconds(),
+			Accesses:     e.Accesses,
+			OnProbation:  e.OnProbation,
+			Schema:       e.Version,
+		})
+	}
+	return d
+}
+
+// Dump the cache's internals, for when it misbehaves
+func (s *Server) debugCacheHandler(w http.ResponseWriter, r *http.Request) {
+	snapshot := s.cache.debugSnapshot()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(snapshot)
+}
@@ -0,0 +1,80 @@
+package weather
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestDebugCacheShowsPromotion(t *testing.T) {
+	config := DefaultConfig()
+	config.AdminToken = "secret"
+	srv, err := NewServer(echoProvider{}, config)
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	for _, city := range []string{"London", "Paris", "Rome", "London"} {
+		getBody(t, ts, "/weather?city="+city, nil)
+	}
+
+	get := func(token string) (*http.Response, debugCache) {
+		req, _ := http.NewRequest(http.MethodGet, ts.URL+"/debug/cache", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var d debugCache
+		if resp.StatusCode == http.StatusOK {
+			if err := json.NewDecoder(resp.Body).Decode(&d); err != nil {
+				t.Fatalf("decoding: %v", err)
+			}
+		}
+		return resp, d
+	}
+	if resp, _ := get("wrong"); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("wrong token: status %d, want 401", resp.StatusCode)
+	}
+	resp, d := get("secret")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d", resp.StatusCode)
+	}
+
+	// The touched London moved ahead of the cities stored after it
+	var order []string
+	accesses := make(map[string]uint64)
+	for _, e := range d.Entries {
+		order = append(order, e.City)
+		accesses[e.City] = e.Accesses
+		if e.TTLRemaining <= 0 || e.AgeSeconds < 0 || e.TTLRemaining > config.CacheTTL.Seconds() {
+			t.Errorf("%s: age %gs, %gs left of %v", e.City, e.AgeSeconds, e.TTLRemaining, config.CacheTTL)
+		}
+	}
+	if want := []string{"London", "Rome", "Paris"}; !reflect.DeepEqual(order, want) {
+		t.Errorf("order = %v, want %v", order, want)
+	}
+	if accesses["London"] <= accesses["Paris"] || accesses["Paris"] != accesses["Rome"] {
+		t.Errorf("accesses = %v, want London ahead of Paris and Rome", accesses)
+	}
+
+	total, capacity := 0, 0
+	for _, sh := range d.Shards {
+		if !sh.Consistent || sh.MapLen != sh.ListLen+sh.ProbationLen {
+			t.Errorf("shard %+v is inconsistent", sh)
+		}
+		total += sh.MapLen
+		capacity += sh.Capacity
+	}
+	if total != 3 || d.TTL != config.CacheTTL.String() || d.MaxSize != config.CacheSize {
+		t.Errorf("%d entries over the shards, TTL %s, max %d; want 3, %v, %d", total, d.TTL, d.MaxSize, config.CacheTTL, config.CacheSize)
+	}
+	if capacity != config.CacheSize {
+		t.Errorf("shard capacities add up to %d, want %d", capacity, config.CacheSize)
+	}
+}
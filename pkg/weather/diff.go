@@ -0,0 +1,90 @@
+package weather
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+)
+
+type weatherDiffEntry struct {
+	Key           string          `json:"key"`
+	Data          CityWeatherData `json:"data"`
+	New           bool            `json:"new,omitempty"`  // nothing earlier to compare with
+	ChangedFields []string        `json:"changed_fields"` // JSON names, sorted; empty when new
+}
+
+type weatherDiff struct {
+	Since  time.Time          `json:"since"`
+	Cities []weatherDiffEntry `json:"cities"`
+}
+
+// Unexpired entries refreshed after since, each compared with the
+// reading it replaced, sorted by key
+func (c *Cache) changedSince(since time.Time) []weatherDiffEntry {
+	result := []weatherDiffEntry{}
+	for _, e := range c.entries.Entries() {
+		if !e.Fresh() || !e.Value.CacheTime.After(since) {
+			continue
+		}
+		entry := weatherDiffEntry{Key: e.Key, Data: e.Value, ChangedFields: []string{}}
+		if prev, ok := c.previousReading(e.Key); ok {
+			entry.ChangedFields = changedFields(prev, e.Value)
+		} else {
+			entry.New = true
+		}
+		result = append(result, entry)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Key < result[j].Key })
+	return result
+}
+
+// Top-level fields that differ between two readings, by JSON name.
+// Timestamps and the local clock change on every refresh, so they are
+// left out.
+func changedFields(before, after CityWeatherData) []string {
+	flatten := func(d CityWeatherData) map[string]json.RawMessage {
+		d.CacheTime, d.ObservationTime, d.LocalTime = time.Time{}, nil, ""
+		if d.Location != nil {
+			loc := *d.Location
+			loc.Localtime = ""
+			d.Location = &loc
+		}
+		b, _ := json.Marshal(d)
+		var m map[string]json.RawMessage
+		json.Unmarshal(b, &m)
+		return m
+	}
+	a, b := flatten(before), flatten(after)
+	changed := []string{}
+	for name, v := range b {
+		if !bytes.Equal(a[name], v) {
+			changed = append(changed, name)
+		}
+	}
+	for name := range a {
+		if _, ok := b[name]; !ok {
+			changed = append(changed, name) // omitted now
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+func (s *Server) diffHandler(w http.ResponseWriter, r *http.Request) {
+	param := r.URL.Query().Get("since")
+	if param == "" {
+		writeProblem(w, http.StatusBadRequest, "", "Since parameter is required", r.URL.Path)
+		return
+	}
+	since, err := time.Parse(time.RFC3339, param)
+	if err != nil {
+		writeProblem(w, http.StatusBadRequest, "", fmt.Sprintf("Invalid since parameter %q: want an RFC 3339 time such as 2024-01-15T12:00:00Z", param), r.URL.Path)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(weatherDiff{Since: since, Cities: s.cache.changedSince(since)})
+}
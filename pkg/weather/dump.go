@@ -0,0 +1,72 @@
+package weather
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+const (
+	defaultDumpPageSize = 50
+	maxDumpPageSize     = 200
+)
+
+type cacheDumpEntry struct {
+	Key     string          `json:"key"`
+	Data    CityWeatherData `json:"data"`
+	Expired bool            `json:"expired"`
+}
+
+type cacheDump struct {
+	TotalEntries int              `json:"total_entries"`
+	TotalPages   int              `json:"total_pages"`
+	CurrentPage  int              `json:"current_page"`
+	PageSize     int              `json:"page_size"`
+	Entries      []cacheDumpEntry `json:"entries"`
+}
+
+// One page of entries in LRU order with the most recently used first;
+// under LRU-2 the probationary entries follow the main list
+func (c *Cache) dump(page, pageSize int) cacheDump {
+	entries := c.entries.Entries()
+	total := len(entries)
+	d := cacheDump{
+		TotalEntries: total,
+		TotalPages:   (total + pageSize - 1) / pageSize,
+		CurrentPage:  page,
+		PageSize:     pageSize,
+		Entries:      []cacheDumpEntry{},
+	}
+	start := min((page-1)*pageSize, total)
+	for _, e := range entries[start:min(start+pageSize, total)] {
+		d.Entries = append(d.Entries, cacheDumpEntry{
+			Key:     e.Key,
+			Data:    e.Value,
+			Expired: e.Expired,
+		})
+	}
+	return d
+}
+
+func (s *Server) cacheDumpHandler(w http.ResponseWriter, r *http.Request) {
+	page, pageSize := 1, defaultDumpPageSize
+	if p := r.URL.Query().Get("page"); p != "" {
+		n, err := strconv.Atoi(p)
+		if err != nil || n <= 0 {
+			writeProblem(w, http.StatusBadRequest, "", "Page must be a positive integer", r.URL.Path)
+			return
+		}
+		page = n
+	}
+	if ps := r.URL.Query().Get("page_size"); ps != "" {
+		n, err := strconv.Atoi(ps)
+		if err != nil || n <= 0 {
+			writeProblem(w, http.StatusBadRequest, "", "Page size must be a positive integer", r.URL.Path)
+			return
+		}
+		pageSize = min(n, maxDumpPageSize)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.cache.dump(page, pageSize))
+}
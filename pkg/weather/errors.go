@@ -0,0 +1,57 @@
+package weather
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+)
+
+// Classes of upstream failure, for callers to match with errors.Is
+var (
+	ErrMissingAPIKey       = errors.New("API key is missing")
+	ErrCityNotFound        = errors.New("city not found")
+	ErrQuotaExceeded       = errors.New("API quota exceeded")
+	ErrUpstreamTimeout     = errors.New("upstream timed out")
+	ErrUpstreamBadResponse = errors.New("bad upstream response")
+)
+
+// Non-200 response from an upstream API; matches ErrUpstreamBadResponse
+type StatusError struct {
+	Code   int
+	Status string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("API error: %s", e.Status)
+}
+
+func (e *StatusError) Unwrap() error {
+	return ErrUpstreamBadResponse
+}
+
+// Mark a failed round trip as ErrUpstreamTimeout when it ran out of time,
+// keeping the original error reachable for errors.Is and errors.As
+func classifyTransportError(err error) error {
+	var ne net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &ne) && ne.Timeout()) {
+		return fmt.Errorf("%w: %w", ErrUpstreamTimeout, err)
+	}
+	return err
+}
+
+// Status to answer with when upstream failed for reasons of its own
+func upstreamErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrCityNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrUpstreamTimeout):
+		return http.StatusGatewayTimeout
+	case errors.Is(err, ErrUpstreamBadResponse):
+		return http.StatusBadGateway
+	case errors.Is(err, ErrQuotaExceeded):
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,119 @@
+package weather
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestFetchErrorClasses(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		want    error
+	}{
+		{"unknown city", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"success": false, "error": {"code": 615, "info": "Your API request failed."}}`)
+		}, ErrCityNotFound},
+		{"quota", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"success": false, "error": {"code": 104, "info": "Monthly limit reached"}}`)
+		}, ErrQuotaExceeded},
+		{"server error", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadGateway)
+		}, ErrUpstreamBadResponse},
+		{"malformed body", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"current": {"temperature": "warm"`)
+		}, ErrUpstreamBadResponse},
+		{"slow", func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+		}, ErrUpstreamTimeout},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := httptest.NewServer(tt.handler)
+			defer ts.Close()
+			ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+			defer cancel()
+
+			_, err := fetchWeatherFromAPI(ctx, ts.Client(), ts.URL, "test-key", "London")
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("err = %v, want %v", err, tt.want)
+			}
+			for _, other := range []error{ErrMissingAPIKey, ErrCityNotFound, ErrQuotaExceeded, ErrUpstreamTimeout, ErrUpstreamBadResponse} {
+				if other != tt.want && errors.Is(err, other) {
+					t.Errorf("err = %v also matches %v", err, other)
+				}
+			}
+		})
+	}
+}
+
+func TestFetchErrorDetailsStayReachable(t *testing.T) {
+	// The status code comes with a bad response
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	_, err := fetchWeatherFromAPI(context.Background(), ts.Client(), ts.URL, "test-key", "London")
+	ts.Close()
+	var se *StatusError
+	if !errors.As(err, &se) || se.Code != http.StatusServiceUnavailable {
+		t.Errorf("err = %v, want a StatusError with code 503", err)
+	}
+
+	// A timeout still carries the context's own error
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer slow.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = fetchWeatherFromAPI(ctx, slow.Client(), slow.URL, "test-key", "London")
+	if !errors.Is(err, ErrUpstreamTimeout) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want ErrUpstreamTimeout wrapping context.DeadlineExceeded", err)
+	}
+
+	// A refused connection is a network error, not a timeout
+	_, err = fetchWeatherFromAPI(context.Background(), http.DefaultClient, ts.URL, "test-key", "London")
+	var ne net.Error
+	if !errors.As(err, &ne) || errors.Is(err, ErrUpstreamTimeout) {
+		t.Errorf("err = %v, want a network error that is not a timeout", err)
+	}
+}
+
+func TestMissingAPIKey(t *testing.T) {
+	p, err := NewWeatherstackProvider("", newKeyPool(nil, time.Minute), http.DefaultClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Current(context.Background(), "London"); !errors.Is(err, ErrMissingAPIKey) {
+		t.Errorf("err = %v, want ErrMissingAPIKey", err)
+	}
+}
+
+func TestUpstreamErrorStatus(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{fmt.Errorf("%w: Atlantis", ErrCityNotFound), http.StatusNotFound},
+		{fmt.Errorf("%w after 5s", ErrUpstreamTimeout), http.StatusGatewayTimeout},
+		{&StatusError{Code: 500, Status: "500 Internal Server Error"}, http.StatusBadGateway},
+		{fmt.Errorf("%w: unexpected EOF", ErrUpstreamBadResponse), http.StatusBadGateway},
+		{fmt.Errorf("all keys exhausted: %w", ErrQuotaExceeded), http.StatusServiceUnavailable},
+		{ErrMissingAPIKey, http.StatusInternalServerError},
+		{errors.New("something else"), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		if got := upstreamErrorStatus(tt.err); got != tt.want {
+			t.Errorf("%v: status %d, want %d", tt.err, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,10 @@
+package weather
+
+import "testing"
+
+// Let alerts call back to httptest servers, which listen on loopback, for
+// the rest of the test
+func AllowLoopbackCallbacks(t *testing.T) {
+	allowLoopbackCallbacks.Store(true)
+	t.Cleanup(func() { allowLoopbackCallbacks.Store(false) })
+}
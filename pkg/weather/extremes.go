@@ -0,0 +1,60 @@
+package weather
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+)
+
+const maxExtremesLimit = 50
+
+// Unexpired cached readings sorted by temperature, warmest first unless
+// ascending, cut to n
+func (c *Cache) topNCities(n int, ascending bool) []CityWeatherData {
+	result := []CityWeatherData{}
+	for _, e := range c.entries.Entries() {
+		if e.Fresh() {
+			result = append(result, e.Value)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if ascending {
+			return result[i].Temp < result[j].Temp
+		}
+		return result[i].Temp > result[j].Temp
+	})
+	if len(result) > n {
+		result = result[:n]
+	}
+	return result
+}
+
+func (s *Server) warmestHandler(w http.ResponseWriter, r *http.Request) {
+	s.extremes(w, r, false)
+}
+
+func (s *Server) coldestHandler(w http.ResponseWriter, r *http.Request) {
+	s.extremes(w, r, true)
+}
+
+func (s *Server) extremes(w http.ResponseWriter, r *http.Request, ascending bool) {
+	limit := 5
+	if l := r.URL.Query().Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n <= 0 {
+			writeProblem(w, http.StatusBadRequest, "", "Limit must be a positive integer", r.URL.Path)
+			return
+		}
+		limit = min(n, maxExtremesLimit)
+	}
+
+	cities := s.cache.topNCities(limit, ascending)
+	if len(cities) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(cities)
+}
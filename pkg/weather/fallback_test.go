@@ -0,0 +1,70 @@
+package weather
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func fallbackServer(t *testing.T, p WeatherProvider) (*Server, *httptest.Server) {
+	t.Helper()
+	config := DefaultConfig()
+	config.FallbackToSimulated = true
+	config.RetryAttempts = 1
+	config.ErrorCacheTTL = 50 * time.Millisecond
+	srv, err := NewServer(p, config)
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	ts := httptest.NewServer(srv.Handler())
+	t.Cleanup(ts.Close)
+	return srv, ts
+}
+
+func TestFallbackToSimulatedIsMarkedAndNotCached(t *testing.T) {
+	p := &stubProvider{err: &StatusError{Code: http.StatusServiceUnavailable, Status: "503 Service Unavailable"}}
+	srv, ts := fallbackServer(t, p)
+
+	var data CityWeatherData
+	if resp := getBody(t, ts, "/weather?city=London", &data); resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d during the outage, want simulated weather", resp.StatusCode)
+	}
+	if data.Source != "simulated" || data.City != "London" {
+		t.Errorf("served %+v, want London marked simulated", data)
+	}
+	if _, ok := srv.cache.getCachedWeatherData(languageCacheKey(srv.resolveCity("London"), "")); ok {
+		t.Error("simulated weather was cached")
+	}
+
+	// Real data replaces it once the error cache lets a fetch through
+	p.err = nil
+	p.data = CityWeatherData{City: "London", Temp: 11, Desc: "Overcast", Source: "weatherstack", CacheTime: time.Now()}
+	time.Sleep(60 * time.Millisecond)
+	if getBody(t, ts, "/weather?city=London", &data); data.Source != "weatherstack" || data.Temp != 11 {
+		t.Errorf("after recovery served %+v, want the live reading", data)
+	}
+	if getBody(t, ts, "/weather?city=London", &data); data.Source != "weatherstack" || p.calls != 2 {
+		t.Errorf("served %+v after %d upstream calls, want the cached live reading", data, p.calls)
+	}
+}
+
+func TestFallbackToSimulatedOnlyForOutages(t *testing.T) {
+	// An unknown city is an answer, not an outage
+	p := &stubProvider{err: ErrCityNotFound}
+	_, ts := fallbackServer(t, p)
+	if resp := getBody(t, ts, "/weather?city=Atlantis", nil); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("status %d, want 404", resp.StatusCode)
+	}
+
+	// Off by default
+	srv, err := NewServer(&stubProvider{err: &StatusError{Code: http.StatusBadGateway, Status: "502 Bad Gateway"}}, DefaultConfig())
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	plain := httptest.NewServer(srv.Handler())
+	defer plain.Close()
+	if resp := getBody(t, plain, "/weather?city=London", nil); resp.StatusCode < 500 {
+		t.Errorf("status %d without FALLBACK_TO_SIMULATED, want a 5xx", resp.StatusCode)
+	}
+}
@@ -0,0 +1,70 @@
+package weather
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+)
+
+// Optional features, read from the environment at startup. The routes of
+// a disabled feature answer 501 rather than 404, so clients can tell a
+// feature that is switched off from a path that does not exist.
+type FeatureFlags struct {
+	EnableRandom    bool `json:"random_endpoint"` // GET /weather/random, ENABLE_RANDOM_ENDPOINT
+	EnableJSONP     bool `json:"jsonp"`           // callback= on JSON responses, ENABLE_JSONP
+	EnableWebSocket bool `json:"websocket"`       // /ws, ENABLE_WEBSOCKET
+	EnableStream    bool `json:"stream"`          // GET /weather/stream, ENABLE_STREAM
+	EnableNearest   bool `json:"nearest"`         // GET /weather/nearest, ENABLE_NEAREST_ENDPOINT
+
+	// Per-request timing breakdown in a Server-Timing header, ENABLE_SERVER_TIMING
+	EnableServerTiming bool `json:"server_timing"`
+}
+
+// Endpoints that have always been served stay on; demo and legacy extras
+// are opt-in
+func DefaultFeatureFlags() FeatureFlags {
+	return FeatureFlags{EnableWebSocket: true, EnableStream: true, EnableNearest: true}
+}
+
+// Override f with any of the ENABLE_* variables that are set
+func featureFlagsFromEnv(f FeatureFlags) FeatureFlags {
+	for _, flag := range []struct {
+		name string
+		dst  *bool
+	}{
+		{"ENABLE_RANDOM_ENDPOINT", &f.EnableRandom},
+		{"ENABLE_JSONP", &f.EnableJSONP},
+		{"ENABLE_WEBSOCKET", &f.EnableWebSocket},
+		{"ENABLE_STREAM", &f.EnableStream},
+		{"ENABLE_NEAREST_ENDPOINT", &f.EnableNearest},
+		{"ENABLE_SERVER_TIMING", &f.EnableServerTiming},
+	} {
+		v := os.Getenv(flag.name)
+		if v == "" {
+			continue
+		}
+		on, err := strconv.ParseBool(v)
+		if err != nil {
+			fatal("Invalid "+flag.name+": must be true or false", "value", v)
+		}
+		*flag.dst = on
+	}
+	return f
+}
+
+// h when the feature is on, a 501 otherwise
+func (s *Server) feature(name string, enabled bool, h http.HandlerFunc) http.HandlerFunc {
+	if enabled {
+		return h
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeProblem(w, http.StatusNotImplemented, "", fmt.Sprintf("The %s feature is not enabled on this server", name), r.URL.Path)
+	}
+}
+
+func (s *Server) featuresHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.config.Features)
+}
@@ -0,0 +1,66 @@
+package weather
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// JSON names of the CityWeatherData fields a client may select
+var weatherFields = func() map[string]bool {
+	names := make(map[string]bool)
+	t := reflect.TypeOf(CityWeatherData{})
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			names[name] = true
+		}
+	}
+	names["observation_age_seconds"] = true // added by MarshalJSON
+	return names
+}()
+
+// Parse a comma-separated fields parameter, rejecting unknown names and,
+// outside /v1, the fields only /v1 has
+func parseFields(param string, v1 bool) ([]string, error) {
+	var fields []string
+	for _, f := range strings.Split(param, ",") {
+		f = strings.TrimSpace(f)
+		if f == "" {
+			continue
+		}
+		if !weatherFields[f] || (v1Fields[f] && !v1) {
+			return nil, fmt.Errorf("unknown field %q", f)
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+// Only the requested fields of data, keyed by their JSON names
+func project(data CityWeatherData, fields []string) (map[string]interface{}, error) {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	// Keep numbers as written rather than round-tripping through float64
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var all map[string]interface{}
+	if err := dec.Decode(&all); err != nil {
+		return nil, err
+	}
+
+	keep := make(map[string]bool, len(fields))
+	for _, f := range fields {
+		keep[f] = true
+	}
+	for k := range all {
+		if !keep[k] {
+			delete(all, k)
+		}
+	}
+	return all, nil
+}
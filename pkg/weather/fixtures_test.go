@@ -0,0 +1,140 @@
+package weather
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// The live provider as Run builds it, with fixtures in mode from dir and
+// Weatherstack at baseURL, called with apiKey
+func fixtureProvider(t *testing.T, mode, dir, baseURL, apiKey string) WeatherProvider {
+	t.Helper()
+	for name, value := range map[string]string{
+		"WEATHER_FIXTURES": mode, "WEATHER_FIXTURES_DIR": dir, "WEATHERSTACK_BASE_URL": baseURL,
+		"WEATHER_PROVIDERS": "", "WEATHER_PROVIDER": "", "WEATHERSTACK_API_KEYS": "", "WEATHERSTACK_API_KEY": apiKey,
+	} {
+		t.Setenv(name, value)
+	}
+	p, err := newUpstream().newProvider(ModeLive, DefaultConfig())
+	if err != nil {
+		t.Fatalf("newProvider: %v", err)
+	}
+	return p
+}
+
+func TestReplayCommittedFixtures(t *testing.T) {
+	p := fixtureProvider(t, FixturesReplay, "../../testdata", "", "")
+
+	data, err := p.Current(context.Background(), "London")
+	if err != nil {
+		t.Fatalf("London: %v", err)
+	}
+	if data.City != "London" || data.Temp != 12 || data.Desc != "Partly cloudy" || data.Condition != ConditionClouds {
+		t.Errorf("London = %+v", data)
+	}
+	if data.Humidity == nil || *data.Humidity != 82 || data.WindSpeed == nil || *data.WindSpeed != 14 {
+		t.Errorf("London humidity and wind = %v, %v; want 82 and 14", data.Humidity, data.WindSpeed)
+	}
+	if data.ObservationTime == nil || !data.ObservationTime.Equal(time.Unix(1741363200, 0)) {
+		t.Errorf("London observed at %v, want the recorded epoch", data.ObservationTime)
+	}
+
+	// The quota error benches the only key, so it comes last
+	tests := []struct {
+		city string
+		want error
+	}{
+		{"Nowhereville", ErrCityNotFound},
+		{"Atlantis", errNoFixture},
+		{"Quota exceeded", ErrQuotaExceeded},
+	}
+	for _, tt := range tests {
+		if _, err := p.Current(context.Background(), tt.city); !errors.Is(err, tt.want) {
+			t.Errorf("%s: err = %v, want %v", tt.city, err, tt.want)
+		}
+	}
+}
+
+func TestReplayedFixturesThroughHandler(t *testing.T) {
+	srv, err := NewServer(fixtureProvider(t, FixturesReplay, "../../testdata", "", ""), DefaultConfig())
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	// The quota fixture benches the only key, so it goes last
+	for _, tt := range []struct {
+		city string
+		want int
+	}{
+		{"London", http.StatusOK},
+		{"Nowhereville", http.StatusNotFound},
+		{"Quota exceeded", http.StatusServiceUnavailable},
+	} {
+		resp, err := http.Get(ts.URL + "/weather?city=" + url.QueryEscape(tt.city))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.city, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.city, resp.StatusCode, tt.want)
+		}
+	}
+}
+
+func TestRecordFixtures(t *testing.T) {
+	london, err := os.ReadFile("../../testdata/london.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("query") != "London" {
+			http.Error(w, "down for maintenance", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write(london)
+	}))
+	defer upstream.Close()
+	dir := t.TempDir()
+	p := fixtureProvider(t, FixturesRecord, dir, upstream.URL, "record-key")
+
+	if _, err := p.Current(context.Background(), "London"); err != nil {
+		t.Fatalf("London: %v", err)
+	}
+	recorded, err := os.ReadFile(filepath.Join(dir, "london.json"))
+	if err != nil || string(recorded) != string(london) {
+		t.Errorf("recorded %q, %v; want the upstream body", recorded, err)
+	}
+
+	// Failures are passed on but not recorded, since replay could not
+	// reproduce their status
+	if _, err := p.Current(context.Background(), "Paris"); err == nil {
+		t.Error("Paris: want the upstream failure")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "paris.json")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Paris recorded: %v", err)
+	}
+}
+
+func TestFixtureName(t *testing.T) {
+	for city, want := range map[string]string{
+		"London":         "london",
+		" New  York ":    "new-york",
+		"St. John's":     "st--john-s",
+		"São Paulo":      "são-paulo",
+		"../etc/passwd":  "---etc-passwd",
+		"Quota exceeded": "quota-exceeded",
+	} {
+		if got := fixtureName(city); got != want {
+			t.Errorf("fixtureName(%q) = %q, want %q", city, got, want)
+		}
+	}
+}
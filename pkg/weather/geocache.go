@@ -0,0 +1,98 @@
+package weather
+
+import (
+	"container/list"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type geoEntry struct {
+	input    string // normalized raw input
+	location Location
+	expires  time.Time
+}
+
+// Where raw user input ("nyc", "New York ") was last resolved to, so the
+// weather cache can key on the provider's canonical name. Geography does
+// not change, so entries live far longer than weather readings.
+type geoCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	maxSize int
+	entries map[string]*list.Element
+	order   *list.List
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+func newGeoCache(maxSize int, ttl time.Duration) *geoCache {
+	return &geoCache{ttl: ttl, maxSize: maxSize, entries: make(map[string]*list.Element), order: list.New()}
+}
+
+func (g *geoCache) get(input string) (Location, bool) {
+	input = normalizeCity(input)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	elem, ok := g.entries[input]
+	if !ok {
+		g.misses.Add(1)
+		return Location{}, false
+	}
+	entry := elem.Value.(*geoEntry)
+	if time.Now().After(entry.expires) {
+		g.order.Remove(elem)
+		delete(g.entries, input)
+		g.misses.Add(1)
+		return Location{}, false
+	}
+	g.order.MoveToFront(elem)
+	g.hits.Add(1)
+	return entry.location, true
+}
+
+func (g *geoCache) put(input string, loc Location) {
+	input = normalizeCity(input)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if elem, ok := g.entries[input]; ok {
+		g.order.Remove(elem)
+	}
+	if g.order.Len() >= g.maxSize {
+		oldest := g.order.Back()
+		g.order.Remove(oldest)
+		delete(g.entries, oldest.Value.(*geoEntry).input)
+	}
+	g.entries[input] = g.order.PushFront(&geoEntry{input: input, location: loc, expires: time.Now().Add(g.ttl)})
+}
+
+func (g *geoCache) len() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.order.Len()
+}
+
+// Weather cache key for what the user typed: the canonical name once the
+// input has been resolved before, the input itself until then
+func (s *Server) resolveCity(city string) string {
+	if loc, ok := s.geo.get(city); ok {
+		return loc.Name
+	}
+	return city
+}
+
+// Remember where city resolved to, under both the raw input and the
+// canonical name. A reading fetched under the raw input moves to the
+// canonical key so later spellings share it.
+func (s *Server) learnLocation(city, key, lang string, data CityWeatherData) {
+	loc := data.Location
+	if loc == nil || loc.Name == "" || key != city {
+		return
+	}
+	s.geo.put(city, *loc)
+	s.geo.put(loc.Name, *loc)
+	if loc.Name != city {
+		s.cache.move(languageCacheKey(city, lang), languageCacheKey(loc.Name, lang))
+	}
+}
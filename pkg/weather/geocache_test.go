@@ -0,0 +1,98 @@
+package weather
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// A provider resolving every spelling of New York to the one place
+type nycProvider struct{ calls int }
+
+func (p *nycProvider) Timeout() time.Duration { return 0 }
+
+func (p *nycProvider) Current(ctx context.Context, city string) (CityWeatherData, error) {
+	p.calls++
+	loc := &Location{Name: "New York", Country: "United States of America", Lat: 40.714, Lon: -74.006}
+	return CityWeatherData{City: loc.Name, Temp: 18, Desc: "Sunny", Location: loc, CacheTime: time.Now()}, nil
+}
+
+func TestRawInputsShareOneWeatherEntry(t *testing.T) {
+	upstream := &nycProvider{}
+	srv, err := NewServer(upstream, DefaultConfig())
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	for _, input := range []string{"nyc", "New York", " NYC ", "new york"} {
+		resp, err := http.Get(ts.URL + "/weather?city=" + url.QueryEscape(input))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var data CityWeatherData
+		json.NewDecoder(resp.Body).Decode(&data)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || data.City != "New York" {
+			t.Errorf("%q: status %d, city %q, want New York", input, resp.StatusCode, data.City)
+		}
+	}
+	if upstream.calls != 1 {
+		t.Errorf("upstream called %d times, want 1", upstream.calls)
+	}
+	if n := srv.cache.entries.Len(); n != 1 {
+		t.Errorf("weather cache holds %d entries, want 1", n)
+	}
+	if _, ok := srv.cache.getCachedWeatherData("New York"); !ok {
+		t.Error("reading not kept under the canonical name")
+	}
+	if _, ok := srv.cache.getCachedWeatherData("nyc"); ok {
+		t.Error("reading still kept under the raw input")
+	}
+
+	// Both caches show up in the stats, each with its own numbers
+	resp, err := http.Get(ts.URL + "/cache/stats")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var stats struct {
+		Size      int `json:"size"`
+		Geocoding struct {
+			Size int    `json:"size"`
+			Hits uint64 `json:"hits"`
+		} `json:"geocoding"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&stats); err != nil {
+		t.Fatal(err)
+	}
+	if stats.Size != 1 || stats.Geocoding.Size != 2 || stats.Geocoding.Hits != 3 {
+		t.Errorf("stats = %+v, want 1 reading and 2 resolved inputs hit 3 times", stats)
+	}
+}
+
+func TestGeoCacheExpiresAndEvicts(t *testing.T) {
+	g := newGeoCache(2, time.Hour)
+	for _, name := range []string{"Paris", "Rome", "Oslo"} {
+		g.put(strings.ToLower(name), Location{Name: name})
+	}
+	if _, ok := g.get("paris"); ok {
+		t.Error("oldest entry kept past the size limit")
+	}
+	if loc, ok := g.get("ROME"); !ok || loc.Name != "Rome" {
+		t.Errorf("get(ROME) = %+v, %v", loc, ok)
+	}
+
+	short := newGeoCache(10, time.Millisecond)
+	short.put("nyc", Location{Name: "New York"})
+	time.Sleep(5 * time.Millisecond)
+	if _, ok := short.get("nyc"); ok || short.len() != 0 {
+		t.Error("expired entry still served")
+	}
+}
@@ -0,0 +1,91 @@
+package weather
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata/golden")
+
+// Fields that depend on when the test runs, kept as placeholders so the
+// golden files still show they are present
+var volatileFields = []string{"cache_time", "local_time", "observation_age_seconds"}
+
+// Compare data as served with testdata/golden/name.json
+func checkGolden(t *testing.T, name string, data CityWeatherData) {
+	t.Helper()
+	b, err := json.Marshal(data)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(b, &fields); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	for _, f := range volatileFields {
+		if _, ok := fields[f]; ok {
+			fields[f] = "<" + f + ">"
+		}
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(fields); err != nil {
+		t.Fatalf("encoding: %v", err)
+	}
+	got := buf.Bytes()
+
+	path := filepath.Join("testdata", "golden", name+".json")
+	if *update {
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatalf("updating %s: %v", path, err)
+		}
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading %s (run with -update to create it): %v", path, err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s differs from the golden file:\ngot:\n%s\nwant:\n%s", name, got, want)
+	}
+}
+
+func TestGoldenResponses(t *testing.T) {
+	london, err := os.ReadFile("../../testdata/london.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("weatherstack", func(t *testing.T) {
+		data, err := weatherstackReplying(t, string(london)).Current(context.Background(), "London")
+		if err != nil {
+			t.Fatalf("Current: %v", err)
+		}
+		checkGolden(t, "weatherstack", data)
+	})
+
+	// Humidity, wind, pressure and feels-like missing upstream are left
+	// out rather than reported as zero
+	t.Run("weatherstack sparse", func(t *testing.T) {
+		body := `{"location": {"name": "London"}, "current": {"temperature": 12, "weather_descriptions": ["Partly cloudy"]}}`
+		data, err := weatherstackReplying(t, body).Current(context.Background(), "London")
+		if err != nil {
+			t.Fatalf("Current: %v", err)
+		}
+		checkGolden(t, "weatherstack-sparse", data)
+	})
+
+	t.Run("simulated", func(t *testing.T) {
+		sim := NewRandomSimulator(1)
+		now := time.Date(2026, 7, 1, 12, 0, 0, 0, time.UTC)
+		sim.now = func() time.Time { return now }
+		checkGolden(t, "simulated", sim.Simulate("London"))
+	})
+}
@@ -0,0 +1,68 @@
+package weather
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const defaultGreetingTemplate = "It's currently {{.Temp}}°{{.Units}} and {{.Desc}} in {{.City}}. Have a great day!"
+
+// Parse Config.GreetingTemplate, falling back to the default English
+// sentence when it is empty
+func parseGreetingTemplate(text string) (*template.Template, error) {
+	if text == "" {
+		text = defaultGreetingTemplate
+	}
+	tmpl, err := template.New("greeting").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	// Catch references to unknown fields at startup rather than per request
+	if err := tmpl.Execute(io.Discard, greetingFields{City: "London", Temp: 18, Desc: "Sunny", Units: "C"}); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// Fields available to GREETING_TEMPLATE
+type greetingFields struct {
+	City  string
+	Temp  float64
+	Desc  string
+	Units string
+}
+
+// The greeting for d in this server's template. It is composed as the
+// reading comes in, before it is cached; the template never changes while
+// the server runs, so the cached copy stays current.
+func (s *Server) greet(d CityWeatherData) string {
+	var sb strings.Builder
+	err := s.greeting.Execute(&sb, greetingFields{City: d.City, Temp: d.Temp, Desc: d.Desc, Units: "C"})
+	if err != nil {
+		slog.Error("Error rendering greeting", "city", d.City, "err", err)
+		return ""
+	}
+	return sb.String()
+}
+
+// Derive the observation age and local time when the data is serialized
+// so they stay current while cached
+func (d CityWeatherData) MarshalJSON() ([]byte, error) {
+	type plain CityWeatherData
+	out := struct {
+		plain
+		ObservationAgeSeconds *int64 `json:"observation_age_seconds,omitempty"`
+	}{plain: plain(d)}
+	if local := d.localTimeAt(time.Now()); local != "" {
+		out.LocalTime = local
+	}
+	if d.ObservationTime != nil {
+		age := int64(time.Since(*d.ObservationTime).Seconds())
+		out.ObservationAgeSeconds = &age
+	}
+	return json.Marshal(out)
+}
@@ -0,0 +1,39 @@
+package weather_test
+
+import (
+	"testing"
+
+	"github.com/deepakg86/weather-api-caching/pkg/weather"
+)
+
+func TestGreetingPerServer(t *testing.T) {
+	plain := newTestServer(t, londonProvider(), nil)
+	custom := newTestServer(t, londonProvider(), func(config *weather.Config) {
+		config.GreetingTemplate = "{{.City}}: {{.Temp}}°{{.Units}}"
+	})
+
+	// Served fresh and then from the cache, each in its own server's words
+	for i := 0; i < 2; i++ {
+		var got struct {
+			Greeting string `json:"greeting"`
+		}
+		getJSON(t, plain, "/weather?city=London", &got)
+		if want := "It's currently 11.5°C and Partly cloudy in London. Have a great day!"; got.Greeting != want {
+			t.Errorf("request %d: default greeting = %q, want %q", i+1, got.Greeting, want)
+		}
+		getJSON(t, custom, "/weather?city=London", &got)
+		if want := "London: 11.5°C"; got.Greeting != want {
+			t.Errorf("request %d: custom greeting = %q, want %q", i+1, got.Greeting, want)
+		}
+	}
+}
+
+func TestGreetingTemplateCheckedAtStartup(t *testing.T) {
+	for _, text := range []string{"{{.City", "{{.Humidity}}"} {
+		config := weather.DefaultConfig()
+		config.GreetingTemplate = text
+		if _, err := weather.NewServer(londonProvider(), config); err == nil {
+			t.Errorf("%q: NewServer succeeded", text)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package weather
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+type requestRecord struct {
+	Timestamp time.Time `json:"timestamp"`
+	City      string    `json:"city"`
+	Source    string    `json:"source"`
+	Temp      float64   `json:"temp"`
+	LatencyMs int64     `json:"latency_ms"`
+	RemoteIP  string    `json:"remote_ip"`
+}
+
+// Request log backed by SQLite; a nil store records nothing
+type historyStore struct {
+	db      *sql.DB
+	records chan requestRecord
+	done    chan struct{} // closed once the writer has drained records
+
+	mu     sync.RWMutex // held to queue a record, and exclusively to close
+	closed bool
+}
+
+// Open the SQLite database and start the single writer goroutine
+func openHistoryStore(path string) (*historyStore, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	// One connection, so a read waits for the writer instead of failing
+	// with SQLITE_BUSY
+	db.SetMaxOpenConns(1)
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS request_history (
+		id         INTEGER PRIMARY KEY AUTOINCREMENT,
+		timestamp  DATETIME NOT NULL,
+		city       TEXT NOT NULL,
+		source     TEXT NOT NULL,
+		temp       REAL NOT NULL,
+		latency_ms INTEGER NOT NULL,
+		remote_ip  TEXT NOT NULL
+	)`)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	h := &historyStore{db: db, records: make(chan requestRecord, 1000), done: make(chan struct{})}
+	go h.writer()
+	return h, nil
+}
+
+// Stop taking records, wait for the queued ones to be written and close
+// the database. Later records are dropped.
+func (h *historyStore) close() error {
+	if h == nil {
+		return nil
+	}
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		return nil
+	}
+	h.closed = true
+	close(h.records)
+	h.mu.Unlock()
+	<-h.done
+	return h.db.Close()
+}
+
+// Drain the record channel so only one goroutine ever writes to the database
+func (h *historyStore) writer() {
+	defer close(h.done)
+	for rec := range h.records {
+		_, err := h.db.Exec(
+			`INSERT INTO request_history (timestamp, city, source, temp, latency_ms, remote_ip) VALUES (?, ?, ?, ?, ?, ?)`,
+			rec.Timestamp, rec.City, rec.Source, rec.Temp, rec.LatencyMs, rec.RemoteIP,
+		)
+		if err != nil {
+			slog.Error("Error writing request history", "err", err)
+		}
+	}
+}
+
+func (h *historyStore) record(r *http.Request, data CityWeatherData, source string, start time.Time) {
+	if h == nil {
+		return
+	}
+
+	remoteIP, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		remoteIP = r.RemoteAddr
+	}
+	rec := requestRecord{
+		Timestamp: start,
+		City:      data.City,
+		Source:    source,
+		Temp:      data.Temp,
+		LatencyMs: time.Since(start).Milliseconds(),
+		RemoteIP:  remoteIP,
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if h.closed {
+		return
+	}
+	// Never block the request path; drop the record if the writer falls behind
+	select {
+	case h.records <- rec:
+	default:
+		slog.Warn("Request history queue full, dropping record", "city", rec.City)
+	}
+}
+
+func (s *Server) historyHandler(w http.ResponseWriter, r *http.Request) {
+	city := r.URL.Query().Get("city")
+	limit := 100
+	if l := r.URL.Query().Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n <= 0 {
+			writeProblem(w, http.StatusBadRequest, "", "Limit must be a positive integer", r.URL.Path)
+			return
+		}
+		limit = n
+	}
+
+	query := `SELECT timestamp, city, source, temp, latency_ms, remote_ip FROM request_history`
+	args := []interface{}{}
+	if city != "" {
+		query += ` WHERE city = ?`
+		args = append(args, city)
+	}
+	query += ` ORDER BY id DESC LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := s.history.db.Query(query, args...)
+	if err != nil {
+		writeProblem(w, http.StatusInternalServerError, "", fmt.Sprintf("Error reading history: %v", err), r.URL.Path)
+		return
+	}
+	defer rows.Close()
+
+	records := []requestRecord{}
+	for rows.Next() {
+		var rec requestRecord
+		if err := rows.Scan(&rec.Timestamp, &rec.City, &rec.Source, &rec.Temp, &rec.LatencyMs, &rec.RemoteIP); err != nil {
+			writeProblem(w, http.StatusInternalServerError, "", fmt.Sprintf("Error reading history: %v", err), r.URL.Path)
+			return
+		}
+		records = append(records, rec)
+	}
+	if err := rows.Err(); err != nil {
+		writeProblem(w, http.StatusInternalServerError, "", fmt.Sprintf("Error reading history: %v", err), r.URL.Path)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(records)
+}
@@ -0,0 +1,79 @@
+package weather
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHistoryStoreDrainsOnClose(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.db")
+	h, err := openHistoryStore(path)
+	if err != nil {
+		t.Fatalf("openHistoryStore: %v", err)
+	}
+	r := httptest.NewRequest(http.MethodGet, "/weather?city=London", nil)
+	for i := 0; i < 200; i++ {
+		h.record(r, CityWeatherData{City: "London", Temp: float64(i)}, "cache", time.Now())
+	}
+	if err := h.close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	// Records after closing are dropped, and closing again is harmless
+	h.record(r, CityWeatherData{City: "Paris"}, "cache", time.Now())
+	if err := h.close(); err != nil {
+		t.Errorf("second close: %v", err)
+	}
+
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var n int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM request_history`).Scan(&n); err != nil {
+		t.Fatalf("counting records: %v", err)
+	}
+	if n != 200 {
+		t.Errorf("%d records written, want all 200 queued before close", n)
+	}
+}
+
+func TestHistoryRoute(t *testing.T) {
+	config := DefaultConfig()
+	config.DBPath = filepath.Join(t.TempDir(), "history.db")
+	srv, err := NewServer(echoProvider{}, config)
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	defer srv.Close()
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	for _, city := range []string{"London", "Paris", "London"} {
+		getBody(t, ts, "/weather?city="+city, nil)
+	}
+	var records []requestRecord
+	for deadline := time.Now().Add(5 * time.Second); len(records) < 3 && time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		getBody(t, ts, "/history", &records)
+	}
+	if len(records) != 3 || records[0].City != "London" || records[1].City != "Paris" {
+		t.Fatalf("history = %+v, want all three requests, newest first", records)
+	}
+	if records[0].Source != "cache" || records[2].Source == "cache" {
+		t.Errorf("sources = %s, %s, want the repeat served from the cache", records[2].Source, records[0].Source)
+	}
+
+	getBody(t, ts, "/history?city=London&limit=1", &records)
+	if len(records) != 1 || records[0].City != "London" {
+		t.Errorf("London, limit 1 = %+v", records)
+	}
+	for _, limit := range []string{"0", "-1", "many"} {
+		if resp := getBody(t, ts, "/history?limit="+limit, nil); resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("limit %s: status %d, want 400", limit, resp.StatusCode)
+		}
+	}
+}
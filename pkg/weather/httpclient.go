@@ -0,0 +1,39 @@
+package weather
+
+import (
+	"net"
+	"net/http"
+	"time"
+)
+
+const (
+	defaultMaxIdleConns    = 10
+	defaultIdleConnTimeout = 90 * time.Second
+)
+
+// One client, and so one connection pool, shared by every upstream call;
+// keeping idle connections open skips the TCP and TLS handshake on reuse
+func newUpstreamClient(maxIdleConns int, idleConnTimeout time.Duration) *http.Client {
+	return &http.Client{
+		Transport: &timedTransport{next: &http.Transport{
+			Proxy: http.ProxyFromEnvironment,
+			DialContext: (&net.Dialer{
+				Timeout:   30 * time.Second,
+				KeepAlive: 30 * time.Second,
+			}).DialContext,
+			ForceAttemptHTTP2:   true,
+			MaxIdleConns:        maxIdleConns,
+			MaxIdleConnsPerHost: maxIdleConns,
+			IdleConnTimeout:     idleConnTimeout,
+			TLSHandshakeTimeout: 10 * time.Second,
+			DisableKeepAlives:   false,
+		}},
+	}
+}
+
+// Pool sizes from HTTP_MAX_IDLE_CONNS and HTTP_IDLE_CONN_TIMEOUT_SECONDS
+func upstreamClientFromEnv() *http.Client {
+	maxIdle := positiveEnv("HTTP_MAX_IDLE_CONNS", defaultMaxIdleConns)
+	timeout := positiveEnv("HTTP_IDLE_CONN_TIMEOUT_SECONDS", int(defaultIdleConnTimeout/time.Second))
+	return newUpstreamClient(maxIdle, time.Duration(timeout)*time.Second)
+}
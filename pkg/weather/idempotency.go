@@ -0,0 +1,126 @@
+package weather
+
+import (
+	"bytes"
+	"container/list"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const idempotencyMaxEntries = 1000
+
+type storedResponse struct {
+	key     string
+	status  int
+	header  http.Header
+	body    []byte
+	expires time.Time
+}
+
+// Responses recently sent for an Idempotency-Key, least recently used
+// first out
+type idempotencyStore struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]*list.Element
+	order   *list.List
+}
+
+func newIdempotencyStore(ttl time.Duration) *idempotencyStore {
+	return &idempotencyStore{ttl: ttl, entries: make(map[string]*list.Element), order: list.New()}
+}
+
+func (st *idempotencyStore) get(key string) (*storedResponse, bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	elem, ok := st.entries[key]
+	if !ok {
+		return nil, false
+	}
+	resp := elem.Value.(*storedResponse)
+	if time.Now().After(resp.expires) {
+		st.order.Remove(elem)
+		delete(st.entries, key)
+		return nil, false
+	}
+	st.order.MoveToFront(elem)
+	return resp, true
+}
+
+func (st *idempotencyStore) put(resp *storedResponse) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if elem, ok := st.entries[resp.key]; ok {
+		st.order.Remove(elem)
+	}
+	if st.order.Len() >= idempotencyMaxEntries {
+		oldest := st.order.Back()
+		st.order.Remove(oldest)
+		delete(st.entries, oldest.Value.(*storedResponse).key)
+	}
+	resp.expires = time.Now().Add(st.ttl)
+	st.entries[resp.key] = st.order.PushFront(resp)
+}
+
+// Passes the response through while keeping a copy of it
+type captureWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (cw *captureWriter) WriteHeader(status int) {
+	if cw.status == 0 {
+		cw.status = status
+	}
+	cw.ResponseWriter.WriteHeader(status)
+}
+
+func (cw *captureWriter) Write(b []byte) (int, error) {
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+	cw.body.Write(b)
+	return cw.ResponseWriter.Write(b)
+}
+
+// Replay the stored response when a request repeats an Idempotency-Key
+// seen within the TTL, instead of handling it again
+func (s *Server) idempotent(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		if key == "" {
+			next(w, r)
+			return
+		}
+		// Keys are scoped to the method and path they were first used with
+		key = r.Method + " " + r.URL.Path + " " + key
+
+		if resp, ok := s.idempotency.get(key); ok {
+			for k, v := range resp.header {
+				// This request keeps its own ID
+				if k != "X-Request-Id" {
+					w.Header()[k] = v
+				}
+			}
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(resp.status)
+			w.Write(resp.body)
+			return
+		}
+
+		cw := &captureWriter{ResponseWriter: w}
+		next(cw, r)
+		// Server errors are not kept, so a retry gets a real second attempt
+		if cw.status == 0 || cw.status >= 500 {
+			return
+		}
+		s.idempotency.put(&storedResponse{
+			key:    key,
+			status: cw.status,
+			header: w.Header().Clone(),
+			body:   cw.body.Bytes(),
+		})
+	}
+}
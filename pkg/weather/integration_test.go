@@ -0,0 +1,326 @@
+package weather_test
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/deepakg86/weather-api-caching/pkg/weather"
+	"github.com/deepakg86/weather-api-caching/pkg/weather/testutil"
+)
+
+// A provider holding every fetch until release is closed, tracking how
+// many are in flight at once
+type gatedProvider struct {
+	started chan string
+	release chan struct{}
+
+	inFlight    atomic.Int32
+	maxInFlight atomic.Int32
+}
+
+func newGatedProvider() *gatedProvider {
+	return &gatedProvider{started: make(chan string, 1000), release: make(chan struct{})}
+}
+
+func (p *gatedProvider) Timeout() time.Duration { return 0 }
+
+func (p *gatedProvider) Current(ctx context.Context, city string) (weather.CityWeatherData, error) {
+	n := p.inFlight.Add(1)
+	defer p.inFlight.Add(-1)
+	for {
+		max := p.maxInFlight.Load()
+		if n <= max || p.maxInFlight.CompareAndSwap(max, n) {
+			break
+		}
+	}
+	p.started <- city
+	select {
+	case <-p.release:
+	case <-ctx.Done():
+		return weather.CityWeatherData{}, ctx.Err()
+	}
+	return weather.CityWeatherData{City: city, Temp: 12, Desc: "Cloudy", CacheTime: time.Now()}, nil
+}
+
+type step struct {
+	method string
+	path   string
+	body   interface{}
+	admin  bool          // send the admin token
+	after  time.Duration // wait this long first
+	want   int
+}
+
+func TestRequestCycle(t *testing.T) {
+	get := func(path string, want int) step { return step{method: http.MethodGet, path: path, want: want} }
+	resize := func(admin bool, want int) step {
+		return step{method: http.MethodPatch, path: "/cache/config", body: map[string]int{"max_size": 10}, admin: admin, want: want}
+	}
+	tests := []struct {
+		name      string
+		configure func(*weather.Config)
+		steps     []step
+		wantCalls map[string]int
+	}{
+		{
+			name:      "cache miss then hit",
+			steps:     []step{get("/weather?city=London", 200), get("/weather?city=London", 200), get("/v1/weather?city=London", 200)},
+			wantCalls: map[string]int{"London": 1},
+		},
+		{
+			name:      "expired entry is refetched",
+			configure: func(c *weather.Config) { c.CacheTTL = 50 * time.Millisecond },
+			steps: []step{
+				get("/weather?city=London", 200),
+				{method: http.MethodGet, path: "/weather?city=London", after: 100 * time.Millisecond, want: 200},
+			},
+			wantCalls: map[string]int{"London": 2},
+		},
+		{
+			name:      "least recently used entry is evicted",
+			configure: func(c *weather.Config) { c.CacheSize = 2; c.CacheShards = 1 },
+			steps: []step{
+				get("/weather?city=London", 200), get("/weather?city=Paris", 200),
+				get("/weather?city=London", 200), // London is now the most recent
+				get("/weather?city=Tokyo", 200),  // evicts Paris
+				get("/weather?city=London", 200), get("/weather?city=Paris", 200),
+			},
+			wantCalls: map[string]int{"London": 1, "Paris": 2, "Tokyo": 1},
+		},
+		{
+			name: "invalid city never reaches the provider",
+			steps: []step{
+				get("/weather", 400), get("/weather?city=%20", 400),
+				get("/weather?city=Lon%00don", 400), get("/weather?city=DROP%20TABLE%3B", 400),
+			},
+			wantCalls: map[string]int{"London": 0},
+		},
+		{
+			name:      "unknown city",
+			steps:     []step{get("/weather?city=Atlantis", 404), get("/weather?city=Atlantis", 404)},
+			wantCalls: map[string]int{"Atlantis": 2},
+		},
+		{
+			name:      "admin endpoint with the token",
+			configure: withAdmin,
+			steps:     []step{resize(true, 200)},
+		},
+		{
+			name:      "admin endpoint without the token",
+			configure: withAdmin,
+			steps:     []step{resize(false, 401), {method: http.MethodGet, path: "/debug/cache", want: 401}},
+		},
+		{
+			name:  "admin endpoint without ADMIN_TOKEN",
+			steps: []step{resize(true, 404)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := testutil.NewMockWeatherProvider(map[string]weather.CityWeatherData{
+				"London": {Temp: 11.5, Desc: "Partly cloudy"},
+				"Paris":  {Temp: 18, Desc: "Sunny"},
+				"Tokyo":  {Temp: 22, Desc: "Clear"},
+			}, nil)
+			configure := tt.configure
+			if configure == nil {
+				configure = func(*weather.Config) {}
+			}
+			ts := newTestServer(t, mock, func(c *weather.Config) {
+				c.StaleThreshold = 1 // no refresh ahead, so fetches are only misses
+				configure(c)
+			})
+			for i, s := range tt.steps {
+				time.Sleep(s.after)
+				var resp *http.Response
+				if s.admin {
+					resp = adminJSON(t, ts, s.method, s.path, s.body, nil)
+				} else {
+					req, _ := http.NewRequest(s.method, ts.URL+s.path, nil)
+					var err error
+					if resp, err = http.DefaultClient.Do(req); err != nil {
+						t.Fatalf("step %d: %v", i+1, err)
+					}
+					resp.Body.Close()
+				}
+				if resp.StatusCode != s.want {
+					t.Errorf("step %d, %s %s: status %d, want %d", i+1, s.method, s.path, resp.StatusCode, s.want)
+				}
+			}
+			for city, want := range tt.wantCalls {
+				if got := mock.Calls(city); got != want {
+					t.Errorf("%s fetched %d times, want %d", city, got, want)
+				}
+			}
+		})
+	}
+}
+
+// A region request fans out over every city in it, through the cache
+func TestRegionRequestFetchesEachCityOnce(t *testing.T) {
+	mock := testutil.NewMockWeatherProvider(map[string]weather.CityWeatherData{
+		"London": {Temp: 11.5}, "Paris": {Temp: 18}, "Rome": {Temp: 21},
+	}, nil)
+	ts := newTestServer(t, mock, nil)
+
+	for i := 0; i < 2; i++ {
+		var body regionBody
+		if resp := getJSON(t, ts, "/weather/region?name=Europe", &body); resp.StatusCode != http.StatusOK {
+			t.Fatalf("request %d: status %d", i+1, resp.StatusCode)
+		}
+		if len(body.Cities) != 3 || len(body.Errors) != 10 {
+			t.Errorf("request %d: %d cities and %d errors, want 3 and 10", i+1, len(body.Cities), len(body.Errors))
+		}
+	}
+	// The second request is served from the cache
+	for _, city := range []string{"London", "Paris", "Rome"} {
+		if calls := mock.Calls(city); calls != 1 {
+			t.Errorf("%s fetched %d times, want 1", city, calls)
+		}
+	}
+}
+
+// Simulated weather from the same seed is the same, request for request
+func TestSimulatedRequestsAreReproducible(t *testing.T) {
+	type reading struct {
+		Temp     float64 `json:"temp"`
+		Humidity float64 `json:"humidity"`
+		Wind     float64 `json:"wind_speed"`
+		Pressure float64 `json:"pressure"`
+	}
+	// Each city is a miss, so each request draws from the generator in turn
+	run := func(seed int64) []reading {
+		ts := newTestServer(t, weather.NewSimulatedProvider(seed), nil)
+		var readings []reading
+		for _, city := range []string{"Oslo", "Cairo", "Lima", "Perth"} {
+			var r reading
+			getJSON(t, ts, "/weather?city="+city, &r)
+			readings = append(readings, r)
+		}
+		return readings
+	}
+	first, second, other := run(7), run(7), run(8)
+	same := func(a, b []reading) bool {
+		for i := range a {
+			// The temperature follows the clock too, which moves on a little
+			// between runs
+			if math.Abs(a[i].Temp-b[i].Temp) > 0.05 || a[i].Humidity != b[i].Humidity ||
+				a[i].Wind != b[i].Wind || a[i].Pressure != b[i].Pressure {
+				return false
+			}
+		}
+		return true
+	}
+	if !same(first, second) {
+		t.Errorf("seed 7 gave %+v, then %+v", first, second)
+	}
+	if same(first, other) {
+		t.Errorf("seeds 7 and 8 both gave %+v", first)
+	}
+}
+
+func TestConcurrencyLimitRejectsExcess(t *testing.T) {
+	gate := newGatedProvider()
+	ts := newTestServer(t, gate, func(c *weather.Config) { c.MaxConcurrentRequests = 1 })
+
+	done := make(chan int)
+	go func() {
+		resp := getJSON(t, ts, "/weather?city=London", nil)
+		done <- resp.StatusCode
+	}()
+	<-gate.started
+	resp := getJSON(t, ts, "/weather?city=Paris", nil)
+	if resp.StatusCode != http.StatusServiceUnavailable || resp.Header.Get("Retry-After") != "1" {
+		t.Errorf("second request: status %d, Retry-After %q, want 503 and 1", resp.StatusCode, resp.Header.Get("Retry-After"))
+	}
+	close(gate.release)
+	if status := <-done; status != http.StatusOK {
+		t.Errorf("first request: status %d, want 200", status)
+	}
+}
+
+func TestConcurrencyLimitCapsUpstreamCalls(t *testing.T) {
+	gate := newGatedProvider()
+	ts := newTestServer(t, gate, nil) // the default limit of 50
+
+	names, _ := towns(100)
+	statuses := make(chan *http.Response, len(names))
+	for _, name := range names {
+		go func(name string) {
+			statuses <- getJSON(t, ts, "/weather?city="+url.QueryEscape(name), nil)
+		}(name)
+	}
+	// Let the fetches pile up before any finishes
+	for i := 0; i < 50; i++ {
+		select {
+		case <-gate.started:
+		case <-time.After(5 * time.Second):
+			close(gate.release)
+			t.Fatalf("only %d fetches started", i)
+		}
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(gate.release)
+
+	counts := make(map[int]int)
+	for i := 0; i < 100; i++ {
+		resp := <-statuses
+		counts[resp.StatusCode]++
+		if resp.StatusCode == http.StatusServiceUnavailable && resp.Header.Get("Retry-After") != "1" {
+			t.Errorf("503 with Retry-After %q, want 1", resp.Header.Get("Retry-After"))
+		}
+	}
+	if max := gate.maxInFlight.Load(); max != 50 {
+		t.Errorf("%d upstream calls in flight at once, want 50", max)
+	}
+	if counts[http.StatusOK] < 50 || counts[http.StatusOK]+counts[http.StatusServiceUnavailable] != 100 {
+		t.Errorf("statuses = %v, want at least 50 OK and the rest 503", counts)
+	}
+}
+
+func TestGracefulShutdownFinishesInFlight(t *testing.T) {
+	gate := newGatedProvider()
+	ts := newTestServer(t, gate, nil)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	status := 0
+	go func() {
+		defer wg.Done()
+		resp, err := http.Get(ts.URL + "/weather?city=London")
+		if err != nil {
+			t.Errorf("in-flight request: %v", err)
+			return
+		}
+		resp.Body.Close()
+		status = resp.StatusCode
+	}()
+	<-gate.started
+
+	shutdown := make(chan error)
+	go func() { shutdown <- ts.Config.Shutdown(context.Background()) }()
+	// Shutdown waits for the request rather than cutting it off
+	select {
+	case err := <-shutdown:
+		t.Fatalf("Shutdown returned %v with a request in flight", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(gate.release)
+	wg.Wait()
+	if status != http.StatusOK {
+		t.Errorf("in-flight request: status %d, want 200", status)
+	}
+	if err := <-shutdown; err != nil {
+		t.Errorf("Shutdown: %v", err)
+	}
+	if resp, err := http.Get(ts.URL + "/weather?city=Paris"); err == nil {
+		resp.Body.Close()
+		t.Error("new request served after shutdown")
+	}
+}
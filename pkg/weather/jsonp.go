@@ -0,0 +1,75 @@
+package weather
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Restricts callbacks to plain identifiers so they cannot inject script
+var jsonpCallbackPattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_.]*$`)
+
+// Buffers a handler's response so it can be wrapped in a callback
+type jsonpWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (jw *jsonpWriter) Header() http.Header { return jw.header }
+
+func (jw *jsonpWriter) WriteHeader(status int) {
+	if jw.status == 0 {
+		jw.status = status
+	}
+}
+
+func (jw *jsonpWriter) Write(b []byte) (int, error) {
+	if jw.status == 0 {
+		jw.status = http.StatusOK
+	}
+	return jw.body.Write(b)
+}
+
+// Wrap JSON responses as callback(...); for GET requests with a callback
+// parameter. A no-op unless ENABLE_JSONP is set.
+func (s *Server) jsonp(next http.HandlerFunc) http.HandlerFunc {
+	if !s.config.Features.EnableJSONP {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		callback := r.URL.Query().Get("callback")
+		if callback == "" || r.Method != http.MethodGet {
+			next(w, r)
+			return
+		}
+		if !jsonpCallbackPattern.MatchString(callback) {
+			writeProblem(w, http.StatusBadRequest, "", "Invalid callback name", r.URL.Path)
+			return
+		}
+
+		jw := &jsonpWriter{header: make(http.Header)}
+		next(jw, r)
+		if jw.status == 0 {
+			jw.status = http.StatusOK
+		}
+		for k, v := range jw.header {
+			w.Header()[k] = v
+		}
+
+		// Problem details and other non-JSON bodies pass through unwrapped
+		if !strings.HasPrefix(jw.header.Get("Content-Type"), "application/json") {
+			w.WriteHeader(jw.status)
+			w.Write(jw.body.Bytes())
+			return
+		}
+		payload := fmt.Sprintf("%s(%s);", callback, bytes.TrimSpace(jw.body.Bytes()))
+		w.Header().Set("Content-Type", "application/javascript")
+		w.Header().Set("Content-Length", strconv.Itoa(len(payload)))
+		w.WriteHeader(jw.status)
+		w.Write([]byte(payload))
+	}
+}
@@ -0,0 +1,178 @@
+package weather
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Returned when every configured API key is cooling down after a quota,
+// auth or rate-limit failure
+var errAllKeysExhausted = errors.New("all API keys exhausted")
+
+const (
+	defaultKeyCooldown     = time.Hour
+	defaultRateLimitPeriod = time.Minute
+)
+
+// Weatherstack keys used in turn, so each key's rate limit takes an equal
+// share of the traffic. A key that comes back over quota or invalid is
+// benched for the cooldown, one that is rate limited (HTTP 429) for the
+// shorter rateLimitCooldown, and the rotation skips it meanwhile. Keys are
+// only ever referred to by index so they never reach a log.
+type keyPool struct {
+	now  func() time.Time
+	next atomic.Uint64 // round-robin position
+
+	mu sync.Mutex
+	// Replaced together by a reload
+	keys              []string
+	cooldown          time.Duration
+	rateLimitCooldown time.Duration
+	deadUntil         []time.Time
+
+	active      int
+	lastCause   error // why the most recent key was benched
+	warnedEmpty bool  // all-benched warning logged for this outage
+}
+
+func newKeyPool(keys []string, cooldown time.Duration) *keyPool {
+	return &keyPool{
+		keys:              keys,
+		cooldown:          cooldown,
+		rateLimitCooldown: defaultRateLimitPeriod,
+		now:               time.Now,
+		deadUntil:         make([]time.Time, len(keys)),
+	}
+}
+
+// Keys from WEATHERSTACK_API_KEYS (comma-separated), falling back to the
+// single WEATHERSTACK_API_KEY, benched for WEATHERSTACK_KEY_COOLDOWN, or
+// for KEY_COOLDOWN_SECONDS when rate limited. Calls go through client.
+func weatherstackKeysFromEnv(client *http.Client) (*keyPool, error) {
+	var keys []string
+	for _, k := range strings.Split(os.Getenv("WEATHERSTACK_API_KEYS"), ",") {
+		if k = strings.TrimSpace(k); k != "" {
+			keys = append(keys, k)
+		}
+	}
+	if len(keys) == 0 {
+		if k := upstreamAPIKey("WEATHERSTACK_API_KEY", client); k != "" {
+			keys = []string{k}
+		}
+	}
+	cooldown := defaultKeyCooldown
+	if v := os.Getenv("WEATHERSTACK_KEY_COOLDOWN"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid WEATHERSTACK_KEY_COOLDOWN %q: must be a positive duration like 1h", v)
+		}
+		cooldown = d
+	}
+	pool := newKeyPool(keys, cooldown)
+	if v := os.Getenv("KEY_COOLDOWN_SECONDS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid KEY_COOLDOWN_SECONDS %q: must be a positive integer", v)
+		}
+		pool.rateLimitCooldown = time.Duration(n) * time.Second
+	}
+	return pool, nil
+}
+
+// The next key in the rotation that is not cooling down
+func (p *keyPool) current() (int, string, error) {
+	if p == nil {
+		return 0, "", fmt.Errorf("%w: set WEATHERSTACK_API_KEY or WEATHERSTACK_API_KEYS", ErrMissingAPIKey)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.keys) == 0 {
+		return 0, "", fmt.Errorf("%w: set WEATHERSTACK_API_KEY or WEATHERSTACK_API_KEYS", ErrMissingAPIKey)
+	}
+	start := int((p.next.Add(1) - 1) % uint64(len(p.keys)))
+	now := p.now()
+	for i := range p.keys {
+		idx := (start + i) % len(p.keys)
+		if !now.Before(p.deadUntil[idx]) {
+			p.active = idx
+			p.warnedEmpty = false
+			return idx, p.keys[idx], nil
+		}
+	}
+	if !p.warnedEmpty {
+		slog.Warn("All Weatherstack API keys are cooling down", "keys", len(p.keys))
+		p.warnedEmpty = true
+	}
+	if p.lastCause != nil {
+		return 0, "", fmt.Errorf("%w (last: %w)", errAllKeysExhausted, p.lastCause)
+	}
+	return 0, "", errAllKeysExhausted
+}
+
+// Bench a key after a quota or auth error, or briefly after a rate limit
+func (p *keyPool) markDead(idx int, key string, cause error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if idx >= len(p.keys) || p.keys[idx] != key {
+		return // replaced by a reload meanwhile
+	}
+	cooldown := p.cooldown
+	if isRateLimited(cause) {
+		cooldown = p.rateLimitCooldown
+	}
+	p.deadUntil[idx] = p.now().Add(cooldown)
+	p.lastCause = cause
+	slog.Warn("Weatherstack API key benched", "key_index", idx, "cooldown", cooldown.String(), "err", cause)
+}
+
+// Take over the keys and cooldowns of a freshly loaded pool. Keys kept
+// across the reload stay benched; new ones start out usable.
+func (p *keyPool) replace(from *keyPool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	benched := make(map[string]time.Time, len(p.keys))
+	for i, k := range p.keys {
+		benched[k] = p.deadUntil[i]
+	}
+	p.keys = from.keys
+	p.cooldown, p.rateLimitCooldown = from.cooldown, from.rateLimitCooldown
+	p.deadUntil = make([]time.Time, len(p.keys))
+	for i, k := range p.keys {
+		p.deadUntil[i] = benched[k]
+	}
+	p.active, p.warnedEmpty = 0, false
+}
+
+// Whether err is an HTTP 429 from the upstream
+func isRateLimited(err error) bool {
+	var se *StatusError
+	return errors.As(err, &se) && se.Code == http.StatusTooManyRequests
+}
+
+// Index of the key most recently handed out
+func (p *keyPool) activeIndex() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.active
+}
+
+// Time until the first benched key may be tried again
+func (p *keyPool) retryAfter() time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var soonest time.Duration
+	for i, until := range p.deadUntil {
+		if d := until.Sub(p.now()); i == 0 || d < soonest {
+			soonest = d
+		}
+	}
+	return max(soonest, 0)
+}
@@ -0,0 +1,98 @@
+package weather
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const quotaBody = `{"success": false, "error": {"code": 104, "type": "usage_limit_reached", "info": "Your monthly API request volume has been reached."}}`
+
+// An upstream over quota for the keys in over, answering the rest; it
+// counts the calls made with each key
+type scriptedUpstream struct {
+	mu    sync.Mutex
+	over  map[string]bool
+	calls map[string]int
+}
+
+func (u *scriptedUpstream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key := r.URL.Query().Get("access_key")
+	u.mu.Lock()
+	u.calls[key]++
+	over := u.over[key]
+	u.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	if over {
+		w.Write([]byte(quotaBody))
+		return
+	}
+	w.Write([]byte(`{"location": {"name": "London"}, "current": {"temperature": 12, "weather_descriptions": ["Sunny"]}}`))
+}
+
+func (u *scriptedUpstream) set(key string, over bool) {
+	u.mu.Lock()
+	u.over[key] = over
+	u.mu.Unlock()
+}
+
+// Capture the default logger's output for the rest of the test
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buf, nil)))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+	return &buf
+}
+
+func TestKeyRotationOnQuota(t *testing.T) {
+	logs := captureLogs(t)
+	upstream := &scriptedUpstream{over: map[string]bool{"first-key": true}, calls: make(map[string]int)}
+	p := weatherstackWith(t, upstream.ServeHTTP)
+	p.keys = newKeyPool([]string{"first-key", "second-key"}, time.Hour)
+	now := time.Now()
+	p.keys.now = func() time.Time { return now }
+
+	for i := 0; i < 4; i++ {
+		if _, err := p.Current(context.Background(), "London"); err != nil {
+			t.Fatalf("call %d: %v", i+1, err)
+		}
+	}
+	// The first key is tried once, benched, and skipped from then on
+	if upstream.calls["first-key"] != 1 || upstream.calls["second-key"] != 4 {
+		t.Errorf("calls = %v, want the first key once and the second every time", upstream.calls)
+	}
+	if idx := p.keys.activeIndex(); idx != 1 {
+		t.Errorf("active key index = %d, want 1", idx)
+	}
+
+	// Only when every key is over quota does the fetch fail
+	upstream.set("second-key", true)
+	_, err := p.Current(context.Background(), "London")
+	if !errors.Is(err, errAllKeysExhausted) || !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("err = %v, want all keys exhausted by quota", err)
+	}
+	for _, key := range []string{"first-key", "second-key"} {
+		if strings.Contains(err.Error(), key) || strings.Contains(logs.String(), key) {
+			t.Errorf("key %q leaked into the error or logs", key)
+		}
+	}
+
+	// After the cooldown a recovered key is used again
+	upstream.set("first-key", false)
+	now = now.Add(time.Hour)
+	data, err := p.Current(context.Background(), "London")
+	if err != nil || data.City != "London" {
+		t.Fatalf("after cooldown: %+v, %v", data, err)
+	}
+	if idx := p.keys.activeIndex(); idx != 0 {
+		t.Errorf("active key index = %d, want 0", idx)
+	}
+}
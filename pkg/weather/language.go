@@ -0,0 +1,60 @@
+package weather
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+const defaultLanguage = "en"
+
+// ISO 639-1 codes accepted by ?lang=, all of which Weatherstack and
+// OpenWeatherMap can localize descriptions into
+var supportedLanguages = []string{"en", "de", "es", "fr", "it", "nl", "pt"}
+
+// Lowercased code for a lang parameter; empty means English
+func parseLanguage(lang string) (string, error) {
+	if lang == "" {
+		return defaultLanguage, nil
+	}
+	lang = strings.ToLower(lang)
+	for _, l := range supportedLanguages {
+		if l == lang {
+			return lang, nil
+		}
+	}
+	return "", fmt.Errorf("unsupported lang %q (want one of %s)", lang, strings.Join(supportedLanguages, ", "))
+}
+
+// Descriptions in other languages lack the English keywords the activity
+// rules look for, so lean on the precipitation type instead
+func activityDesc(desc, precipType, lang string) string {
+	if lang == defaultLanguage {
+		return desc
+	}
+	return precipType
+}
+
+type languageKey struct{}
+
+// Ask providers to describe the weather in lang
+func withLanguage(ctx context.Context, lang string) context.Context {
+	return context.WithValue(ctx, languageKey{}, lang)
+}
+
+// Language the caller asked for, English by default
+func languageFrom(ctx context.Context) string {
+	if lang, ok := ctx.Value(languageKey{}).(string); ok {
+		return lang
+	}
+	return defaultLanguage
+}
+
+// Cache key for a city in a language; English keeps the bare city so
+// existing entries and lookups by city are unaffected
+func languageCacheKey(city, lang string) string {
+	if lang == defaultLanguage {
+		return city
+	}
+	return city + "|" + lang
+}
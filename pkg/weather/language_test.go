@@ -0,0 +1,132 @@
+package weather
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+// A provider describing the weather in whatever language it is asked for
+type languageProvider struct {
+	mu    sync.Mutex
+	calls map[string]int
+}
+
+func (p *languageProvider) Timeout() time.Duration { return 0 }
+
+func (p *languageProvider) Current(ctx context.Context, city string) (CityWeatherData, error) {
+	lang := languageFrom(ctx)
+	p.mu.Lock()
+	p.calls[lang]++
+	p.mu.Unlock()
+	return CityWeatherData{City: city, Temp: 15, Desc: "desc-" + lang, CacheTime: time.Now()}, nil
+}
+
+func TestLanguageCachedSeparately(t *testing.T) {
+	upstream := &languageProvider{calls: make(map[string]int)}
+	srv, err := NewServer(upstream, DefaultConfig())
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	tests := []struct {
+		query, wantDesc string
+	}{
+		{"", "desc-en"},
+		{"&lang=fr", "desc-fr"},
+		{"&lang=FR", "desc-fr"},
+		{"&lang=en", "desc-en"},
+		{"", "desc-en"},
+		{"&lang=de", "desc-de"},
+	}
+	for _, tt := range tests {
+		resp, err := http.Get(ts.URL + "/weather?city=London" + tt.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var data CityWeatherData
+		json.NewDecoder(resp.Body).Decode(&data)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || data.Desc != tt.wantDesc {
+			t.Errorf("%q: status %d, desc %q, want %q", tt.query, resp.StatusCode, data.Desc, tt.wantDesc)
+		}
+	}
+	// One fetch per language, each kept under its own key
+	for _, lang := range []string{"en", "fr", "de"} {
+		if upstream.calls[lang] != 1 {
+			t.Errorf("%s fetched %d times, want 1", lang, upstream.calls[lang])
+		}
+	}
+	if data, ok := srv.cache.getCachedWeatherData(languageCacheKey("London", "fr")); !ok || data.Desc != "desc-fr" {
+		t.Errorf("French entry = %+v, %v", data, ok)
+	}
+	if data, ok := srv.cache.getCachedWeatherData("London"); !ok || data.Desc != "desc-en" {
+		t.Errorf("English entry = %+v, %v", data, ok)
+	}
+
+	resp, err := http.Get(ts.URL + "/weather?city=London&lang=xx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("lang=xx: status %d, want 400", resp.StatusCode)
+	}
+}
+
+func TestWeatherstackLanguageParameter(t *testing.T) {
+	var got url.Values
+	p := weatherstackWith(t, func(w http.ResponseWriter, r *http.Request) {
+		got = r.URL.Query()
+		w.Write([]byte(`{"current": {"temperature": 10, "weather_descriptions": ["Partiellement nuageux"]}}`))
+	})
+	if _, err := p.Current(withLanguage(context.Background(), "fr"), "Paris"); err != nil {
+		t.Fatal(err)
+	}
+	if got.Get("language") != "fr" {
+		t.Errorf("language = %q, want fr", got.Get("language"))
+	}
+	if _, err := p.Current(context.Background(), "Paris"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := got["language"]; ok {
+		t.Errorf("English request sent language=%q", got.Get("language"))
+	}
+}
+
+func TestSimulatedTranslations(t *testing.T) {
+	labels := []string{defaultDescTable.top}
+	for _, b := range defaultDescTable.buckets {
+		labels = append(labels, b.label)
+	}
+	for _, lang := range supportedLanguages {
+		if lang == defaultLanguage {
+			continue
+		}
+		for _, label := range labels {
+			if descTranslations[lang][label] == "" {
+				t.Errorf("%s has no translation of %q", lang, label)
+			}
+		}
+	}
+
+	// The same reading, described in French
+	english, err := NewSimulatedProvider(7).Current(context.Background(), "Lyon")
+	if err != nil {
+		t.Fatal(err)
+	}
+	french, err := NewSimulatedProvider(7).Current(withLanguage(context.Background(), "fr"), "Lyon")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if french.Temp != english.Temp || french.Desc != descTranslations["fr"][english.Desc] {
+		t.Errorf("French reading %v°C %q, English %v°C %q", french.Temp, french.Desc, english.Temp, english.Desc)
+	}
+}
@@ -0,0 +1,61 @@
+package weather
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+)
+
+// Minimum level logged, adjustable while running through a reload
+var logLevel slog.LevelVar
+
+// Install the default slog logger, at LOG_LEVEL (debug, info, warn or
+// error; default info) and in LOG_FORMAT (text or json; default text)
+func configureLogging() error {
+	level, err := logLevelFromEnv()
+	if err != nil {
+		return err
+	}
+	logLevel.Set(level)
+	opts := &slog.HandlerOptions{Level: &logLevel}
+	var handler slog.Handler
+	switch format := strings.ToLower(os.Getenv("LOG_FORMAT")); format {
+	case "", "text":
+		handler = slog.NewTextHandler(os.Stderr, opts)
+	case "json":
+		handler = slog.NewJSONHandler(os.Stderr, opts)
+	default:
+		return fmt.Errorf("invalid LOG_FORMAT %q: must be text or json", format)
+	}
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
+
+func logLevelFromEnv() (slog.Level, error) {
+	var level slog.Level
+	if v := os.Getenv("LOG_LEVEL"); v != "" {
+		if err := level.UnmarshalText([]byte(v)); err != nil {
+			return 0, fmt.Errorf("invalid LOG_LEVEL %q: must be debug, info, warn or error", v)
+		}
+	}
+	return level, nil
+}
+
+// Logger carrying the request ID, for lines logged on a request's behalf
+func loggerFrom(ctx context.Context) *slog.Logger {
+	return slog.With("request_id", requestIDFrom(ctx))
+}
+
+// Duration in fractional milliseconds, e.g. upstream_ms=12.345
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// Log at error level and exit, for configuration and startup failures
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
@@ -0,0 +1,138 @@
+package weather
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Keeps each record's message and attributes, for asserting on them
+type recordingHandler struct {
+	mu      sync.Mutex
+	records []map[string]any
+}
+
+func (h *recordingHandler) Enabled(context.Context, slog.Level) bool { return true }
+
+func (h *recordingHandler) Handle(_ context.Context, r slog.Record) error {
+	attrs := map[string]any{"msg": r.Message, "level": r.Level}
+	r.Attrs(func(a slog.Attr) bool {
+		attrs[a.Key] = a.Value.Any()
+		return true
+	})
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.records = append(h.records, attrs)
+	return nil
+}
+
+func (h *recordingHandler) WithAttrs([]slog.Attr) slog.Handler { return h }
+func (h *recordingHandler) WithGroup(string) slog.Handler      { return h }
+
+// Records logged with message msg
+func (h *recordingHandler) logged(msg string) []map[string]any {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var out []map[string]any
+	for _, r := range h.records {
+		if r["msg"] == msg {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// Send the default logger's records to a recordingHandler for the rest of
+// the test
+func recordLogs(t *testing.T) *recordingHandler {
+	t.Helper()
+	h := &recordingHandler{}
+	prev := slog.Default()
+	slog.SetDefault(slog.New(h))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+	return h
+}
+
+func TestRequestLogAttributes(t *testing.T) {
+	h := recordLogs(t)
+	p := &stubProvider{data: CityWeatherData{City: "London", Temp: 12, Desc: "Cloudy", CacheTime: time.Now()}}
+	srv, err := NewServer(p, DefaultConfig())
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	ts := httptest.NewServer(srv.Handler())
+	for _, id := range []string{"first", "second"} {
+		req, _ := http.NewRequest(http.MethodGet, ts.URL+"/weather?city=London", nil)
+		req.Header.Set("X-Request-ID", id)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	// Waits for the handlers, so their request lines are in
+	ts.Close()
+
+	requests := h.logged("Request")
+	if len(requests) != 2 {
+		t.Fatalf("%d request lines, want 2: %v", len(requests), h.records)
+	}
+	for i, want := range []struct{ id, cache string }{{"first", "miss"}, {"second", "hit"}} {
+		r := requests[i]
+		if r["request_id"] != want.id || r["city"] != "London" || r["cache"] != want.cache || r["status"] != int64(http.StatusOK) {
+			t.Errorf("request %d logged %v, want request_id %s, city London, cache %s and status 200", i+1, r, want.id, want.cache)
+		}
+		if _, ok := r["upstream_ms"].(float64); !ok {
+			t.Errorf("request %d upstream_ms = %#v, want milliseconds", i+1, r["upstream_ms"])
+		}
+		if r["level"] != slog.LevelInfo {
+			t.Errorf("request %d logged at %v, want info", i+1, r["level"])
+		}
+	}
+}
+
+func TestConfigureLogging(t *testing.T) {
+	prev := slog.Default()
+	prevLevel := logLevel.Level()
+	t.Cleanup(func() {
+		slog.SetDefault(prev)
+		logLevel.Set(prevLevel)
+	})
+
+	tests := []struct {
+		level, format string
+		want          slog.Level
+		wantJSON      bool
+		wantErr       bool
+	}{
+		{"", "", slog.LevelInfo, false, false},
+		{"debug", "json", slog.LevelDebug, true, false},
+		{"WARN", "TEXT", slog.LevelWarn, false, false},
+		{"error", "json", slog.LevelError, true, false},
+		{"loud", "", 0, false, true},
+		{"", "xml", 0, false, true},
+	}
+	for _, tt := range tests {
+		t.Setenv("LOG_LEVEL", tt.level)
+		t.Setenv("LOG_FORMAT", tt.format)
+		err := configureLogging()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("LOG_LEVEL=%q LOG_FORMAT=%q: err = %v", tt.level, tt.format, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if logLevel.Level() != tt.want {
+			t.Errorf("LOG_LEVEL=%q: level %v, want %v", tt.level, logLevel.Level(), tt.want)
+		}
+		_, isJSON := slog.Default().Handler().(*slog.JSONHandler)
+		if isJSON != tt.wantJSON {
+			t.Errorf("LOG_FORMAT=%q: handler %T", tt.format, slog.Default().Handler())
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package weather
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"runtime/debug"
+	"sync/atomic"
+	"time"
+)
+
+type ctxKey int
+
+const requestInfoKey ctxKey = iota
+
+// Per-request details filled in by handlers and read back by the logger
+type requestInfo struct {
+	id string
+
+	// "hit", "miss" or empty when the cache was not consulted; atomic, as
+	// handlers such as /weather/region look up several cities at once
+	cache atomic.Pointer[string]
+
+	// Nanoseconds spent looking in the cache, waiting on the provider and
+	// encoding the response
+	cacheLookup atomic.Int64
+	upstream    atomic.Int64
+	encode      atomic.Int64
+}
+
+// The last cache result recorded, "" when none was
+func (info *requestInfo) cacheResult() string {
+	if result := info.cache.Load(); result != nil {
+		return *result
+	}
+	return ""
+}
+
+func requestInfoFrom(ctx context.Context) *requestInfo {
+	info, _ := ctx.Value(requestInfoKey).(*requestInfo)
+	return info
+}
+
+// Request ID for log lines, or "-" outside a request
+func requestIDFrom(ctx context.Context) string {
+	if info := requestInfoFrom(ctx); info != nil {
+		return info.id
+	}
+	return "-"
+}
+
+// The breakdown as a Server-Timing header value, in milliseconds
+func (info *requestInfo) serverTiming() string {
+	return fmt.Sprintf("cache;dur=%.3f, upstream;dur=%.3f, encode;dur=%.3f",
+		milliseconds(time.Duration(info.cacheLookup.Load())),
+		milliseconds(time.Duration(info.upstream.Load())),
+		milliseconds(time.Duration(info.encode.Load())))
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// ResponseWriter that remembers the status code; it passes through
+// flushing and hijacking so streaming and WebSocket handlers keep working.
+// With timing set, it adds a Server-Timing header just before the headers
+// go out.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	timing *requestInfo
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+		rec.addServerTiming()
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+		rec.addServerTiming()
+	}
+	return rec.ResponseWriter.Write(b)
+}
+
+func (rec *statusRecorder) addServerTiming() {
+	if rec.timing != nil {
+		rec.Header().Set("Server-Timing", rec.timing.serverTiming())
+	}
+}
+
+func (rec *statusRecorder) Flush() {
+	if f, ok := rec.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (rec *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := rec.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response writer does not support hijacking")
+	}
+	if rec.status == 0 {
+		rec.status = http.StatusSwitchingProtocols
+	}
+	return h.Hijack()
+}
+
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// Turn a handler panic into a 500 and keep serving. It must wrap every
+// other middleware so a panic in any of them is caught too; the request
+// ID is read back from the response header logRequests sets.
+func (s *Server) recoverPanics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w}
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			if v == http.ErrAbortHandler {
+				panic(v) // a deliberate abort, which net/http handles quietly
+			}
+			s.panics.Add(1)
+			slog.Error("Handler panicked", "request_id", w.Header().Get("X-Request-ID"),
+				"method", r.Method, "path", r.URL.Path, "panic", fmt.Sprint(v), "stack", string(debug.Stack()))
+			if rec.status == 0 {
+				writeProblem(w, http.StatusInternalServerError, "", "Internal server error", r.URL.Path)
+			}
+		}()
+		next.ServeHTTP(rec, r)
+	})
+}
+
+// Assign a request ID (honoring X-Request-ID) and log each request on
+// completion, at warn with the timing breakdown when upstream was slow
+func (s *Server) logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		id := r.Header.Get("X-Request-ID")
+		if id == "" || len(id) > 128 {
+			id = newRequestID()
+		}
+		info := &requestInfo{id: id}
+		w.Header().Set("X-Request-ID", id)
+
+		rec := &statusRecorder{ResponseWriter: w}
+		if s.config.Features.EnableServerTiming {
+			rec.timing = info
+		}
+		next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), requestInfoKey, info)))
+
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		cacheResult := info.cacheResult()
+		if cacheResult == "" {
+			cacheResult = "-"
+		}
+		level := slog.LevelInfo
+		if rec.status >= http.StatusInternalServerError {
+			level = slog.LevelWarn
+		}
+		slog.Log(r.Context(), level, "Request", "request_id", id, "method", r.Method, "path", r.URL.Path,
+			"city", r.URL.Query().Get("city"), "status", rec.status, "cache", cacheResult,
+			"upstream_ms", milliseconds(time.Duration(info.upstream.Load())), "total_ms", milliseconds(time.Since(start)))
+		if upstream := time.Duration(info.upstream.Load()); upstream > s.config.SlowUpstreamThreshold {
+			slog.Warn("Slow upstream", "request_id", id, "method", r.Method, "path", r.URL.Path,
+				"city", r.URL.Query().Get("city"), "threshold_ms", milliseconds(s.config.SlowUpstreamThreshold),
+				"cache_ms", milliseconds(time.Duration(info.cacheLookup.Load())), "upstream_ms", milliseconds(upstream),
+				"encode_ms", milliseconds(time.Duration(info.encode.Load())), "total_ms", milliseconds(time.Since(start)))
+		}
+	})
+}
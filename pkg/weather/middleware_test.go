@@ -0,0 +1,106 @@
+package weather_test
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/deepakg86/weather-api-caching/pkg/weather"
+	"github.com/deepakg86/weather-api-caching/pkg/weather/testutil"
+)
+
+// Log output shared with the server's goroutines
+type logBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+// Log lines mentioning s
+func (b *logBuffer) linesWith(s string) []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var lines []string
+	for _, line := range strings.Split(b.buf.String(), "\n") {
+		if strings.Contains(line, s) {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// Send the default logger to a buffer for the rest of the test
+func captureServerLogs(t *testing.T) *logBuffer {
+	t.Helper()
+	logs := &logBuffer{}
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(logs, nil)))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+	return logs
+}
+
+func getWithID(t *testing.T, url, id string) *http.Response {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	if id != "" {
+		req.Header.Set("X-Request-ID", id)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET %s: %v", url, err)
+	}
+	resp.Body.Close()
+	return resp
+}
+
+func TestRequestLogsCarryTheRequestID(t *testing.T) {
+	logs := captureServerLogs(t)
+	mock := testutil.NewMockWeatherProvider(map[string]weather.CityWeatherData{
+		"London": {City: "London", Temp: 11.5, Desc: "Partly cloudy"},
+	}, map[string]error{"Paris": errors.New("upstream exploded")})
+	ts := newTestServer(t, mock, nil)
+
+	resp := getWithID(t, ts.URL+"/weather?city=London", "trace-london-1")
+	if got := resp.Header.Get("X-Request-ID"); got != "trace-london-1" {
+		t.Errorf("X-Request-ID = %q, want the incoming one", got)
+	}
+	lines := logs.linesWith("request_id=trace-london-1")
+	if len(lines) != 1 {
+		t.Fatalf("log lines with the request ID = %q, want the request line", lines)
+	}
+	for _, want := range []string{"msg=Request", "method=GET", "path=/weather", "city=London", "status=200", "cache=miss", "upstream_ms=", "total_ms="} {
+		if !strings.Contains(lines[0], want) {
+			t.Errorf("request line %q lacks %s", lines[0], want)
+		}
+	}
+	getWithID(t, ts.URL+"/weather?city=London", "trace-london-2")
+	if lines := logs.linesWith("request_id=trace-london-2"); len(lines) != 1 || !strings.Contains(lines[0], "cache=hit") {
+		t.Errorf("second request logged %q, want a cache hit", lines)
+	}
+
+	// The upstream fetch logs its failure under the same ID
+	getWithID(t, ts.URL+"/weather?city=Paris", "trace-paris")
+	lines = logs.linesWith("request_id=trace-paris")
+	if len(lines) != 2 || !strings.Contains(lines[0], `msg="Upstream fetch failed"`) || !strings.Contains(lines[1], "msg=Request") {
+		t.Errorf("failed request logged %q, want the fetch failure then the request", lines)
+	}
+
+	// Without one, an ID is made up and logged
+	resp = getWithID(t, ts.URL+"/weather?city=London", "")
+	id := resp.Header.Get("X-Request-ID")
+	if id == "" {
+		t.Fatal("no X-Request-ID generated")
+	}
+	if lines := logs.linesWith("request_id=" + id); len(lines) != 1 {
+		t.Errorf("log lines with the generated ID %s = %q", id, lines)
+	}
+}
@@ -0,0 +1,147 @@
+package weather
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// A stand-in for Weatherstack answering every city with a mild reading
+func fakeWeatherstack(t *testing.T) *httptest.Server {
+	t.Helper()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		city := r.URL.Query().Get("query")
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"location": {"name": %q, "timezone_id": "Europe/London", "localtime_epoch": 1741363200},
+			"current": {"temperature": 14, "weather_code": 116, "weather_descriptions": ["Partly cloudy"], "humidity": 70, "wind_speed": 9}}`, city)
+	}))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+// A server for mode built the way Run builds one, with live mode calling
+// a fake Weatherstack
+func modeServer(t *testing.T, mode string) *httptest.Server {
+	t.Helper()
+	for name, value := range map[string]string{
+		"WEATHER_PROVIDERS": "", "WEATHER_PROVIDER": "", "WEATHER_FIXTURES": "",
+		"WEATHERSTACK_API_KEYS": "", "WEATHERSTACK_API_KEY": "suite-key", "WEATHERSTACK_BASE_URL": "",
+		"SIM_SCENARIO": "", "SIM_SCRIPTED_FILE": "", "SIM_DESC_BUCKETS": "",
+	} {
+		t.Setenv(name, value)
+	}
+	if mode == ModeLive {
+		t.Setenv("WEATHERSTACK_BASE_URL", fakeWeatherstack(t).URL)
+	}
+	config := DefaultConfig()
+	config.Mode = mode
+	config.Provider = providerName(mode)
+	config.SimulatorSeed = 42
+	up := newUpstream()
+	provider, err := up.newProvider(mode, config)
+	if err != nil {
+		t.Fatalf("newProvider(%s): %v", mode, err)
+	}
+	srv, err := newServer(provider, config, up)
+	if err != nil {
+		t.Fatalf("newServer: %v", err)
+	}
+	ts := httptest.NewServer(srv.Handler())
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func getBody(t *testing.T, ts *httptest.Server, path string, out interface{}) *http.Response {
+	t.Helper()
+	resp, err := http.Get(ts.URL + path)
+	if err != nil {
+		t.Fatalf("GET %s: %v", path, err)
+	}
+	defer resp.Body.Close()
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatalf("GET %s: decoding body: %v", path, err)
+		}
+	}
+	return resp
+}
+
+// The handler behavior both modes share; only where the weather comes
+// from differs
+func TestHandlersInBothModes(t *testing.T) {
+	for _, mode := range []string{ModeLive, ModeSimulated} {
+		t.Run(mode, func(t *testing.T) {
+			ts := modeServer(t, mode)
+
+			t.Run("weather", func(t *testing.T) {
+				var data map[string]interface{}
+				resp := getBody(t, ts, "/weather?city=London", &data)
+				if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "application/json" {
+					t.Fatalf("status %d, Content-Type %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+				}
+				for _, field := range []string{"city", "temp", "desc", "activity", "condition", "cache_time"} {
+					if _, ok := data[field]; !ok {
+						t.Errorf("response lacks %s: %v", field, data)
+					}
+				}
+				if data["city"] != "London" {
+					t.Errorf("city = %v, want London", data["city"])
+				}
+			})
+
+			t.Run("cache hit", func(t *testing.T) {
+				getBody(t, ts, "/weather?city=Paris", nil)
+				getBody(t, ts, "/weather?city=Paris", nil)
+				var stats struct {
+					Hits uint64 `json:"hits"`
+				}
+				getBody(t, ts, "/cache/stats", &stats)
+				if stats.Hits < 1 {
+					t.Errorf("hits = %d after a repeat request", stats.Hits)
+				}
+			})
+
+			t.Run("bad input", func(t *testing.T) {
+				for _, query := range []string{"", "?city=" + url.QueryEscape("London<script>"), "?city=London&fields=nope"} {
+					if resp := getBody(t, ts, "/weather"+query, nil); resp.StatusCode != http.StatusBadRequest {
+						t.Errorf("/weather%s: status %d, want 400", query, resp.StatusCode)
+					}
+				}
+			})
+
+			t.Run("fields", func(t *testing.T) {
+				var body map[string]interface{}
+				getBody(t, ts, "/weather?city=London&fields=city,temp", &body)
+				if len(body) != 2 {
+					t.Errorf("body = %v, want only city and temp", body)
+				}
+			})
+
+			t.Run("region", func(t *testing.T) {
+				var body struct {
+					Cities []CityWeatherData `json:"cities"`
+					Errors map[string]string `json:"errors"`
+				}
+				if resp := getBody(t, ts, "/weather/region?name=Europe", &body); resp.StatusCode != http.StatusOK {
+					t.Fatalf("status %d", resp.StatusCode)
+				}
+				if len(body.Cities) != 13 || len(body.Errors) != 0 {
+					t.Errorf("%d cities and errors %v, want all 13 of Europe", len(body.Cities), body.Errors)
+				}
+			})
+
+			t.Run("version", func(t *testing.T) {
+				var v struct {
+					Mode string `json:"mode"`
+				}
+				getBody(t, ts, "/version", &v)
+				if v.Mode != mode {
+					t.Errorf("mode = %q, want %q", v.Mode, mode)
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,229 @@
+package weather
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Live weather from the OpenWeatherMap current weather API
+type OpenWeatherMapProvider struct {
+	client  *http.Client
+	timeout time.Duration
+}
+
+func (p OpenWeatherMapProvider) Timeout() time.Duration { return p.timeout }
+
+func (p OpenWeatherMapProvider) Current(ctx context.Context, city string) (CityWeatherData, error) {
+	apiKey := upstreamAPIKey("OPENWEATHERMAP_API_KEY", p.client)
+	if apiKey == "" {
+		return CityWeatherData{}, fmt.Errorf("%w: set OPENWEATHERMAP_API_KEY", ErrMissingAPIKey)
+	}
+
+	query := url.Values{"q": {city}, "appid": {apiKey}, "lang": {languageFrom(ctx)}}
+	if lat, lon, ok := parseCoordinates(city); ok {
+		// A point, e.g. from /weather/nearest, rather than a name
+		query.Del("q")
+		query.Set("lat", strconv.FormatFloat(lat, 'f', -1, 64))
+		query.Set("lon", strconv.FormatFloat(lon, 'f', -1, 64))
+	}
+	/*
+	   Request URL: https://api.openweathermap.org/data/2.5/weather?q=London&appid=your_api_key_here
+	   Raw Response (abridged):
+	   {
+	       "weather": [
+	           {"id": 803, "main": "Clouds", "description": "broken clouds", "icon": "04d"}
+	       ],
+	       "main": {
+	           "temp": 288.15,
+	           "humidity": 82
+	       },
+	       "name": "London",
+	       "cod": 200
+	   }
+	*/
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://api.openweathermap.org/data/2.5/weather?"+query.Encode(), nil)
+	if err != nil {
+		return CityWeatherData{}, err
+	}
+	resp, err := tracedDo(p.client, "openweathermap", req)
+	if err != nil {
+		return CityWeatherData{}, classifyTransportError(err)
+	}
+	defer resp.Body.Close()
+	// Unlike Weatherstack, failures come back with a matching HTTP status
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return CityWeatherData{}, fmt.Errorf("%w: %s", ErrCityNotFound, city)
+	case http.StatusUnauthorized:
+		return CityWeatherData{}, errInvalidAPIKey
+	case http.StatusTooManyRequests:
+		return CityWeatherData{}, ErrQuotaExceeded
+	default:
+		return CityWeatherData{}, &StatusError{Code: resp.StatusCode, Status: resp.Status}
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return CityWeatherData{}, classifyTransportError(err)
+	}
+	return parseOpenWeatherMap(city, languageFrom(ctx), body)
+}
+
+func parseOpenWeatherMap(city, lang string, body []byte) (CityWeatherData, error) {
+	var apiResponse struct {
+		Weather []struct {
+			ID          int    `json:"id"`
+			Description string `json:"description"`
+			Icon        string `json:"icon"`
+		} `json:"weather"`
+		Main struct {
+			Temp      float64  `json:"temp"`
+			FeelsLike *float64 `json:"feels_like"`
+			Humidity  *float64 `json:"humidity"`
+			Pressure  *float64 `json:"pressure"`
+		} `json:"main"`
+		Name  string `json:"name"`
+		Coord struct {
+			Lat float64 `json:"lat"`
+			Lon float64 `json:"lon"`
+		} `json:"coord"`
+		Sys struct {
+			Country string `json:"country"`
+		} `json:"sys"`
+		Dt       int64 `json:"dt"`       // observation time
+		Timezone int   `json:"timezone"` // seconds east of UTC
+		Wind     *struct {
+			Speed float64  `json:"speed"`
+			Deg   *float64 `json:"deg"`
+		} `json:"wind"`
+		Rain struct {
+			OneHour float64 `json:"1h"`
+		} `json:"rain"`
+		Snow struct {
+			OneHour float64 `json:"1h"`
+		} `json:"snow"`
+	}
+	if err := json.Unmarshal(body, &apiResponse); err != nil {
+		return CityWeatherData{}, fmt.Errorf("%w: %v", ErrUpstreamBadResponse, err)
+	}
+
+	// Report Celsius like Weatherstack, rounded to its whole degrees
+	temperature := math.Round(apiResponse.Main.Temp - 273.15)
+	desc := "No description available"
+	if len(apiResponse.Weather) > 0 && apiResponse.Weather[0].Description != "" {
+		// "broken clouds" -> "Broken clouds", matching Weatherstack's casing
+		d := apiResponse.Weather[0].Description
+		r, size := utf8.DecodeRuneInString(d)
+		desc = string(unicode.ToUpper(r)) + d[size:]
+	}
+	humidity, hasHumidity := 0.0, apiResponse.Main.Humidity != nil
+	if hasHumidity {
+		humidity = *apiResponse.Main.Humidity
+	}
+	precipType, condition, code, icon := "", ConditionUnknown, 0, ""
+	if len(apiResponse.Weather) > 0 {
+		w := apiResponse.Weather[0]
+		precipType = openWeatherMapPrecipType(w.ID)
+		condition, code = openWeatherMapCondition(w.ID), w.ID
+		if w.Icon != "" {
+			icon = fmt.Sprintf("https://openweathermap.org/img/wn/%s@2x.png", w.Icon)
+		}
+	}
+	precipMM := apiResponse.Rain.OneHour + apiResponse.Snow.OneHour
+
+	// Convert to Weatherstack's units: km/h, a compass point and Celsius
+	var windSpeed, feelsLike *float64
+	windDir := ""
+	if w := apiResponse.Wind; w != nil {
+		kmh := math.Round(w.Speed * 3.6)
+		windSpeed = &kmh
+		if w.Deg != nil {
+			windDir = compassPoint(*w.Deg)
+		}
+	}
+	if k := apiResponse.Main.FeelsLike; k != nil {
+		c := math.Round(*k - 273.15)
+		feelsLike = &c
+	}
+	// OpenWeatherMap gives a UTC offset rather than a zone name
+	var location *Location
+	if apiResponse.Name != "" {
+		city = apiResponse.Name
+		location = &Location{
+			Name:    apiResponse.Name,
+			Country: apiResponse.Sys.Country,
+			Lat:     apiResponse.Coord.Lat,
+			Lon:     apiResponse.Coord.Lon,
+		}
+		if apiResponse.Dt != 0 {
+			zone := time.FixedZone("", apiResponse.Timezone)
+			location.Localtime = time.Unix(apiResponse.Dt, 0).In(zone).Format("2006-01-02 15:04")
+		}
+	}
+	// No zone name to report, but the offset is enough for the local time
+	var utcOffset *int
+	if apiResponse.Name != "" {
+		utcOffset = &apiResponse.Timezone
+	}
+	var observed *time.Time
+	if apiResponse.Dt > 0 {
+		t := time.Unix(apiResponse.Dt, 0).UTC()
+		observed = &t
+	}
+	return CityWeatherData{
+		City:            city,
+		Temp:            temperature,
+		Desc:            desc,
+		Activity:        recommendActivity(temperature, humidity, hasHumidity, activityDesc(desc, precipType, lang)),
+		Condition:       condition,
+		ProviderCode:    code,
+		IconURL:         icon,
+		PrecipProb:      currentPrecipProb(precipType, precipMM),
+		PrecipMM:        precipMM,
+		PrecipType:      precipType,
+		Humidity:        apiResponse.Main.Humidity,
+		WindSpeed:       windSpeed,
+		WindDir:         windDir,
+		Pressure:        apiResponse.Main.Pressure,
+		FeelsLike:       feelsLike,
+		Location:        location,
+		UTCOffset:       utcOffset,
+		Source:          "openweathermap",
+		ObservationTime: observed,
+		CacheTime:       time.Now(),
+	}, nil
+}
+
+// Map OpenWeatherMap condition ids onto the same precipitation types as
+// Weatherstack: https://openweathermap.org/weather-conditions
+func openWeatherMapPrecipType(id int) string {
+	switch {
+	case id == 511 || (id >= 611 && id <= 616):
+		return "sleet" // freezing rain, sleet and rain-snow mixes
+	case id >= 600 && id < 700:
+		return "snow"
+	case id >= 200 && id < 600:
+		return "rain" // thunderstorm, drizzle and rain
+	}
+	return ""
+}
+
+var compassPoints = []string{"N", "NNE", "NE", "ENE", "E", "ESE", "SE", "SSE", "S", "SSW", "SW", "WSW", "W", "WNW", "NW", "NNW"}
+
+// Nearest 16-point compass direction for a bearing in degrees
+func compassPoint(deg float64) string {
+	i := int(math.Round(math.Mod(deg, 360)/22.5)) % len(compassPoints)
+	if i < 0 {
+		i += len(compassPoints)
+	}
+	return compassPoints[i]
+}
@@ -0,0 +1,110 @@
+package weather
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+)
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+// An OpenWeatherMap provider whose requests are answered with the
+// recorded payload in file
+func openWeatherMapReplaying(t *testing.T, file string) OpenWeatherMapProvider {
+	t.Helper()
+	body, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("OPENWEATHERMAP_API_KEY", "test-key")
+	client := &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		if req.URL.Host != "api.openweathermap.org" || req.URL.Query().Get("appid") != "test-key" {
+			t.Errorf("request to %s", req.URL)
+		}
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": {"application/json"}},
+			Body:       io.NopCloser(bytes.NewReader(body)),
+			Request:    req,
+		}, nil
+	})}
+	return OpenWeatherMapProvider{client: client}
+}
+
+// The same London observation recorded from both providers comes out in
+// the same units and with the same meaning
+func TestRecordedPayloadsAgree(t *testing.T) {
+	recorded, err := os.ReadFile("../../testdata/london.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ws, err := weatherstackReplying(t, string(recorded)).Current(context.Background(), "London")
+	if err != nil {
+		t.Fatalf("Weatherstack: %v", err)
+	}
+	owm, err := openWeatherMapReplaying(t, "testdata/openweathermap/london.json").Current(context.Background(), "London")
+	if err != nil {
+		t.Fatalf("OpenWeatherMap: %v", err)
+	}
+
+	observed := time.Unix(1741363200, 0).UTC()
+	for _, got := range []CityWeatherData{ws, owm} {
+		t.Run(got.Source, func(t *testing.T) {
+			if got.City != "London" || got.Temp != 12 || got.Condition != ConditionClouds {
+				t.Errorf("city, temp, condition = %s, %v, %s, want London, 12, clouds", got.City, got.Temp, got.Condition)
+			}
+			if got.FeelsLike == nil || *got.FeelsLike != 10 {
+				t.Errorf("feels_like = %v, want 10", got.FeelsLike)
+			}
+			if got.WindSpeed == nil || *got.WindSpeed != 14 || got.WindDir != "WSW" {
+				t.Errorf("wind = %v km/h %s, want 14 km/h WSW", got.WindSpeed, got.WindDir)
+			}
+			if got.Humidity == nil || *got.Humidity != 82 || got.Pressure == nil || *got.Pressure != 1016 {
+				t.Errorf("humidity, pressure = %v, %v, want 82, 1016", got.Humidity, got.Pressure)
+			}
+			if got.PrecipType != "" || got.PrecipMM != 0 {
+				t.Errorf("precipitation = %q %v mm, want none", got.PrecipType, got.PrecipMM)
+			}
+			if got.ObservationTime == nil || !got.ObservationTime.Equal(observed) {
+				t.Errorf("observation_time = %v, want %v", got.ObservationTime, observed)
+			}
+			if got.Activity != "Good for a walk" {
+				t.Errorf("activity = %q", got.Activity)
+			}
+		})
+	}
+	// Descriptions are the provider's own words, cased alike
+	if ws.Desc != "Partly cloudy" || owm.Desc != "Scattered clouds" {
+		t.Errorf("descriptions = %q, %q", ws.Desc, owm.Desc)
+	}
+	if ws.Source != "weatherstack" || owm.Source != "openweathermap" {
+		t.Errorf("sources = %q, %q", ws.Source, owm.Source)
+	}
+}
+
+func TestOpenWeatherMapErrors(t *testing.T) {
+	tests := []struct {
+		status int
+		want   error
+	}{
+		{http.StatusNotFound, ErrCityNotFound},
+		{http.StatusUnauthorized, errInvalidAPIKey},
+		{http.StatusTooManyRequests, ErrQuotaExceeded},
+	}
+	t.Setenv("OPENWEATHERMAP_API_KEY", "test-key")
+	for _, tt := range tests {
+		p := OpenWeatherMapProvider{client: &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			return &http.Response{StatusCode: tt.status, Body: io.NopCloser(bytes.NewReader(nil)), Request: req}, nil
+		})}}
+		if _, err := p.Current(context.Background(), "London"); !errors.Is(err, tt.want) {
+			t.Errorf("status %d: err = %v, want %v", tt.status, err, tt.want)
+		}
+	}
+}
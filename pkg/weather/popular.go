@@ -0,0 +1,135 @@
+package weather
+
+import (
+	"container/list"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+type cityCount struct {
+	city  string // normalized
+	key   string // cache key it was last requested under
+	count uint64
+}
+
+// Requests per city, kept apart from the cache so evictions do not lose
+// them. Only the maxSize most recently requested cities are tracked; a
+// city that has not been asked for in a long while is forgotten first.
+type cityCounters struct {
+	mu      sync.Mutex
+	maxSize int
+	entries map[string]*list.Element
+	order   *list.List
+}
+
+func newCityCounters(maxSize int) *cityCounters {
+	return &cityCounters{maxSize: maxSize, entries: make(map[string]*list.Element), order: list.New()}
+}
+
+// Count a request for the cache key a city resolved to
+func (c *cityCounters) record(key string) {
+	city := normalizeCity(key)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[city]; ok {
+		entry := elem.Value.(*cityCount)
+		entry.key = key
+		entry.count++
+		c.order.MoveToFront(elem)
+		return
+	}
+	if c.order.Len() >= c.maxSize {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cityCount).city)
+	}
+	c.entries[city] = c.order.PushFront(&cityCount{city: city, key: key, count: 1})
+}
+
+// The most requested cities, ties broken by name
+func (c *cityCounters) top(limit int) []cityCount {
+	c.mu.Lock()
+	counts := make([]cityCount, 0, c.order.Len())
+	for elem := c.order.Front(); elem != nil; elem = elem.Next() {
+		counts = append(counts, *elem.Value.(*cityCount))
+	}
+	c.mu.Unlock()
+
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].count != counts[j].count {
+			return counts[i].count > counts[j].count
+		}
+		return counts[i].city < counts[j].city
+	})
+	if len(counts) > limit {
+		counts = counts[:limit]
+	}
+	return counts
+}
+
+func (c *cityCounters) reset() {
+	c.mu.Lock()
+	c.entries = make(map[string]*list.Element)
+	c.order.Init()
+	c.mu.Unlock()
+}
+
+// Cache statuses reported by /stats/cities
+const (
+	cacheStatusFresh   = "fresh"
+	cacheStatusExpired = "expired"
+	cacheStatusAbsent  = "absent"
+)
+
+// Whether city is cached, without counting as a lookup or reordering the
+// LRU lists
+func (c *Cache) status(city string) string {
+	e, ok := c.entries.Peek(city)
+	if !ok {
+		return cacheStatusAbsent
+	}
+	if !e.Fresh() {
+		return cacheStatusExpired
+	}
+	return cacheStatusFresh
+}
+
+type popularCity struct {
+	City        string `json:"city"` // normalized
+	Requests    uint64 `json:"requests"`
+	CacheStatus string `json:"cache_status"` // fresh, expired or absent
+}
+
+// The most requested cities, e.g. to choose which to pre-warm
+func (s *Server) popularCitiesHandler(w http.ResponseWriter, r *http.Request) {
+	limit := 20
+	if l := r.URL.Query().Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n <= 0 {
+			writeProblem(w, http.StatusBadRequest, "", "Limit must be a positive integer", r.URL.Path)
+			return
+		}
+		limit = n
+	}
+
+	result := []popularCity{}
+	for _, c := range s.requests.top(limit) {
+		result = append(result, popularCity{City: c.city, Requests: c.count, CacheStatus: s.cache.status(c.key)})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// Start counting afresh, e.g. after a traffic pattern has changed
+func (s *Server) resetPopularCitiesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		w.Header().Set("Allow", http.MethodDelete)
+		writeProblem(w, http.StatusMethodNotAllowed, "", "Method not allowed", r.URL.Path)
+		return
+	}
+	s.requests.reset()
+	w.WriteHeader(http.StatusNoContent)
+}
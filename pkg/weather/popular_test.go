@@ -0,0 +1,112 @@
+package weather
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestCityCountersOrdering(t *testing.T) {
+	c := newCityCounters(10)
+	for city, n := range map[string]int{"Paris": 3, "London": 5, "Oslo": 3, "Rome": 1} {
+		for i := 0; i < n; i++ {
+			c.record(city)
+		}
+	}
+	// Case and spacing do not split a city's count
+	c.record(" LONDON ")
+
+	var got []string
+	for _, cc := range c.top(10) {
+		got = append(got, fmt.Sprintf("%s=%d", cc.city, cc.count))
+	}
+	if want := []string{"london=6", "oslo=3", "paris=3", "rome=1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("top = %v, want %v", got, want)
+	}
+	if top := c.top(2); len(top) != 2 || top[1].city != "oslo" {
+		t.Errorf("top(2) = %v, want london and oslo", top)
+	}
+}
+
+func TestCityCountersBounded(t *testing.T) {
+	c := newCityCounters(3)
+	for i := 0; i < 5; i++ {
+		c.record("London")
+	}
+	for i := 0; i < 1000; i++ {
+		c.record(fmt.Sprintf("City %d", i))
+		c.record("London") // kept by being asked for all along
+	}
+	if len(c.entries) != 3 || c.order.Len() != 3 {
+		t.Fatalf("tracking %d cities in %d list entries, want at most 3", len(c.entries), c.order.Len())
+	}
+	top := c.top(10)
+	if top[0].city != "london" || top[0].count != 1005 {
+		t.Errorf("top = %v, want london first with all 1005 requests", top)
+	}
+	if _, ok := c.entries["city 0"]; ok {
+		t.Error("city 0, not asked for since, is still tracked")
+	}
+	if _, ok := c.entries["city 999"]; !ok {
+		t.Error("city 999, asked for last, is not tracked")
+	}
+
+	c.reset()
+	if len(c.entries) != 0 || c.order.Len() != 0 || len(c.top(10)) != 0 {
+		t.Errorf("after reset tracking %d cities", len(c.entries))
+	}
+}
+
+func TestPopularCitiesEndpoint(t *testing.T) {
+	config := DefaultConfig()
+	config.CacheSize = 1
+	config.AdminToken = "secret"
+	srv, err := NewServer(echoProvider{}, config)
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+	for _, city := range []string{"Paris", "London", "Paris", "Rome", "Paris", "London"} {
+		getBody(t, ts, "/weather?city="+city, nil)
+	}
+
+	// With room for one entry only London is still cached, but the
+	// evicted cities keep their counts
+	var popular []popularCity
+	if resp := getBody(t, ts, "/stats/cities?limit=2", &popular); resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d", resp.StatusCode)
+	}
+	want := []popularCity{
+		{City: "paris", Requests: 3, CacheStatus: cacheStatusAbsent},
+		{City: "london", Requests: 2, CacheStatus: cacheStatusFresh},
+	}
+	if !reflect.DeepEqual(popular, want) {
+		t.Errorf("popular = %+v, want %+v", popular, want)
+	}
+	if resp := getBody(t, ts, "/stats/cities?limit=0", nil); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("limit=0: status %d, want 400", resp.StatusCode)
+	}
+
+	reset := func(token string) int {
+		req, _ := http.NewRequest(http.MethodDelete, ts.URL+"/admin/stats/cities", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if code := reset("wrong"); code != http.StatusUnauthorized {
+		t.Errorf("reset with the wrong token: status %d, want 401", code)
+	}
+	if code := reset("secret"); code != http.StatusNoContent {
+		t.Errorf("reset: status %d, want 204", code)
+	}
+	if getBody(t, ts, "/stats/cities", &popular); len(popular) != 0 {
+		t.Errorf("after reset popular = %+v, want none", popular)
+	}
+}
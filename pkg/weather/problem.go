@@ -0,0 +1,37 @@
+package weather
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// An RFC 7807 problem details body, the shape of every error response
+type problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+
+	// Extension for rejected city names
+	InvalidCharacters []string `json:"invalid_characters,omitempty"`
+}
+
+// Reply with an application/problem+json error. There are no custom
+// problem types, so type is always about:blank, and an empty title is
+// filled in with the status text as RFC 7807 asks for such problems.
+// instance is the path of the failing request.
+func writeProblem(w http.ResponseWriter, status int, title, detail, instance string) {
+	encodeProblem(w, problem{Title: title, Status: status, Detail: detail, Instance: instance})
+}
+
+func encodeProblem(w http.ResponseWriter, p problem) {
+	p.Type = "about:blank"
+	if p.Title == "" {
+		p.Title = http.StatusText(p.Status)
+	}
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
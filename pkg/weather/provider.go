@@ -0,0 +1,191 @@
+package weather
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Source of current weather readings; the cache, handlers and middleware
+// are shared by every implementation
+type WeatherProvider interface {
+	Current(ctx context.Context, city string) (CityWeatherData, error)
+	// How long one call may take, applied by the caller; 0 for no limit
+	Timeout() time.Duration
+}
+
+const defaultProviderTimeout = 10 * time.Second
+
+// Call p under its own deadline, if it has one. Running out of that time
+// is reported as ErrUpstreamTimeout, which unlike the caller's deadline
+// is worth retrying or falling back from.
+func callWithTimeout(ctx context.Context, p WeatherProvider, city string) (CityWeatherData, error) {
+	timeout := p.Timeout()
+	if timeout <= 0 {
+		return p.Current(ctx, city)
+	}
+	callCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	data, err := p.Current(callCtx, city)
+	if err != nil && ctx.Err() == nil && errors.Is(callCtx.Err(), context.DeadlineExceeded) {
+		return data, fmt.Errorf("%w after %v", ErrUpstreamTimeout, timeout)
+	}
+	return data, err
+}
+
+const (
+	ModeLive      = "live"
+	ModeSimulated = "simulated"
+)
+
+// What the providers of one Server share, and what it reports about them
+type upstream struct {
+	client *http.Client     // every live provider calls through it
+	keys   *keyPool         // Weatherstack's; nil when it is not in use
+	stats  *providerStats   // per instrumented provider
+	sim    *RandomSimulator // nil unless simulated weather is served
+}
+
+func newUpstream() *upstream {
+	return &upstream{client: newUpstreamClient(defaultMaxIdleConns, defaultIdleConnTimeout), stats: newProviderStats()}
+}
+
+// Provider for mode, its simulator seeded with config.SimulatorSeed
+func (u *upstream) newProvider(mode string, config Config) (WeatherProvider, error) {
+	switch mode {
+	case ModeLive:
+		return u.newLiveProvider(config)
+	case ModeSimulated:
+		p, err := u.simulated(config)
+		if err != nil {
+			return nil, err
+		}
+		return u.stats.instrument("simulated", p), nil
+	default:
+		return nil, fmt.Errorf("unknown mode %q (want %q or %q)", mode, ModeLive, ModeSimulated)
+	}
+}
+
+// Upstream used in live mode: the WEATHER_PROVIDERS chain when set,
+// otherwise the single WEATHER_PROVIDER
+func (u *upstream) newLiveProvider(config Config) (WeatherProvider, error) {
+	client, err := fixturesFromEnv(upstreamClientFromEnv())
+	if err != nil {
+		return nil, err
+	}
+	u.client = client
+
+	names := liveProviderNames()
+	var providers []WeatherProvider
+	for _, name := range names {
+		p, err := u.providerByName(name, config)
+		if err != nil {
+			return nil, err
+		}
+		providers = append(providers, u.stats.instrument(name, p))
+	}
+	if len(providers) == 1 {
+		return providers[0], nil
+	}
+	return &fallbackProvider{providers: providers, names: names}, nil
+}
+
+// Simulated weather from the environment, remembered for /debug/simulated
+// and /cache/stats
+func (u *upstream) simulated(config Config) (*SimulatedProvider, error) {
+	p, sim, err := simulatedFromEnv(config.SimulatorSeed, config.ScenarioFile)
+	if err != nil {
+		return nil, err
+	}
+	u.sim = sim
+	return p, nil
+}
+
+// Names in the live provider chain, in order
+func liveProviderNames() []string {
+	chain := os.Getenv("WEATHER_PROVIDERS")
+	if chain == "" {
+		chain = os.Getenv("WEATHER_PROVIDER")
+	}
+	var names []string
+	for _, name := range strings.Split(chain, ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			name = "weatherstack"
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// The provider a mode uses, as /version reports it: a live chain is
+// joined with commas
+func providerName(mode string) string {
+	if mode == ModeLive {
+		return strings.Join(liveProviderNames(), ",")
+	}
+	return mode
+}
+
+func (u *upstream) providerByName(name string, config Config) (WeatherProvider, error) {
+	switch name {
+	case "", "weatherstack":
+		keys, err := weatherstackKeysFromEnv(u.client)
+		if err != nil {
+			return nil, err
+		}
+		u.keys = keys
+		p, err := NewWeatherstackProvider(os.Getenv("WEATHERSTACK_BASE_URL"), keys, u.client)
+		if err != nil {
+			return nil, err
+		}
+		p.timeout = time.Duration(positiveEnv("WEATHERSTACK_TIMEOUT_SECONDS", int(defaultProviderTimeout/time.Second))) * time.Second
+		return p, nil
+	case "openweathermap":
+		timeout := positiveEnv("OPENWEATHERMAP_TIMEOUT_SECONDS", int(defaultProviderTimeout/time.Second))
+		return OpenWeatherMapProvider{client: u.client, timeout: time.Duration(timeout) * time.Second}, nil
+	case "simulated":
+		return u.simulated(config)
+	default:
+		return nil, fmt.Errorf("unknown provider %q (want weatherstack, openweathermap or simulated)", name)
+	}
+}
+
+// Failures another provider might not share: outages, quota and auth
+// errors. An unknown city, or a client that has gone away, ends the chain.
+func canFallBack(err error) bool {
+	return !errors.Is(err, ErrCityNotFound) &&
+		!errors.Is(err, context.Canceled) &&
+		!errors.Is(err, context.DeadlineExceeded)
+}
+
+// Tries each provider in priority order until one succeeds
+type fallbackProvider struct {
+	providers []WeatherProvider
+	names     []string
+}
+
+// Each provider in the chain gets its own deadline
+func (f *fallbackProvider) Timeout() time.Duration { return 0 }
+
+func (f *fallbackProvider) Current(ctx context.Context, city string) (CityWeatherData, error) {
+	var err error
+	for i, p := range f.providers {
+		var data CityWeatherData
+		data, err = callWithTimeout(ctx, p, city)
+		if err == nil {
+			return data, nil
+		}
+		if !canFallBack(err) {
+			return CityWeatherData{}, err
+		}
+		if i < len(f.providers)-1 {
+			loggerFrom(ctx).Warn("Provider failed, falling back", "provider", f.names[i],
+				"fallback", f.names[i+1], "city", city, "err", err)
+		}
+	}
+	return CityWeatherData{}, err
+}
@@ -0,0 +1,141 @@
+package weather
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// A provider answering with data or err, counting its calls
+type stubProvider struct {
+	data  CityWeatherData
+	err   error
+	calls int
+}
+
+func (p *stubProvider) Timeout() time.Duration { return 0 }
+
+func (p *stubProvider) Current(ctx context.Context, city string) (CityWeatherData, error) {
+	p.calls++
+	if p.err != nil {
+		return CityWeatherData{}, p.err
+	}
+	return p.data, nil
+}
+
+func TestFallbackChain(t *testing.T) {
+	outage := &StatusError{Code: 503, Status: "503 Service Unavailable"}
+	notFound := fmt.Errorf("%w: Atlantis", ErrCityNotFound)
+	tests := []struct {
+		name       string
+		first      error
+		second     error
+		wantSource string
+		wantErr    error
+		wantCalls  int // of the second provider
+	}{
+		{"first serves", nil, nil, "first", nil, 0},
+		{"outage falls back", outage, nil, "second", nil, 1},
+		{"quota falls back", ErrQuotaExceeded, nil, "second", nil, 1},
+		{"timeout falls back", fmt.Errorf("%w after 5s", ErrUpstreamTimeout), nil, "second", nil, 1},
+		{"bad key falls back", errInvalidAPIKey, nil, "second", nil, 1},
+		{"unknown city stops", notFound, nil, "", ErrCityNotFound, 0},
+		{"cancelled stops", context.Canceled, nil, "", context.Canceled, 0},
+		{"all fail", outage, ErrQuotaExceeded, "", ErrQuotaExceeded, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			first := &stubProvider{data: CityWeatherData{City: "London", Source: "first"}, err: tt.first}
+			second := &stubProvider{data: CityWeatherData{City: "London", Source: "second"}, err: tt.second}
+			chain := &fallbackProvider{providers: []WeatherProvider{first, second}, names: []string{"first", "second"}}
+
+			data, err := chain.Current(context.Background(), "London")
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("err = %v, want %v", err, tt.wantErr)
+				}
+			} else if err != nil || data.Source != tt.wantSource {
+				t.Errorf("got %q, %v, want data from %s", data.Source, err, tt.wantSource)
+			}
+			if first.calls != 1 || second.calls != tt.wantCalls {
+				t.Errorf("calls = %d, %d, want 1, %d", first.calls, second.calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+// WEATHER_PROVIDERS=weatherstack,simulated against a Weatherstack that
+// answers with body
+func chainServer(t *testing.T, body string) *httptest.Server {
+	t.Helper()
+	weatherstack := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, body)
+	}))
+	t.Cleanup(weatherstack.Close)
+	for name, value := range map[string]string{
+		"WEATHER_PROVIDERS": "weatherstack,simulated", "WEATHER_FIXTURES": "",
+		"WEATHERSTACK_API_KEYS": "", "WEATHERSTACK_API_KEY": "chain-key", "WEATHERSTACK_BASE_URL": weatherstack.URL,
+		"SIM_SCENARIO": "", "SIM_SCRIPTED_FILE": "", "SIM_DESC_BUCKETS": "",
+	} {
+		t.Setenv(name, value)
+	}
+	config := DefaultConfig()
+	config.Mode = ModeLive
+	config.Provider = providerName(ModeLive)
+	config.RetryAttempts = 1
+	up := newUpstream()
+	provider, err := up.newProvider(ModeLive, config)
+	if err != nil {
+		t.Fatalf("newProvider: %v", err)
+	}
+	srv, err := newServer(provider, config, up)
+	if err != nil {
+		t.Fatalf("newServer: %v", err)
+	}
+	ts := httptest.NewServer(srv.Handler())
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func TestFallbackChainFromEnvironment(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantSource string
+	}{
+		{"healthy", `{"location": {"name": "London"}, "current": {"temperature": 14, "weather_code": 116, "weather_descriptions": ["Partly cloudy"]}}`,
+			http.StatusOK, "weatherstack"},
+		{"over quota", `{"success": false, "error": {"code": 104, "info": "Monthly limit reached"}}`, http.StatusOK, "simulated"},
+		{"unknown city", `{"success": false, "error": {"code": 615, "info": "No results"}}`, http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := chainServer(t, tt.body)
+			resp, err := http.Get(ts.URL + "/weather?city=London")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if tt.wantSource == "" {
+				return
+			}
+			var data CityWeatherData
+			if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+				t.Fatal(err)
+			}
+			if data.Source != tt.wantSource {
+				t.Errorf("source = %q, want %q", data.Source, tt.wantSource)
+			}
+		})
+	}
+}
@@ -0,0 +1,193 @@
+package weather
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Upper bounds of the round-trip latency histogram; slower calls land in
+// a final +Inf bucket
+var latencyBuckets = []time.Duration{
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+// Calls, failures by class and round-trip latency for one provider
+type providerMetrics struct {
+	mu      sync.Mutex
+	calls   uint64
+	errors  map[string]uint64
+	buckets []uint64 // per bucket, not cumulative; one more than latencyBuckets
+}
+
+type latencyBucket struct {
+	LE    string `json:"le"` // upper bound in milliseconds, or "+Inf"
+	Count uint64 `json:"count"`
+}
+
+type providerSnapshot struct {
+	Calls     uint64            `json:"calls"`
+	Errors    map[string]uint64 `json:"errors"`
+	LatencyMs []latencyBucket   `json:"latency_ms"` // cumulative, Prometheus style
+}
+
+func (m *providerMetrics) record(latency time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls++
+	if err != nil {
+		m.errors[errorClass(err)]++
+	}
+	i := 0
+	for i < len(latencyBuckets) && latency > latencyBuckets[i] {
+		i++
+	}
+	m.buckets[i]++
+}
+
+func (m *providerMetrics) snapshot() providerSnapshot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := providerSnapshot{Calls: m.calls, Errors: make(map[string]uint64, len(m.errors))}
+	for class, n := range m.errors {
+		s.Errors[class] = n
+	}
+	var total uint64
+	for i, n := range m.buckets {
+		total += n
+		le := "+Inf"
+		if i < len(latencyBuckets) {
+			le = strconv.FormatInt(latencyBuckets[i].Milliseconds(), 10)
+		}
+		s.LatencyMs = append(s.LatencyMs, latencyBucket{LE: le, Count: total})
+	}
+	return s
+}
+
+// Metrics for every instrumented provider, keyed by provider name
+type providerStats struct {
+	mu     sync.Mutex
+	byName map[string]*providerMetrics
+}
+
+func newProviderStats() *providerStats {
+	return &providerStats{byName: make(map[string]*providerMetrics)}
+}
+
+func (ps *providerStats) metricsFor(name string) *providerMetrics {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	m, ok := ps.byName[name]
+	if !ok {
+		m = &providerMetrics{errors: make(map[string]uint64), buckets: make([]uint64, len(latencyBuckets)+1)}
+		ps.byName[name] = m
+	}
+	return m
+}
+
+func (ps *providerStats) snapshots() map[string]providerSnapshot {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	out := make(map[string]providerSnapshot, len(ps.byName))
+	for name, m := range ps.byName {
+		out[name] = m.snapshot()
+	}
+	return out
+}
+
+// Coarse failure class used as the errors dimension
+func errorClass(err error) string {
+	var ne net.Error
+	switch {
+	case errors.Is(err, ErrCityNotFound):
+		return "not_found"
+	case errors.Is(err, ErrUpstreamTimeout):
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, ErrUpstreamBadResponse):
+		return "bad_response"
+	case errors.Is(err, ErrQuotaExceeded), errors.Is(err, errAllKeysExhausted):
+		return "quota"
+	case errors.Is(err, ErrMissingAPIKey), errors.Is(err, errInvalidAPIKey):
+		return "auth"
+	case errors.As(err, &ne):
+		return "network"
+	}
+	return "other"
+}
+
+// Decorator that records metrics for any provider under the given name
+type instrumentedProvider struct {
+	next    WeatherProvider
+	metrics *providerMetrics
+}
+
+func (ps *providerStats) instrument(name string, p WeatherProvider) WeatherProvider {
+	return &instrumentedProvider{next: p, metrics: ps.metricsFor(name)}
+}
+
+func (p *instrumentedProvider) Timeout() time.Duration { return p.next.Timeout() }
+
+func (p *instrumentedProvider) Current(ctx context.Context, city string) (CityWeatherData, error) {
+	timer := &roundTripTimer{}
+	start := time.Now()
+	data, err := p.next.Current(context.WithValue(ctx, roundTripTimerKey{}, timer), city)
+
+	// Time on the wire when the call went over HTTP, excluding our parsing;
+	// the whole call otherwise, e.g. simulated data or replayed fixtures
+	latency, ok := timer.total()
+	if !ok {
+		latency = time.Since(start)
+	}
+	p.metrics.record(latency, err)
+	return data, err
+}
+
+type roundTripTimerKey struct{}
+
+// Accumulates the HTTP round trips made on behalf of one provider call
+type roundTripTimer struct {
+	mu      sync.Mutex
+	elapsed time.Duration
+	trips   int
+}
+
+func (t *roundTripTimer) add(d time.Duration) {
+	t.mu.Lock()
+	t.elapsed += d
+	t.trips++
+	t.mu.Unlock()
+}
+
+func (t *roundTripTimer) total() (time.Duration, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.elapsed, t.trips > 0
+}
+
+// Times each round trip, up to the response headers, for the provider
+// call that made it
+type timedTransport struct {
+	next http.RoundTripper
+}
+
+func (t *timedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	if timer, ok := req.Context().Value(roundTripTimerKey{}).(*roundTripTimer); ok {
+		timer.add(time.Since(start))
+	}
+	return resp, err
+}
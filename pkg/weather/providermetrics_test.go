@@ -0,0 +1,109 @@
+package weather
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestInstrumentedProviderCounts(t *testing.T) {
+	stats := newProviderStats()
+	upstream := &stubProvider{data: CityWeatherData{City: "London"}}
+	p := stats.instrument("stub", upstream)
+
+	for _, err := range []error{
+		nil, nil, nil,
+		fmt.Errorf("%w: Atlantis", ErrCityNotFound),
+		fmt.Errorf("%w after 5s", ErrUpstreamTimeout),
+		&StatusError{Code: 502, Status: "502 Bad Gateway"},
+	} {
+		upstream.err = err
+		p.Current(context.Background(), "London")
+	}
+
+	got := stats.snapshots()["stub"]
+	if got.Calls != 6 {
+		t.Errorf("calls = %d, want 6", got.Calls)
+	}
+	want := map[string]uint64{"not_found": 1, "timeout": 1, "bad_response": 1}
+	if len(got.Errors) != len(want) {
+		t.Errorf("errors = %v, want %v", got.Errors, want)
+	}
+	for class, n := range want {
+		if got.Errors[class] != n {
+			t.Errorf("errors[%s] = %d, want %d", class, got.Errors[class], n)
+		}
+	}
+	if n := len(got.LatencyMs); n != len(latencyBuckets)+1 || got.LatencyMs[n-1].LE != "+Inf" || got.LatencyMs[n-1].Count != 6 {
+		t.Errorf("latency = %+v, want every call counted by +Inf", got.LatencyMs)
+	}
+	// Instant calls all fall in the first bucket
+	if got.LatencyMs[0].LE != "50" || got.LatencyMs[0].Count != 6 {
+		t.Errorf("first bucket = %+v, want all 6 calls under 50ms", got.LatencyMs[0])
+	}
+}
+
+// Only the round trip is timed, so a slow upstream shows up in the
+// histogram and local work after it does not
+func TestInstrumentedProviderTimesRoundTrip(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(120 * time.Millisecond)
+		fmt.Fprint(w, `{"current": {"temperature": 10}}`)
+	}))
+	defer ts.Close()
+	ws, err := NewWeatherstackProvider(ts.URL, newKeyPool([]string{"test-key"}, time.Minute), newUpstreamClient(1, time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats := newProviderStats()
+	p := stats.instrument("weatherstack", ws)
+	for i := 0; i < 3; i++ {
+		if _, err := p.Current(context.Background(), "London"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	latency := stats.snapshots()["weatherstack"].LatencyMs
+	if latency[1].Count != 0 || latency[2].LE != "250" || latency[2].Count != 3 {
+		t.Errorf("latency = %+v, want all 3 calls between 100 and 250ms", latency)
+	}
+}
+
+func TestProviderMetricsInStats(t *testing.T) {
+	up := newUpstream()
+	provider := up.stats.instrument("stub", &stubProvider{data: CityWeatherData{City: "London", Temp: 10, CacheTime: time.Now()}})
+	config := DefaultConfig()
+	srv, err := newServer(provider, config, up)
+	if err != nil {
+		t.Fatalf("newServer: %v", err)
+	}
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	for _, city := range []string{"London", "Paris", "London"} {
+		resp, err := http.Get(ts.URL + "/weather?city=" + city)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	resp, err := http.Get(ts.URL + "/cache/stats")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var stats struct {
+		Providers map[string]providerSnapshot `json:"providers"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&stats); err != nil {
+		t.Fatal(err)
+	}
+	// The second London request is a cache hit
+	if got := stats.Providers["stub"]; got.Calls != 2 || len(got.LatencyMs) == 0 {
+		t.Errorf("providers = %+v, want 2 calls to stub", stats.Providers)
+	}
+}
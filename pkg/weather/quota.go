@@ -0,0 +1,116 @@
+package weather
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Returned instead of calling upstream once the month's budget is spent
+var errQuotaExhausted = errors.New("upstream quota exhausted for this month")
+
+// Calls made in the current calendar month, as persisted to disk
+type quotaState struct {
+	Month string `json:"month"` // e.g. "2026-10"
+	Calls int    `json:"calls"`
+}
+
+// Counts upstream calls against a monthly budget and refuses to exceed it.
+// The count is saved after every call so a restart does not reset it.
+type quotaTracker struct {
+	next  WeatherProvider
+	limit int
+	path  string
+	now   func() time.Time
+
+	mu    sync.Mutex
+	state quotaState
+}
+
+func newQuotaTracker(next WeatherProvider, limit int, path string) (*quotaTracker, error) {
+	q := &quotaTracker{next: next, limit: limit, path: path, now: time.Now}
+	b, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(b, &q.state); err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", path, err)
+		}
+	}
+	return q, nil
+}
+
+func (q *quotaTracker) Timeout() time.Duration { return q.next.Timeout() }
+
+func (q *quotaTracker) Current(ctx context.Context, city string) (CityWeatherData, error) {
+	if !q.reserve() {
+		return CityWeatherData{}, errQuotaExhausted
+	}
+	return q.next.Current(ctx, city)
+}
+
+// Take one call from the budget; a failed call still counts upstream
+func (q *quotaTracker) reserve() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.rollover()
+	if q.state.Calls >= q.limit {
+		return false
+	}
+	q.state.Calls++
+	if err := q.save(); err != nil {
+		slog.Error("Error saving quota state", "err", err)
+	}
+	return true
+}
+
+// Start a fresh count when the calendar month changes
+func (q *quotaTracker) rollover() {
+	if month := q.now().Format("2006-01"); q.state.Month != month {
+		q.state = quotaState{Month: month}
+	}
+}
+
+// Write to a temporary file and rename, so a crash cannot leave it torn
+func (q *quotaTracker) save() error {
+	b, err := json.Marshal(q.state)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(q.path), ".quota-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), q.path)
+}
+
+func (q *quotaTracker) remaining() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.rollover()
+	return max(q.limit-q.state.Calls, 0)
+}
+
+// Time until the budget resets at the start of next month
+func (q *quotaTracker) resetIn() time.Duration {
+	now := q.now()
+	next := time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, now.Location())
+	return next.Sub(now)
+}
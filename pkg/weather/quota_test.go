@@ -0,0 +1,77 @@
+package weather
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Answers every city at once, counting the calls
+type countingProvider struct{ calls int }
+
+func (p *countingProvider) Timeout() time.Duration { return 0 }
+
+func (p *countingProvider) Current(ctx context.Context, city string) (CityWeatherData, error) {
+	p.calls++
+	return CityWeatherData{City: city, Temp: 10, CacheTime: time.Now()}, nil
+}
+
+func TestQuotaRollsOverWithTheMonth(t *testing.T) {
+	for _, tt := range []struct {
+		name       string
+		last, next time.Time
+	}{
+		{"month", time.Date(2026, 10, 31, 23, 59, 0, 0, time.UTC), time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)},
+		{"year", time.Date(2026, 12, 31, 23, 59, 59, 0, time.UTC), time.Date(2027, 1, 1, 0, 0, 1, 0, time.UTC)},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "quota.json")
+			upstream := &countingProvider{}
+			q, err := newQuotaTracker(upstream, 3, path)
+			if err != nil {
+				t.Fatalf("newQuotaTracker: %v", err)
+			}
+			now := tt.last
+			q.now = func() time.Time { return now }
+
+			for i := 0; i < 3; i++ {
+				if _, err := q.Current(context.Background(), "London"); err != nil {
+					t.Fatalf("call %d: %v", i+1, err)
+				}
+			}
+			if _, err := q.Current(context.Background(), "London"); !errors.Is(err, errQuotaExhausted) {
+				t.Fatalf("over budget: err = %v, want errQuotaExhausted", err)
+			}
+			if upstream.calls != 3 || q.remaining() != 0 {
+				t.Errorf("%d upstream calls, %d remaining; want 3 and 0", upstream.calls, q.remaining())
+			}
+			if want := tt.next.Sub(tt.last); q.resetIn() > want {
+				t.Errorf("resets in %v, want at most %v", q.resetIn(), want)
+			}
+
+			// The new month starts with the whole budget
+			now = tt.next
+			if got := q.remaining(); got != 3 {
+				t.Errorf("remaining after rollover = %d, want 3", got)
+			}
+			if _, err := q.Current(context.Background(), "London"); err != nil {
+				t.Fatalf("after rollover: %v", err)
+			}
+
+			// and a restart picks up where it left off
+			reloaded, err := newQuotaTracker(upstream, 3, path)
+			if err != nil {
+				t.Fatalf("reloading: %v", err)
+			}
+			reloaded.now = q.now
+			if want := (quotaState{Month: tt.next.Format("2006-01"), Calls: 1}); reloaded.state != want {
+				t.Errorf("saved state = %+v, want %+v", reloaded.state, want)
+			}
+			if got := reloaded.remaining(); got != 2 {
+				t.Errorf("remaining after restart = %d, want 2", got)
+			}
+		})
+	}
+}
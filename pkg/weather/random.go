@@ -0,0 +1,35 @@
+package weather
+
+import (
+	"math/rand"
+	"net/http"
+)
+
+// Well-known cities /weather/random picks from
+var demoCities = []string{
+	"London", "Paris", "Berlin", "Madrid", "Rome", "Amsterdam", "Vienna", "Prague", "Stockholm", "Oslo",
+	"Copenhagen", "Dublin", "Lisbon", "Athens", "Istanbul", "Moscow", "Cairo", "Lagos", "Nairobi", "Johannesburg",
+	"Cape Town", "Casablanca", "Dubai", "Riyadh", "Tehran", "Karachi", "Mumbai", "Delhi", "Bangalore", "Dhaka",
+	"Bangkok", "Singapore", "Jakarta", "Manila", "Hong Kong", "Shanghai", "Beijing", "Seoul", "Tokyo", "Sydney",
+	"Melbourne", "Auckland", "Honolulu", "Los Angeles", "San Francisco", "Chicago", "New York", "Toronto", "Mexico City", "Sao Paulo",
+}
+
+// Weather for a random demo city, served exactly as /weather would
+func (s *Server) randomHandler(w http.ResponseWriter, r *http.Request) {
+	var candidates []string
+	for _, city := range demoCities {
+		if s.allowed.allows(city) {
+			candidates = append(candidates, city)
+		}
+	}
+	if len(candidates) == 0 {
+		writeProblem(w, http.StatusNotFound, "", "No demo cities are allowed", r.URL.Path)
+		return
+	}
+
+	r2 := r.Clone(r.Context())
+	q := r2.URL.Query()
+	q.Set("city", candidates[rand.Intn(len(candidates))])
+	r2.URL.RawQuery = q.Encode()
+	s.weatherHandler(w, r2)
+}
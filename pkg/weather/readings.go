@@ -0,0 +1,322 @@
+package weather
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Writes waiting for the database before new ones are dropped
+const readingQueueSize = 1000
+
+// Schema changes in order; the database records how many it has applied,
+// so only later ones run at startup. Append, never edit.
+var readingMigrations = []string{
+	`CREATE TABLE readings (
+		id          INTEGER PRIMARY KEY AUTOINCREMENT,
+		city        TEXT NOT NULL,
+		temp        REAL NOT NULL,
+		desc        TEXT NOT NULL,
+		humidity    REAL,
+		wind_speed  REAL,
+		observed_at DATETIME NOT NULL,
+		provider    TEXT NOT NULL
+	)`,
+	`CREATE INDEX readings_city_observed_at ON readings (city, observed_at)`,
+}
+
+// Every successful upstream fetch, kept in SQLite for trend features
+// beyond the cache's lifetime; a nil store records nothing
+type readingStore struct {
+	db      *sql.DB
+	queue   chan CityWeatherData
+	done    chan struct{} // closed once the writer has drained the queue
+	dropped atomic.Uint64 // readings lost because the queue was full
+
+	lastDropWarn atomic.Int64 // unix second of the last warning, so a backlog logs once a second
+
+	mu     sync.RWMutex // held to queue a reading, and exclusively to close
+	closed bool
+}
+
+// Open the database at path, bring its schema up to date and start the
+// single writer goroutine
+func openReadingStore(path string) (*readingStore, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	// One connection, so a read waits for the writer instead of failing
+	// with SQLITE_BUSY, and a :memory: database is the same one throughout
+	db.SetMaxOpenConns(1)
+	if err := migrateReadings(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	rs := &readingStore{db: db, queue: make(chan CityWeatherData, readingQueueSize), done: make(chan struct{})}
+	go rs.writer()
+	return rs, nil
+}
+
+// Stop taking readings, wait for the queued ones to be written and close
+// the database. Readings fetched later, e.g. by a refresh still running,
+// are dropped.
+func (rs *readingStore) close() error {
+	if rs == nil {
+		return nil
+	}
+	rs.mu.Lock()
+	if rs.closed {
+		rs.mu.Unlock()
+		return nil
+	}
+	rs.closed = true
+	close(rs.queue)
+	rs.mu.Unlock()
+	<-rs.done
+	return rs.db.Close()
+}
+
+func migrateReadings(db *sql.DB) error {
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_version (version INTEGER NOT NULL)`); err != nil {
+		return err
+	}
+	var version int
+	if err := db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_version`).Scan(&version); err != nil {
+		return err
+	}
+	if version > len(readingMigrations) {
+		return fmt.Errorf("database schema version %d is newer than this server knows (%d)", version, len(readingMigrations))
+	}
+	for i := version; i < len(readingMigrations); i++ {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(readingMigrations[i]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d: %w", i+1, err)
+		}
+		if _, err := tx.Exec(`DELETE FROM schema_version`); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if _, err := tx.Exec(`INSERT INTO schema_version (version) VALUES (?)`, i+1); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+		slog.Info("Applied readings database migration", "version", i+1)
+	}
+	return nil
+}
+
+// Drain the queue so only one goroutine ever writes to the database
+func (rs *readingStore) writer() {
+	defer close(rs.done)
+	for data := range rs.queue {
+		observed := data.CacheTime
+		if data.ObservationTime != nil {
+			observed = *data.ObservationTime
+		}
+		_, err := rs.db.Exec(
+			`INSERT INTO readings (city, temp, desc, humidity, wind_speed, observed_at, provider) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			data.City, data.Temp, data.Desc, data.Humidity, data.WindSpeed, observed.UTC(), data.Source,
+		)
+		if err != nil {
+			slog.Error("Error writing reading", "city", data.City, "err", err)
+		}
+	}
+}
+
+// Queue a reading without ever blocking the request path; when the
+// writer falls behind the reading is dropped and counted
+func (rs *readingStore) record(data CityWeatherData) {
+	if rs == nil {
+		return
+	}
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+	if rs.closed {
+		return
+	}
+	select {
+	case rs.queue <- data:
+	default:
+		dropped := rs.dropped.Add(1)
+		if now := time.Now().Unix(); rs.lastDropWarn.Swap(now) != now {
+			slog.Warn("Readings queue full, dropping readings", "city", data.City, "dropped_total", dropped)
+		}
+	}
+}
+
+const (
+	defaultReadingsWindow = 24 * time.Hour
+	maxReadingsWindow     = 31 * 24 * time.Hour
+	defaultReadingsLimit  = 100
+	maxReadingsLimit      = 1000
+)
+
+type storedReading struct {
+	City       string    `json:"city"`
+	Temp       float64   `json:"temp"`
+	Desc       string    `json:"desc"`
+	Humidity   *float64  `json:"humidity,omitempty"`
+	WindSpeed  *float64  `json:"wind_speed,omitempty"`
+	ObservedAt time.Time `json:"observed_at"`
+	Provider   string    `json:"provider"`
+
+	id int64
+}
+
+type readingsPage struct {
+	City       string          `json:"city"`
+	From       time.Time       `json:"from"`
+	To         time.Time       `json:"to"`
+	Readings   []storedReading `json:"readings"`
+	NextCursor string          `json:"next_cursor,omitempty"` // pass as cursor for the next page
+}
+
+// Where a page ended: the last reading's time and row ID, since several
+// readings can share a time
+type readingsCursor struct {
+	at time.Time
+	id int64
+}
+
+func (c readingsCursor) String() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(c.at.UTC().Format(time.RFC3339Nano) + "|" + strconv.FormatInt(c.id, 10)))
+}
+
+func parseReadingsCursor(s string) (readingsCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return readingsCursor{}, errors.New("malformed cursor")
+	}
+	at, id, ok := strings.Cut(string(b), "|")
+	t, err1 := time.Parse(time.RFC3339Nano, at)
+	n, err2 := strconv.ParseInt(id, 10, 64)
+	if !ok || err1 != nil || err2 != nil {
+		return readingsCursor{}, errors.New("malformed cursor")
+	}
+	return readingsCursor{at: t, id: n}, nil
+}
+
+// Up to limit readings of city observed in [from, to) and after the
+// cursor, oldest first, and whether more follow. Times are compared as
+// the driver writes them, which sorts correctly for UTC times.
+func (rs *readingStore) query(city string, from, to time.Time, after *readingsCursor, limit int) ([]storedReading, bool, error) {
+	query := `SELECT id, city, temp, desc, humidity, wind_speed, observed_at, provider FROM readings
+		WHERE city = ? COLLATE NOCASE AND observed_at >= ? AND observed_at < ?`
+	args := []interface{}{city, from.UTC(), to.UTC()}
+	if after != nil {
+		query += ` AND (observed_at > ? OR (observed_at = ? AND id > ?))`
+		args = append(args, after.at.UTC(), after.at.UTC(), after.id)
+	}
+	query += ` ORDER BY observed_at, id LIMIT ?`
+	args = append(args, limit+1)
+
+	rows, err := rs.db.Query(query, args...)
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+	readings := []storedReading{}
+	for rows.Next() {
+		var r storedReading
+		if err := rows.Scan(&r.id, &r.City, &r.Temp, &r.Desc, &r.Humidity, &r.WindSpeed, &r.ObservedAt, &r.Provider); err != nil {
+			return nil, false, err
+		}
+		readings = append(readings, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, false, err
+	}
+	if len(readings) > limit {
+		return readings[:limit], true, nil
+	}
+	return readings, false, nil
+}
+
+// Stored readings for a city over a time range, oldest first, from the
+// database alone; a city never fetched has an empty list
+func (s *Server) readingsHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	city := q.Get("city")
+	if city == "" {
+		writeProblem(w, http.StatusBadRequest, "", "City parameter is required", r.URL.Path)
+		return
+	}
+	city, err := ValidateCity(city)
+	if err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+	city = s.aliases.resolve(city)
+
+	to := time.Now()
+	if v := q.Get("to"); v != "" {
+		if to, err = time.Parse(time.RFC3339, v); err != nil {
+			writeProblem(w, http.StatusBadRequest, "", fmt.Sprintf("Invalid to parameter %q: want an RFC 3339 time such as 2024-01-15T12:00:00Z", v), r.URL.Path)
+			return
+		}
+	}
+	from := to.Add(-defaultReadingsWindow)
+	if v := q.Get("from"); v != "" {
+		if from, err = time.Parse(time.RFC3339, v); err != nil {
+			writeProblem(w, http.StatusBadRequest, "", fmt.Sprintf("Invalid from parameter %q: want an RFC 3339 time such as 2024-01-15T12:00:00Z", v), r.URL.Path)
+			return
+		}
+	}
+	if !from.Before(to) {
+		writeProblem(w, http.StatusBadRequest, "", "From must be before to", r.URL.Path)
+		return
+	}
+	if to.Sub(from) > maxReadingsWindow {
+		writeProblem(w, http.StatusBadRequest, "", fmt.Sprintf("Time range too long: at most %d days", int(maxReadingsWindow.Hours()/24)), r.URL.Path)
+		return
+	}
+
+	limit := defaultReadingsLimit
+	if l := q.Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n <= 0 {
+			writeProblem(w, http.StatusBadRequest, "", "Limit must be a positive integer", r.URL.Path)
+			return
+		}
+		limit = min(n, maxReadingsLimit)
+	}
+	var after *readingsCursor
+	if v := q.Get("cursor"); v != "" {
+		c, err := parseReadingsCursor(v)
+		if err != nil {
+			writeProblem(w, http.StatusBadRequest, "", fmt.Sprintf("Invalid cursor parameter: %v", err), r.URL.Path)
+			return
+		}
+		after = &c
+	}
+
+	readings, more, err := s.readings.query(city, from, to, after, limit)
+	if err != nil {
+		writeProblem(w, http.StatusInternalServerError, "", fmt.Sprintf("Error reading history: %v", err), r.URL.Path)
+		return
+	}
+	page := readingsPage{City: city, From: from, To: to, Readings: readings}
+	if more {
+		last := readings[len(readings)-1]
+		page.NextCursor = readingsCursor{at: last.ObservedAt, id: last.id}.String()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
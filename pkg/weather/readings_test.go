@@ -0,0 +1,180 @@
+package weather_test
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/deepakg86/weather-api-caching/pkg/weather"
+	"github.com/deepakg86/weather-api-caching/pkg/weather/testutil"
+)
+
+type readingsBody struct {
+	City     string `json:"city"`
+	Readings []struct {
+		City       string    `json:"city"`
+		Temp       float64   `json:"temp"`
+		ObservedAt time.Time `json:"observed_at"`
+	} `json:"readings"`
+	NextCursor string `json:"next_cursor"`
+}
+
+var readingsEpoch = time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+
+// A server keeping readings in a fresh database, and a second handle on
+// that database for seeding it directly
+func newReadingsServer(t *testing.T) (*httptest.Server, *sql.DB, *testutil.MockWeatherProvider) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "readings.db")
+	mock := testutil.NewMockWeatherProvider(nil, nil)
+	ts := newTestServer(t, mock, func(config *weather.Config) { config.ReadingsDBPath = path })
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatalf("opening %s: %v", path, err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return ts, db, mock
+}
+
+// Insert a reading of city observed hours after the epoch, with that as
+// its temperature so the order is easy to check
+func seedReading(t *testing.T, db *sql.DB, city string, hours float64) {
+	t.Helper()
+	observed := readingsEpoch.Add(time.Duration(hours * float64(time.Hour)))
+	_, err := db.Exec(`INSERT INTO readings (city, temp, desc, observed_at, provider) VALUES (?, ?, 'Cool', ?, 'mock')`, city, hours, observed)
+	if err != nil {
+		t.Fatalf("seeding: %v", err)
+	}
+}
+
+func historyQuery(city string, fromHours, toHours float64, extra string) string {
+	at := func(h float64) string {
+		return url.QueryEscape(readingsEpoch.Add(time.Duration(h * float64(time.Hour))).Format(time.RFC3339))
+	}
+	return fmt.Sprintf("/history/readings?city=%s&from=%s&to=%s%s", url.QueryEscape(city), at(fromHours), at(toHours), extra)
+}
+
+func temps(body readingsBody) []float64 {
+	result := []float64{}
+	for _, r := range body.Readings {
+		result = append(result, r.Temp)
+	}
+	return result
+}
+
+func TestHistoryFiltersByCityAndRange(t *testing.T) {
+	ts, db, mock := newReadingsServer(t)
+	// Out of order, so the response order comes from the query
+	for _, h := range []float64{3, 0, 4, 1, 2} {
+		seedReading(t, db, "London", h)
+	}
+	seedReading(t, db, "Paris", 2)
+
+	var body readingsBody
+	resp := getJSON(t, ts, historyQuery("london", 1, 4, ""), &body)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d", resp.StatusCode)
+	}
+	// from is inclusive, to exclusive, and the city matches in any case
+	if got, want := fmt.Sprint(temps(body)), "[1 2 3]"; got != want {
+		t.Errorf("temps = %s, want %s", got, want)
+	}
+	for _, r := range body.Readings {
+		if r.City != "London" {
+			t.Errorf("reading of %s in London's history", r.City)
+		}
+	}
+	if body.NextCursor != "" {
+		t.Errorf("next_cursor = %q on the only page", body.NextCursor)
+	}
+	if calls := mock.Calls("london") + mock.Calls("London"); calls != 0 {
+		t.Errorf("provider called %d times", calls)
+	}
+}
+
+func TestHistoryEmptyForUnknownCity(t *testing.T) {
+	ts, _, _ := newReadingsServer(t)
+	var raw map[string]interface{}
+	resp := getJSON(t, ts, historyQuery("Atlantis", 0, 24, ""), &raw)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want 200", resp.StatusCode)
+	}
+	if readings, ok := raw["readings"].([]interface{}); !ok || len(readings) != 0 {
+		t.Errorf("readings = %v, want an empty list", raw["readings"])
+	}
+}
+
+func TestHistoryPaginates(t *testing.T) {
+	ts, db, _ := newReadingsServer(t)
+	for _, h := range []float64{0, 1, 1, 2, 3} {
+		seedReading(t, db, "London", h)
+	}
+
+	var pages [][]float64
+	query := historyQuery("London", 0, 24, "&limit=2")
+	for page := 0; page < 5; page++ {
+		var body readingsBody
+		getJSON(t, ts, query, &body)
+		pages = append(pages, temps(body))
+		if body.NextCursor == "" {
+			break
+		}
+		query = historyQuery("London", 0, 24, "&limit=2&cursor="+body.NextCursor)
+	}
+	// The two readings sharing a time are split across pages, and neither
+	// is lost or repeated
+	if got, want := fmt.Sprint(pages), "[[0 1] [1 2] [3]]"; got != want {
+		t.Errorf("pages = %s, want %s", got, want)
+	}
+
+	// A page ending exactly at the last reading has no cursor
+	var body readingsBody
+	getJSON(t, ts, historyQuery("London", 0, 24, "&limit=5"), &body)
+	if len(body.Readings) != 5 || body.NextCursor != "" {
+		t.Errorf("%d readings with cursor %q, want all 5 and no cursor", len(body.Readings), body.NextCursor)
+	}
+}
+
+func TestHistoryValidatesQuery(t *testing.T) {
+	ts, _, _ := newReadingsServer(t)
+	tests := []struct {
+		name, query string
+	}{
+		{"missing city", "/history/readings?from=2025-03-01T00:00:00Z"},
+		{"bad from", "/history/readings?city=London&from=yesterday"},
+		{"bad to", "/history/readings?city=London&to=2025-13-01T00:00:00Z"},
+		{"from after to", historyQuery("London", 5, 1, "")},
+		{"empty range", historyQuery("London", 1, 1, "")},
+		{"range too long", historyQuery("London", 0, 32*24, "")},
+		{"bad limit", historyQuery("London", 0, 1, "&limit=0")},
+		{"bad cursor", historyQuery("London", 0, 1, "&cursor=nope!")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var p problemBody
+			if resp := getJSON(t, ts, tt.query, &p); resp.StatusCode != http.StatusBadRequest {
+				t.Errorf("status = %d, want 400 (%s)", resp.StatusCode, p.Detail)
+			}
+		})
+	}
+}
+
+func TestHistoryRecordsFetchedReadings(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "readings.db")
+	ts := newTestServer(t, londonProvider(), func(config *weather.Config) { config.ReadingsDBPath = path })
+	getJSON(t, ts, "/weather?city=London", nil)
+
+	var body readingsBody
+	for deadline := time.Now().Add(5 * time.Second); len(body.Readings) == 0 && time.Now().Before(deadline); {
+		getJSON(t, ts, "/history/readings?city=London", &body)
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(body.Readings) != 1 || body.Readings[0].Temp != 11.5 {
+		t.Errorf("readings = %+v, want the one fetch", body.Readings)
+	}
+}
@@ -0,0 +1,158 @@
+package weather
+
+import (
+	"context"
+	"database/sql"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Answers London with a full reading and fails every other city
+type readingProvider struct{}
+
+func (readingProvider) Timeout() time.Duration { return 0 }
+
+func (readingProvider) Current(ctx context.Context, city string) (CityWeatherData, error) {
+	if normalizeCity(city) != "london" {
+		return CityWeatherData{}, ErrCityNotFound
+	}
+	humidity, wind := 81.0, 13.0
+	observed := time.Date(2026, 3, 7, 9, 30, 0, 0, time.UTC)
+	return CityWeatherData{
+		City: "London", Temp: 11.5, Desc: "Light rain", Humidity: &humidity, WindSpeed: &wind,
+		ObservationTime: &observed, Source: "weatherstack", CacheTime: time.Now(),
+	}, nil
+}
+
+// Rows in the readings table once the writer has caught up to want, or
+// whatever is there after a few seconds
+func readingRows(t *testing.T, db *sql.DB, want int) int {
+	t.Helper()
+	var n int
+	for deadline := time.Now().Add(3 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		if err := db.QueryRow(`SELECT COUNT(*) FROM readings`).Scan(&n); err != nil {
+			t.Fatalf("counting readings: %v", err)
+		}
+		if n >= want {
+			break
+		}
+	}
+	return n
+}
+
+func TestReadingsRecordedInMemoryDatabase(t *testing.T) {
+	config := DefaultConfig()
+	config.ReadingsDBPath = ":memory:"
+	srv, err := NewServer(readingProvider{}, config)
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+	db := srv.readings.db
+
+	getBody(t, ts, "/weather?city=London", nil)
+	if n := readingRows(t, db, 1); n != 1 {
+		t.Fatalf("%d rows after one fetch, want 1", n)
+	}
+	var (
+		city, desc, provider string
+		temp, humidity, wind float64
+		observed             time.Time
+	)
+	err = db.QueryRow(`SELECT city, temp, desc, humidity, wind_speed, observed_at, provider FROM readings`).
+		Scan(&city, &temp, &desc, &humidity, &wind, &observed, &provider)
+	if err != nil {
+		t.Fatalf("reading the row: %v", err)
+	}
+	if city != "London" || temp != 11.5 || desc != "Light rain" || humidity != 81 || wind != 13 || provider != "weatherstack" ||
+		!observed.Equal(time.Date(2026, 3, 7, 9, 30, 0, 0, time.UTC)) {
+		t.Errorf("row = %s %g %q %g %g %v %s, want the fetched reading", city, temp, desc, humidity, wind, observed, provider)
+	}
+
+	// Only fetches are recorded: neither cache hits nor failures add rows
+	getBody(t, ts, "/weather?city=London", nil)
+	getBody(t, ts, "/weather?city=Atlantis", nil)
+	srv.cache.SetExpiry(time.Nanosecond)
+	getBody(t, ts, "/weather?city=London", nil)
+	if n := readingRows(t, db, 2); n != 2 {
+		t.Errorf("%d rows after a hit, a failure and a refetch, want 2", n)
+	}
+}
+
+func TestReadingMigrationsRunOnce(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "readings.db")
+	for i := 0; i < 2; i++ {
+		rs, err := openReadingStore(path)
+		if err != nil {
+			t.Fatalf("opening %d: %v", i+1, err)
+		}
+		var version int
+		rs.db.QueryRow(`SELECT MAX(version) FROM schema_version`).Scan(&version)
+		rs.close()
+		if version != len(readingMigrations) {
+			t.Errorf("open %d: schema version %d, want %d", i+1, version, len(readingMigrations))
+		}
+	}
+
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Exec(`UPDATE schema_version SET version = ?`, len(readingMigrations)+1)
+	db.Close()
+	if _, err := openReadingStore(path); err == nil {
+		t.Error("opened a database from a newer schema")
+	}
+}
+
+func TestReadingsDroppedWhenQueueFull(t *testing.T) {
+	captureLogs(t)
+	// No writer, so the queue never drains
+	rs := &readingStore{queue: make(chan CityWeatherData, 2)}
+	for i := 0; i < 5; i++ {
+		rs.record(CityWeatherData{City: "London"})
+	}
+	if got := rs.dropped.Load(); got != 3 {
+		t.Errorf("dropped %d of 5 with room for 2, want 3", got)
+	}
+	var nilStore *readingStore
+	nilStore.record(CityWeatherData{City: "London"}) // records nothing, without panicking
+}
+
+func TestServerCloseWritesQueuedReadings(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "readings.db")
+	config := DefaultConfig()
+	config.ReadingsDBPath = path
+	srv, err := NewServer(readingProvider{}, config)
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	for i := 0; i < 100; i++ {
+		srv.readings.record(CityWeatherData{City: "Paris", Temp: float64(i), CacheTime: time.Now()})
+	}
+	if err := srv.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	// Later readings, e.g. from a refresh still running, are dropped
+	srv.readings.record(CityWeatherData{City: "Paris"})
+	if err := srv.Close(); err != nil {
+		t.Errorf("second Close: %v", err)
+	}
+
+	// No waiting for the writer: Close has already let it finish
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var n int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM readings`).Scan(&n); err != nil {
+		t.Fatalf("counting readings: %v", err)
+	}
+	if n != 100 {
+		t.Errorf("%d readings written, want all 100 queued before Close", n)
+	}
+}
@@ -0,0 +1,91 @@
+package weather
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Panics on its first call, the way a bad type assertion in a fetch would
+type panickyProvider struct {
+	calls atomic.Int32
+}
+
+func (p *panickyProvider) Timeout() time.Duration { return 0 }
+
+func (p *panickyProvider) Current(ctx context.Context, city string) (CityWeatherData, error) {
+	if p.calls.Add(1) == 1 {
+		var m map[string]int
+		m[city]++ // assignment to entry in nil map
+	}
+	return CityWeatherData{City: city, Temp: 9, Desc: "Drizzle", CacheTime: time.Now()}, nil
+}
+
+func TestPanicAnswers500AndServerKeepsServing(t *testing.T) {
+	captureLogs(t)
+	srv, err := NewServer(&panickyProvider{}, DefaultConfig())
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	var problem problem
+	resp := getBody(t, ts, "/weather?city=London", &problem)
+	if resp.StatusCode != http.StatusInternalServerError || !strings.HasPrefix(resp.Header.Get("Content-Type"), "application/problem+json") {
+		t.Fatalf("status %d, Content-Type %q; want a 500 problem", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	if problem.Status != http.StatusInternalServerError || strings.Contains(problem.Detail, "nil map") {
+		t.Errorf("problem %+v, want a 500 without the panic's details", problem)
+	}
+
+	// Neither the cache nor its fetch key is left stuck
+	for i := 0; i < 3; i++ {
+		var data CityWeatherData
+		if resp := getBody(t, ts, "/weather?city=London", &data); resp.StatusCode != http.StatusOK || data.Temp != 9 {
+			t.Fatalf("request %d after the panic: status %d, %+v", i+1, resp.StatusCode, data)
+		}
+	}
+	var stats struct {
+		Panics uint64 `json:"panics"`
+	}
+	getBody(t, ts, "/cache/stats", &stats)
+	if stats.Panics != 1 {
+		t.Errorf("panics = %d, want 1", stats.Panics)
+	}
+}
+
+func TestRecoverPanicsLogsTheStack(t *testing.T) {
+	logs := captureLogs(t)
+	srv, err := NewServer(&stubProvider{}, DefaultConfig())
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	h := srv.recoverPanics(srv.logRequests(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var v interface{} = "not a number"
+		_ = v.(int)
+	})))
+	req := httptest.NewRequest(http.MethodGet, "/boom", nil)
+	req.Header.Set("X-Request-ID", "panic-1")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("status %d, want 500", rec.Code)
+	}
+	var problem problem
+	if err := json.Unmarshal(rec.Body.Bytes(), &problem); err != nil {
+		t.Errorf("body %q is not a problem: %v", rec.Body, err)
+	}
+	out := logs.String()
+	for _, want := range []string{"Handler panicked", "request_id=panic-1", "interface conversion", "recover_test.go"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("log lacks %q:\n%s", want, out)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package weather
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Default region definitions; REGIONS_FILE replaces them without a rebuild
+//
+//go:embed regions.json
+var regionsJSON []byte
+
+// Upstream fetches one region request may have in flight
+const regionFetchConcurrency = 8
+
+type region struct {
+	name   string // as written in the definitions
+	cities []string
+}
+
+// Regions keyed by lowercased name, for case-insensitive lookup
+type regionIndex map[string]region
+
+// Parse regions from path, or from the embedded list when path is empty
+func loadRegions(path string) (regionIndex, error) {
+	b := regionsJSON
+	if path != "" {
+		var err error
+		if b, err = os.ReadFile(path); err != nil {
+			return nil, err
+		}
+	}
+	var raw map[string][]string
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return nil, fmt.Errorf("parsing regions: %w", err)
+	}
+	regions := make(regionIndex, len(raw))
+	for name, cities := range raw {
+		regions[strings.ToLower(name)] = region{name: name, cities: cities}
+	}
+	return regions, nil
+}
+
+type regionWeather struct {
+	Region string            `json:"region"`
+	Cities []CityWeatherData `json:"cities"`
+	Errors map[string]string `json:"errors,omitempty"` // city to why it is missing
+}
+
+func (s *Server) regionHandler(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		writeProblem(w, http.StatusBadRequest, "", "Name parameter is required", r.URL.Path)
+		return
+	}
+	reg, ok := s.regions[strings.ToLower(name)]
+	if !ok {
+		writeProblem(w, http.StatusNotFound, "", fmt.Sprintf("Region not found: %s", name), r.URL.Path)
+		return
+	}
+
+	// Cache first, under the keys /weather uses, with a bounded number of
+	// concurrent fetches per request; each also takes one of the server's
+	// request slots, so a region cannot push upstream past the limit
+	result := regionWeather{Region: reg.name, Cities: []CityWeatherData{}}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, regionFetchConcurrency)
+	for _, city := range reg.cities {
+		if !s.allowed.allows(s.aliases.resolve(city)) {
+			continue
+		}
+		wg.Add(1)
+		go func(city string) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			data, _, err := s.snapshot(r.Context(), s.aliases.resolve(city), defaultLanguage)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				if result.Errors == nil {
+					result.Errors = make(map[string]string)
+				}
+				result.Errors[city] = err.Error()
+				return
+			}
+			result.Cities = append(result.Cities, data)
+		}(city)
+	}
+	wg.Wait()
+
+	sort.Slice(result.Cities, func(i, j int) bool {
+		return result.Cities[i].City < result.Cities[j].City
+	})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
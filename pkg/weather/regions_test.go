@@ -0,0 +1,116 @@
+package weather_test
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/deepakg86/weather-api-caching/pkg/weather"
+	"github.com/deepakg86/weather-api-caching/pkg/weather/testutil"
+)
+
+type regionBody struct {
+	Region string                    `json:"region"`
+	Cities []weather.CityWeatherData `json:"cities"`
+	Errors map[string]string         `json:"errors"`
+}
+
+// Each region request fans out over goroutines that all record their
+// cache result on the one request; run with -race
+func TestRegionHandlerFetchesConcurrently(t *testing.T) {
+	europe := []string{"Amsterdam", "Athens", "Berlin", "Dublin", "Lisbon", "London", "Madrid", "Paris", "Prague", "Rome", "Stockholm", "Vienna", "Warsaw"}
+	data := make(map[string]weather.CityWeatherData)
+	for _, city := range europe {
+		data[city] = weather.CityWeatherData{City: city, Temp: 15, Desc: "Mild", Source: "mock"}
+	}
+	mock := testutil.NewMockWeatherProvider(data, map[string]error{"Rome": errors.New("upstream down")})
+	ts := newTestServer(t, mock, nil)
+
+	for i := 1; i <= 2; i++ {
+		var body regionBody
+		resp := getJSON(t, ts, "/weather/region?name=europe", &body)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("request %d: status = %d", i, resp.StatusCode)
+		}
+		if body.Region != "Europe" || len(body.Cities) != len(europe)-1 {
+			t.Errorf("request %d: %s with %d cities, want Europe with %d", i, body.Region, len(body.Cities), len(europe)-1)
+		}
+		if !sort.SliceIsSorted(body.Cities, func(a, b int) bool { return body.Cities[a].City < body.Cities[b].City }) {
+			t.Errorf("request %d: cities not sorted", i)
+		}
+		if _, ok := body.Errors["Rome"]; !ok || len(body.Errors) != 1 {
+			t.Errorf("request %d: errors = %v, want Rome only", i, body.Errors)
+		}
+	}
+	if calls := mock.Calls("London"); calls != 1 {
+		t.Errorf("London fetched %d times; the second request should hit the cache", calls)
+	}
+}
+
+func TestRegionHandlerUnknownRegion(t *testing.T) {
+	ts := newTestServer(t, londonProvider(), nil)
+	if resp := getJSON(t, ts, "/weather/region?name=atlantis", nil); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("status = %d, want 404", resp.StatusCode)
+	}
+	if resp := getJSON(t, ts, "/weather/region", nil); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", resp.StatusCode)
+	}
+}
+
+func TestRegionFetchesTakeRequestSlots(t *testing.T) {
+	gate := newGatedProvider()
+	ts := newTestServer(t, gate, func(c *weather.Config) { c.MaxConcurrentRequests = 3 })
+
+	done := make(chan regionBody)
+	go func() {
+		var body regionBody
+		getJSON(t, ts, "/weather/region?name=Europe", &body)
+		done <- body
+	}()
+	for i := 0; i < 3; i++ {
+		<-gate.started
+	}
+	// The region's own limit is higher; the server's holds the rest back
+	time.Sleep(50 * time.Millisecond)
+	if n := gate.inFlight.Load(); n != 3 {
+		t.Errorf("%d region fetches in flight with 3 request slots, want 3", n)
+	}
+	close(gate.release)
+	if body := <-done; len(body.Cities) != 13 {
+		t.Errorf("%d cities, want all 13 once the slots free up", len(body.Cities))
+	}
+	if max := gate.maxInFlight.Load(); max != 3 {
+		t.Errorf("%d upstream calls in flight at once, want 3", max)
+	}
+}
+
+func TestRegionSharesAliasedEntries(t *testing.T) {
+	dir := t.TempDir()
+	regions, aliases := filepath.Join(dir, "regions.json"), filepath.Join(dir, "aliases.txt")
+	if err := os.WriteFile(regions, []byte(`{"East Coast": ["NYC"]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(aliases, []byte("NYC = New York City\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	provider := &warmingProvider{}
+	ts := newTestServer(t, provider, func(config *weather.Config) {
+		config.RegionsFile = regions
+		config.CityAliasesFile = aliases
+	})
+
+	var body regionBody
+	getJSON(t, ts, "/weather/region?name=east%20coast", &body)
+	if len(body.Cities) != 1 || body.Cities[0].City != "New York City" {
+		t.Fatalf("region = %+v, want New York City", body)
+	}
+	var data weather.CityWeatherData
+	getJSON(t, ts, "/weather?city=New%20York%20City", &data)
+	if n := provider.fetches.Load(); n != 1 || data.Temp != body.Cities[0].Temp {
+		t.Errorf("/weather served %v after %d fetches, want the region's entry", data.Temp, n)
+	}
+}
@@ -0,0 +1,201 @@
+package weather
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+// Settings that are safe to change while serving. A reload builds a new
+// set from the environment and swaps it in whole.
+type liveSettings struct {
+	LogLevel          slog.Level
+	CacheTTL          time.Duration
+	Keys              *keyPool // Weatherstack keys and their cooldowns
+	OpenWeatherMapKey string   // read from the environment on every call
+}
+
+// LOG_LEVEL, CACHE_TTL_SECONDS and the API key variables, for providers
+// calling through client
+func liveSettingsFromEnv(client *http.Client) (*liveSettings, error) {
+	level, err := logLevelFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	ttl := DefaultConfig().CacheTTL
+	if v := os.Getenv("CACHE_TTL_SECONDS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid CACHE_TTL_SECONDS %q: must be a positive integer", v)
+		}
+		ttl = time.Duration(n) * time.Second
+	}
+	keys, err := weatherstackKeysFromEnv(client)
+	if err != nil {
+		return nil, err
+	}
+	return &liveSettings{LogLevel: level, CacheTTL: ttl, Keys: keys, OpenWeatherMapKey: os.Getenv("OPENWEATHERMAP_API_KEY")}, nil
+}
+
+// The settings s runs with now, as the baseline for the next reload
+func (s *Server) currentSettings() *liveSettings {
+	keys := newKeyPool(nil, defaultKeyCooldown)
+	if p := s.upstream.keys; p != nil {
+		p.mu.Lock()
+		keys.keys, keys.cooldown, keys.rateLimitCooldown = p.keys, p.cooldown, p.rateLimitCooldown
+		p.mu.Unlock()
+	}
+	return &liveSettings{LogLevel: logLevel.Level(), CacheTTL: s.cache.ttl(), Keys: keys, OpenWeatherMapKey: os.Getenv("OPENWEATHERMAP_API_KEY")}
+}
+
+type settingChange struct {
+	name, from, to string
+}
+
+// What differs between two sets, without ever showing a key
+func (prev *liveSettings) diff(next *liveSettings) []settingChange {
+	var changes []settingChange
+	if prev.LogLevel != next.LogLevel {
+		changes = append(changes, settingChange{"LOG_LEVEL", prev.LogLevel.String(), next.LogLevel.String()})
+	}
+	if prev.CacheTTL != next.CacheTTL {
+		changes = append(changes, settingChange{"CACHE_TTL_SECONDS", prev.CacheTTL.String(), next.CacheTTL.String()})
+	}
+	if !slices.Equal(prev.Keys.keys, next.Keys.keys) {
+		changes = append(changes, settingChange{"WEATHERSTACK_API_KEYS", fmt.Sprintf("%d keys", len(prev.Keys.keys)), fmt.Sprintf("%d keys", len(next.Keys.keys))})
+	}
+	if prev.Keys.cooldown != next.Keys.cooldown {
+		changes = append(changes, settingChange{"WEATHERSTACK_KEY_COOLDOWN", prev.Keys.cooldown.String(), next.Keys.cooldown.String()})
+	}
+	if prev.Keys.rateLimitCooldown != next.Keys.rateLimitCooldown {
+		changes = append(changes, settingChange{"KEY_COOLDOWN_SECONDS", prev.Keys.rateLimitCooldown.String(), next.Keys.rateLimitCooldown.String()})
+	}
+	if prev.OpenWeatherMapKey != next.OpenWeatherMapKey {
+		set := func(k string) string {
+			if k == "" {
+				return "unset"
+			}
+			return "set"
+		}
+		changes = append(changes, settingChange{"OPENWEATHERMAP_API_KEY", set(prev.OpenWeatherMapKey), set(next.OpenWeatherMapKey) + ", changed"})
+	}
+	return changes
+}
+
+// Variables only read at startup; a reload reports changes to them
+var restartOnlyEnv = []string{
+	"WEATHER_MODE", "WEATHER_PROVIDER", "WEATHER_PROVIDERS", "WEATHERSTACK_BASE_URL",
+	"LISTEN_ADDR", "PORT", "HTTP_PORT", "TLS_DOMAIN", "TLS_CERT_FILE", "TLS_KEY_FILE",
+	"LOG_FORMAT", "CACHE_SHARDS", "CACHE_EVICTION_POLICY", "DB_PATH", "ADMIN_TOKEN",
+	"MAX_CONCURRENT_REQUESTS",
+}
+
+// Where the environment came from, so a reload can read it the same way
+type envSource struct {
+	file     string          // -env-file, or "" for an optional .env
+	useFile  bool            // only live mode loads one
+	fromProc map[string]bool // set before the file was read, so never taken from it
+	atStart  map[string]string
+}
+
+// Call before loading the env file, to tell the process's own variables
+// from the file's
+func captureEnv(file string, useFile bool) *envSource {
+	e := &envSource{file: file, useFile: useFile, fromProc: make(map[string]bool), atStart: make(map[string]string)}
+	for _, kv := range os.Environ() {
+		name, _, _ := strings.Cut(kv, "=")
+		e.fromProc[name] = true
+	}
+	return e
+}
+
+// Remember the restart-only values in effect, once the env file is loaded
+func (e *envSource) settle() {
+	for _, name := range restartOnlyEnv {
+		e.atStart[name] = os.Getenv(name)
+	}
+}
+
+// Apply the env file's current values. As at startup, the process's own
+// variables win over the file's.
+func (e *envSource) reread() error {
+	if !e.useFile {
+		return nil
+	}
+	path := e.file
+	if path == "" {
+		path = ".env"
+	}
+	vars, err := godotenv.Read(path)
+	if err != nil {
+		if e.file == "" && errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	for name, v := range vars {
+		if !e.fromProc[name] {
+			os.Setenv(name, v)
+		}
+	}
+	return nil
+}
+
+// Restart-only variables that no longer have their startup value
+func (e *envSource) ignoredChanges() []string {
+	var names []string
+	for _, name := range restartOnlyEnv {
+		if os.Getenv(name) != e.atStart[name] {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Re-read the environment and apply what changed among the live
+// settings. On any error the previous settings stay in force.
+func (s *Server) reload(env *envSource) error {
+	if err := env.reread(); err != nil {
+		return fmt.Errorf("reading env file: %w", err)
+	}
+	next, err := liveSettingsFromEnv(s.upstream.client)
+	if err != nil {
+		return err
+	}
+	prev := s.settings.Load()
+	changes := prev.diff(next)
+
+	// Only what changed is applied, so e.g. a TTL set through
+	// /admin/config survives a reload that leaves CACHE_TTL_SECONDS alone
+	if next.LogLevel != prev.LogLevel {
+		logLevel.Set(next.LogLevel)
+	}
+	if next.CacheTTL != prev.CacheTTL {
+		s.cache.SetExpiry(next.CacheTTL)
+	}
+	keysChanged := !slices.Equal(prev.Keys.keys, next.Keys.keys) ||
+		prev.Keys.cooldown != next.Keys.cooldown || prev.Keys.rateLimitCooldown != next.Keys.rateLimitCooldown
+	if keysChanged && s.upstream.keys != nil {
+		s.upstream.keys.replace(next.Keys)
+	}
+	s.settings.Store(next)
+
+	for _, c := range changes {
+		slog.Info("Setting reloaded", "name", c.name, "from", c.from, "to", c.to)
+	}
+	for _, name := range env.ignoredChanges() {
+		slog.Warn("Setting changed but needs a restart, ignored", "name", name)
+	}
+	if len(changes) == 0 {
+		slog.Info("Configuration reloaded, nothing changed")
+	}
+	return nil
+}
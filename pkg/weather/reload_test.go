@@ -0,0 +1,151 @@
+package weather
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// A Weatherstack stand-in noting the access key of each call
+type keyRecorder struct {
+	mu   sync.Mutex
+	keys []string
+}
+
+func (k *keyRecorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	k.mu.Lock()
+	k.keys = append(k.keys, r.URL.Query().Get("access_key"))
+	k.mu.Unlock()
+	fmt.Fprintf(w, `{"location": {"name": %q}, "current": {"temperature": 10, "weather_code": 113, "weather_descriptions": ["Sunny"]}}`, r.URL.Query().Get("query"))
+}
+
+func (k *keyRecorder) last() string {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if len(k.keys) == 0 {
+		return ""
+	}
+	return k.keys[len(k.keys)-1]
+}
+
+// A live server calling recorder as Weatherstack, built the way Run builds
+// one from the current environment
+func reloadServer(t *testing.T, recorder *keyRecorder) (*Server, *httptest.Server) {
+	t.Helper()
+	upstream := httptest.NewServer(recorder)
+	t.Cleanup(upstream.Close)
+	t.Setenv("WEATHERSTACK_BASE_URL", upstream.URL)
+	config := DefaultConfig()
+	up := newUpstream()
+	provider, err := up.newProvider(ModeLive, config)
+	if err != nil {
+		t.Fatalf("newProvider: %v", err)
+	}
+	srv, err := newServer(provider, config, up)
+	if err != nil {
+		t.Fatalf("newServer: %v", err)
+	}
+	ts := httptest.NewServer(srv.Handler())
+	t.Cleanup(ts.Close)
+	return srv, ts
+}
+
+// Clear the variables reload reads, for the rest of the test
+func clearReloadEnv(t *testing.T) {
+	t.Helper()
+	for _, name := range append([]string{
+		"WEATHERSTACK_API_KEY", "WEATHERSTACK_API_KEYS", "WEATHERSTACK_KEY_COOLDOWN", "KEY_COOLDOWN_SECONDS",
+		"OPENWEATHERMAP_API_KEY", "LOG_LEVEL", "CACHE_TTL_SECONDS", "WEATHER_FIXTURES",
+	}, restartOnlyEnv...) {
+		t.Setenv(name, "")
+		os.Unsetenv(name)
+	}
+}
+
+func TestReloadUsesTheNewKey(t *testing.T) {
+	clearReloadEnv(t)
+	logs := captureLogs(t)
+	prevLevel := logLevel.Level()
+	t.Cleanup(func() { logLevel.Set(prevLevel) })
+	t.Setenv("WEATHERSTACK_API_KEY", "old-key")
+	recorder := &keyRecorder{}
+	srv, ts := reloadServer(t, recorder)
+	env := captureEnv("", false)
+	env.settle()
+
+	getBody(t, ts, "/weather?city=London", nil)
+	if got := recorder.last(); got != "old-key" {
+		t.Fatalf("first fetch used %q, want old-key", got)
+	}
+
+	t.Setenv("WEATHERSTACK_API_KEY", "new-key")
+	t.Setenv("CACHE_TTL_SECONDS", "90")
+	t.Setenv("LISTEN_ADDR", ":9999")
+	if err := srv.reload(env); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	getBody(t, ts, "/weather?city=Paris", nil)
+	if got := recorder.last(); got != "new-key" {
+		t.Errorf("fetch after reload used %q, want new-key", got)
+	}
+	if got := srv.cache.ttl(); got != 90*time.Second {
+		t.Errorf("cache TTL %v after reload, want 1m30s", got)
+	}
+	// A bad value leaves everything as it was
+	t.Setenv("WEATHERSTACK_API_KEY", "third-key")
+	t.Setenv("LOG_LEVEL", "chatty")
+	if err := srv.reload(env); err == nil {
+		t.Fatal("reload accepted LOG_LEVEL=chatty")
+	}
+	getBody(t, ts, "/weather?city=Rome", nil)
+	if got := recorder.last(); got != "new-key" {
+		t.Errorf("fetch after a failed reload used %q, want new-key", got)
+	}
+
+	ts.Close() // so no request is still logging
+	out := logs.String()
+	for _, want := range []string{"name=WEATHERSTACK_API_KEYS", "name=CACHE_TTL_SECONDS", "needs a restart, ignored\" name=LISTEN_ADDR"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("log lacks %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "new-key") || strings.Contains(out, "old-key") {
+		t.Errorf("log shows a key:\n%s", out)
+	}
+}
+
+func TestReloadRereadsTheEnvFile(t *testing.T) {
+	clearReloadEnv(t)
+	captureLogs(t)
+	file := filepath.Join(t.TempDir(), "weather.env")
+	write := func(key string) {
+		if err := os.WriteFile(file, []byte("WEATHERSTACK_API_KEY="+key+"\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("file-key")
+	env := captureEnv(file, true)
+	if err := env.reread(); err != nil {
+		t.Fatalf("reading %s: %v", file, err)
+	}
+	env.settle()
+	t.Cleanup(func() { os.Unsetenv("WEATHERSTACK_API_KEY") })
+	recorder := &keyRecorder{}
+	srv, ts := reloadServer(t, recorder)
+
+	getBody(t, ts, "/weather?city=London", nil)
+	write("rotated-key")
+	if err := srv.reload(env); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	getBody(t, ts, "/weather?city=Paris", nil)
+	if got := recorder.keys; len(got) != 2 || got[0] != "file-key" || got[1] != "rotated-key" {
+		t.Errorf("keys used %v, want file-key then rotated-key", got)
+	}
+}
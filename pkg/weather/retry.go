@@ -0,0 +1,64 @@
+package weather
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"time"
+)
+
+const retryInitialDelay = 200 * time.Millisecond
+
+// Network failures, timeouts and 5xx responses are worth another try;
+// 4xx responses and unknown cities are not
+func retriable(err error) bool {
+	if errors.Is(err, errNoFixture) {
+		return false // replaying again will not conjure one up
+	}
+	if errors.Is(err, ErrUpstreamTimeout) {
+		return true
+	}
+	var se *StatusError
+	if errors.As(err, &se) {
+		return se.Code >= 500
+	}
+	var ne net.Error
+	return errors.As(err, &ne)
+}
+
+// Retries transient upstream failures with exponential backoff and jitter
+type retryingProvider struct {
+	next     WeatherProvider
+	attempts int
+}
+
+// Each attempt gets its own deadline
+func (p *retryingProvider) Timeout() time.Duration { return 0 }
+
+func (p *retryingProvider) Current(ctx context.Context, city string) (CityWeatherData, error) {
+	delay := retryInitialDelay
+	for attempt := 1; ; attempt++ {
+		data, err := callWithTimeout(ctx, p.next, city)
+		if err == nil || attempt >= p.attempts || !retriable(err) || ctx.Err() != nil {
+			return data, err
+		}
+
+		// Jitter to 50-150% of the delay, and never sleep past the client's deadline
+		wait := time.Duration(rand.Int63n(int64(delay))) + delay/2
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+			return data, err
+		}
+		loggerFrom(ctx).Warn("Upstream fetch failed, retrying", "city", city,
+			"attempt", attempt, "attempts", p.attempts, "retry_in_ms", wait.Milliseconds(), "err", err)
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return data, ctx.Err()
+		case <-timer.C:
+		}
+		delay *= 2
+	}
+}
@@ -0,0 +1,122 @@
+package weather
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const londonReply = `{"location": {"name": "London"}, "current": {"temperature": 14, "weather_code": 116, "weather_descriptions": ["Partly cloudy"]}}`
+
+// A Weatherstack answering the first failures requests with status, and
+// London after that
+func flakyWeatherstack(t *testing.T, failures int32, status int) (WeatherstackProvider, *atomic.Int32) {
+	t.Helper()
+	var calls atomic.Int32
+	p := weatherstackWith(t, func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) <= failures {
+			w.WriteHeader(status)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, londonReply)
+	})
+	return p, &calls
+}
+
+func TestRetryRecoversFromTwoFailures(t *testing.T) {
+	logs := captureLogs(t)
+	p, calls := flakyWeatherstack(t, 2, http.StatusBadGateway)
+	srv, err := NewServer(p, DefaultConfig())
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/weather?city=London")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var data CityWeatherData
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || data.Temp != 14 {
+		t.Errorf("status %d, body %+v, want London at 14", resp.StatusCode, data)
+	}
+	if n := calls.Load(); n != 3 {
+		t.Errorf("upstream called %d times, want 3", n)
+	}
+	for _, attempt := range []string{"attempt=1", "attempt=2"} {
+		if !strings.Contains(logs.String(), attempt) {
+			t.Errorf("no retry logged with %s:\n%s", attempt, logs)
+		}
+	}
+}
+
+func TestRetryOnlyTransientFailures(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    int
+		wantCalls int32
+	}{
+		{"server error", http.StatusServiceUnavailable, 3},
+		{"client error", http.StatusBadRequest, 1},
+		{"rate limited", http.StatusTooManyRequests, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, calls := flakyWeatherstack(t, 5, tt.status)
+			r := &retryingProvider{next: p, attempts: 3}
+			if _, err := r.Current(context.Background(), "London"); err == nil {
+				t.Error("got data, want the upstream error")
+			}
+			if n := calls.Load(); n != tt.wantCalls {
+				t.Errorf("upstream called %d times, want %d", n, tt.wantCalls)
+			}
+		})
+	}
+
+	notFound := weatherstackWith(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"success": false, "error": {"code": 615, "info": "No results"}}`)
+	})
+	counting := &stubProvider{err: fmt.Errorf("%w: Atlantis", ErrCityNotFound)}
+	for _, p := range []WeatherProvider{notFound, counting} {
+		r := &retryingProvider{next: p, attempts: 3}
+		if _, err := r.Current(context.Background(), "Atlantis"); !errors.Is(err, ErrCityNotFound) {
+			t.Errorf("err = %v, want ErrCityNotFound", err)
+		}
+	}
+	if counting.calls != 1 {
+		t.Errorf("unknown city tried %d times, want 1", counting.calls)
+	}
+}
+
+func TestRetryStopsAtTheDeadline(t *testing.T) {
+	p, calls := flakyWeatherstack(t, 5, http.StatusInternalServerError)
+	r := &retryingProvider{next: p, attempts: 5}
+
+	// Too little time left for the first backoff, so no retry is made
+	ctx, cancel := context.WithTimeout(context.Background(), retryInitialDelay/4)
+	defer cancel()
+	start := time.Now()
+	var se *StatusError
+	if _, err := r.Current(ctx, "London"); !errors.As(err, &se) {
+		t.Errorf("err = %v, want the upstream status", err)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("upstream called %d times, want 1", n)
+	}
+	if elapsed := time.Since(start); elapsed > retryInitialDelay/4 {
+		t.Errorf("returned after %v, past the deadline", elapsed)
+	}
+}
@@ -0,0 +1,76 @@
+package weather
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// One point on a city's scripted timeline, at an offset from startup
+type scenarioKeyframe struct {
+	At   string  `json:"at"` // e.g. "0s", "10m"
+	Temp float64 `json:"temp"`
+	Desc string  `json:"desc,omitempty"` // bucket description when empty
+
+	offset time.Duration
+}
+
+// Scripted timelines by normalized city, for demos: temperatures are
+// interpolated between keyframes, descriptions switch at each keyframe
+type simScenario map[string][]scenarioKeyframe
+
+// Load and check a scenario file, e.g.
+//
+//	{"London": [{"at": "0s", "temp": 15, "desc": "Cloudy"},
+//	            {"at": "10m", "temp": -2, "desc": "Snow"}]}
+func loadScenario(path string) (simScenario, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var raw map[string][]scenarioKeyframe
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	s := make(simScenario, len(raw))
+	for city, frames := range raw {
+		if len(frames) == 0 {
+			return nil, fmt.Errorf("%s: %s has no keyframes", path, city)
+		}
+		for i := range frames {
+			f := &frames[i]
+			d, err := time.ParseDuration(f.At)
+			if err != nil || d < 0 {
+				return nil, fmt.Errorf("%s: %s keyframe %d: at %q must be a non-negative duration like 90s or 10m", path, city, i+1, f.At)
+			}
+			f.offset = d
+			if i > 0 && d <= frames[i-1].offset {
+				return nil, fmt.Errorf("%s: %s keyframe %d: at %q is not after %q; keyframes must be in time order", path, city, i+1, f.At, frames[i-1].At)
+			}
+		}
+		s[normalizeCity(city)] = frames
+	}
+	return s, nil
+}
+
+// The scripted reading for city at elapsed time since startup, holding
+// the first keyframe before it and the last one after
+func (s simScenario) at(city string, elapsed time.Duration) (temp float64, desc string, ok bool) {
+	frames, ok := s[normalizeCity(city)]
+	if !ok {
+		return 0, "", false
+	}
+	if elapsed <= frames[0].offset {
+		return frames[0].Temp, frames[0].Desc, true
+	}
+	for i := 1; i < len(frames); i++ {
+		prev, next := frames[i-1], frames[i]
+		if elapsed < next.offset {
+			frac := float64(elapsed-prev.offset) / float64(next.offset-prev.offset)
+			return prev.Temp + (next.Temp-prev.Temp)*frac, prev.Desc, true
+		}
+	}
+	last := frames[len(frames)-1]
+	return last.Temp, last.Desc, true
+}
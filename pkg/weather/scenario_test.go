@@ -0,0 +1,79 @@
+package weather
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeScenario(t *testing.T, body string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "scenario.json")
+	if err := os.WriteFile(path, []byte(body), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestScenarioInterpolates(t *testing.T) {
+	scenario, err := loadScenario(writeScenario(t, `{"London": [
+		{"at": "0s", "temp": 15, "desc": "Cloudy"},
+		{"at": "10m", "temp": -2, "desc": "Snow"}]}`))
+	if err != nil {
+		t.Fatalf("loadScenario: %v", err)
+	}
+	start := time.Date(2026, 1, 10, 9, 0, 0, 0, time.UTC)
+	sim := simulatorAt(1, start)
+	sim.start, sim.scenario = start, scenario
+
+	tests := []struct {
+		elapsed time.Duration
+		temp    float64
+		desc    string
+	}{
+		{0, 15, "Cloudy"},
+		{5 * time.Minute, 6.5, "Cloudy"},
+		{7*time.Minute + 30*time.Second, 2.25, "Cloudy"},
+		{10 * time.Minute, -2, "Snow"},
+		{time.Hour, -2, "Snow"},
+	}
+	for _, tt := range tests {
+		sim.now = func() time.Time { return start.Add(tt.elapsed) }
+		data := sim.Simulate("london")
+		if data.Temp != tt.temp || data.Desc != tt.desc {
+			t.Errorf("after %v: %g %q, want %g %q", tt.elapsed, data.Temp, data.Desc, tt.temp, tt.desc)
+		}
+	}
+
+	// Cities the file does not list stay random, within the range
+	for i := 0; i < 20; i++ {
+		if data := sim.Simulate("Paris"); data.Temp < sim.MinTemp || data.Temp > sim.MaxTemp {
+			t.Fatalf("Paris = %g outside %g to %g", data.Temp, sim.MinTemp, sim.MaxTemp)
+		}
+	}
+}
+
+func TestScenarioValidation(t *testing.T) {
+	tests := []struct {
+		body, want string
+	}{
+		{`{"London": [{"at": "10m", "temp": 1}, {"at": "5m", "temp": 2}]}`, "keyframes must be in time order"},
+		{`{"London": [{"at": "5m", "temp": 1}, {"at": "5m", "temp": 2}]}`, "keyframes must be in time order"},
+		{`{"London": [{"at": "-1m", "temp": 1}]}`, "non-negative duration"},
+		{`{"London": [{"at": "soon", "temp": 1}]}`, "non-negative duration"},
+		{`{"London": []}`, "has no keyframes"},
+		{`["London"]`, "cannot unmarshal"},
+	}
+	for _, tt := range tests {
+		_, err := loadScenario(writeScenario(t, tt.body))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: err = %v, want %q", tt.body, err, tt.want)
+		}
+	}
+	t.Setenv("SIM_SCENARIO", "")
+	if _, _, err := simulatedFromEnv(1, writeScenario(t, tests[0].body)); err == nil || !strings.HasPrefix(err.Error(), "invalid scenario") {
+		t.Errorf("simulatedFromEnv: err = %v, want a startup error", err)
+	}
+}
@@ -0,0 +1,187 @@
+package weather
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Fields added in the /v1 schema. The unversioned routes leave them out
+// so clients written against the original shape see exactly that.
+var v1Fields = map[string]bool{
+	"observation_time":        true,
+	"observation_age_seconds": true,
+}
+
+type apiVersionKey struct{}
+
+// Mark requests as made against the /v1 schema
+func versioned(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiVersionKey{}, 1)))
+	})
+}
+
+// Whether the request came in under /v1
+func isV1(ctx context.Context) bool {
+	v, _ := ctx.Value(apiVersionKey{}).(int)
+	return v >= 1
+}
+
+// Marshal v for the schema of the request's route
+func marshalFor(ctx context.Context, v interface{}) ([]byte, error) {
+	return marshalSchema(v, isV1(ctx))
+}
+
+func marshalSchema(v interface{}, v1 bool) ([]byte, error) {
+	b, err := json.Marshal(v)
+	if err != nil || v1 {
+		return b, err
+	}
+	return stripV1Fields(b)
+}
+
+// Serve the unversioned routes in the original schema: JSON bodies are
+// held back until the handler returns and the /v1 fields dropped from
+// them. Anything else, such as an event stream, passes straight through.
+func legacySchema(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lw := &legacyWriter{ResponseWriter: w}
+		next.ServeHTTP(lw, r)
+		lw.finish()
+	})
+}
+
+type legacyWriter struct {
+	http.ResponseWriter
+	decided   bool
+	buffering bool
+	status    int
+	body      bytes.Buffer
+}
+
+func (lw *legacyWriter) WriteHeader(code int) {
+	if lw.decided {
+		return
+	}
+	lw.decided = true
+	lw.status = code
+	lw.buffering = strings.Contains(lw.Header().Get("Content-Type"), "json")
+	if !lw.buffering {
+		lw.ResponseWriter.WriteHeader(code)
+	}
+}
+
+func (lw *legacyWriter) Write(b []byte) (int, error) {
+	if !lw.decided {
+		lw.WriteHeader(http.StatusOK)
+	}
+	if lw.buffering {
+		return lw.body.Write(b)
+	}
+	return lw.ResponseWriter.Write(b)
+}
+
+func (lw *legacyWriter) finish() {
+	if !lw.buffering {
+		return
+	}
+	body := lw.body.Bytes()
+	if stripped, err := stripV1Fields(body); err == nil {
+		body = stripped
+	}
+	lw.Header().Del("Content-Length")
+	lw.ResponseWriter.WriteHeader(lw.status)
+	lw.ResponseWriter.Write(body)
+}
+
+func (lw *legacyWriter) Flush() {
+	if lw.buffering {
+		return
+	}
+	if f, ok := lw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (lw *legacyWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := lw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response writer does not support hijacking")
+	}
+	lw.decided = true
+	return h.Hijack()
+}
+
+func (lw *legacyWriter) Unwrap() http.ResponseWriter {
+	return lw.ResponseWriter
+}
+
+// Drop the /v1 fields from every object in a JSON document, keeping the
+// order of everything else and the trailing newline, if any
+func stripV1Fields(doc []byte) ([]byte, error) {
+	trimmed := bytes.TrimSpace(doc)
+	if len(trimmed) == 0 {
+		return doc, nil
+	}
+	var buf bytes.Buffer
+	if err := stripValue(&buf, trimmed); err != nil {
+		return nil, err
+	}
+	if bytes.HasSuffix(doc, []byte("\n")) {
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), nil
+}
+
+func stripValue(buf *bytes.Buffer, raw json.RawMessage) error {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || (raw[0] != '{' && raw[0] != '[') {
+		buf.Write(raw)
+		return nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.Token() // the opening delimiter
+	buf.WriteByte(raw[0])
+	first := true
+	for dec.More() {
+		var key string
+		if raw[0] == '{' {
+			tok, err := dec.Token()
+			if err != nil {
+				return err
+			}
+			key, _ = tok.(string)
+		}
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return err
+		}
+		if raw[0] == '{' && v1Fields[key] {
+			continue
+		}
+		if !first {
+			buf.WriteByte(',')
+		}
+		first = false
+		if raw[0] == '{' {
+			k, _ := json.Marshal(key)
+			buf.Write(k)
+			buf.WriteByte(':')
+		}
+		if err := stripValue(buf, value); err != nil {
+			return err
+		}
+	}
+	if raw[0] == '{' {
+		buf.WriteByte('}')
+	} else {
+		buf.WriteByte(']')
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package weather
+
+import "testing"
+
+func TestStripV1Fields(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+	}{
+		{"object", `{"city":"London","observation_time":"2025-03-07T16:00:00Z","temp":12,"observation_age_seconds":90}` + "\n",
+			`{"city":"London","temp":12}` + "\n"},
+		{"nested", `{"cities":[{"city":"Oslo","observation_time":"x"},{"city":"Rome"}],"n":2}`,
+			`{"cities":[{"city":"Oslo"},{"city":"Rome"}],"n":2}`},
+		{"keeps order and numbers", `{"z":1.50,"a":"<b>","observation_age_seconds":3}`, `{"z":1.50,"a":"<b>"}`},
+		{"only v1 fields", `{"observation_time":"x"}`, `{}`},
+		{"scalar", `42`, `42`},
+		{"empty", ``, ``},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := stripV1Fields([]byte(tt.in))
+			if err != nil {
+				t.Fatalf("stripV1Fields: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+	if _, err := stripV1Fields([]byte(`{"city":`)); err == nil {
+		t.Error("truncated JSON accepted")
+	}
+}
@@ -0,0 +1,94 @@
+package weather
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Fixed readings per city, for load tests and scenarios that need the
+// same answer every time. Cities not in the script are passed to
+// fallback.
+type ScriptedSimulator struct {
+	readings map[string]CityWeatherData // by normalized city
+	fallback WeatherSimulator
+}
+
+// Load a YAML file mapping cities to readings, with the field names of
+// the /weather response, e.g.
+//
+//	London:
+//	  temp: 11.5
+//	  desc: Cool
+//	  condition: rain
+//	  humidity: 82
+func LoadScriptedSimulator(path string, fallback WeatherSimulator) (*ScriptedSimulator, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var raw map[string]map[string]any
+	if err := yaml.Unmarshal(b, &raw); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	s := &ScriptedSimulator{readings: make(map[string]CityWeatherData, len(raw)), fallback: fallback}
+	for city, fields := range raw {
+		// Through JSON, so the file uses the response's field names
+		j, err := json.Marshal(fields)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s: %v", path, city, err)
+		}
+		var data CityWeatherData
+		if err := json.Unmarshal(j, &data); err != nil {
+			return nil, fmt.Errorf("%s: %s: %v", path, city, err)
+		}
+		if data.City == "" {
+			data.City = city
+		}
+		if data.Source == "" {
+			data.Source = "simulated"
+		}
+		if data.Desc == "" {
+			data.Desc = defaultDescTable.describe(data.Temp)
+		}
+		if data.Activity == "" {
+			var humidity float64
+			if data.Humidity != nil {
+				humidity = *data.Humidity
+			}
+			data.Activity = recommendActivity(data.Temp, humidity, data.Humidity != nil, data.Desc)
+		}
+		if data.Condition == "" {
+			switch c := (conditions{desc: strings.ToLower(data.Desc)}); {
+			case c.snowy():
+				data.Condition = ConditionSnow
+			case c.wet():
+				data.Condition = ConditionRain
+			case data.Temp >= 20:
+				data.Condition = ConditionClear
+			default:
+				data.Condition = ConditionClouds
+			}
+		}
+		s.readings[normalizeCity(city)] = data
+	}
+	return s, nil
+}
+
+func (s *ScriptedSimulator) Simulate(city string) CityWeatherData {
+	data, ok := s.readings[normalizeCity(city)]
+	if !ok {
+		return s.fallback.Simulate(city)
+	}
+	now := time.Now()
+	if data.ObservationTime == nil {
+		observed := now.UTC()
+		data.ObservationTime = &observed
+	}
+	data.CacheTime = now
+	return data
+}
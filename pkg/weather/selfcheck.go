@@ -0,0 +1,50 @@
+package weather
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+)
+
+const (
+	defaultProbeCity = "London"
+	selfCheckTimeout = 30 * time.Second
+)
+
+// Configuration mistakes no amount of waiting will fix
+func definitiveFailure(err error) bool {
+	return errors.Is(err, ErrMissingAPIKey) || errors.Is(err, errInvalidAPIKey)
+}
+
+// Fetch one reading for the probe city before serving, so a bad API key
+// shows up at deploy time rather than as a stream of failed requests. Only
+// definitive configuration problems are returned; anything else is logged
+// and startup carries on.
+func (s *Server) selfCheck(ctx context.Context, city string) error {
+	ctx, cancel := context.WithTimeout(ctx, selfCheckTimeout)
+	defer cancel()
+
+	start := time.Now()
+	data, err := s.getCityWeatherData(ctx, city)
+	switch {
+	case err == nil:
+		slog.Info("Startup check passed", "city", city, "source", data.Source, "upstream_ms", milliseconds(time.Since(start)))
+		return nil
+	case definitiveFailure(err):
+		return fmt.Errorf("startup check for %s failed: %w; check WEATHERSTACK_API_KEY(S) or OPENWEATHERMAP_API_KEY, or pass -skip-startup-check", city, err)
+	default:
+		slog.Warn("Startup check failed, serving anyway", "city", city, "err", err)
+		return nil
+	}
+}
+
+// City the startup check fetches, from STARTUP_PROBE_CITY
+func probeCity() string {
+	if city := os.Getenv("STARTUP_PROBE_CITY"); city != "" {
+		return city
+	}
+	return defaultProbeCity
+}
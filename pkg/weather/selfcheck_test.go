@@ -0,0 +1,68 @@
+package weather
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSelfCheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		fatal   bool
+		wantLog string
+	}{
+		{"healthy", nil, false, "Startup check passed"},
+		{"invalid key", fmt.Errorf("%w: You have not supplied a valid API Access Key", errInvalidAPIKey), true, ""},
+		{"missing key", fmt.Errorf("%w: set WEATHERSTACK_API_KEY", ErrMissingAPIKey), true, ""},
+		{"outage", &StatusError{Code: 503, Status: "503 Service Unavailable"}, false, "serving anyway"},
+		{"timeout", fmt.Errorf("%w after 10s", ErrUpstreamTimeout), false, "serving anyway"},
+		{"network", &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}, false, "serving anyway"},
+		{"quota", ErrQuotaExceeded, false, "serving anyway"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs := captureLogs(t)
+			upstream := &stubProvider{data: CityWeatherData{City: "London", Source: "stub", CacheTime: time.Now()}, err: tt.err}
+			config := DefaultConfig()
+			config.RetryAttempts = 1
+			srv, err := NewServer(upstream, config)
+			if err != nil {
+				t.Fatalf("NewServer: %v", err)
+			}
+
+			err = srv.selfCheck(context.Background(), "London")
+			if (err != nil) != tt.fatal {
+				t.Fatalf("selfCheck = %v, want fatal %v", err, tt.fatal)
+			}
+			if tt.fatal {
+				if !errors.Is(err, tt.err) || !strings.Contains(err.Error(), "-skip-startup-check") {
+					t.Errorf("error %q should wrap the cause and mention -skip-startup-check", err)
+				}
+				return
+			}
+			if !strings.Contains(logs.String(), tt.wantLog) {
+				t.Errorf("logs lack %q:\n%s", tt.wantLog, logs)
+			}
+			if upstream.calls != 1 {
+				t.Errorf("probe made %d upstream calls, want 1", upstream.calls)
+			}
+		})
+	}
+}
+
+func TestProbeCity(t *testing.T) {
+	t.Setenv("STARTUP_PROBE_CITY", "")
+	if got := probeCity(); got != defaultProbeCity {
+		t.Errorf("default probe city = %q", got)
+	}
+	t.Setenv("STARTUP_PROBE_CITY", "Oslo")
+	if got := probeCity(); got != "Oslo" {
+		t.Errorf("probe city = %q, want Oslo", got)
+	}
+}
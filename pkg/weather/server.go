@@ -0,0 +1,650 @@
+package weather
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"text/template"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+type Config struct {
+	// Reported by /version: ModeLive or ModeSimulated, and the provider
+	// (chain) in use
+	Mode     string
+	Provider string
+
+	CacheSize   int
+	CacheTTL    time.Duration
+	CacheShards int // independently locked slices of the cache
+
+	// Cache of where raw city input resolved to
+	GeoCacheSize  int
+	GeoCacheTTL   time.Duration
+	HistoryDepth  int // readings kept per city for /weather/history
+	RetryAttempts int // upstream attempts per fetch, including the first
+
+	EvictionPolicy string // EvictionLRU (default) or EvictionLRU2
+	ProbationSize  int    // LRU-2 probationary FIFO size
+
+	// Consecutive upstream outages that open the circuit, and how long it
+	// stays open before a probe
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+
+	ErrorCacheTTL time.Duration // how long a failed fetch is answered with 503
+
+	// Upstream time above which a request is logged at warn with its
+	// timing breakdown
+	SlowUpstreamThreshold time.Duration
+
+	// Fraction of CacheTTL after which a hit also refreshes the entry in
+	// the background, so popular cities rarely miss; 1 or more disables it
+	StaleThreshold float64
+
+	// Monthly upstream call budget (0 for unlimited), tracked in QuotaStateFile
+	QuotaLimit     int
+	QuotaStateFile string
+
+	// Restrict the API to these cities, read from a file and/or listed
+	// directly; every city is served when both are empty
+	AllowedCitiesFile string
+	AllowedCities     []string
+
+	RegionsFile string // region definitions replacing the built-in ones
+
+	CityAliasesFile string // "alias = city" lines, re-read whenever the file changes
+
+	GreetingTemplate string // text/template for each reading's greeting; empty means the English default
+
+	// Postal code lookups for /weather/nearest: the Zippopotam base URL
+	// (the public one when empty) and how long an answer is kept
+	ZipLookupURL string
+	ZipCacheTTL  time.Duration
+
+	DBPath string // enables the SQLite request history when set
+
+	ReadingsDBPath string // SQLite database every fetched reading is kept in, when set
+
+	Features FeatureFlags // optional endpoints and behaviors
+
+	IdempotencyTTL time.Duration // how long an Idempotency-Key's response is replayed
+
+	MaxConcurrentRequests int // weather lookups in flight before new ones get 503
+
+	TrackedCities int // cities whose request counts are kept for /stats/cities
+
+	// Answer with uncached simulated weather when the upstream is down,
+	// for demos that should never show an error page
+	FallbackToSimulated bool
+
+	// Seed for simulated weather, so a run can be replayed, and the file
+	// scripting it per city over time (SIM_SCENARIO when empty)
+	SimulatorSeed int64
+	ScenarioFile  string
+
+	AdminToken string // bearer token for the admin endpoints, which are off when empty
+}
+
+func DefaultConfig() Config {
+	return Config{
+		CacheSize:        100,
+		CacheTTL:         30 * time.Minute,
+		CacheShards:      16,
+		GeoCacheSize:     1000,
+		GeoCacheTTL:      24 * time.Hour,
+		TrackedCities:    1000,
+		ZipCacheTTL:      30 * 24 * time.Hour,
+		HistoryDepth:     288, // 24 hours at 5-minute intervals
+		RetryAttempts:    3,
+		EvictionPolicy:   EvictionLRU,
+		ProbationSize:    20,
+		BreakerThreshold: 5,
+		BreakerCooldown:  30 * time.Second,
+		ErrorCacheTTL:    30 * time.Second,
+		StaleThreshold:   0.8,
+		QuotaStateFile:   "quota-state.json",
+		IdempotencyTTL:   time.Minute,
+		Features:         DefaultFeatureFlags(),
+
+		MaxConcurrentRequests: 50,
+		SlowUpstreamThreshold: time.Second,
+	}
+}
+
+// Everything a running instance needs, so handlers can be exercised with
+// a stub provider and an isolated cache
+type Server struct {
+	provider WeatherProvider
+	cache    *Cache
+	geo      *geoCache
+	config   Config
+	breaker  *circuitBreaker
+	quota    *quotaTracker // nil without a quota limit
+
+	hub             *updateHub
+	bus             *Bus // internal subscribers to cache updates
+	alerts          *alertStore
+	trends          *trendTracker
+	cities          *cityIndex
+	allowed         cityAllowlist
+	aliases         *cityAliases
+	regions         regionIndex
+	greeting        *template.Template
+	series          *tempSeries
+	history         *historyStore
+	readings        *readingStore // nil unless ReadingsDBPath is set
+	idempotency     *idempotencyStore
+	upstreamLatency latencyTracker
+	fallback        *SimulatedProvider // nil unless FallbackToSimulated
+	zips            *zipResolver
+	requests        *cityCounters // per-city request counts for /stats/cities
+	upstream        *upstream     // HTTP client, API keys and metrics of the providers
+
+	// Slots for weather lookups in flight, and when being full was last logged
+	inFlight     chan struct{}
+	lastFullWarn atomic.Int64
+
+	panics atomic.Uint64 // handler panics caught by recoverPanics
+
+	settings atomic.Pointer[liveSettings] // swapped by reload on SIGHUP
+}
+
+func NewServer(provider WeatherProvider, config Config) (*Server, error) {
+	return newServer(provider, config, newUpstream())
+}
+
+// A server reporting on the providers up was used to build
+func newServer(provider WeatherProvider, config Config, up *upstream) (*Server, error) {
+	// Zero values fall back to the defaults
+	defaults := DefaultConfig()
+	if config.CacheSize <= 0 {
+		config.CacheSize = defaults.CacheSize
+	}
+	if config.CacheTTL <= 0 {
+		config.CacheTTL = defaults.CacheTTL
+	}
+	if config.CacheShards <= 0 {
+		config.CacheShards = defaults.CacheShards
+	}
+	if config.GeoCacheSize <= 0 {
+		config.GeoCacheSize = defaults.GeoCacheSize
+	}
+	if config.TrackedCities <= 0 {
+		config.TrackedCities = defaults.TrackedCities
+	}
+	if config.GeoCacheTTL <= 0 {
+		config.GeoCacheTTL = defaults.GeoCacheTTL
+	}
+	if config.ZipCacheTTL <= 0 {
+		config.ZipCacheTTL = defaults.ZipCacheTTL
+	}
+	if config.HistoryDepth <= 0 {
+		config.HistoryDepth = defaults.HistoryDepth
+	}
+	if config.RetryAttempts <= 0 {
+		config.RetryAttempts = defaults.RetryAttempts
+	}
+	if config.EvictionPolicy == "" {
+		config.EvictionPolicy = defaults.EvictionPolicy
+	}
+	if config.ProbationSize <= 0 {
+		config.ProbationSize = defaults.ProbationSize
+	}
+	if config.BreakerThreshold <= 0 {
+		config.BreakerThreshold = defaults.BreakerThreshold
+	}
+	if config.SlowUpstreamThreshold <= 0 {
+		config.SlowUpstreamThreshold = defaults.SlowUpstreamThreshold
+	}
+	if config.BreakerCooldown <= 0 {
+		config.BreakerCooldown = defaults.BreakerCooldown
+	}
+	if config.ErrorCacheTTL <= 0 {
+		config.ErrorCacheTTL = defaults.ErrorCacheTTL
+	}
+	if config.StaleThreshold <= 0 {
+		config.StaleThreshold = defaults.StaleThreshold
+	}
+	if config.QuotaStateFile == "" {
+		config.QuotaStateFile = defaults.QuotaStateFile
+	}
+	if config.IdempotencyTTL <= 0 {
+		config.IdempotencyTTL = defaults.IdempotencyTTL
+	}
+	if config.MaxConcurrentRequests <= 0 {
+		config.MaxConcurrentRequests = defaults.MaxConcurrentRequests
+	}
+
+	// Build the city search index once at startup
+	idx, err := loadCityIndex()
+	if err != nil {
+		return nil, fmt.Errorf("loading city list: %w", err)
+	}
+
+	allowed, err := loadAllowlist(config.AllowedCitiesFile, config.AllowedCities)
+	if err != nil {
+		return nil, fmt.Errorf("loading allowed cities: %w", err)
+	}
+
+	aliases, err := loadAliases(config.CityAliasesFile)
+	if err != nil {
+		return nil, fmt.Errorf("loading city aliases: %w", err)
+	}
+
+	regions, err := loadRegions(config.RegionsFile)
+	if err != nil {
+		return nil, fmt.Errorf("loading regions: %w", err)
+	}
+
+	greeting, err := parseGreetingTemplate(config.GreetingTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("parsing greeting template: %w", err)
+	}
+
+	// Every attempt, retries included, is charged to the quota
+	var quota *quotaTracker
+	if config.QuotaLimit > 0 {
+		quota, err = newQuotaTracker(provider, config.QuotaLimit, config.QuotaStateFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading quota state: %w", err)
+		}
+		provider = quota
+	}
+
+	// A whole retried fetch counts as one call to the breaker
+	breaker := newCircuitBreaker(
+		&retryingProvider{next: provider, attempts: config.RetryAttempts},
+		config.BreakerThreshold, config.BreakerCooldown)
+
+	var probationSize int
+	switch config.EvictionPolicy {
+	case EvictionLRU:
+	case EvictionLRU2:
+		probationSize = config.ProbationSize
+	default:
+		return nil, fmt.Errorf("unknown eviction policy %q (want %q or %q)", config.EvictionPolicy, EvictionLRU, EvictionLRU2)
+	}
+	cache, err := NewCache(config.CacheSize, config.CacheTTL, config.CacheShards, probationSize)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		provider: breaker,
+		breaker:  breaker,
+		quota:    quota,
+		cache:    cache,
+		geo:      newGeoCache(config.GeoCacheSize, config.GeoCacheTTL),
+		requests: newCityCounters(config.TrackedCities),
+		upstream: up,
+		config:   config,
+		hub:      newUpdateHub(),
+		bus:      NewBus(),
+		alerts:   newAlertStore(),
+		trends:   newTrendTracker(),
+		cities:   idx,
+		allowed:  allowed,
+		aliases:  &cityAliases{names: aliases},
+		regions:  regions,
+		greeting: greeting,
+		series:   newTempSeries(config.HistoryDepth),
+
+		idempotency: newIdempotencyStore(config.IdempotencyTTL),
+		inFlight:    make(chan struct{}, config.MaxConcurrentRequests),
+	}
+	s.cache.errorTTL = config.ErrorCacheTTL
+	s.cache.staleThreshold = config.StaleThreshold
+	if config.FallbackToSimulated {
+		s.fallback = NewSimulatedProvider(config.SimulatorSeed)
+	}
+	s.zips = newZipResolver(config.ZipLookupURL, config.ZipCacheTTL, up.client)
+
+	s.settings.Store(s.currentSettings())
+
+	// Stream subscribers follow cache keys; everything else listens on the bus
+	s.cache.onUpdate = s.hub.publish
+	s.cache.bus = s.bus
+	s.bus.handle(TopicWeatherUpdated, s.alerts.evaluate)
+	s.bus.handle(TopicWeatherUpdated, s.trends.record)
+	s.bus.handle(TopicWeatherUpdated, s.series.record)
+
+	// Optional persistent request history
+	if config.DBPath != "" {
+		h, err := openHistoryStore(config.DBPath)
+		if err != nil {
+			return nil, fmt.Errorf("opening history database: %w", err)
+		}
+		s.history = h
+	}
+	if config.ReadingsDBPath != "" {
+		rs, err := openReadingStore(config.ReadingsDBPath)
+		if err != nil {
+			s.history.close()
+			return nil, fmt.Errorf("opening readings database: %w", err)
+		}
+		s.readings = rs
+	}
+	return s, nil
+}
+
+// Stop recording request history and readings, write out what is
+// already queued and close both databases. Call it once the HTTP server
+// has shut down.
+func (s *Server) Close() error {
+	return errors.Join(s.history.close(), s.readings.close())
+}
+
+// Idempotency replay and optional JSONP for the plain JSON endpoints;
+// streaming endpoints can be neither buffered nor replayed
+func (s *Server) api(h http.HandlerFunc) http.HandlerFunc {
+	return s.idempotent(s.jsonp(h))
+}
+
+// Routes wrapped in the request logging middleware
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/weather", s.api(s.weatherHandler))
+	mux.HandleFunc("/weather/subscribe", s.api(s.subscribeHandler))
+	mux.HandleFunc("/weather/stream", s.feature("stream", s.config.Features.EnableStream, s.streamHandler))
+	mux.HandleFunc("/weather/trending", s.api(s.trendingHandler))
+	mux.HandleFunc("/weather/history", s.api(s.seriesHandler))
+	mux.HandleFunc("/weather/warmest", s.api(s.warmestHandler))
+	mux.HandleFunc("/weather/coldest", s.api(s.coldestHandler))
+	mux.HandleFunc("/weather/region", s.api(s.regionHandler))
+	mux.HandleFunc("/weather/diff", s.api(s.diffHandler))
+	mux.HandleFunc("/weather/map", s.api(s.weatherMapHandler))
+	mux.HandleFunc("/weather/nearest", s.feature("nearest", s.config.Features.EnableNearest, s.api(s.nearestHandler)))
+	mux.HandleFunc("/weather/random", s.feature("random_endpoint", s.config.Features.EnableRandom, s.api(s.randomHandler)))
+	mux.HandleFunc("/ws", s.feature("websocket", s.config.Features.EnableWebSocket, s.wsHandler))
+	mux.HandleFunc("/features", s.api(s.featuresHandler))
+	mux.HandleFunc("/version", s.api(s.versionHandler))
+	mux.HandleFunc("/cache/stats", s.api(s.cacheStatsHandler))
+	mux.HandleFunc("/cache/dump", s.api(s.cacheDumpHandler))
+	mux.HandleFunc("/stats/cities", s.api(s.popularCitiesHandler))
+	mux.HandleFunc("/cities/search", s.api(s.citySearchHandler))
+	if s.config.AdminToken != "" {
+		mux.HandleFunc("/alerts", s.requireAdmin(s.alertsHandler))
+		mux.HandleFunc("/cache/entry", s.requireAdmin(s.cacheEntryHandler))
+		mux.HandleFunc("/cache/config", s.requireAdmin(s.cacheConfigHandler))
+		mux.HandleFunc("/admin/config", s.requireAdmin(s.adminConfigHandler))
+		mux.HandleFunc("/admin/stats/cities", s.requireAdmin(s.resetPopularCitiesHandler))
+		mux.HandleFunc("/debug/cache", s.requireAdmin(s.debugCacheHandler))
+	}
+	if s.history != nil {
+		mux.HandleFunc("/history", s.api(s.historyHandler))
+	}
+	if s.readings != nil {
+		mux.HandleFunc("/history/readings", s.api(s.readingsHandler))
+	}
+	if s.upstream.sim != nil {
+		mux.HandleFunc("/debug/simulated", s.api(s.simulatedBaselinesHandler))
+	}
+	// Every route is also served under /v1, which alone has the fields
+	// added since; the unversioned routes keep the original schema
+	root := http.NewServeMux()
+	root.Handle("/v1/", http.StripPrefix("/v1", versioned(mux)))
+	root.Handle("/", legacySchema(mux))
+	return s.recoverPanics(s.logRequests(traceRequests(root)))
+}
+
+// Start the server. The mode comes from -mode, then WEATHER_MODE, then
+// defaultMode, so each binary can pick its own default.
+func Run(defaultMode string) {
+	modeFlag := flag.String("mode", "", "weather source: live or simulated (overrides WEATHER_MODE)")
+	listenFlag := flag.String("listen", "", "address to listen on, e.g. 127.0.0.1:9090 or :0 (overrides LISTEN_ADDR and PORT)")
+	envFileFlag := flag.String("env-file", "", "file to load environment variables from (default .env, if present)")
+	seedFlag := flag.String("seed", "", "seed for simulated weather, for reproducible runs (overrides SIM_SEED)")
+	scenarioFlag := flag.String("scenario", "", "JSON file scripting simulated weather per city over time (overrides SIM_SCENARIO)")
+	skipCheckFlag := flag.Bool("skip-startup-check", false, "start without fetching STARTUP_PROBE_CITY first (live mode)")
+	flag.Parse()
+
+	mode := *modeFlag
+	if mode == "" {
+		mode = os.Getenv("WEATHER_MODE")
+	}
+	if mode == "" {
+		mode = defaultMode
+	}
+
+	// Live providers read their API keys from the environment, optionally
+	// seeded from a .env file; in containers the real environment suffices
+	env := captureEnv(*envFileFlag, mode == ModeLive)
+	if mode == ModeLive {
+		loadEnvFile(*envFileFlag)
+	}
+	env.settle()
+	if err := configureLogging(); err != nil {
+		fatal("Error configuring logging", "err", err)
+	}
+	shutdownTracing, err := configureTracing(context.Background())
+	if err != nil {
+		fatal("Error configuring tracing", "err", err)
+	}
+	seed, err := simulatorSeed(*seedFlag)
+	if err != nil {
+		fatal("Invalid simulator seed", "err", err)
+	}
+
+	config := DefaultConfig()
+	config.Mode = mode
+	config.Provider = providerName(mode)
+	config.DBPath = os.Getenv("DB_PATH")
+	config.ReadingsDBPath = os.Getenv("HISTORY_DB")
+	config.GreetingTemplate = os.Getenv("GREETING_TEMPLATE")
+	config.Features = featureFlagsFromEnv(config.Features)
+	config.FallbackToSimulated = os.Getenv("FALLBACK_TO_SIMULATED") == "true"
+	config.AdminToken = os.Getenv("ADMIN_TOKEN")
+	config.AllowedCitiesFile = os.Getenv("ALLOWED_CITIES_FILE")
+	config.RegionsFile = os.Getenv("REGIONS_FILE")
+	config.CityAliasesFile = os.Getenv("CITY_ALIASES_FILE")
+	config.ZipLookupURL = os.Getenv("ZIPPOPOTAM_BASE_URL")
+	if v := os.Getenv("ALLOWED_CITIES"); v != "" {
+		config.AllowedCities = strings.Split(v, ",")
+	}
+	config.CacheTTL = time.Duration(positiveEnv("CACHE_TTL_SECONDS", int(config.CacheTTL.Seconds()))) * time.Second
+	config.CacheShards = positiveEnv("CACHE_SHARDS", config.CacheShards)
+	config.GeoCacheSize = positiveEnv("GEO_CACHE_SIZE", config.GeoCacheSize)
+	config.TrackedCities = positiveEnv("TRACKED_CITIES", config.TrackedCities)
+	config.GeoCacheTTL = time.Duration(positiveEnv("GEO_CACHE_TTL_SECONDS", int(config.GeoCacheTTL.Seconds()))) * time.Second
+	config.ZipCacheTTL = time.Duration(positiveEnv("ZIP_CACHE_TTL_HOURS", int(config.ZipCacheTTL.Hours()))) * time.Hour
+	config.HistoryDepth = positiveEnv("HISTORY_DEPTH", config.HistoryDepth)
+	config.RetryAttempts = positiveEnv("RETRY_ATTEMPTS", config.RetryAttempts)
+	if v := os.Getenv("CACHE_EVICTION_POLICY"); v != "" {
+		config.EvictionPolicy = v
+	}
+	config.ProbationSize = positiveEnv("LRU_K_PROBATION_SIZE", config.ProbationSize)
+	config.BreakerThreshold = positiveEnv("BREAKER_THRESHOLD", config.BreakerThreshold)
+	config.QuotaLimit = positiveEnv("UPSTREAM_QUOTA", config.QuotaLimit)
+	if v := os.Getenv("QUOTA_STATE_FILE"); v != "" {
+		config.QuotaStateFile = v
+	}
+	config.MaxConcurrentRequests = positiveEnv("MAX_CONCURRENT_REQUESTS", config.MaxConcurrentRequests)
+	config.IdempotencyTTL = time.Duration(positiveEnv("IDEMPOTENCY_TTL_SECONDS", int(config.IdempotencyTTL.Seconds()))) * time.Second
+	config.ErrorCacheTTL = time.Duration(positiveEnv("ERROR_CACHE_TTL_SECONDS", int(config.ErrorCacheTTL.Seconds()))) * time.Second
+	if v := os.Getenv("STALE_THRESHOLD"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f <= 0 {
+			fatal("Invalid STALE_THRESHOLD: must be a fraction of the cache TTL such as 0.8", "value", v)
+		}
+		config.StaleThreshold = f
+	}
+	if v := os.Getenv("BREAKER_COOLDOWN"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			fatal("Invalid BREAKER_COOLDOWN: must be a positive duration such as 30s", "value", v)
+		}
+		config.BreakerCooldown = d
+	}
+	if v := os.Getenv("SLOW_UPSTREAM_THRESHOLD"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			fatal("Invalid SLOW_UPSTREAM_THRESHOLD: must be a positive duration such as 1s", "value", v)
+		}
+		config.SlowUpstreamThreshold = d
+	}
+	config.SimulatorSeed = seed
+	config.ScenarioFile = *scenarioFlag
+	up := newUpstream()
+	provider, err := up.newProvider(mode, config)
+	if err != nil {
+		fatal("Error selecting weather provider", "err", err)
+	}
+	if up.sim != nil {
+		slog.Info("Simulated weather seed, replay with -seed", "seed", seed)
+	}
+	srv, err := newServer(provider, config, up)
+	if err != nil {
+		fatal("Error starting server", "err", err)
+	}
+	if mode == ModeLive && !*skipCheckFlag {
+		if err := srv.selfCheck(context.Background(), probeCity()); err != nil {
+			fatal("Startup check failed", "err", err)
+		}
+	}
+
+	if config.CityAliasesFile != "" {
+		slog.Info("City aliases loaded", "file", config.CityAliasesFile, "aliases", len(srv.aliases.names))
+		if err := srv.aliases.watch(config.CityAliasesFile); err != nil {
+			fatal("Error watching CITY_ALIASES_FILE", "err", err)
+		}
+	}
+
+	// Serve on -listen, LISTEN_ADDR or PORT, defaulting to port 8080
+	ln, err := listen(*listenFlag)
+	if err != nil {
+		fatal("Error starting listener", "err", err)
+	}
+	server := &http.Server{
+		Addr:    ln.Addr().String(),
+		Handler: srv.Handler(),
+	}
+	// Fail fast on a half-configured or unloadable certificate
+	redirect, err := configureTLS(server)
+	if err != nil {
+		fatal("Error configuring TLS", "err", err)
+	}
+	if redirect != nil {
+		if err := startRedirect(redirect); err != nil {
+			fatal("Error starting HTTP redirect listener", "err", err)
+		}
+	}
+	v := srv.version()
+	slog.Info("Server started", "addr", ln.Addr().String(), "mode", mode, "provider", v.Provider,
+		"version", v.Version, "commit", v.Commit, "build_date", v.Date, "go_version", v.GoVersion)
+
+	// Apply changed keys, log level and TTL on SIGHUP, e.g. after editing .env
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			if err := srv.reload(env); err != nil {
+				slog.Error("Reload failed, keeping the previous settings", "err", err)
+			}
+		}
+	}()
+	go func() {
+		if err := serve(server, ln); !errors.Is(err, http.ErrServerClosed) {
+			fatal("Server stopped", "err", err)
+		}
+	}()
+
+	// Let in-flight requests finish on SIGINT or SIGTERM; streams and long
+	// polls are cut off after shutdownTimeout
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	sig := <-stop
+	slog.Info("Shutting down", "signal", sig.String())
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		slog.Warn("Shutdown timed out, closing remaining connections", "err", err)
+		server.Close()
+	}
+	if redirect != nil {
+		if err := redirect.Shutdown(ctx); err != nil {
+			redirect.Close()
+		}
+	}
+	// No request can record history any more, so what is queued is the
+	// last; a refresh still running drops its reading
+	if err := srv.Close(); err != nil {
+		slog.Warn("Error closing the history databases", "err", err)
+	}
+	if err := shutdownTracing(ctx); err != nil {
+		slog.Warn("Error flushing traces", "err", err)
+	}
+	slog.Info("Server stopped")
+}
+
+const shutdownTimeout = 10 * time.Second
+
+// LISTEN_ADDR takes precedence over PORT; default is ":8080"
+func listenAddr() string {
+	if addr := os.Getenv("LISTEN_ADDR"); addr != "" {
+		return addr
+	}
+	if port := os.Getenv("PORT"); port != "" {
+		return ":" + port
+	}
+	return ":8080"
+}
+
+// Bind the -listen flag value, falling back to the environment. Use ":0"
+// for an ephemeral port and read the chosen one from the listener.
+func listen(flagAddr string) (net.Listener, error) {
+	addr := flagAddr
+	if addr == "" {
+		addr = listenAddr()
+	}
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid listen address %q: %v", addr, err)
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 0 || n > 65535 {
+		return nil, fmt.Errorf("invalid port in listen address %q", addr)
+	}
+	return net.Listen("tcp", addr)
+}
+
+// Integer setting from the environment, or def when unset
+func positiveEnv(name string, def int) int {
+	v := os.Getenv(name)
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		fatal("Invalid "+name+": must be a positive integer", "value", v)
+	}
+	return n
+}
+
+// Load variables from path, or from .env when path is empty. A missing
+// default .env is fine; a missing file named with -env-file is not.
+func loadEnvFile(path string) {
+	if path == "" {
+		if err := godotenv.Load(); err != nil {
+			if !errors.Is(err, os.ErrNotExist) {
+				fatal("Error loading .env file", "err", err)
+			}
+			slog.Info("No .env file found, using the process environment")
+		}
+		return
+	}
+	if err := godotenv.Load(path); err != nil {
+		fatal("Error loading env file", "path", path, "err", err)
+	}
+}
@@ -0,0 +1,137 @@
+package weather
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestListenAddress(t *testing.T) {
+	tests := []struct {
+		name     string
+		flag     string
+		env      map[string]string
+		wantHost string
+		wantErr  bool
+	}{
+		{"flag", "127.0.0.1:0", map[string]string{"LISTEN_ADDR": "256.0.0.1:0", "PORT": "x"}, "127.0.0.1", false},
+		{"LISTEN_ADDR over PORT", "", map[string]string{"LISTEN_ADDR": "127.0.0.1:0", "PORT": "x"}, "127.0.0.1", false},
+		{"PORT", "", map[string]string{"PORT": "0"}, "", false},
+		{"missing port", "127.0.0.1", nil, "", true},
+		{"port out of range", ":70000", nil, "", true},
+		{"named port", "", map[string]string{"LISTEN_ADDR": "localhost:http"}, "", true},
+		{"bad PORT", "", map[string]string{"PORT": "-1"}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, name := range []string{"LISTEN_ADDR", "PORT"} {
+				t.Setenv(name, tt.env[name])
+			}
+			ln, err := listen(tt.flag)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("listen(%q) err = %v, want error %v", tt.flag, err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			defer ln.Close()
+			host, port, _ := net.SplitHostPort(ln.Addr().String())
+			if port == "0" {
+				t.Errorf("bound %s, want an ephemeral port", ln.Addr())
+			}
+			if tt.wantHost != "" && host != tt.wantHost {
+				t.Errorf("bound %s, want host %s", ln.Addr(), tt.wantHost)
+			}
+		})
+	}
+}
+
+func TestServeOnEphemeralPort(t *testing.T) {
+	srv, err := NewServer(&countingProvider{}, DefaultConfig())
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	ln, err := listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	server := &http.Server{Addr: ln.Addr().String(), Handler: srv.Handler()}
+	go serve(server, ln)
+	defer server.Close()
+
+	resp, err := http.Get("http://" + ln.Addr().String() + "/weather?city=London")
+	if err != nil {
+		t.Fatalf("GET /weather: %v", err)
+	}
+	defer resp.Body.Close()
+	var data CityWeatherData
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		t.Fatalf("decoding body: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || data.City != "London" {
+		t.Errorf("status %d, body %+v, want London", resp.StatusCode, data)
+	}
+}
+
+// Run the rest of the test in dir
+func chdir(t *testing.T, dir string) {
+	t.Helper()
+	prev, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(prev) })
+}
+
+func TestStartsWithoutEnvFile(t *testing.T) {
+	chdir(t, t.TempDir())
+	for _, name := range []string{"WEATHER_PROVIDERS", "WEATHER_PROVIDER", "WEATHER_FIXTURES", "WEATHERSTACK_BASE_URL", "WEATHERSTACK_API_KEYS", "WEATHERSTACK_API_KEY"} {
+		t.Setenv(name, "")
+	}
+
+	// No .env is no problem, and neither is the key being unset
+	env := captureEnv("", true)
+	loadEnvFile("")
+	env.settle()
+	if err := env.reread(); err != nil {
+		t.Fatalf("reread: %v", err)
+	}
+	config := DefaultConfig()
+	config.RetryAttempts = 1
+	up := newUpstream()
+	provider, err := up.newProvider(ModeLive, config)
+	if err != nil {
+		t.Fatalf("newProvider: %v", err)
+	}
+	if _, err := newServer(provider, config, up); err != nil {
+		t.Fatalf("newServer: %v", err)
+	}
+
+	// Only using it fails, naming the variable to set
+	_, err = provider.Current(context.Background(), "London")
+	if !errors.Is(err, ErrMissingAPIKey) || !strings.Contains(err.Error(), "WEATHERSTACK_API_KEY") {
+		t.Errorf("err = %v, want ErrMissingAPIKey naming WEATHERSTACK_API_KEY", err)
+	}
+}
+
+func TestLoadEnvFileFromFlag(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "weather.env")
+	if err := os.WriteFile(path, []byte("ENV_FILE_TEST_VALUE=from-file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Unsetenv("ENV_FILE_TEST_VALUE") })
+
+	loadEnvFile(path)
+	if got := os.Getenv("ENV_FILE_TEST_VALUE"); got != "from-file" {
+		t.Errorf("ENV_FILE_TEST_VALUE = %q, want the file's value", got)
+	}
+}
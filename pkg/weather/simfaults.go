@@ -0,0 +1,109 @@
+package weather
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Upstream trouble injected into simulated mode, so load tests see
+// latency, outages and timeouts like a live provider's
+type simFaults struct {
+	latencyMin, latencyMax time.Duration
+	errorRate              float64 // chance of a synthetic 503
+	timeoutRate            float64 // chance of outlasting the deadline
+	timeout                time.Duration
+
+	mu  sync.Mutex // rand.Rand is not safe for concurrent use
+	rng *rand.Rand // apart from the weather's, so readings stay the same
+}
+
+// Faults from SIM_LATENCY ("50ms-300ms" or a fixed "100ms"),
+// SIM_ERROR_RATE and SIM_TIMEOUT_RATE (0-1), with SIM_TIMEOUT_SECONDS as
+// the deadline; nil when none is set
+func simFaultsFromEnv(seed int64) (*simFaults, error) {
+	f := &simFaults{timeout: defaultProviderTimeout, rng: rand.New(rand.NewSource(seed))}
+	if v := os.Getenv("SIM_LATENCY"); v != "" {
+		lo, hi, ranged := strings.Cut(v, "-")
+		if !ranged {
+			hi = lo
+		}
+		minD, err1 := time.ParseDuration(strings.TrimSpace(lo))
+		maxD, err2 := time.ParseDuration(strings.TrimSpace(hi))
+		if err1 != nil || err2 != nil || minD < 0 || maxD < minD {
+			return nil, fmt.Errorf("invalid SIM_LATENCY %q: want a duration like 100ms or a range like 50ms-300ms", v)
+		}
+		f.latencyMin, f.latencyMax = minD, maxD
+	}
+	for _, r := range []struct {
+		name string
+		dst  *float64
+	}{
+		{"SIM_ERROR_RATE", &f.errorRate},
+		{"SIM_TIMEOUT_RATE", &f.timeoutRate},
+	} {
+		v := os.Getenv(r.name)
+		if v == "" {
+			continue
+		}
+		rate, err := strconv.ParseFloat(v, 64)
+		if err != nil || rate < 0 || rate > 1 {
+			return nil, fmt.Errorf("invalid %s %q: must be a probability from 0 to 1", r.name, v)
+		}
+		*r.dst = rate
+	}
+	if v := os.Getenv("SIM_TIMEOUT_SECONDS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid SIM_TIMEOUT_SECONDS %q: must be a positive integer", v)
+		}
+		f.timeout = time.Duration(n) * time.Second
+	}
+	if f.latencyMax == 0 && f.errorRate == 0 && f.timeoutRate == 0 {
+		return nil, nil
+	}
+	return f, nil
+}
+
+// Wait out the drawn latency, then maybe fail. A timeout blocks until the
+// caller's deadline, which callWithTimeout reports as ErrUpstreamTimeout;
+// an outage is a 503, so both take the same retry and error-mapping path
+// as a live provider's.
+func (f *simFaults) inject(ctx context.Context) error {
+	latency, timeoutRoll, errorRoll := f.draw()
+	if timeoutRoll < f.timeoutRate {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	if latency > 0 {
+		t := time.NewTimer(latency)
+		defer t.Stop()
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if errorRoll < f.errorRate {
+		return &StatusError{Code: http.StatusServiceUnavailable, Status: "503 Service Unavailable (simulated)"}
+	}
+	return nil
+}
+
+// The next call's latency and its timeout and error rolls, in the order
+// the seed fixes
+func (f *simFaults) draw() (latency time.Duration, timeoutRoll, errorRoll float64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	latency = f.latencyMin
+	if span := f.latencyMax - f.latencyMin; span > 0 {
+		latency += time.Duration(f.rng.Int63n(int64(span) + 1))
+	}
+	return latency, f.rng.Float64(), f.rng.Float64()
+}
@@ -0,0 +1,102 @@
+package weather
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestSimulatedErrorRateOneAlwaysFails(t *testing.T) {
+	t.Setenv("SIM_LATENCY", "")
+	t.Setenv("SIM_TIMEOUT_RATE", "")
+	t.Setenv("SIM_ERROR_RATE", "1.0")
+	p, _, err := simulatedFromEnv(7, "")
+	if err != nil {
+		t.Fatalf("simulatedFromEnv: %v", err)
+	}
+	for i := 0; i < 20; i++ {
+		_, err := p.Current(context.Background(), "London")
+		var se *StatusError
+		if !errors.As(err, &se) || se.Code != http.StatusServiceUnavailable {
+			t.Fatalf("call %d: err = %v, want a simulated 503", i, err)
+		}
+	}
+
+	// Mapped the way a live provider's outage is
+	ts := modeServer(t, ModeSimulated)
+	for _, city := range []string{"London", "Paris"} {
+		resp := getBody(t, ts, "/weather?city="+city, nil)
+		if resp.StatusCode < 500 {
+			t.Errorf("%s: status %d, want a 5xx", city, resp.StatusCode)
+		}
+	}
+}
+
+func TestSimulatedLatencyDrawsReproducible(t *testing.T) {
+	t.Setenv("SIM_LATENCY", "0s-1h")
+	t.Setenv("SIM_ERROR_RATE", "")
+	t.Setenv("SIM_TIMEOUT_RATE", "")
+	draws := func(seed int64) []time.Duration {
+		f, err := simFaultsFromEnv(seed)
+		if err != nil || f == nil {
+			t.Fatalf("simFaultsFromEnv: %v, %v", f, err)
+		}
+		var out []time.Duration
+		for i := 0; i < 5; i++ {
+			latency, _, _ := f.draw()
+			out = append(out, latency)
+		}
+		return out
+	}
+
+	a, b := draws(42), draws(42)
+	for i := range a {
+		if a[i] != b[i] {
+			t.Fatalf("seed 42 drew %v then %v", a, b)
+		}
+		if a[i] < 0 || a[i] > time.Hour {
+			t.Errorf("draw %v outside 0s-1h", a[i])
+		}
+	}
+	if c := draws(43); c[0] == a[0] && c[1] == a[1] {
+		t.Errorf("seeds 42 and 43 both drew %v", a[:2])
+	}
+}
+
+func TestSimFaultsFromEnv(t *testing.T) {
+	tests := []struct {
+		latency, errorRate string
+		wantMin, wantMax   time.Duration
+		wantNil, wantErr   bool
+	}{
+		{latency: "", errorRate: "", wantNil: true},
+		{latency: "100ms", wantMin: 100 * time.Millisecond, wantMax: 100 * time.Millisecond},
+		{latency: "50ms-300ms", wantMin: 50 * time.Millisecond, wantMax: 300 * time.Millisecond},
+		{latency: "300ms-50ms", wantErr: true},
+		{latency: "soon", wantErr: true},
+		{errorRate: "1.5", wantErr: true},
+		{errorRate: "0.5"},
+	}
+	for _, tt := range tests {
+		t.Setenv("SIM_LATENCY", tt.latency)
+		t.Setenv("SIM_ERROR_RATE", tt.errorRate)
+		t.Setenv("SIM_TIMEOUT_RATE", "")
+		f, err := simFaultsFromEnv(1)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%q, %q: err = %v", tt.latency, tt.errorRate, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if (f == nil) != tt.wantNil {
+			t.Errorf("%q, %q: faults = %+v", tt.latency, tt.errorRate, f)
+			continue
+		}
+		if f != nil && (f.latencyMin != tt.wantMin || f.latencyMax != tt.wantMax) {
+			t.Errorf("%q: latency %v-%v, want %v-%v", tt.latency, f.latencyMin, f.latencyMax, tt.wantMin, tt.wantMax)
+		}
+	}
+}
@@ -0,0 +1,493 @@
+package weather
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Activity recommendation for each simulated description
+var activityByDesc = map[string]string{
+	"Freezing":  "Stay indoors or bundle up",
+	"Cold":      "Wrap up warm for a short walk",
+	"Cool":      "Good for a walk",
+	"Warm":      "Great for outdoor sports",
+	"Hot":       "Stay hydrated and keep it light",
+	"Scorching": "Stay out of the midday sun",
+}
+
+// The simulated descriptions in each supported language but English
+var descTranslations = map[string]map[string]string{
+	"de": {"Freezing": "Eisig", "Cold": "Kalt", "Cool": "Kühl", "Warm": "Warm", "Hot": "Heiß", "Scorching": "Glühend heiß"},
+	"es": {"Freezing": "Helado", "Cold": "Frío", "Cool": "Fresco", "Warm": "Templado", "Hot": "Caluroso", "Scorching": "Abrasador"},
+	"fr": {"Freezing": "Glacial", "Cold": "Froid", "Cool": "Frais", "Warm": "Doux", "Hot": "Chaud", "Scorching": "Torride"},
+	"it": {"Freezing": "Gelido", "Cold": "Freddo", "Cool": "Fresco", "Warm": "Mite", "Hot": "Caldo", "Scorching": "Torrido"},
+	"nl": {"Freezing": "IJskoud", "Cold": "Koud", "Cool": "Koel", "Warm": "Warm", "Hot": "Heet", "Scorching": "Snikheet"},
+	"pt": {"Freezing": "Gelado", "Cold": "Frio", "Cool": "Fresco", "Warm": "Ameno", "Hot": "Quente", "Scorching": "Escaldante"},
+}
+
+// One description bucket: label applies below the threshold, from the
+// previous bucket's threshold up
+type descBucket struct {
+	below float64
+	label string
+}
+
+// Description buckets in ascending order, with the label for anything at
+// or above the last threshold; every float, NaN included, gets a label
+type descTable struct {
+	buckets []descBucket
+	top     string
+}
+
+var defaultDescTable = descTable{
+	buckets: []descBucket{{0, "Freezing"}, {10, "Cold"}, {20, "Cool"}, {30, "Warm"}, {40, "Hot"}},
+	top:     "Scorching",
+}
+
+func (t descTable) describe(temp float64) string {
+	for _, b := range t.buckets {
+		if temp < b.below {
+			return b.label
+		}
+	}
+	return t.top
+}
+
+// Parse SIM_DESC_BUCKETS, e.g. "0:Freezing,10:Cold,20:Cool,30:Warm,40:Hot,
+// Scorching": each label covers temperatures below its threshold, and a
+// final label without one covers the rest. Without it, the last label
+// covers everything above the previous threshold.
+func parseDescTable(s string) (descTable, error) {
+	var t descTable
+	entries := strings.Split(s, ",")
+	for i, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		threshold, label, ok := strings.Cut(entry, ":")
+		if !ok {
+			if i != len(entries)-1 || entry == "" {
+				return descTable{}, fmt.Errorf("bucket %q: want threshold:label, with only the last label bare", entry)
+			}
+			t.top = entry
+			break
+		}
+		below, err := strconv.ParseFloat(strings.TrimSpace(threshold), 64)
+		if err != nil || math.IsNaN(below) {
+			return descTable{}, fmt.Errorf("bucket %q: threshold must be a number", entry)
+		}
+		if label = strings.TrimSpace(label); label == "" {
+			return descTable{}, fmt.Errorf("bucket %q: label must not be empty", entry)
+		}
+		if n := len(t.buckets); n > 0 && below <= t.buckets[n-1].below {
+			return descTable{}, fmt.Errorf("bucket %q: thresholds must increase", entry)
+		}
+		t.buckets = append(t.buckets, descBucket{below, label})
+	}
+	if t.top == "" {
+		t.top = t.buckets[len(t.buckets)-1].label
+		t.buckets = t.buckets[:len(t.buckets)-1]
+	}
+	return t, nil
+}
+
+// Default swing in °C from the daily and yearly averages, and the default
+// range readings are kept within
+const (
+	defaultDiurnalAmplitude  = 5.0
+	defaultSeasonalAmplitude = 8.0
+	defaultSimTempMin        = 0.0
+	defaultSimTempMax        = 40.0
+)
+
+// Source of simulated readings. Implementations need not be safe for
+// concurrent use by more than one provider, but must be by one.
+type WeatherSimulator interface {
+	Simulate(city string) CityWeatherData
+}
+
+// Weather for demos and development without an API key, from whichever
+// simulator it is given
+type SimulatedProvider struct {
+	sim    WeatherSimulator
+	faults *simFaults // nil unless latency or failures are injected
+}
+
+// Random readings around a stable base per city, following the local
+// time of day and season
+type RandomSimulator struct {
+	// Swing in °C between the daily average and the mid-afternoon peak
+	// or pre-dawn low, and between the yearly average and midsummer or
+	// midwinter at the poles; 0 switches either off
+	DiurnalAmplitude  float64
+	SeasonalAmplitude float64
+
+	// Readings stay within [MinTemp, MaxTemp), in °C
+	MinTemp float64
+	MaxTemp float64
+
+	descs descTable
+
+	// Scripted cities, timed from start
+	scenario simScenario
+	start    time.Time
+
+	mu                sync.Mutex // rand.Rand is not safe for concurrent use
+	randomTemperature *rand.Rand
+	now               func() time.Time
+}
+
+// Random weather; the same seed produces the same sequence of readings at
+// the same times
+func NewSimulatedProvider(seed int64) *SimulatedProvider {
+	return NewSimulatedProviderWith(NewRandomSimulator(seed))
+}
+
+func NewSimulatedProviderWith(sim WeatherSimulator) *SimulatedProvider {
+	return &SimulatedProvider{sim: sim}
+}
+
+func NewRandomSimulator(seed int64) *RandomSimulator {
+	return &RandomSimulator{
+		DiurnalAmplitude:  defaultDiurnalAmplitude,
+		SeasonalAmplitude: defaultSeasonalAmplitude,
+		MinTemp:           defaultSimTempMin,
+		MaxTemp:           defaultSimTempMax,
+		descs:             defaultDescTable,
+		randomTemperature: rand.New(rand.NewSource(seed)),
+		now:               time.Now,
+		start:             time.Now(),
+	}
+}
+
+// Provider seeded with seed, with amplitudes from SIM_DIURNAL_AMPLITUDE
+// and SIM_SEASONAL_AMPLITUDE and its range from SIM_TEMP_MIN and
+// SIM_TEMP_MAX, SIM_DESC_BUCKETS for its descriptions the SIM_LATENCY
+// family for injected faults and the scenario from scenarioPath (-scenario)
+// or SIM_SCENARIO. SIM_SCRIPTED_FILE fixes the readings of the cities it
+// lists. The random simulator is returned too, for its settings.
+func simulatedFromEnv(seed int64, scenarioPath string) (*SimulatedProvider, *RandomSimulator, error) {
+	p := NewRandomSimulator(seed)
+	for _, a := range []struct {
+		name     string
+		dst      *float64
+		negative bool // whether the value may be below zero
+	}{
+		{"SIM_DIURNAL_AMPLITUDE", &p.DiurnalAmplitude, false},
+		{"SIM_SEASONAL_AMPLITUDE", &p.SeasonalAmplitude, false},
+		{"SIM_TEMP_MIN", &p.MinTemp, true},
+		{"SIM_TEMP_MAX", &p.MaxTemp, true},
+	} {
+		v := os.Getenv(a.name)
+		if v == "" {
+			continue
+		}
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || math.IsInf(f, 0) || math.IsNaN(f) {
+			return nil, nil, fmt.Errorf("invalid %s %q: must be a number of degrees", a.name, v)
+		}
+		if f < 0 && !a.negative {
+			return nil, nil, fmt.Errorf("invalid %s %q: must not be negative", a.name, v)
+		}
+		*a.dst = f
+	}
+	if p.MinTemp >= p.MaxTemp {
+		return nil, nil, fmt.Errorf("invalid simulated temperature range: SIM_TEMP_MIN (%g) must be below SIM_TEMP_MAX (%g)", p.MinTemp, p.MaxTemp)
+	}
+	if v := os.Getenv("SIM_DESC_BUCKETS"); v != "" {
+		t, err := parseDescTable(v)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid SIM_DESC_BUCKETS: %v", err)
+		}
+		p.descs = t
+	}
+	faults, err := simFaultsFromEnv(seed)
+	if err != nil {
+		return nil, nil, err
+	}
+	path := scenarioPath
+	if path == "" {
+		path = os.Getenv("SIM_SCENARIO")
+	}
+	if path != "" {
+		if p.scenario, err = loadScenario(path); err != nil {
+			return nil, nil, fmt.Errorf("invalid scenario: %w", err)
+		}
+	}
+	var sim WeatherSimulator = p
+	if path := os.Getenv("SIM_SCRIPTED_FILE"); path != "" {
+		if sim, err = LoadScriptedSimulator(path, p); err != nil {
+			return nil, nil, fmt.Errorf("invalid SIM_SCRIPTED_FILE: %w", err)
+		}
+	}
+	provider := NewSimulatedProviderWith(sim)
+	provider.faults = faults
+	return provider, p, nil
+}
+
+// Seed from the -seed flag, then SIM_SEED, then the clock
+func simulatorSeed(flagValue string) (int64, error) {
+	v := flagValue
+	if v == "" {
+		v = os.Getenv("SIM_SEED")
+	}
+	if v == "" {
+		return time.Now().UnixNano(), nil
+	}
+	seed, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid seed %q: must be an integer", v)
+	}
+	return seed, nil
+}
+
+// Answers instantly, so needs no deadline unless faults are injected
+func (p *SimulatedProvider) Timeout() time.Duration {
+	if p.faults != nil {
+		return p.faults.timeout
+	}
+	return 0
+}
+
+func (p *SimulatedProvider) Current(ctx context.Context, city string) (CityWeatherData, error) {
+	if p.faults != nil {
+		if err := p.faults.inject(ctx); err != nil {
+			return CityWeatherData{}, err
+		}
+	}
+	data := p.sim.Simulate(city)
+	if desc, ok := descTranslations[languageFrom(ctx)][data.Desc]; ok {
+		data.Desc = desc
+	}
+	return data, nil
+}
+
+func (p *RandomSimulator) Simulate(city string) CityWeatherData {
+	// Simulate fetching weather data: the city's own base, shifted for the
+	// local season and time of day, plus a small wobble
+	now := p.now()
+	p.mu.Lock()
+	temperature := simulatedBaseTemp(city, p.MinTemp, p.MaxTemp) + p.timeOfYearAndDay(city, now) + (p.randomTemperature.Float64()*2-1)*simulatedTempVariation
+	precipRoll, amountRoll, typeRoll := p.randomTemperature.Float64(), p.randomTemperature.Float64(), p.randomTemperature.Float64()
+	humidity := float64(20 + p.randomTemperature.Intn(81)) // 20-100%
+	windSpeed := float64(p.randomTemperature.Intn(41))     // 0-40 km/h
+	windDir := compassPoints[p.randomTemperature.Intn(len(compassPoints))]
+	pressure := float64(980 + p.randomTemperature.Intn(61)) // 980-1040 hPa
+	p.mu.Unlock()
+	// A scripted city follows its timeline instead, outside the range if
+	// the script says so
+	scriptedTemp, scriptedDesc, scripted := p.scenario.at(city, now.Sub(p.start))
+	if scripted {
+		temperature = scriptedTemp
+	} else {
+		temperature = p.clamp(temperature)
+	}
+	// Describe the reading as reported, so e.g. -0.004 shown as 0 is not
+	// labelled as below zero
+	temperature = float64(int(temperature*100)) / 100.0
+	desc := scriptedDesc // Simulated weather description
+	if desc == "" {
+		desc = p.descs.describe(temperature)
+	}
+
+	// Precipitation is likelier in the cold; snow and sleet only near freezing
+	precipProb := precipRoll * 0.6
+	if temperature < 10 {
+		precipProb = 0.3 + precipRoll*0.7
+	}
+	precipProb = float64(int(precipProb*100)) / 100.0
+	precipType, precipMM := "", 0.0
+	if amountRoll < precipProb {
+		precipMM = float64(int(amountRoll/precipProb*1000)) / 100.0 // up to 10mm
+		switch {
+		case temperature <= 2:
+			precipType = "snow"
+		case temperature <= 5 && typeRoll < 0.5:
+			precipType = "sleet"
+		default:
+			precipType = "rain"
+		}
+	}
+	// Wind makes it feel colder, humid heat warmer
+	feelsLike := temperature - windSpeed/10
+	if temperature > 25 {
+		feelsLike = temperature + (humidity-40)/20
+	}
+	feelsLike = float64(int(feelsLike*100)) / 100.0
+
+	observed := now.UTC()
+
+	// Follow the precipitation, otherwise the temperature, independent of
+	// the description buckets in use
+	condition := ConditionClouds
+	switch {
+	case precipType == "snow" || precipType == "sleet":
+		condition = ConditionSnow
+	case precipType == "rain" && temperature >= 30:
+		condition = ConditionStorm
+	case precipType == "rain":
+		condition = ConditionRain
+	case temperature >= 20:
+		condition = ConditionClear
+	case temperature < 10 && humidity > 90:
+		condition = ConditionFog
+	}
+	// A scripted "Snow" or "Rain" should look it
+	if c := (conditions{desc: strings.ToLower(scriptedDesc)}); c.snowy() {
+		condition = ConditionSnow
+	} else if c.wet() {
+		condition = ConditionRain
+	}
+
+	activity, ok := activityByDesc[desc]
+	if !ok {
+		// A custom or scripted label; judge by the reading itself
+		activity = recommendActivity(temperature, humidity, true, precipType+" "+scriptedDesc)
+	}
+	return CityWeatherData{
+		City:            city,
+		Temp:            temperature,
+		Desc:            desc,
+		Activity:        activity,
+		Condition:       condition,
+		PrecipProb:      precipProb,
+		PrecipMM:        precipMM,
+		PrecipType:      precipType,
+		Humidity:        &humidity,
+		WindSpeed:       &windSpeed,
+		WindDir:         windDir,
+		Pressure:        &pressure,
+		FeelsLike:       &feelsLike,
+		Location:        simulatedLocation(city, now),
+		Timezone:        simulatedTimezone(city),
+		Source:          "simulated",
+		ObservationTime: &observed,
+		CacheTime:       now,
+	}
+}
+
+// Degrees either side of a city's base temperature
+const simulatedTempVariation = 2.5
+
+// Hash of the normalized name, so "Oslo" and " oslo " are the same city
+func simulatedCityHash(city string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(normalizeCity(city)))
+	return h.Sum64()
+}
+
+// Made-up latitude from -60 to 70
+func simulatedLatitude(city string) float64 {
+	return float64(int((float64(simulatedCityHash(city)%13000)/100-60)*100)) / 100
+}
+
+// Base temperature of a city, warmest at its simulated equator and
+// coolest towards the poles, leaving room for the variation within
+// [lo, hi)
+func simulatedBaseTemp(city string, lo, hi float64) float64 {
+	span := max(hi-lo-2*simulatedTempVariation, 0)
+	base := lo + min(simulatedTempVariation, (hi-lo)/2) + (1-math.Abs(simulatedLatitude(city))/70)*span
+	return float64(int(base*100)) / 100
+}
+
+// Keep t within [MinTemp, MaxTemp), to the hundredth of a degree
+func (p *RandomSimulator) clamp(t float64) float64 {
+	return math.Min(math.Max(t, p.MinTemp), p.MaxTemp-0.01)
+}
+
+// Made-up longitude from -180 to 180
+func simulatedLongitude(city string) float64 {
+	return float64(int((float64((simulatedCityHash(city)>>20)%36000)/100-180)*100)) / 100
+}
+
+// Zones simulated cities are spread over, covering both hemispheres,
+// half-hour offsets and zones with and without daylight saving
+var simulatedTimezones = []string{
+	"America/Los_Angeles", "America/Denver", "America/Chicago", "America/New_York",
+	"America/Sao_Paulo", "America/Mexico_City", "Europe/London", "Europe/Paris",
+	"Europe/Berlin", "Europe/Moscow", "Africa/Cairo", "Africa/Lagos",
+	"Africa/Johannesburg", "Asia/Dubai", "Asia/Kolkata", "Asia/Shanghai",
+	"Asia/Tokyo", "Asia/Singapore", "Australia/Sydney", "Pacific/Auckland",
+}
+
+// A stable, made-up zone for the city
+func simulatedTimezone(city string) string {
+	return simulatedTimezones[(simulatedCityHash(city)>>40)%uint64(len(simulatedTimezones))]
+}
+
+// Local time in the city's simulated zone
+func simulatedLocalTime(city string, now time.Time) time.Time {
+	loc, err := time.LoadLocation(simulatedTimezone(city))
+	if err != nil {
+		return now.UTC() // unreachable with the embedded zone database
+	}
+	return now.In(loc)
+}
+
+// Shift from the base temperature at the city's local time: warmest
+// around 15:00 and coolest around 03:00, warmest in mid-July north of the
+// equator and mid-January south of it. Seasons grow stronger with latitude.
+func (p *RandomSimulator) timeOfYearAndDay(city string, now time.Time) float64 {
+	local := simulatedLocalTime(city, now)
+	hour := float64(local.Hour()) + float64(local.Minute())/60
+	diurnal := p.DiurnalAmplitude * math.Cos(2*math.Pi*(hour-15)/24)
+	seasonal := p.SeasonalAmplitude * math.Cos(2*math.Pi*float64(local.YearDay()-196)/365.25) * simulatedLatitude(city) / 70
+	return diurnal + seasonal
+}
+
+// Made-up but stable coordinates and zone, so the same city always lands
+// in the same place
+func simulatedLocation(city string, now time.Time) *Location {
+	return &Location{
+		Name:       city,
+		Lat:        simulatedLatitude(city),
+		Lon:        simulatedLongitude(city),
+		TimezoneID: simulatedTimezone(city),
+		Localtime:  simulatedLocalTime(city, now).Format("2006-01-02 15:04"),
+	}
+}
+
+type simulatedBaseline struct {
+	City     string  `json:"city"`
+	BaseTemp float64 `json:"base_temp"`
+	MinTemp  float64 `json:"min_temp"`
+	MaxTemp  float64 `json:"max_temp"`
+}
+
+// The base temperature simulated readings for each city move around, and
+// the bounds the season, time of day and wobble keep them within, e.g.
+// ?city=Oslo,Cairo, so demo scripts know what to expect
+func (s *Server) simulatedBaselinesHandler(w http.ResponseWriter, r *http.Request) {
+	param := r.URL.Query().Get("city")
+	if param == "" {
+		writeProblem(w, http.StatusBadRequest, "", "City parameter is required", r.URL.Path)
+		return
+	}
+	baselines := []simulatedBaseline{}
+	for _, raw := range strings.Split(param, ",") {
+		city, err := ValidateCity(raw)
+		if err != nil {
+			writeProblem(w, http.StatusBadRequest, "", fmt.Sprintf("Invalid city %q: %v", raw, err), r.URL.Path)
+			return
+		}
+		p := s.upstream.sim
+		base := simulatedBaseTemp(city, p.MinTemp, p.MaxTemp)
+		swing := simulatedTempVariation + p.DiurnalAmplitude + p.SeasonalAmplitude*math.Abs(simulatedLatitude(city))/70
+		baselines = append(baselines, simulatedBaseline{
+			City:     city,
+			BaseTemp: base,
+			MinTemp:  math.Round(p.clamp(base-swing)*100) / 100,
+			MaxTemp:  math.Round(p.clamp(base+swing)*100) / 100,
+		})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(baselines)
+}
@@ -0,0 +1,401 @@
+package weather
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSimulatedSnowOnlyNearFreezing(t *testing.T) {
+	sim := NewRandomSimulator(1)
+	sim.MinTemp, sim.MaxTemp = -10, 15 // plenty of readings either side of 5°C
+	snowy, warm := 0, 0
+	for i := 0; i < 5000; i++ {
+		data := sim.Simulate(fmt.Sprintf("City %d", i%200))
+		if data.Temp > 5 {
+			warm++
+			if data.PrecipType == "snow" || data.PrecipType == "sleet" {
+				t.Fatalf("%s at %v°C: %s", data.City, data.Temp, data.PrecipType)
+			}
+		}
+		if data.PrecipType == "snow" {
+			snowy++
+		}
+	}
+	// Make sure both sides were actually exercised
+	if snowy == 0 || warm == 0 {
+		t.Errorf("%d snowy and %d readings above 5°C, want some of each", snowy, warm)
+	}
+}
+
+// Coordinates and zone depend on the city alone, not on the seed
+func TestSimulatedLocationStable(t *testing.T) {
+	first, err := NewSimulatedProvider(1).Current(context.Background(), "Springfield")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := NewSimulatedProvider(2).Current(context.Background(), "Springfield")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Location == nil || second.Location == nil {
+		t.Fatalf("locations = %+v, %+v", first.Location, second.Location)
+	}
+	a, b := *first.Location, *second.Location
+	if a.Name != "Springfield" || a.Lat != b.Lat || a.Lon != b.Lon || a.TimezoneID != b.TimezoneID {
+		t.Errorf("Springfield at %+v, then %+v", a, b)
+	}
+	if a.Lat < -90 || a.Lat > 90 || a.Lon < -180 || a.Lon > 180 {
+		t.Errorf("coordinates %v, %v out of range", a.Lat, a.Lon)
+	}
+	other := simulatedLocation("Shelbyville", time.Now())
+	if other.Lat == a.Lat && other.Lon == a.Lon {
+		t.Errorf("Shelbyville and Springfield both at %v, %v", a.Lat, a.Lon)
+	}
+}
+
+// The condition agrees with the precipitation and temperature it comes with
+func TestSimulatedConditionMatchesReading(t *testing.T) {
+	sim := NewRandomSimulator(3)
+	seen := map[string]bool{}
+	for i := 0; i < 5000; i++ {
+		data := sim.Simulate(fmt.Sprintf("City %d", i%200))
+		seen[data.Condition] = true
+		var ok bool
+		switch data.Condition {
+		case ConditionSnow:
+			ok = data.PrecipType == "snow" || data.PrecipType == "sleet"
+		case ConditionStorm:
+			ok = data.PrecipType == "rain" && data.Temp >= 30
+		case ConditionRain:
+			ok = data.PrecipType == "rain" && data.Temp < 30
+		case ConditionClear:
+			ok = data.PrecipType == "" && data.Temp >= 20
+		case ConditionFog:
+			ok = data.PrecipType == "" && data.Temp < 10
+		case ConditionClouds:
+			ok = data.PrecipType == "" && data.Temp < 20
+		}
+		if !ok {
+			t.Fatalf("%s at %v°C with %q precipitation: %s", data.City, data.Temp, data.PrecipType, data.Condition)
+		}
+	}
+	for _, c := range []string{ConditionSnow, ConditionRain, ConditionClear, ConditionClouds} {
+		if !seen[c] {
+			t.Errorf("no %s readings in 5000", c)
+		}
+	}
+}
+
+// A simulator with its clock stopped at at
+func simulatorAt(seed int64, at time.Time) *RandomSimulator {
+	sim := NewRandomSimulator(seed)
+	sim.now = func() time.Time { return at }
+	return sim
+}
+
+func TestSimulatedSameSeedSameOutput(t *testing.T) {
+	at := time.Date(2026, 4, 1, 12, 0, 0, 0, time.UTC)
+	first, second, other := simulatorAt(42, at), simulatorAt(42, at), simulatorAt(43, at)
+	differs := false
+	for i := 0; i < 50; i++ {
+		city := []string{"Oslo", "Cairo", "Lima", "Perth", "Quito"}[i%5]
+		a, b, c := first.Simulate(city), second.Simulate(city), other.Simulate(city)
+		if !reflect.DeepEqual(a, b) {
+			t.Fatalf("reading %d for %s differs with the same seed:\n%+v\n%+v", i, city, a, b)
+		}
+		if a.Temp != c.Temp || a.PrecipMM != c.PrecipMM {
+			differs = true
+		}
+	}
+	if !differs {
+		t.Error("seeds 42 and 43 produced the same 50 readings")
+	}
+}
+
+func TestSimulatorSeed(t *testing.T) {
+	tests := []struct {
+		flag, env string
+		want      int64
+		wantErr   bool
+	}{
+		{"7", "9", 7, false},
+		{"", "9", 9, false},
+		{"-3", "", -3, false},
+		{"seven", "", 0, true},
+		{"", "1.5", 0, true},
+	}
+	for _, tt := range tests {
+		t.Setenv("SIM_SEED", tt.env)
+		seed, err := simulatorSeed(tt.flag)
+		if (err != nil) != tt.wantErr || (err == nil && seed != tt.want) {
+			t.Errorf("flag %q, SIM_SEED %q: %d, %v, want %d", tt.flag, tt.env, seed, err, tt.want)
+		}
+	}
+
+	// Unset, a fresh seed is picked each run
+	t.Setenv("SIM_SEED", "")
+	a, _ := simulatorSeed("")
+	time.Sleep(time.Microsecond)
+	if b, _ := simulatorSeed(""); a == b {
+		t.Errorf("two unseeded runs both got %d", a)
+	}
+}
+
+func TestSimulatorSeedInStats(t *testing.T) {
+	var stats struct {
+		SimulatorSeed *int64 `json:"simulator_seed"`
+	}
+	getBody(t, modeServer(t, ModeSimulated), "/cache/stats", &stats)
+	if stats.SimulatorSeed == nil || *stats.SimulatorSeed != 42 {
+		t.Errorf("simulator_seed = %v, want 42", stats.SimulatorSeed)
+	}
+	stats.SimulatorSeed = nil
+	getBody(t, modeServer(t, ModeLive), "/cache/stats", &stats)
+	if stats.SimulatorSeed != nil {
+		t.Errorf("live mode reports simulator_seed %d", *stats.SimulatorSeed)
+	}
+}
+
+func TestSimulatedCityStable(t *testing.T) {
+	sim := simulatorAt(5, time.Date(2026, 1, 15, 9, 0, 0, 0, time.UTC))
+	bands := map[string][2]float64{}
+	for _, city := range []string{"Oslo", "Cairo", "Lima", "Perth", "Quito", "Tokyo"} {
+		lo, hi := math.Inf(1), math.Inf(-1)
+		for i := 0; i < 200; i++ {
+			temp := sim.Simulate(city).Temp
+			lo, hi = math.Min(lo, temp), math.Max(hi, temp)
+		}
+		if hi-lo > 2*simulatedTempVariation {
+			t.Errorf("%s ranged from %v to %v°C, want within %v°C", city, lo, hi, 2*simulatedTempVariation)
+		}
+		bands[city] = [2]float64{lo, hi}
+	}
+	// Different cities sit at different bases, so some bands don't overlap
+	apart := 0
+	for a, ab := range bands {
+		for b, bb := range bands {
+			if a < b && (ab[1] < bb[0] || bb[1] < ab[0]) {
+				apart++
+			}
+		}
+	}
+	if apart == 0 {
+		t.Errorf("every city's readings overlap: %v", bands)
+	}
+
+	// The base follows the normalized name
+	for _, spelling := range []string{"oslo", " OSLO "} {
+		if got, want := simulatedBaseTemp(spelling, 0, 40), simulatedBaseTemp("Oslo", 0, 40); got != want {
+			t.Errorf("base for %q = %v, want %v", spelling, got, want)
+		}
+	}
+}
+
+// Readings stay within the bounds /debug/simulated promises
+func TestSimulatedBaselinesBoundReadings(t *testing.T) {
+	ts := modeServer(t, ModeSimulated)
+	var baselines []simulatedBaseline
+	if resp := getBody(t, ts, "/debug/simulated?city=Oslo,Cairo", &baselines); resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d", resp.StatusCode)
+	}
+	if len(baselines) != 2 || baselines[0].BaseTemp == baselines[1].BaseTemp {
+		t.Fatalf("baselines = %+v, want two different bases", baselines)
+	}
+	for _, b := range baselines {
+		if b.MinTemp > b.BaseTemp || b.BaseTemp > b.MaxTemp {
+			t.Errorf("%s: base %v outside [%v, %v]", b.City, b.BaseTemp, b.MinTemp, b.MaxTemp)
+		}
+		var data CityWeatherData
+		getBody(t, ts, "/weather?city="+b.City, &data)
+		if data.Temp < b.MinTemp || data.Temp > b.MaxTemp {
+			t.Errorf("%s served at %v°C, outside [%v, %v]", b.City, data.Temp, b.MinTemp, b.MaxTemp)
+		}
+		sim := NewRandomSimulator(1)
+		for i := 0; i < 200; i++ {
+			if temp := sim.Simulate(b.City).Temp; temp < b.MinTemp || temp > b.MaxTemp {
+				t.Fatalf("%s simulated at %v°C, outside [%v, %v]", b.City, temp, b.MinTemp, b.MaxTemp)
+			}
+		}
+	}
+}
+
+// A made-up city name placed at a latitude satisfying want
+func cityAtLatitude(t *testing.T, want func(lat float64) bool) string {
+	t.Helper()
+	for i := 0; i < 1000; i++ {
+		city := fmt.Sprintf("Town %d", i)
+		if want(simulatedLatitude(city)) {
+			return city
+		}
+	}
+	t.Fatal("no city found at the wanted latitude")
+	return ""
+}
+
+func TestSimulatedSeasonAndTimeOfDay(t *testing.T) {
+	north := cityAtLatitude(t, func(lat float64) bool { return lat > 40 })
+	south := cityAtLatitude(t, func(lat float64) bool { return lat < -40 })
+
+	// Local wall-clock times in the city's simulated zone
+	at := func(city string, month time.Month, hour int) time.Time {
+		loc, err := time.LoadLocation(simulatedTimezone(city))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return time.Date(2026, month, 15, hour, 0, 0, 0, loc)
+	}
+	reading := func(city string, when time.Time, diurnal, seasonal float64) CityWeatherData {
+		sim := simulatorAt(11, when)
+		sim.MinTemp, sim.MaxTemp = -60, 80 // keep clamping out of it
+		sim.DiurnalAmplitude, sim.SeasonalAmplitude = diurnal, seasonal
+		return sim.Simulate(city)
+	}
+
+	tests := []struct {
+		city        string
+		colder      time.Time
+		warmer      time.Time
+		wantAtLeast float64 // difference, less the worst-case wobble
+	}{
+		{north, at(north, time.January, 3), at(north, time.July, 12), 10},
+		{south, at(south, time.July, 3), at(south, time.January, 12), 10},
+		{north, at(north, time.July, 3), at(north, time.July, 15), 4},
+	}
+	for _, tt := range tests {
+		cold := reading(tt.city, tt.colder, defaultDiurnalAmplitude, defaultSeasonalAmplitude)
+		warm := reading(tt.city, tt.warmer, defaultDiurnalAmplitude, defaultSeasonalAmplitude)
+		if warm.Temp-cold.Temp < tt.wantAtLeast {
+			t.Errorf("%s: %v°C at %v, %v°C at %v; want at least %v°C warmer", tt.city,
+				cold.Temp, tt.colder, warm.Temp, tt.warmer, tt.wantAtLeast)
+		}
+		// The description follows the adjusted temperature
+		for _, r := range []CityWeatherData{cold, warm} {
+			if want := defaultDescTable.describe(r.Temp); r.Desc != want {
+				t.Errorf("%v°C described as %q, want %q", r.Temp, r.Desc, want)
+			}
+		}
+	}
+
+	// With both amplitudes at zero only the wobble is left
+	flatCold := reading(north, at(north, time.January, 3), 0, 0)
+	flatWarm := reading(north, at(north, time.July, 12), 0, 0)
+	if math.Abs(flatWarm.Temp-flatCold.Temp) > 2*simulatedTempVariation {
+		t.Errorf("without amplitudes: %v°C and %v°C", flatCold.Temp, flatWarm.Temp)
+	}
+}
+
+func TestSimulatedAmplitudesFromEnv(t *testing.T) {
+	for name, value := range map[string]string{"SIM_DIURNAL_AMPLITUDE": "3", "SIM_SEASONAL_AMPLITUDE": "12.5", "SIM_TEMP_MIN": "", "SIM_TEMP_MAX": "",
+		"SIM_DESC_BUCKETS": "", "SIM_SCENARIO": "", "SIM_SCRIPTED_FILE": ""} {
+		t.Setenv(name, value)
+	}
+	_, sim, err := simulatedFromEnv(1, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sim.DiurnalAmplitude != 3 || sim.SeasonalAmplitude != 12.5 {
+		t.Errorf("amplitudes = %v, %v, want 3, 12.5", sim.DiurnalAmplitude, sim.SeasonalAmplitude)
+	}
+	t.Setenv("SIM_DIURNAL_AMPLITUDE", "-1")
+	if _, _, err := simulatedFromEnv(1, ""); err == nil {
+		t.Error("accepted a negative amplitude")
+	}
+}
+
+func TestSimulatedWideRangeReachesEveryBucket(t *testing.T) {
+	for name, value := range map[string]string{"SIM_TEMP_MIN": "-20", "SIM_TEMP_MAX": "50", "SIM_DIURNAL_AMPLITUDE": "", "SIM_SEASONAL_AMPLITUDE": "",
+		"SIM_DESC_BUCKETS": "", "SIM_SCENARIO": "", "SIM_SCRIPTED_FILE": ""} {
+		t.Setenv(name, value)
+	}
+	_, sim, err := simulatedFromEnv(9, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := map[string]int{}
+	for i := 0; i < 2000; i++ {
+		data := sim.Simulate(fmt.Sprintf("City %d", i%400))
+		if data.Temp < -20 || data.Temp >= 50 {
+			t.Fatalf("%s at %v°C, outside [-20, 50)", data.City, data.Temp)
+		}
+		seen[data.Desc]++
+	}
+	for _, label := range []string{"Freezing", "Cold", "Cool", "Warm", "Hot", "Scorching"} {
+		if seen[label] == 0 {
+			t.Errorf("no %q readings: %v", label, seen)
+		}
+	}
+
+	for _, bad := range [][2]string{{"10", "10"}, {"30", "-5"}, {"cold", "40"}, {"0", "Inf"}} {
+		t.Setenv("SIM_TEMP_MIN", bad[0])
+		t.Setenv("SIM_TEMP_MAX", bad[1])
+		if _, _, err := simulatedFromEnv(9, ""); err == nil {
+			t.Errorf("SIM_TEMP_MIN=%s SIM_TEMP_MAX=%s accepted", bad[0], bad[1])
+		}
+	}
+}
+
+func TestDescriptionBoundaries(t *testing.T) {
+	tests := []struct {
+		temp float64
+		want string
+	}{
+		{math.Inf(-1), "Freezing"},
+		{-40, "Freezing"},
+		{-0.01, "Freezing"},
+		{0, "Cold"},
+		{9.99, "Cold"},
+		{10, "Cool"},
+		{19.99, "Cool"},
+		{20, "Warm"},
+		{29.99, "Warm"},
+		{30, "Hot"},
+		{39.99, "Hot"},
+		{40, "Scorching"},
+		{55, "Scorching"},
+		{math.Inf(1), "Scorching"},
+		{math.NaN(), "Scorching"},
+	}
+	for _, tt := range tests {
+		if got := defaultDescTable.describe(tt.temp); got != tt.want {
+			t.Errorf("describe(%v) = %q, want %q", tt.temp, got, tt.want)
+		}
+	}
+}
+
+func TestParseDescTable(t *testing.T) {
+	tests := []struct {
+		spec    string
+		temps   []float64
+		want    []string
+		wantErr bool
+	}{
+		{"0:Freezing,10:Cold,20:Cool,30:Warm,40:Hot", []float64{-1, 0, 29.99, 30, 40, 100}, []string{"Freezing", "Cold", "Warm", "Hot", "Hot", "Hot"}, false},
+		{"0:Freezing,10:Cold,20:Cool,30:Warm,40:Hot,Scorching", []float64{39.99, 40}, []string{"Hot", "Scorching"}, false},
+		{" 5 : Chilly , Balmy ", []float64{4.9, 5}, []string{"Chilly", "Balmy"}, false},
+		{"-10:Arctic,0:Icy", []float64{-10.01, -10, 0}, []string{"Arctic", "Icy", "Icy"}, false},
+		{"10:Cold,5:Colder", nil, nil, true},
+		{"10:Cold,10:Cool", nil, nil, true},
+		{"warm:Hot", nil, nil, true},
+		{"NaN:Odd", nil, nil, true},
+		{"0:", nil, nil, true},
+		{"Bare,10:Cold", nil, nil, true},
+		{"0:Freezing,", nil, nil, true},
+	}
+	for _, tt := range tests {
+		table, err := parseDescTable(tt.spec)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%q: err = %v, want error %v", tt.spec, err, tt.wantErr)
+			continue
+		}
+		for i, temp := range tt.temps {
+			if got := table.describe(temp); got != tt.want[i] {
+				t.Errorf("%q: describe(%v) = %q, want %q", tt.spec, temp, got, tt.want[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package weather
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	latencyWindow   = 1000 // measurements kept for the p99 estimate
+	latencyEMAAlpha = 0.1  // weight of the newest measurement in the average
+)
+
+// Upstream latency as an exponential moving average plus a ring buffer
+// of recent measurements for percentiles
+type latencyTracker struct {
+	mu      sync.Mutex
+	ema     float64
+	samples [latencyWindow]float64
+	next    int
+	count   int
+}
+
+func (t *latencyTracker) record(d time.Duration) {
+	ms := float64(d) / float64(time.Millisecond)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.count == 0 {
+		t.ema = ms
+	} else {
+		t.ema = latencyEMAAlpha*ms + (1-latencyEMAAlpha)*t.ema
+	}
+	t.samples[t.next] = ms
+	t.next = (t.next + 1) % latencyWindow
+	if t.count < latencyWindow {
+		t.count++
+	}
+}
+
+// Average and approximate p99 in milliseconds
+func (t *latencyTracker) snapshot() (avg, p99 float64) {
+	t.mu.Lock()
+	sorted := make([]float64, t.count)
+	copy(sorted, t.samples[:t.count])
+	avg = t.ema
+	t.mu.Unlock()
+
+	if len(sorted) == 0 {
+		return 0, 0
+	}
+	sort.Float64s(sorted)
+	rank := int(math.Ceil(0.99*float64(len(sorted)))) - 1
+	return avg, sorted[rank]
+}
+
+// Raw input to location lookups, reported apart from the weather cache
+type geoCacheStats struct {
+	Hits    uint64 `json:"hits"`
+	Misses  uint64 `json:"misses"`
+	Size    int    `json:"size"`
+	MaxSize int    `json:"max_size"`
+}
+
+type cacheStats struct {
+	Hits                 uint64  `json:"hits"`
+	Misses               uint64  `json:"misses"`
+	EvictedByExpiry      uint64  `json:"evicted_by_expiry"`
+	EvictedBySize        uint64  `json:"evicted_by_size"`
+	RefreshedAhead       uint64  `json:"refreshed_ahead"` // hits refetched in the background before expiry
+	Panics               uint64  `json:"panics"`          // handler panics answered with 500
+	Size                 int     `json:"size"`
+	MaxSize              int     `json:"max_size"`
+	AvgUpstreamLatencyMs float64 `json:"avg_upstream_latency_ms"`
+	P99UpstreamLatencyMs float64 `json:"p99_upstream_latency_ms"`
+	CircuitState         string  `json:"circuit_state"`
+	QuotaRemaining       *int    `json:"quota_remaining,omitempty"`  // only with UPSTREAM_QUOTA set
+	APIKeyIndex          *int    `json:"api_key_index,omitempty"`    // Weatherstack key last used, counting from 0
+	SimulatorSeed        *int64  `json:"simulator_seed,omitempty"`   // only when serving simulated weather
+	ReadingsDropped      *uint64 `json:"readings_dropped,omitempty"` // only with HISTORY_DB set
+	BusDropped           uint64  `json:"bus_dropped"`                // updates a slow internal subscriber missed
+
+	Providers map[string]providerSnapshot `json:"providers,omitempty"`
+	Geocoding geoCacheStats               `json:"geocoding"`
+}
+
+func (s *Server) cacheStatsHandler(w http.ResponseWriter, r *http.Request) {
+	entries := s.cache.entries.Stats()
+
+	avg, p99 := s.upstreamLatency.snapshot()
+	stats := cacheStats{
+		Hits:                 entries.Hits,
+		Misses:               entries.Misses,
+		EvictedByExpiry:      entries.EvictedByExpiry,
+		EvictedBySize:        entries.EvictedBySize,
+		RefreshedAhead:       s.cache.refreshedAhead.Load(),
+		Panics:               s.panics.Load(),
+		Size:                 entries.Size,
+		MaxSize:              entries.MaxSize,
+		AvgUpstreamLatencyMs: avg,
+		P99UpstreamLatencyMs: p99,
+		CircuitState:         s.breaker.currentState(),
+		BusDropped:           s.bus.dropped.Load(),
+		Providers:            s.upstream.stats.snapshots(),
+		Geocoding: geoCacheStats{
+			Hits:    s.geo.hits.Load(),
+			Misses:  s.geo.misses.Load(),
+			Size:    s.geo.len(),
+			MaxSize: s.geo.maxSize,
+		},
+	}
+	if s.quota != nil {
+		remaining := s.quota.remaining()
+		stats.QuotaRemaining = &remaining
+	}
+	if s.upstream.sim != nil {
+		seed := s.config.SimulatorSeed
+		stats.SimulatorSeed = &seed
+	}
+	if s.readings != nil {
+		dropped := s.readings.dropped.Load()
+		stats.ReadingsDropped = &dropped
+	}
+	if s.upstream.keys != nil {
+		idx := s.upstream.keys.activeIndex()
+		stats.APIKeyIndex = &idx
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
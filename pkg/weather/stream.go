@@ -0,0 +1,186 @@
+package weather
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	heartbeatInterval = 15 * time.Second
+	maxStreamCities   = 50 // per /weather/stream request
+)
+
+// Fan-out of cache updates to interested subscribers, keyed by lowercased city
+type updateHub struct {
+	mu   sync.Mutex
+	subs map[string]map[chan CityWeatherData]struct{}
+}
+
+func newUpdateHub() *updateHub {
+	return &updateHub{subs: make(map[string]map[chan CityWeatherData]struct{})}
+}
+
+// Register a buffered channel that receives updates for the given cities
+func (h *updateHub) subscribe(cities []string) chan CityWeatherData {
+	ch := make(chan CityWeatherData, 16)
+	h.add(ch, cities)
+	return ch
+}
+
+// Extend an existing subscription with more cities
+func (h *updateHub) add(ch chan CityWeatherData, cities []string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, city := range cities {
+		key := strings.ToLower(city)
+		if h.subs[key] == nil {
+			h.subs[key] = make(map[chan CityWeatherData]struct{})
+		}
+		h.subs[key][ch] = struct{}{}
+	}
+}
+
+func (h *updateHub) unsubscribe(ch chan CityWeatherData, cities []string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, city := range cities {
+		key := strings.ToLower(city)
+		delete(h.subs[key], ch)
+		if len(h.subs[key]) == 0 {
+			delete(h.subs, key)
+		}
+	}
+}
+
+// Deliver an update to every subscriber of the city without blocking;
+// a subscriber whose buffer is full misses the update
+func (h *updateHub) publish(city string, data CityWeatherData) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subs[strings.ToLower(city)] {
+		select {
+		case ch <- data:
+		default:
+			slog.Warn("Stream subscriber too slow, dropping update", "city", city)
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, r *http.Request, event string, v interface{}) error {
+	payload, err := marshalFor(r.Context(), v)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload)
+	return err
+}
+
+// The current reading of city, already validated and alias-resolved, as
+// /weather would serve it, and the cache key its updates are published
+// under from then on
+func (s *Server) snapshot(ctx context.Context, city, lang string) (CityWeatherData, string, error) {
+	if !s.acquireSlot(ctx) {
+		return CityWeatherData{}, "", ctx.Err()
+	}
+	defer s.releaseSlot()
+	key := s.resolveCity(city)
+	data, err := s.cachedWeather(ctx, key, lang)
+	if err == nil {
+		// A first fetch may re-key the reading under its canonical name
+		s.learnLocation(city, key, lang, data)
+	}
+	return data, languageCacheKey(s.resolveCity(city), lang), err
+}
+
+func (s *Server) streamHandler(w http.ResponseWriter, r *http.Request) {
+	// Resolved as /weather resolves them, so the stream follows the same
+	// cache entries /weather writes
+	var cities []string
+	seen := make(map[string]bool)
+	for _, city := range strings.Split(r.URL.Query().Get("cities"), ",") {
+		if city = strings.TrimSpace(city); city == "" {
+			continue
+		}
+		city, err := ValidateCity(city)
+		if err != nil {
+			writeValidationError(w, r, err)
+			return
+		}
+		city = s.aliases.resolve(city)
+		if !s.allowed.allows(city) {
+			writeProblem(w, http.StatusForbidden, "", fmt.Sprintf("City not allowed: %s", city), r.URL.Path)
+			return
+		}
+		if !seen[strings.ToLower(city)] {
+			seen[strings.ToLower(city)] = true
+			cities = append(cities, city)
+		}
+	}
+	if len(cities) == 0 {
+		writeProblem(w, http.StatusBadRequest, "", "Cities parameter is required", r.URL.Path)
+		return
+	}
+	if len(cities) > maxStreamCities {
+		writeProblem(w, http.StatusBadRequest, "", fmt.Sprintf("At most %d cities can be streamed at once", maxStreamCities), r.URL.Path)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeProblem(w, http.StatusInternalServerError, "", "Streaming unsupported", r.URL.Path)
+		return
+	}
+
+	// Each city is subscribed to once its snapshot is written, so a fetch
+	// for the snapshot is not also delivered as an update; a reading
+	// cached in between is caught by looking again
+	updates := s.hub.subscribe(nil)
+	var subscribed []string
+	defer func() { s.hub.unsubscribe(updates, subscribed) }()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	for _, city := range cities {
+		data, key, err := s.snapshot(r.Context(), city, defaultLanguage)
+		if r.Context().Err() != nil {
+			return
+		}
+		s.hub.add(updates, []string{key})
+		subscribed = append(subscribed, key)
+		if err != nil {
+			writeEvent(w, r, "error", map[string]string{"city": city, "error": err.Error()})
+			continue
+		}
+		writeEvent(w, r, "weather", data)
+		if latest, ok := s.cache.peek(key); ok && !latest.CacheTime.Equal(data.CacheTime) {
+			writeEvent(w, r, "weather", latest)
+		}
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case data := <-updates:
+			if err := writeEvent(w, r, "weather", data); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,254 @@
+package weather_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/deepakg86/weather-api-caching/pkg/weather"
+)
+
+// A provider reporting one degree warmer on every fetch, so each refresh
+// is told apart from the last
+type warmingProvider struct{ fetches atomic.Int32 }
+
+func (p *warmingProvider) Timeout() time.Duration { return 0 }
+
+func (p *warmingProvider) Current(ctx context.Context, city string) (weather.CityWeatherData, error) {
+	n := p.fetches.Add(1)
+	return weather.CityWeatherData{City: city, Temp: float64(10 + n), Desc: "Cloudy", CacheTime: time.Now()}, nil
+}
+
+type sseEvent struct {
+	name string
+	data string
+}
+
+// Read events off an event stream in the background, skipping comments
+func readEvents(t *testing.T, resp *http.Response) <-chan sseEvent {
+	t.Helper()
+	events := make(chan sseEvent, 16)
+	go func() {
+		defer close(events)
+		var ev sseEvent
+		sc := bufio.NewScanner(resp.Body)
+		for sc.Scan() {
+			line := sc.Text()
+			switch {
+			case line == "":
+				if ev.name != "" {
+					events <- ev
+				}
+				ev = sseEvent{}
+			case strings.HasPrefix(line, "event: "):
+				ev.name = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				ev.data = strings.TrimPrefix(line, "data: ")
+			}
+		}
+	}()
+	return events
+}
+
+func nextWeather(t *testing.T, events <-chan sseEvent) weather.CityWeatherData {
+	t.Helper()
+	select {
+	case ev, ok := <-events:
+		if !ok {
+			t.Fatal("stream closed")
+		}
+		if ev.name != "weather" {
+			t.Fatalf("event %q (%s), want weather", ev.name, ev.data)
+		}
+		var data weather.CityWeatherData
+		if err := json.Unmarshal([]byte(ev.data), &data); err != nil {
+			t.Fatalf("decoding event %s: %v", ev.data, err)
+		}
+		return data
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event within 5s")
+	}
+	return weather.CityWeatherData{}
+}
+
+func TestStreamSendsSnapshotThenUpdates(t *testing.T) {
+	provider := &warmingProvider{}
+	ts := newTestServer(t, provider, func(config *weather.Config) {
+		config.CacheTTL = 100 * time.Millisecond
+	})
+
+	// London is cached before the stream opens, Paris is fetched for it
+	getJSON(t, ts, "/weather?city=London", nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+"/weather/stream?cities=London,Paris,london", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET /weather/stream: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want 200", resp.StatusCode)
+	}
+	if got := resp.Header.Get("Content-Type"); got != "text/event-stream" {
+		t.Errorf("Content-Type = %q, want text/event-stream", got)
+	}
+	events := readEvents(t, resp)
+
+	initial := map[string]float64{}
+	for i := 0; i < 2; i++ {
+		data := nextWeather(t, events)
+		initial[data.City] = data.Temp
+	}
+	if len(initial) != 2 || initial["London"] != 11 || initial["Paris"] != 12 {
+		t.Errorf("initial events = %v, want cached London (11) and fetched Paris (12)", initial)
+	}
+
+	// Another client refetching London once it expires reaches the stream
+	time.Sleep(150 * time.Millisecond)
+	getJSON(t, ts, "/weather?city=London", nil)
+	if data := nextWeather(t, events); data.City != "London" || data.Temp != 13 {
+		t.Errorf("update = %s at %v, want London at 13", data.City, data.Temp)
+	}
+
+	// Closing the stream leaves the server serving
+	cancel()
+	for range events {
+	}
+	if resp := getJSON(t, ts, "/weather?city=Paris", nil); resp.StatusCode != http.StatusOK {
+		t.Errorf("after disconnect: status %d", resp.StatusCode)
+	}
+}
+
+func TestStreamClientsShareOneFetch(t *testing.T) {
+	provider := newGatedProvider()
+	ts := newTestServer(t, provider, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Headers only arrive with the snapshot, so each client waits apart
+	const clients = 5
+	temps := make(chan float64, clients)
+	for i := 0; i < clients; i++ {
+		go func() {
+			req, _ := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+"/weather/stream?cities=Oslo", nil)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				temps <- -1
+				return
+			}
+			defer resp.Body.Close()
+			ev, ok := <-readEvents(t, resp)
+			var data weather.CityWeatherData
+			if !ok || ev.name != "weather" || json.Unmarshal([]byte(ev.data), &data) != nil {
+				temps <- -1
+				return
+			}
+			temps <- data.Temp
+		}()
+	}
+	// Let every client reach the cold cache before the fetch completes
+	time.Sleep(100 * time.Millisecond)
+	close(provider.release)
+
+	for i := 0; i < clients; i++ {
+		select {
+		case temp := <-temps:
+			if temp != 12 {
+				t.Errorf("client snapshot at %v, want the fetched 12", temp)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("a client got no snapshot within 5s")
+		}
+	}
+	if n := len(provider.started); n != 1 {
+		t.Errorf("%d upstream fetches for %d clients of a cold city, want 1", n, clients)
+	}
+}
+
+func TestStreamRejectsBadCities(t *testing.T) {
+	ts := newTestServer(t, &warmingProvider{}, nil)
+
+	for _, query := range []string{"", "?cities=%20,%20", "?cities=London,Par1s"} {
+		var p problemBody
+		if resp := getJSON(t, ts, "/weather/stream"+query, &p); resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%q: status %d, want 400", query, resp.StatusCode)
+		}
+	}
+}
+
+func TestStreamSnapshotsEveryColdCity(t *testing.T) {
+	ts := newTestServer(t, &warmingProvider{}, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// More cold cities than a subscriber's update buffer holds
+	var names []string
+	for i := 0; i < 30; i++ {
+		names = append(names, "City"+strings.Repeat("x", i))
+	}
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+"/weather/stream?cities="+strings.Join(names, ","), nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET /weather/stream: %v", err)
+	}
+	defer resp.Body.Close()
+	events := readEvents(t, resp)
+	got := make(map[string]bool)
+	for range names {
+		got[nextWeather(t, events).City] = true
+	}
+	if len(got) != len(names) {
+		t.Errorf("snapshots for %d distinct cities, want %d", len(got), len(names))
+	}
+
+	for len(names) <= 50 {
+		names = append(names, "Town"+strings.Repeat("x", len(names)))
+	}
+	if resp := getJSON(t, ts, "/weather/stream?cities="+strings.Join(names, ","), nil); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("%d cities: status %d, want 400", len(names), resp.StatusCode)
+	}
+}
+
+func TestStreamFollowsAliasedCity(t *testing.T) {
+	aliases := filepath.Join(t.TempDir(), "aliases.txt")
+	if err := os.WriteFile(aliases, []byte("NYC = New York City\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ts := newTestServer(t, &warmingProvider{}, func(config *weather.Config) {
+		config.CityAliasesFile = aliases
+		config.CacheTTL = 100 * time.Millisecond
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+"/weather/stream?cities=nyc", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET /weather/stream: %v", err)
+	}
+	defer resp.Body.Close()
+	events := readEvents(t, resp)
+	if data := nextWeather(t, events); data.City != "New York City" || data.Temp != 11 {
+		t.Fatalf("snapshot = %s at %v, want New York City at 11", data.City, data.Temp)
+	}
+
+	// /weather under the full name shares the entry, so its refresh
+	// reaches the stream
+	var data weather.CityWeatherData
+	if getJSON(t, ts, "/weather?city=New%20York%20City", &data); data.Temp != 11 {
+		t.Errorf("/weather served %v, want the streamed entry's 11", data.Temp)
+	}
+	time.Sleep(150 * time.Millisecond)
+	getJSON(t, ts, "/weather?city=New%20York%20City", nil)
+	if data := nextWeather(t, events); data.City != "New York City" || data.Temp != 12 {
+		t.Errorf("update = %s at %v, want New York City at 12", data.City, data.Temp)
+	}
+}
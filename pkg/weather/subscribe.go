@@ -0,0 +1,96 @@
+package weather
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultPollTimeout = 30 * time.Second
+	maxPollTimeout     = 60 * time.Second
+)
+
+// Latest reading for the city regardless of age, without counting as a
+// cache hit or reordering the LRU list
+func (c *Cache) peek(city string) (CityWeatherData, bool) {
+	e, ok := c.entries.Peek(city)
+	if !ok || e.Outdated {
+		return CityWeatherData{}, false
+	}
+	return e.Value, true
+}
+
+// Long polling for clients that can use neither SSE nor WebSocket: hold
+// the request until the city's cache entry is refreshed, or answer with
+// whatever is cached once the timeout passes
+func (s *Server) subscribeHandler(w http.ResponseWriter, r *http.Request) {
+	city := r.URL.Query().Get("city")
+	if city == "" {
+		writeProblem(w, http.StatusBadRequest, "", "City parameter is required", r.URL.Path)
+		return
+	}
+	city, err := ValidateCity(city)
+	if err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+	city = s.aliases.resolve(city)
+	if !s.allowed.allows(city) {
+		writeProblem(w, http.StatusForbidden, "", fmt.Sprintf("City not allowed: %s", city), r.URL.Path)
+		return
+	}
+
+	timeout := defaultPollTimeout
+	if t := r.URL.Query().Get("timeout"); t != "" {
+		n, err := strconv.Atoi(t)
+		if err != nil || n <= 0 {
+			writeProblem(w, http.StatusBadRequest, "", "Timeout must be a positive number of seconds", r.URL.Path)
+			return
+		}
+		timeout = min(time.Duration(n)*time.Second, maxPollTimeout)
+	}
+
+	// Waits on the entry /weather reads and writes for the city
+	key := languageCacheKey(s.resolveCity(city), defaultLanguage)
+	updates := s.hub.subscribe([]string{key})
+	defer s.hub.unsubscribe(updates, []string{key})
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	var data CityWeatherData
+	fresh := false
+	select {
+	case data = <-updates:
+		fresh = true
+	case <-r.Context().Done():
+		return
+	case <-timer.C:
+		var ok bool
+		if data, ok = s.cache.peek(key); !ok {
+			// Nothing cached at all: fetch rather than answer empty-handed
+			if data, _, err = s.snapshot(r.Context(), city, defaultLanguage); err != nil {
+				writeProblem(w, upstreamErrorStatus(err), "", fmt.Sprintf("Failed to fetch weather data: %v", err), r.URL.Path)
+				return
+			}
+		}
+	}
+
+	// CityWeatherData marshals itself, so add the flag to its fields
+	var body map[string]json.RawMessage
+	b, err := json.Marshal(data)
+	if err == nil {
+		err = json.Unmarshal(b, &body)
+	}
+	if err != nil {
+		writeProblem(w, http.StatusInternalServerError, "", fmt.Sprintf("Error encoding response: %v", err), r.URL.Path)
+		return
+	}
+	body["fresh"] = json.RawMessage(strconv.FormatBool(fresh))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(body)
+}
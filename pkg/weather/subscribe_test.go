@@ -0,0 +1,77 @@
+package weather_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/deepakg86/weather-api-caching/pkg/weather"
+)
+
+type pollBody struct {
+	City  string  `json:"city"`
+	Temp  float64 `json:"temp"`
+	Fresh bool    `json:"fresh"`
+}
+
+// A server where NYC is an alias of New York City and entries expire
+// quickly, so a test can refresh one
+func aliasServer(t *testing.T, provider weather.WeatherProvider) *httptest.Server {
+	t.Helper()
+	aliases := filepath.Join(t.TempDir(), "aliases.txt")
+	if err := os.WriteFile(aliases, []byte("NYC = New York City\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return newTestServer(t, provider, func(config *weather.Config) {
+		config.CityAliasesFile = aliases
+		config.CacheTTL = 100 * time.Millisecond
+	})
+}
+
+func TestLongPollOnAliasWakesOnRefresh(t *testing.T) {
+	ts := aliasServer(t, &warmingProvider{})
+
+	polled := make(chan pollBody, 1)
+	go func() {
+		var body pollBody
+		if resp, err := http.Get(ts.URL + "/weather/subscribe?city=nyc&timeout=5"); err == nil {
+			json.NewDecoder(resp.Body).Decode(&body)
+			resp.Body.Close()
+		}
+		polled <- body
+	}()
+	time.Sleep(100 * time.Millisecond) // let the poll start waiting
+	getJSON(t, ts, "/weather?city=New%20York%20City", nil)
+
+	select {
+	case body := <-polled:
+		if !body.Fresh || body.City != "New York City" || body.Temp != 11 {
+			t.Errorf("poll = %+v, want the fresh New York City reading", body)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("poll on nyc did not wake for a New York City refresh")
+	}
+}
+
+func TestLongPollTimeoutFetchesTheSharedEntry(t *testing.T) {
+	provider := &warmingProvider{}
+	ts := aliasServer(t, provider)
+
+	var body pollBody
+	if resp := getJSON(t, ts, "/weather/subscribe?city=NYC&timeout=1", &body); resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d", resp.StatusCode)
+	}
+	if body.Fresh || body.City != "New York City" || body.Temp != 11 {
+		t.Errorf("poll = %+v, want New York City fetched at 11 after the timeout", body)
+	}
+
+	// /weather finds the entry the poll fetched
+	var data weather.CityWeatherData
+	if getJSON(t, ts, "/weather?city=New%20York%20City", &data); data.Temp != 11 || provider.fetches.Load() != 1 {
+		t.Errorf("/weather served %v after %d fetches, want the polled 11 from one", data.Temp, provider.fetches.Load())
+	}
+}
@@ -0,0 +1,63 @@
+// Package testutil holds helpers for exercising the weather server without
+// a live upstream
+package testutil
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/deepakg86/weather-api-caching/pkg/weather"
+)
+
+// A WeatherProvider with canned answers: Errors is checked first, then
+// Data; any other city is reported as not found. Cities are matched
+// exactly as the server passes them.
+type MockWeatherProvider struct {
+	Data   map[string]weather.CityWeatherData
+	Errors map[string]error
+
+	mu    sync.Mutex
+	calls map[string]int
+}
+
+func NewMockWeatherProvider(data map[string]weather.CityWeatherData, errs map[string]error) *MockWeatherProvider {
+	return &MockWeatherProvider{Data: data, Errors: errs, calls: make(map[string]int)}
+}
+
+// Answers instantly, so needs no deadline
+func (m *MockWeatherProvider) Timeout() time.Duration { return 0 }
+
+func (m *MockWeatherProvider) Current(ctx context.Context, city string) (weather.CityWeatherData, error) {
+	m.mu.Lock()
+	if m.calls == nil {
+		m.calls = make(map[string]int)
+	}
+	m.calls[city]++
+	m.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return weather.CityWeatherData{}, err
+	}
+	if err, ok := m.Errors[city]; ok {
+		return weather.CityWeatherData{}, err
+	}
+	data, ok := m.Data[city]
+	if !ok {
+		return weather.CityWeatherData{}, fmt.Errorf("%w: %s", weather.ErrCityNotFound, city)
+	}
+	// Stamp the reading as fresh, as a real fetch would
+	data.CacheTime = time.Now()
+	if data.City == "" {
+		data.City = city
+	}
+	return data, nil
+}
+
+// How often city has been fetched, e.g. to tell a cache hit from a miss
+func (m *MockWeatherProvider) Calls(city string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.calls[city]
+}
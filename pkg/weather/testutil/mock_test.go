@@ -0,0 +1,62 @@
+package testutil
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/deepakg86/weather-api-caching/pkg/weather"
+)
+
+func TestMockWeatherProvider(t *testing.T) {
+	outage := errors.New("upstream down")
+	m := NewMockWeatherProvider(map[string]weather.CityWeatherData{
+		"London": {Temp: 11.5, Desc: "Partly cloudy"},
+		"Paris":  {City: "Paris", Temp: 18},
+	}, map[string]error{"Paris": outage})
+
+	data, err := m.Current(context.Background(), "London")
+	if err != nil {
+		t.Fatalf("London: %v", err)
+	}
+	if data.City != "London" || data.Temp != 11.5 || data.CacheTime.IsZero() {
+		t.Errorf("London = %+v, want the canned reading named and stamped", data)
+	}
+
+	// Errors win over data, and unknown cities are not found
+	if _, err := m.Current(context.Background(), "Paris"); !errors.Is(err, outage) {
+		t.Errorf("Paris: err = %v, want the canned error", err)
+	}
+	if _, err := m.Current(context.Background(), "Atlantis"); !errors.Is(err, weather.ErrCityNotFound) {
+		t.Errorf("Atlantis: err = %v, want ErrCityNotFound", err)
+	}
+	if _, err := m.Current(context.Background(), "london"); !errors.Is(err, weather.ErrCityNotFound) {
+		t.Errorf("london: err = %v, want cities matched exactly", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := m.Current(ctx, "London"); !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled: err = %v, want context.Canceled", err)
+	}
+
+	// Every call counts, failed ones included
+	for city, want := range map[string]int{"London": 2, "Paris": 1, "Atlantis": 1, "Rome": 0} {
+		if got := m.Calls(city); got != want {
+			t.Errorf("Calls(%s) = %d, want %d", city, got, want)
+		}
+	}
+	if m.Timeout() != 0 {
+		t.Errorf("Timeout = %v, want none", m.Timeout())
+	}
+}
+
+func TestMockWeatherProviderZeroValue(t *testing.T) {
+	var m MockWeatherProvider
+	if _, err := m.Current(context.Background(), "London"); !errors.Is(err, weather.ErrCityNotFound) {
+		t.Errorf("err = %v, want ErrCityNotFound", err)
+	}
+	if m.Calls("London") != 1 {
+		t.Errorf("Calls = %d, want 1", m.Calls("London"))
+	}
+}
@@ -0,0 +1,91 @@
+package weather
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type HistoryPoint struct {
+	Timestamp time.Time `json:"timestamp"`
+	Temp      float64   `json:"temp"`
+}
+
+// Per-city rings of recent temperatures, oldest overwritten first
+type tempSeries struct {
+	mu     sync.Mutex
+	depth  int
+	cities map[string]*pointRing
+}
+
+type pointRing struct {
+	points []HistoryPoint
+	next   int
+	count  int
+}
+
+func newTempSeries(depth int) *tempSeries {
+	return &tempSeries{depth: depth, cities: make(map[string]*pointRing)}
+}
+
+func (ts *tempSeries) record(data CityWeatherData) {
+	key := strings.ToLower(data.City)
+
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	r, ok := ts.cities[key]
+	if !ok {
+		r = &pointRing{points: make([]HistoryPoint, ts.depth)}
+		ts.cities[key] = r
+	}
+	r.points[r.next] = HistoryPoint{Timestamp: data.CacheTime, Temp: data.Temp}
+	r.next = (r.next + 1) % ts.depth
+	if r.count < ts.depth {
+		r.count++
+	}
+}
+
+// Points recorded since the given time, oldest first
+func (ts *tempSeries) since(city string, cutoff time.Time) []HistoryPoint {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	result := []HistoryPoint{}
+	r, ok := ts.cities[strings.ToLower(city)]
+	if !ok {
+		return result
+	}
+	start := (r.next - r.count + ts.depth) % ts.depth
+	for i := 0; i < r.count; i++ {
+		p := r.points[(start+i)%ts.depth]
+		if !p.Timestamp.Before(cutoff) {
+			result = append(result, p)
+		}
+	}
+	return result
+}
+
+func (s *Server) seriesHandler(w http.ResponseWriter, r *http.Request) {
+	city := r.URL.Query().Get("city")
+	if city == "" {
+		writeProblem(w, http.StatusBadRequest, "", "City parameter is required", r.URL.Path)
+		return
+	}
+
+	// Without hours, return everything still in the ring
+	var cutoff time.Time
+	if h := r.URL.Query().Get("hours"); h != "" {
+		n, err := strconv.Atoi(h)
+		if err != nil || n <= 0 {
+			writeProblem(w, http.StatusBadRequest, "", "Hours must be a positive integer", r.URL.Path)
+			return
+		}
+		cutoff = time.Now().Add(-time.Duration(n) * time.Hour)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.series.since(city, cutoff))
+}
@@ -0,0 +1,85 @@
+package weather
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// Takes delay to answer, like a struggling upstream
+type slowProvider struct {
+	delay time.Duration
+}
+
+func (p slowProvider) Timeout() time.Duration { return 0 }
+
+func (p slowProvider) Current(ctx context.Context, city string) (CityWeatherData, error) {
+	time.Sleep(p.delay)
+	return CityWeatherData{City: city, Temp: 17, Desc: "Fog", CacheTime: time.Now()}, nil
+}
+
+var serverTimingFormat = regexp.MustCompile(`^cache;dur=(\d+\.\d{1,3}), upstream;dur=(\d+\.\d{1,3}), encode;dur=(\d+\.\d{1,3})$`)
+
+func TestSlowUpstreamWarnsWithBreakdown(t *testing.T) {
+	h := recordLogs(t)
+	config := DefaultConfig()
+	config.SlowUpstreamThreshold = 30 * time.Millisecond
+	config.Features.EnableServerTiming = true
+	srv, err := NewServer(slowProvider{delay: 80 * time.Millisecond}, config)
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	ts := httptest.NewServer(srv.Handler())
+
+	upstreamMs := func(resp *http.Response) float64 {
+		t.Helper()
+		header := resp.Header.Get("Server-Timing")
+		m := serverTimingFormat.FindStringSubmatch(header)
+		if m == nil {
+			t.Fatalf("Server-Timing %q, want cache, upstream and encode durations", header)
+		}
+		ms, _ := strconv.ParseFloat(m[2], 64)
+		return ms
+	}
+	if ms := upstreamMs(getBody(t, ts, "/weather?city=London", nil)); ms < 80 {
+		t.Errorf("upstream;dur=%g for an 80ms fetch", ms)
+	}
+	// A cache hit waits on nothing
+	if ms := upstreamMs(getBody(t, ts, "/weather?city=London", nil)); ms != 0 {
+		t.Errorf("upstream;dur=%g on a cache hit, want 0", ms)
+	}
+	ts.Close()
+
+	warnings := h.logged("Slow upstream")
+	if len(warnings) != 1 {
+		t.Fatalf("%d slow upstream warnings, want 1 for the miss", len(warnings))
+	}
+	w := warnings[0]
+	if w["threshold_ms"] != 30.0 || w["city"] != "London" || w["request_id"] == "" {
+		t.Errorf("warning %v, want threshold_ms 30 for London with a request ID", w)
+	}
+	for _, key := range []string{"cache_ms", "upstream_ms", "encode_ms", "total_ms"} {
+		if _, ok := w[key].(float64); !ok {
+			t.Errorf("warning lacks %s: %v", key, w)
+		}
+	}
+	if ms, _ := w["upstream_ms"].(float64); ms < 80 {
+		t.Errorf("upstream_ms = %g for an 80ms fetch", ms)
+	}
+}
+
+func TestServerTimingOffByDefault(t *testing.T) {
+	srv, err := NewServer(slowProvider{}, DefaultConfig())
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+	if resp := getBody(t, ts, "/weather?city=London", nil); resp.Header.Get("Server-Timing") != "" {
+		t.Errorf("Server-Timing %q without ENABLE_SERVER_TIMING", resp.Header.Get("Server-Timing"))
+	}
+}
@@ -0,0 +1,113 @@
+package weather
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// Build the TLS configuration from TLS_DOMAIN (Let's Encrypt) or
+// TLS_CERT_FILE and TLS_KEY_FILE. The returned server is the plain HTTP
+// redirect listener, only run when HTTP_PORT is set; it is nil otherwise
+// and whenever TLS is not configured.
+func configureTLS(server *http.Server) (*http.Server, error) {
+	certFile := os.Getenv("TLS_CERT_FILE")
+	keyFile := os.Getenv("TLS_KEY_FILE")
+	domain := os.Getenv("TLS_DOMAIN")
+
+	var redirect http.Handler
+	switch {
+	case domain != "":
+		cacheDir := os.Getenv("TLS_CACHE_DIR")
+		if cacheDir == "" {
+			cacheDir = "autocert-cache"
+		}
+		manager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(domain),
+			Cache:      autocert.DirCache(cacheDir),
+		}
+		server.TLSConfig = manager.TLSConfig()
+		server.TLSConfig.MinVersion = tls.VersionTLS12
+		slog.Info("Serving HTTPS with Let's Encrypt certificates", "domain", domain)
+		// The plain HTTP listener also answers the ACME http-01 challenge;
+		// without it certificates come through tls-alpn-01 on the TLS port
+		redirect = manager.HTTPHandler(redirectToHTTPS(server.Addr))
+
+	case certFile != "" || keyFile != "":
+		if certFile == "" || keyFile == "" {
+			return nil, fmt.Errorf("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+		}
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading TLS certificate: %w", err)
+		}
+		server.TLSConfig = &tls.Config{
+			MinVersion:   tls.VersionTLS12,
+			Certificates: []tls.Certificate{cert},
+		}
+		slog.Info("Serving HTTPS", "certificate", certFile)
+		redirect = redirectToHTTPS(server.Addr)
+
+	default:
+		return nil, nil
+	}
+
+	port := os.Getenv("HTTP_PORT")
+	if port == "" {
+		return nil, nil
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 0 || n > 65535 {
+		return nil, fmt.Errorf("invalid HTTP_PORT %q: must be a port number", port)
+	}
+	return &http.Server{Addr: ":" + port, Handler: redirect}, nil
+}
+
+// Start the server over HTTPS when TLS is configured, plain HTTP otherwise
+func serve(server *http.Server, ln net.Listener) error {
+	if server.TLSConfig == nil {
+		return server.Serve(ln)
+	}
+	// Certificates are already part of the TLS config
+	return server.ServeTLS(ln, "", "")
+}
+
+// Bind the redirect listener up front, so a taken port fails startup, and
+// serve it in the background until it is shut down. Addr becomes the
+// bound address.
+func startRedirect(redirect *http.Server) error {
+	ln, err := net.Listen("tcp", redirect.Addr)
+	if err != nil {
+		return err
+	}
+	redirect.Addr = ln.Addr().String()
+	slog.Info("Redirecting HTTP to HTTPS", "addr", redirect.Addr)
+	go func() {
+		if err := redirect.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("HTTP redirect listener stopped", "err", err)
+		}
+	}()
+	return nil
+}
+
+func redirectToHTTPS(tlsAddr string) http.Handler {
+	_, tlsPort, _ := net.SplitHostPort(tlsAddr)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if tlsPort != "" && tlsPort != "443" {
+			host = net.JoinHostPort(host, tlsPort)
+		}
+		target := "https://" + host + r.URL.RequestURI()
+		http.Redirect(w, r, target, http.StatusMovedPermanently)
+	})
+}
@@ -0,0 +1,190 @@
+package weather
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Write a self-signed certificate for 127.0.0.1 and localhost, returning
+// the certificate and key files
+func selfSignedCert(t *testing.T) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generating key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("creating certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("encoding key: %v", err)
+	}
+	dir := t.TempDir()
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600)
+	return certFile, keyFile
+}
+
+func TestConfigureTLS(t *testing.T) {
+	certFile, keyFile := selfSignedCert(t)
+	tests := []struct {
+		name         string
+		env          map[string]string
+		wantTLS      bool
+		wantRedirect bool
+		wantErr      bool
+	}{
+		{"off", nil, false, false, false},
+		{"off ignores HTTP_PORT", map[string]string{"HTTP_PORT": "80"}, false, false, false},
+		{"certificate", map[string]string{"TLS_CERT_FILE": certFile, "TLS_KEY_FILE": keyFile}, true, false, false},
+		{"certificate and redirect", map[string]string{"TLS_CERT_FILE": certFile, "TLS_KEY_FILE": keyFile, "HTTP_PORT": "0"}, true, true, false},
+		{"bad HTTP_PORT", map[string]string{"TLS_CERT_FILE": certFile, "TLS_KEY_FILE": keyFile, "HTTP_PORT": "http"}, false, false, true},
+		{"cert without key", map[string]string{"TLS_CERT_FILE": certFile}, false, false, true},
+		{"key without cert", map[string]string{"TLS_KEY_FILE": keyFile}, false, false, true},
+		{"unloadable pair", map[string]string{"TLS_CERT_FILE": keyFile, "TLS_KEY_FILE": certFile}, false, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, name := range []string{"TLS_CERT_FILE", "TLS_KEY_FILE", "TLS_DOMAIN", "HTTP_PORT"} {
+				t.Setenv(name, tt.env[name])
+			}
+			server := &http.Server{Addr: "127.0.0.1:8443"}
+			redirect, err := configureTLS(server)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if (server.TLSConfig != nil) != tt.wantTLS {
+				t.Errorf("TLS configured = %v, want %v", server.TLSConfig != nil, tt.wantTLS)
+			}
+			if (redirect != nil) != tt.wantRedirect {
+				t.Errorf("redirect listener = %v, want %v", redirect != nil, tt.wantRedirect)
+			}
+		})
+	}
+}
+
+func TestRedirectListenerShutsDown(t *testing.T) {
+	certFile, keyFile := selfSignedCert(t)
+	t.Setenv("TLS_CERT_FILE", certFile)
+	t.Setenv("TLS_KEY_FILE", keyFile)
+	t.Setenv("TLS_DOMAIN", "")
+	t.Setenv("HTTP_PORT", "0")
+	redirect, err := configureTLS(&http.Server{Addr: "127.0.0.1:8443"})
+	if err != nil || redirect == nil {
+		t.Fatalf("configureTLS = %v, %v", redirect, err)
+	}
+	if err := startRedirect(redirect); err != nil {
+		t.Fatalf("startRedirect: %v", err)
+	}
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	_, port, _ := net.SplitHostPort(redirect.Addr)
+	url := "http://127.0.0.1:" + port + "/weather?city=London"
+	resp, err := client.Get(url)
+	if err != nil {
+		t.Fatalf("GET %s: %v", url, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMovedPermanently {
+		t.Errorf("status = %d, want 301", resp.StatusCode)
+	}
+	if want := "https://127.0.0.1:8443/weather?city=London"; resp.Header.Get("Location") != want {
+		t.Errorf("Location = %q, want %q", resp.Header.Get("Location"), want)
+	}
+
+	if err := redirect.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	if resp, err := client.Get(url); err == nil {
+		resp.Body.Close()
+		t.Error("redirect listener still serving after shutdown")
+	}
+}
+
+func TestTLSServesWeather(t *testing.T) {
+	certFile, keyFile := selfSignedCert(t)
+	t.Setenv("TLS_CERT_FILE", certFile)
+	t.Setenv("TLS_KEY_FILE", keyFile)
+	t.Setenv("TLS_DOMAIN", "")
+	t.Setenv("HTTP_PORT", "")
+
+	srv, err := NewServer(&countingProvider{}, DefaultConfig())
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	server := &http.Server{Addr: "127.0.0.1:0", Handler: srv.Handler()}
+	if _, err := configureTLS(server); err != nil {
+		t.Fatalf("configureTLS: %v", err)
+	}
+	ln, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go serve(server, ln)
+	defer server.Close()
+
+	pemCert, err := os.ReadFile(certFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(pemCert)
+	clientFor := func(maxVersion uint16) *http.Client {
+		return &http.Client{Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{RootCAs: roots, MaxVersion: maxVersion},
+		}}
+	}
+	url := "https://" + ln.Addr().String() + "/weather?city=London"
+
+	resp, err := clientFor(0).Get(url)
+	if err != nil {
+		t.Fatalf("GET %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+	var data CityWeatherData
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		t.Fatalf("decoding body: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || data.City != "London" {
+		t.Errorf("status %d, body %+v, want London", resp.StatusCode, data)
+	}
+	if resp.TLS == nil || resp.TLS.Version < tls.VersionTLS12 {
+		t.Errorf("connection state = %+v, want TLS 1.2 or later", resp.TLS)
+	}
+
+	// Anything older than TLS 1.2 is refused
+	if resp, err := clientFor(tls.VersionTLS11).Get(url); err == nil {
+		resp.Body.Close()
+		t.Error("TLS 1.1 client was served")
+	}
+}
@@ -0,0 +1,113 @@
+package weather
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	spansOnce sync.Once
+	spans     = tracetest.NewInMemoryExporter()
+)
+
+// Record this package's spans in memory, from none. The global provider
+// can only be swapped in once, since tracer is bound to the first one set.
+func recordSpans(t *testing.T) *tracetest.InMemoryExporter {
+	t.Helper()
+	spansOnce.Do(func() {
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(spans)))
+		otel.SetTextMapPropagator(propagation.TraceContext{})
+	})
+	spans.Reset()
+	t.Cleanup(spans.Reset)
+	return spans
+}
+
+func spanNamed(t *testing.T, stubs tracetest.SpanStubs, name string) tracetest.SpanStub {
+	t.Helper()
+	for _, s := range stubs {
+		if s.Name == name {
+			return s
+		}
+	}
+	t.Fatalf("no %q span among %d", name, len(stubs))
+	return tracetest.SpanStub{}
+}
+
+func spanAttr(s tracetest.SpanStub, key attribute.Key) attribute.Value {
+	for _, kv := range s.Attributes {
+		if kv.Key == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func TestRequestSpans(t *testing.T) {
+	exporter := recordSpans(t)
+	ts := modeServer(t, ModeLive)
+
+	const traceID, parentID = "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7"
+	get := func() {
+		req, _ := http.NewRequest(http.MethodGet, ts.URL+"/weather?city=London", nil)
+		req.Header.Set("traceparent", "00-"+traceID+"-"+parentID+"-01")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	get()
+	get()
+	ts.Close() // server spans end after the response is written
+
+	stubs := exporter.GetSpans()
+	server := spanNamed(t, stubs, "GET /weather")
+	lookup := spanNamed(t, stubs, "cache lookup")
+	upstream := spanNamed(t, stubs, "weatherstack request")
+
+	// One trace, continuing the caller's
+	if server.SpanKind != trace.SpanKindServer || server.SpanContext.TraceID().String() != traceID || server.Parent.SpanID().String() != parentID {
+		t.Errorf("server span %v in trace %s under %s, want a server span continuing the traceparent",
+			server.SpanKind, server.SpanContext.TraceID(), server.Parent.SpanID())
+	}
+	if got := spanAttr(server, "http.response.status_code").AsInt64(); got != http.StatusOK {
+		t.Errorf("server span status %d, want 200", got)
+	}
+	for _, child := range []tracetest.SpanStub{lookup, upstream} {
+		if child.Parent.SpanID() != server.SpanContext.SpanID() || child.SpanContext.TraceID() != server.SpanContext.TraceID() {
+			t.Errorf("%q span is not a child of the server span", child.Name)
+		}
+	}
+
+	// The second request is served from the cache
+	var hits []bool
+	for _, s := range stubs {
+		if s.Name == "cache lookup" {
+			hits = append(hits, spanAttr(s, "cache.hit").AsBool())
+		}
+	}
+	if len(hits) != 2 || hits[0] || !hits[1] || spanAttr(lookup, "cache.key").AsString() == "" {
+		t.Errorf("cache lookups hit %v with key %q, want a miss then a hit", hits, spanAttr(lookup, "cache.key").AsString())
+	}
+	if n := len(stubs); n != 5 {
+		t.Errorf("%d spans, want two requests and lookups and one upstream call", n)
+	}
+	if upstream.SpanKind != trace.SpanKindClient || spanAttr(upstream, "upstream.provider").AsString() != "weatherstack" ||
+		spanAttr(upstream, "http.response.status_code").AsInt64() != http.StatusOK {
+		t.Errorf("upstream span %v with %v, want a weatherstack client span with status 200", upstream.SpanKind, upstream.Attributes)
+	}
+	for _, kv := range upstream.Attributes {
+		if kv.Key == "url.full" {
+			t.Errorf("upstream span carries the URL, which holds the API key: %v", kv.Value.AsString())
+		}
+	}
+}
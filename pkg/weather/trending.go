@@ -0,0 +1,124 @@
+package weather
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	trendPointsPerCity = 24
+	trendWindow        = time.Hour
+)
+
+type trendPoint struct {
+	time  time.Time
+	temp  float64
+	delta float64
+}
+
+// Fixed-size ring of recent readings for one city
+type cityTrend struct {
+	city   string
+	points [trendPointsPerCity]trendPoint
+	next   int
+	count  int
+}
+
+func (t *cityTrend) last() (trendPoint, bool) {
+	if t.count == 0 {
+		return trendPoint{}, false
+	}
+	return t.points[(t.next+trendPointsPerCity-1)%trendPointsPerCity], true
+}
+
+func (t *cityTrend) push(p trendPoint) {
+	t.points[t.next] = p
+	t.next = (t.next + 1) % trendPointsPerCity
+	if t.count < trendPointsPerCity {
+		t.count++
+	}
+}
+
+type trendTracker struct {
+	mu     sync.Mutex
+	cities map[string]*cityTrend
+}
+
+func newTrendTracker() *trendTracker {
+	return &trendTracker{cities: make(map[string]*cityTrend)}
+}
+
+// Record a fresh upstream reading and its change from the previous one
+func (tr *trendTracker) record(data CityWeatherData) {
+	key := strings.ToLower(data.City)
+
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	t, ok := tr.cities[key]
+	if !ok {
+		t = &cityTrend{city: data.City}
+		tr.cities[key] = t
+	}
+	p := trendPoint{time: data.CacheTime, temp: data.Temp}
+	if prev, ok := t.last(); ok {
+		p.delta = data.Temp - prev.temp
+	}
+	t.push(p)
+}
+
+type trendingCity struct {
+	City         string  `json:"city"`
+	PreviousTemp float64 `json:"previous_temp"`
+	CurrentTemp  float64 `json:"current_temp"`
+	Delta        float64 `json:"delta"`
+}
+
+// Cities refreshed within the trend window, largest absolute change first
+func (tr *trendTracker) top(limit int) []trendingCity {
+	cutoff := time.Now().Add(-trendWindow)
+
+	tr.mu.Lock()
+	result := []trendingCity{}
+	for _, t := range tr.cities {
+		p, _ := t.last()
+		if t.count < 2 || p.time.Before(cutoff) {
+			continue
+		}
+		result = append(result, trendingCity{
+			City:         t.city,
+			PreviousTemp: p.temp - p.delta,
+			CurrentTemp:  p.temp,
+			Delta:        p.delta,
+		})
+	}
+	tr.mu.Unlock()
+
+	sort.Slice(result, func(i, j int) bool {
+		return math.Abs(result[i].Delta) > math.Abs(result[j].Delta)
+	})
+	if len(result) > limit {
+		result = result[:limit]
+	}
+	return result
+}
+
+func (s *Server) trendingHandler(w http.ResponseWriter, r *http.Request) {
+	limit := 5
+	if l := r.URL.Query().Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n <= 0 {
+			writeProblem(w, http.StatusBadRequest, "", "Limit must be a positive integer", r.URL.Path)
+			return
+		}
+		limit = n
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.trends.top(limit))
+}
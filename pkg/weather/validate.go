@@ -0,0 +1,69 @@
+package weather
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const maxCityLength = 100 // runes
+
+// Why a city name was rejected, with the characters that were not allowed
+type CityValidationError struct {
+	Reason  string   `json:"error"`
+	Invalid []string `json:"invalid_characters,omitempty"`
+}
+
+func (e *CityValidationError) Error() string {
+	if len(e.Invalid) > 0 {
+		return fmt.Sprintf("%s: %q", e.Reason, e.Invalid)
+	}
+	return e.Reason
+}
+
+// Letters (including accents and the vowel signs of scripts such as
+// Devanagari) plus the punctuation found in real place names such as
+// "St. John's" and "Washington, DC"
+func allowedCityRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.Is(unicode.Mn, r) || unicode.Is(unicode.Mc, r) ||
+		r == ' ' || r == '-' || r == '\'' || r == '’' || r == ',' || r == '.'
+}
+
+// ValidateCity trims a user-supplied city name and checks it is safe to
+// send upstream. It returns the cleaned name or a *CityValidationError.
+func ValidateCity(city string) (string, error) {
+	city = strings.TrimSpace(city)
+	if city == "" {
+		return "", &CityValidationError{Reason: "city must not be empty"}
+	}
+	if n := utf8.RuneCountInString(city); n > maxCityLength {
+		return "", &CityValidationError{Reason: fmt.Sprintf("city must be at most %d characters, got %d", maxCityLength, n)}
+	}
+
+	var invalid []string
+	seen := make(map[rune]bool)
+	for _, r := range city {
+		if !allowedCityRune(r) && !seen[r] {
+			seen[r] = true
+			invalid = append(invalid, string(r))
+		}
+	}
+	if len(invalid) > 0 {
+		return "", &CityValidationError{Reason: "city contains characters that are not allowed", Invalid: invalid}
+	}
+	return city, nil
+}
+
+// Reply 400 with the validation error as a problem, listing any
+// characters that were not allowed
+func writeValidationError(w http.ResponseWriter, r *http.Request, err error) {
+	p := problem{Status: http.StatusBadRequest, Detail: err.Error(), Instance: r.URL.Path}
+	var ve *CityValidationError
+	if errors.As(err, &ve) {
+		p.Detail, p.InvalidCharacters = ve.Reason, ve.Invalid
+	}
+	encodeProblem(w, p)
+}
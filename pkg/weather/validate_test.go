@@ -0,0 +1,84 @@
+package weather_test
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/deepakg86/weather-api-caching/pkg/weather"
+)
+
+func TestValidateCity(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+		invalid        []string // nil when the name is accepted
+	}{
+		{"plain", "London", "London", nil},
+		{"trimmed", "  Paris \t", "Paris", nil},
+		{"apostrophe and period", "St. John's", "St. John's", nil},
+		{"typographic apostrophe", "St. John’s", "St. John’s", nil},
+		{"comma", "Washington, DC", "Washington, DC", nil},
+		{"hyphen", "Stratford-upon-Avon", "Stratford-upon-Avon", nil},
+		{"accents", "São Paulo", "São Paulo", nil},
+		{"combining accent", "Zürich", "Zürich", nil},
+		{"German", "München", "München", nil},
+		{"Polish", "Łódź", "Łódź", nil},
+		{"Icelandic", "Reykjavík", "Reykjavík", nil},
+		{"Cyrillic", "Москва", "Москва", nil},
+		{"Greek", "Αθήνα", "Αθήνα", nil},
+		{"Japanese", "東京", "東京", nil},
+		{"Arabic", "القاهرة", "القاهرة", nil},
+		{"Hindi", "नई दिल्ली", "नई दिल्ली", nil},
+		{"Tamil", "சென்னை", "சென்னை", nil},
+		{"Thai", "เชียงใหม่", "เชียงใหม่", nil},
+		{"at the length limit", strings.Repeat("é", 100), strings.Repeat("é", 100), nil},
+
+		{"empty", "", "", []string{}},
+		{"blank", "   ", "", []string{}},
+		{"too long", strings.Repeat("a", 101), "", []string{}},
+		{"digits", "District 9", "", []string{"9"}},
+		{"markup", "<script>alert(1)</script>", "", []string{"<", ">", "(", "1", ")", "/"}},
+		{"SQL", "x'; DROP TABLE users;--", "", []string{";"}},
+		{"emoji", "Paris 🌧", "", []string{"🌧"}},
+		{"control character", "Lon\x00don\n", "", []string{"\x00"}},
+		{"query string", "London&units=f", "", []string{"&", "="}},
+		{"invalid UTF-8", "Lon\xffdon", "", []string{"�"}},
+		{"each character once", "a/b/c", "", []string{"/"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := weather.ValidateCity(tt.in)
+			if tt.invalid == nil {
+				if err != nil || got != tt.want {
+					t.Errorf("ValidateCity(%q) = %q, %v; want %q", tt.in, got, err, tt.want)
+				}
+				return
+			}
+			var ve *weather.CityValidationError
+			if !errors.As(err, &ve) {
+				t.Fatalf("ValidateCity(%q) = %q, %v; want a CityValidationError", tt.in, got, err)
+			}
+			if len(tt.invalid) > 0 && !reflect.DeepEqual(ve.Invalid, tt.invalid) {
+				t.Errorf("invalid characters = %q, want %q", ve.Invalid, tt.invalid)
+			}
+		})
+	}
+}
+
+func TestWeatherHandlerListsInvalidCharacters(t *testing.T) {
+	ts := newTestServer(t, londonProvider(), nil)
+	var p struct {
+		Detail            string   `json:"detail"`
+		InvalidCharacters []string `json:"invalid_characters"`
+	}
+	resp := getJSON(t, ts, "/weather?city="+url.QueryEscape("Lon<d>on"), &p)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400", resp.StatusCode)
+	}
+	if !reflect.DeepEqual(p.InvalidCharacters, []string{"<", ">"}) {
+		t.Errorf("invalid_characters = %q, want < and >", p.InvalidCharacters)
+	}
+}
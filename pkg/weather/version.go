@@ -0,0 +1,24 @@
+package weather
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/deepakg86/weather-api-caching/pkg/buildinfo"
+)
+
+// Which build is running, and against what
+type versionInfo struct {
+	buildinfo.Info
+	Mode     string `json:"mode"`
+	Provider string `json:"provider"`
+}
+
+func (s *Server) version() versionInfo {
+	return versionInfo{Info: buildinfo.Get(), Mode: s.config.Mode, Provider: s.config.Provider}
+}
+
+func (s *Server) versionHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.version())
+}
@@ -0,0 +1,28 @@
+package weather
+
+import (
+	"net/http"
+	"runtime"
+	"testing"
+)
+
+func TestVersionEndpoint(t *testing.T) {
+	ts := modeServer(t, ModeSimulated)
+	var body map[string]string
+	resp := getBody(t, ts, "/version", &body)
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "application/json" {
+		t.Fatalf("status %d, Content-Type %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	want := map[string]string{
+		"version": "dev", "commit": "dev", "build_date": "dev", "go_version": runtime.Version(),
+		"mode": ModeSimulated, "provider": providerName(ModeSimulated),
+	}
+	if len(body) != len(want) {
+		t.Errorf("body %v, want exactly %v", body, want)
+	}
+	for k, v := range want {
+		if body[k] != v {
+			t.Errorf("%s = %q, want %q", k, body[k], v)
+		}
+	}
+}
@@ -0,0 +1,319 @@
+package weather
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	_ "time/tzdata" // zone names resolve even where the host has no zoneinfo
+)
+
+type CityWeatherData struct {
+	City     string  `json:"city"`
+	Temp     float64 `json:"temp"`
+	Desc     string  `json:"desc"`
+	Activity string  `json:"activity"`
+
+	Condition    string `json:"condition"`               // one of the Condition constants
+	ProviderCode int    `json:"provider_code,omitempty"` // the provider's own condition code
+	IconURL      string `json:"icon_url,omitempty"`
+
+	PrecipProb float64 `json:"precip_prob"` // 0-1
+	PrecipMM   float64 `json:"precip_mm"`
+	PrecipType string  `json:"precip_type"` // "", "rain", "snow" or "sleet"
+
+	// Omitted when the provider does not report them
+	Humidity  *float64 `json:"humidity,omitempty"`   // percent
+	WindSpeed *float64 `json:"wind_speed,omitempty"` // km/h
+	WindDir   string   `json:"wind_dir,omitempty"`   // 16-point compass, e.g. "WSW"
+	Pressure  *float64 `json:"pressure,omitempty"`   // hPa
+	FeelsLike *float64 `json:"feels_like,omitempty"` // degrees Celsius
+
+	Location  *Location `json:"location,omitempty"`
+	Timezone  string    `json:"timezone,omitempty"`           // IANA name, e.g. "Europe/London"
+	UTCOffset *int      `json:"utc_offset_seconds,omitempty"` // when the provider gives an offset rather than a zone name
+	LocalTime string    `json:"local_time,omitempty"`         // RFC 3339, in the city's zone; set when serialized
+
+	Greeting        string     `json:"greeting"`
+	Source          string     `json:"source,omitempty"`           // provider that served the reading
+	ObservationTime *time.Time `json:"observation_time,omitempty"` // when the provider measured it, UTC
+	CacheTime       time.Time  `json:"cache_time"`
+}
+
+// Where the provider resolved the requested city, so clients can tell
+// which of several same-named places they got
+type Location struct {
+	Name       string  `json:"name"`
+	Country    string  `json:"country,omitempty"`
+	Region     string  `json:"region,omitempty"`
+	Lat        float64 `json:"lat"`
+	Lon        float64 `json:"lon"`
+	TimezoneID string  `json:"timezone_id,omitempty"`
+	Localtime  string  `json:"localtime,omitempty"` // "2006-01-02 15:04" in the city's zone
+}
+
+// t in the named IANA zone as RFC 3339, or "" when the zone is unknown
+func localTimeIn(zone string, t time.Time) string {
+	if zone == "" {
+		return ""
+	}
+	loc, err := time.LoadLocation(zone)
+	if err != nil {
+		return ""
+	}
+	return t.In(loc).Format(time.RFC3339)
+}
+
+// t in the city's zone as RFC 3339, from the zone name or else the UTC
+// offset; "" when the provider gave neither
+func (d CityWeatherData) localTimeAt(t time.Time) string {
+	if local := localTimeIn(d.Timezone, t); local != "" {
+		return local
+	}
+	if d.UTCOffset != nil {
+		return t.In(time.FixedZone("", *d.UTCOffset)).Format(time.RFC3339)
+	}
+	return ""
+}
+
+// Fetch fresh data from the provider, recording how long it took
+func (s *Server) getCityWeatherData(ctx context.Context, city string) (CityWeatherData, error) {
+	start := time.Now()
+	weatherData, err := callWithTimeout(ctx, s.provider, city)
+	elapsed := time.Since(start)
+	s.upstreamLatency.record(elapsed)
+	if info := requestInfoFrom(ctx); info != nil {
+		info.upstream.Add(int64(elapsed))
+	}
+	if err != nil {
+		loggerFrom(ctx).Warn("Upstream fetch failed", "city", city, "upstream_ms", milliseconds(elapsed), "err", err)
+		return CityWeatherData{}, err
+	}
+	weatherData.Greeting = s.greet(weatherData)
+	s.readings.record(weatherData)
+	return weatherData, nil
+}
+
+// Serve key in lang from the cache, fetching it when missing or expired.
+// Every reader of a city goes through here, so concurrent misses share
+// one fetch and a recent failure is answered from the error cache.
+func (s *Server) cachedWeather(ctx context.Context, key, lang string) (CityWeatherData, error) {
+	fetch := func(ctx context.Context, _ string) (CityWeatherData, error) {
+		return s.getCityWeatherData(withLanguage(ctx, lang), key)
+	}
+	return s.cache.GetOrFetch(ctx, languageCacheKey(key, lang), fetch)
+}
+
+// Wait for one of the MaxConcurrentRequests slots, for lookups made
+// outside /weather; false if ctx ends first. Release with releaseSlot.
+func (s *Server) acquireSlot(ctx context.Context) bool {
+	select {
+	case s.inFlight <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (s *Server) releaseSlot() { <-s.inFlight }
+
+// How long a client should wait when upstream is deliberately not being
+// called: the circuit is open, the city failed recently, the monthly
+// quota is spent, or every API key is benched
+func (s *Server) retryAfter(err error) (time.Duration, bool) {
+	var ce *cachedError
+	switch {
+	case errors.Is(err, errCircuitOpen):
+		return s.breaker.retryAfter(), true
+	case errors.As(err, &ce):
+		return ce.retryAfter, true
+	case errors.Is(err, errQuotaExhausted):
+		return s.quota.resetIn(), true
+	case errors.Is(err, errAllKeysExhausted) && s.upstream.keys != nil:
+		return s.upstream.keys.retryAfter(), true
+	}
+	return 0, false
+}
+
+func (s *Server) weatherHandler(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+
+	// Get the 'city' query parameter
+	city := r.URL.Query().Get("city")
+	if city == "" {
+		writeProblem(w, http.StatusBadRequest, "", "City parameter is required", r.URL.Path)
+		return
+	}
+	city, err := ValidateCity(city)
+	if err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+	city = s.aliases.resolve(city)
+
+	if !s.allowed.allows(city) {
+		writeProblem(w, http.StatusForbidden, "", fmt.Sprintf("City not allowed: %s", city), r.URL.Path)
+		return
+	}
+
+	lang, err := parseLanguage(r.URL.Query().Get("lang"))
+	if err != nil {
+		writeProblem(w, http.StatusBadRequest, "", fmt.Sprintf("Invalid lang parameter: %v", err), r.URL.Path)
+		return
+	}
+
+	// A dry run fetches from upstream as usual but leaves the cache, the
+	// geocoding cache, the request counts and the request history alone,
+	// e.g. to check a new API key. It is for admins only, since every call
+	// costs quota.
+	dryRun := false
+	if v := r.URL.Query().Get("dry_run"); v != "" {
+		if dryRun, err = strconv.ParseBool(v); err != nil {
+			writeProblem(w, http.StatusBadRequest, "", fmt.Sprintf("Invalid dry_run parameter %q: must be true or false", v), r.URL.Path)
+			return
+		}
+		if dryRun && !s.isAdmin(r) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeProblem(w, http.StatusUnauthorized, "", "dry_run requires the admin token", r.URL.Path)
+			return
+		}
+	}
+
+	// Optional projection, e.g. fields=city,temp,desc
+	var fields []string
+	if f := r.URL.Query().Get("fields"); f != "" {
+		var err error
+		if fields, err = parseFields(f, isV1(r.Context())); err != nil {
+			writeProblem(w, http.StatusBadRequest, "", fmt.Sprintf("Invalid fields parameter: %v", err), r.URL.Path)
+			return
+		}
+	}
+
+	// Refuse rather than queue once every slot is taken, so a slow upstream
+	// cannot pile up goroutines without bound
+	select {
+	case s.inFlight <- struct{}{}:
+		defer func() { <-s.inFlight }()
+	default:
+		if now := time.Now().Unix(); s.lastFullWarn.Swap(now) != now {
+			slog.Warn("All request slots in use, rejecting with 503", "slots", cap(s.inFlight))
+		}
+		w.Header().Set("Retry-After", "1")
+		writeProblem(w, http.StatusServiceUnavailable, "", "Server busy, try again shortly", r.URL.Path)
+		return
+	}
+
+	// Serve from cache, fetching new weather data if missing or expired;
+	// each language is cached separately
+	key := s.resolveCity(city)
+	var data CityWeatherData
+	if dryRun {
+		data, err = callWithTimeout(withLanguage(r.Context(), lang), s.provider, key)
+		data.Greeting = s.greet(data)
+	} else {
+		s.requests.record(key)
+		data, err = s.cachedWeather(r.Context(), key, lang)
+	}
+	if errors.Is(err, ErrCityNotFound) {
+		msg := fmt.Sprintf("City not found: %s", city)
+		if suggestions := s.cities.suggest(city, 3); len(suggestions) > 0 {
+			msg += fmt.Sprintf(". Did you mean: %s?", strings.Join(suggestions, ", "))
+		}
+		writeProblem(w, http.StatusNotFound, "", msg, r.URL.Path)
+		return
+	}
+	// With the upstream down, a demo gets made-up weather marked with
+	// source "simulated" rather than an error. It is not cached, so real
+	// data takes over as soon as the error cache lets a fetch through.
+	simulated := false
+	if err != nil && !dryRun && s.fallback != nil && canFallBack(err) {
+		loggerFrom(r.Context()).Warn("Serving simulated weather", "city", city, "err", err)
+		data, err = s.fallback.Current(withLanguage(r.Context(), lang), city)
+		data.Greeting = s.greet(data)
+		simulated = true
+	}
+	if retryAfter, ok := s.retryAfter(err); ok {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		writeProblem(w, http.StatusServiceUnavailable, "", fmt.Sprintf("Failed to fetch weather data: %v", err), r.URL.Path)
+		return
+	}
+	if err != nil {
+		writeProblem(w, upstreamErrorStatus(err), "", fmt.Sprintf("Failed to fetch weather data: %v", err), r.URL.Path)
+		return
+	}
+
+	if !simulated && !dryRun {
+		s.learnLocation(city, key, lang, data)
+	}
+
+	// Return the data in JSON format
+	var body interface{} = data
+	if fields != nil {
+		if body, err = project(data, fields); err != nil {
+			writeProblem(w, http.StatusInternalServerError, "", fmt.Sprintf("Error encoding response: %v", err), r.URL.Path)
+			return
+		}
+	}
+	// Encoded up front, so its time makes the Server-Timing header
+	encodeStart := time.Now()
+	var buf bytes.Buffer
+	err = json.NewEncoder(&buf).Encode(body)
+	if info := requestInfoFrom(r.Context()); info != nil {
+		info.encode.Add(int64(time.Since(encodeStart)))
+	}
+	if err != nil {
+		loggerFrom(r.Context()).Error("Error encoding response", "err", err)
+		writeProblem(w, http.StatusInternalServerError, "", fmt.Sprintf("Error encoding response: %v", err), r.URL.Path)
+		return
+	}
+	out := buf.Bytes()
+	if dryRun {
+		// The same object with one more field, keeping the field order
+		out = append(bytes.TrimSuffix(out, []byte("}\n")), []byte(`,"dry_run":true}`+"\n")...)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	s.setCacheHeaders(w, data, simulated || dryRun)
+	w.Write(out)
+
+	if dryRun {
+		return
+	}
+	source := "api"
+	if info := requestInfoFrom(r.Context()); info != nil && info.cacheResult() == "hit" {
+		source = "cache"
+	}
+	if simulated {
+		source = "simulated"
+	}
+	s.history.record(r, data, source, start)
+}
+
+// How long past expiry a proxy may serve a response whose entry is being
+// refreshed ahead, while it revalidates
+const staleWhileRevalidate = 30 * time.Second
+
+// Let proxies and CDNs keep a reading for as long as the cache would.
+// Readings this server does not cache, simulated fallback weather and dry
+// runs, are not to be cached there either.
+func (s *Server) setCacheHeaders(w http.ResponseWriter, data CityWeatherData, uncached bool) {
+	w.Header().Set("Vary", "Accept-Encoding, Accept")
+	if uncached {
+		w.Header().Set("Cache-Control", "no-store")
+		return
+	}
+	expires := data.CacheTime.Add(s.cache.ttl())
+	maxAge := max(0, int(time.Until(expires).Round(time.Second).Seconds()))
+	cacheControl := fmt.Sprintf("public, max-age=%d", maxAge)
+	if s.cache.dueForRefresh(data) {
+		cacheControl += fmt.Sprintf(", stale-while-revalidate=%d", int(staleWhileRevalidate.Seconds()))
+	}
+	w.Header().Set("Cache-Control", cacheControl)
+	w.Header().Set("Expires", expires.UTC().Format(http.TimeFormat))
+}
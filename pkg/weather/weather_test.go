@@ -0,0 +1,285 @@
+package weather_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/deepakg86/weather-api-caching/pkg/weather"
+	"github.com/deepakg86/weather-api-caching/pkg/weather/testutil"
+)
+
+// A server over provider with one upstream attempt per fetch, so failures
+// come back without retry delays; configure adjusts anything else
+func newTestServer(t *testing.T, provider weather.WeatherProvider, configure func(*weather.Config)) *httptest.Server {
+	t.Helper()
+	config := weather.DefaultConfig()
+	config.RetryAttempts = 1
+	if configure != nil {
+		configure(&config)
+	}
+	srv, err := weather.NewServer(provider, config)
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	t.Cleanup(func() { srv.Close() })
+	ts := httptest.NewServer(srv.Handler())
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+// GET path and decode the JSON body into out, when given
+func getJSON(t *testing.T, ts *httptest.Server, path string, out interface{}) *http.Response {
+	t.Helper()
+	resp, err := http.Get(ts.URL + path)
+	if err != nil {
+		t.Fatalf("GET %s: %v", path, err)
+	}
+	defer resp.Body.Close()
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatalf("GET %s: decoding body: %v", path, err)
+		}
+	}
+	return resp
+}
+
+type problemBody struct {
+	Status int    `json:"status"`
+	Detail string `json:"detail"`
+}
+
+func londonProvider() *testutil.MockWeatherProvider {
+	return testutil.NewMockWeatherProvider(map[string]weather.CityWeatherData{
+		"London": {City: "London", Temp: 11.5, Desc: "Partly cloudy", Condition: weather.ConditionClouds, Source: "mock"},
+	}, nil)
+}
+
+func TestWeatherHandlerServesFromCacheAfterFirstFetch(t *testing.T) {
+	mock := londonProvider()
+	ts := newTestServer(t, mock, nil)
+
+	for i := 1; i <= 3; i++ {
+		var data weather.CityWeatherData
+		resp := getJSON(t, ts, "/weather?city=London", &data)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("request %d: status = %d, want 200", i, resp.StatusCode)
+		}
+		if data.City != "London" || data.Temp != 11.5 || data.Desc != "Partly cloudy" {
+			t.Errorf("request %d: got %+v", i, data)
+		}
+		if got := resp.Header.Get("Content-Type"); got != "application/json" {
+			t.Errorf("request %d: Content-Type = %q", i, got)
+		}
+	}
+	if calls := mock.Calls("London"); calls != 1 {
+		t.Errorf("provider called %d times, want 1 (later requests served from cache)", calls)
+	}
+}
+
+func TestWeatherHandlerRejectsBadInput(t *testing.T) {
+	mock := londonProvider()
+	ts := newTestServer(t, mock, nil)
+
+	tests := []struct {
+		name, query string
+	}{
+		{"missing city", ""},
+		{"blank city", "?city=%20%20"},
+		{"invalid characters", "?city=London%3Cscript%3E"},
+		{"unsupported language", "?city=London&lang=xx"},
+		{"unknown field", "?city=London&fields=city,nope"},
+		{"bad dry_run", "?city=London&dry_run=maybe"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var p problemBody
+			resp := getJSON(t, ts, "/weather"+tt.query, &p)
+			if resp.StatusCode != http.StatusBadRequest || p.Status != http.StatusBadRequest {
+				t.Errorf("status = %d (body %d), want 400", resp.StatusCode, p.Status)
+			}
+			if got := resp.Header.Get("Content-Type"); got != "application/problem+json" {
+				t.Errorf("Content-Type = %q, want application/problem+json", got)
+			}
+		})
+	}
+	if calls := mock.Calls("London"); calls != 0 {
+		t.Errorf("provider called %d times for rejected requests", calls)
+	}
+}
+
+func TestWeatherHandlerSuggestsCitiesWhenNotFound(t *testing.T) {
+	ts := newTestServer(t, londonProvider(), nil)
+
+	var p problemBody
+	resp := getJSON(t, ts, "/weather?city=Londn", &p)
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("status = %d, want 404", resp.StatusCode)
+	}
+	if !strings.Contains(p.Detail, "Did you mean") || !strings.Contains(p.Detail, "London") {
+		t.Errorf("detail = %q, want a suggestion of London", p.Detail)
+	}
+}
+
+func TestWeatherHandlerMapsUpstreamErrors(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{fmt.Errorf("%w: after 10s", weather.ErrUpstreamTimeout), http.StatusGatewayTimeout},
+		{&weather.StatusError{Code: 500, Status: "500 Internal Server Error"}, http.StatusBadGateway},
+		{fmt.Errorf("%w: 104", weather.ErrQuotaExceeded), http.StatusServiceUnavailable},
+		{fmt.Errorf("%w: set WEATHERSTACK_API_KEY", weather.ErrMissingAPIKey), http.StatusInternalServerError},
+		{errors.New("something else"), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.err.Error(), func(t *testing.T) {
+			mock := testutil.NewMockWeatherProvider(nil, map[string]error{"Paris": tt.err})
+			ts := newTestServer(t, mock, nil)
+
+			var p problemBody
+			resp := getJSON(t, ts, "/weather?city=Paris", &p)
+			if resp.StatusCode != tt.want {
+				t.Errorf("status = %d, want %d (detail %q)", resp.StatusCode, tt.want, p.Detail)
+			}
+		})
+	}
+}
+
+func TestWeatherHandlerProjectsFields(t *testing.T) {
+	ts := newTestServer(t, londonProvider(), nil)
+
+	var body map[string]interface{}
+	resp := getJSON(t, ts, "/weather?city=London&fields=city,temp", &body)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want 200", resp.StatusCode)
+	}
+	if len(body) != 2 || body["city"] != "London" || body["temp"] != 11.5 {
+		t.Errorf("body = %v, want only city and temp", body)
+	}
+}
+
+func TestWeatherDryRunLeavesStateAlone(t *testing.T) {
+	mock := testutil.NewMockWeatherProvider(map[string]weather.CityWeatherData{
+		"London": {City: "London", Temp: 11.5, Desc: "Partly cloudy"},
+		"Paris":  {City: "Paris", Temp: 18, Desc: "Sunny"},
+	}, nil)
+	ts := newTestServer(t, mock, func(config *weather.Config) {
+		withAdmin(config)
+		config.DBPath = filepath.Join(t.TempDir(), "history.db")
+	})
+
+	var body map[string]interface{}
+	if resp := adminJSON(t, ts, http.MethodGet, "/weather?city=London&dry_run=true", nil, &body); resp.StatusCode != http.StatusOK {
+		t.Fatalf("dry run: status %d", resp.StatusCode)
+	}
+	if body["dry_run"] != true || body["city"] != "London" {
+		t.Errorf("dry run body = %v", body)
+	}
+
+	var stats struct {
+		Size   int    `json:"size"`
+		Misses uint64 `json:"misses"`
+	}
+	getJSON(t, ts, "/cache/stats", &stats)
+	if stats.Size != 0 || stats.Misses != 0 {
+		t.Errorf("cache stats after a dry run = %+v, want untouched", stats)
+	}
+	var popular []map[string]interface{}
+	getJSON(t, ts, "/stats/cities", &popular)
+	if len(popular) != 0 {
+		t.Errorf("request counts after a dry run = %v, want none", popular)
+	}
+
+	// History is written in the background, in order: once a later
+	// request shows up, the dry run would have too
+	getJSON(t, ts, "/weather?city=Paris", nil)
+	var history []struct {
+		City string `json:"city"`
+	}
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		getJSON(t, ts, "/history", &history)
+		if len(history) > 0 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(history) != 1 || history[0].City != "Paris" {
+		t.Errorf("history = %+v, want only the Paris request", history)
+	}
+	if calls := mock.Calls("London"); calls != 1 {
+		t.Errorf("London fetched %d times, want 1", calls)
+	}
+}
+
+func TestObservationFieldsOnlyUnderV1(t *testing.T) {
+	observed := time.Now().Add(-90 * time.Second).UTC()
+	mock := testutil.NewMockWeatherProvider(map[string]weather.CityWeatherData{
+		"London": {City: "London", Temp: 11.5, Desc: "Partly cloudy", ObservationTime: &observed},
+		"Paris":  {City: "Paris", Temp: 18, Desc: "Sunny"},
+	}, nil)
+	ts := newTestServer(t, mock, nil)
+
+	tests := []struct {
+		path      string
+		wantAge   bool
+		wantStamp bool
+	}{
+		{"/weather?city=London", false, false},
+		{"/v1/weather?city=London", true, true},
+		{"/weather?city=Paris", false, false},
+		{"/v1/weather?city=Paris", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			var body map[string]interface{}
+			if resp := getJSON(t, ts, tt.path, &body); resp.StatusCode != http.StatusOK {
+				t.Fatalf("status = %d", resp.StatusCode)
+			}
+			if _, ok := body["observation_time"]; ok != tt.wantStamp {
+				t.Errorf("observation_time present = %v, want %v", ok, tt.wantStamp)
+			}
+			age, ok := body["observation_age_seconds"].(float64)
+			if ok != tt.wantAge {
+				t.Errorf("observation_age_seconds present = %v, want %v", ok, tt.wantAge)
+			}
+			if ok && (age < 90 || age > 100) {
+				t.Errorf("observation_age_seconds = %v, want about 90", age)
+			}
+			if body["city"] == nil || body["cache_time"] == nil {
+				t.Errorf("body = %v, want the rest of the reading", body)
+			}
+		})
+	}
+
+	// Lists are rewritten too, and fields= knows which schema it is in
+	var dump struct {
+		Entries []struct {
+			Data map[string]interface{} `json:"data"`
+		} `json:"entries"`
+	}
+	getJSON(t, ts, "/cache/dump", &dump)
+	if len(dump.Entries) != 2 {
+		t.Fatalf("dump has %d entries, want 2", len(dump.Entries))
+	}
+	for _, e := range dump.Entries {
+		if _, ok := e.Data["observation_time"]; ok {
+			t.Errorf("unversioned dump entry has observation_time: %v", e.Data)
+		}
+	}
+	var p problemBody
+	if resp := getJSON(t, ts, "/weather?city=London&fields=city,observation_time", &p); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("unversioned fields=observation_time: status %d, want 400", resp.StatusCode)
+	}
+	var projected map[string]interface{}
+	getJSON(t, ts, "/v1/weather?city=London&fields=city,observation_time", &projected)
+	if len(projected) != 2 || projected["observation_time"] == nil {
+		t.Errorf("/v1 projection = %v, want city and observation_time", projected)
+	}
+}
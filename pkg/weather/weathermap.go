@@ -0,0 +1,52 @@
+package weather
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+type geoJSONPoint struct {
+	Type        string     `json:"type"` // always "Point"
+	Coordinates [2]float64 `json:"coordinates"`
+}
+
+type geoJSONFeature struct {
+	Type       string          `json:"type"` // always "Feature"
+	ID         string          `json:"id"`   // cache key
+	Geometry   geoJSONPoint    `json:"geometry"`
+	Properties CityWeatherData `json:"properties"`
+}
+
+type geoJSONFeatureCollection struct {
+	Type     string           `json:"type"` // always "FeatureCollection"
+	Features []geoJSONFeature `json:"features"`
+}
+
+// A point for every unexpired cached reading whose provider reported
+// coordinates, sorted by key. Other languages' copies of a reading are
+// left out, so each place appears once.
+func (c *Cache) features() []geoJSONFeature {
+	result := []geoJSONFeature{}
+	for _, e := range c.entries.Entries() {
+		if !e.Fresh() || e.Value.Location == nil || strings.Contains(e.Key, "|") {
+			continue
+		}
+		result = append(result, geoJSONFeature{
+			Type: "Feature",
+			ID:   e.Key,
+			// GeoJSON puts longitude first
+			Geometry:   geoJSONPoint{Type: "Point", Coordinates: [2]float64{e.Value.Location.Lon, e.Value.Location.Lat}},
+			Properties: e.Value,
+		})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result
+}
+
+// Cached weather as a GeoJSON FeatureCollection, for GIS tools and maps
+func (s *Server) weatherMapHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/geo+json")
+	json.NewEncoder(w).Encode(geoJSONFeatureCollection{Type: "FeatureCollection", Features: s.cache.features()})
+}
@@ -0,0 +1,288 @@
+package weather
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Failures Weatherstack reports inside an HTTP 200 body, besides those
+// in errors.go
+var (
+	errInvalidAPIKey = errors.New("invalid API key")
+	errMissingQuery  = errors.New("missing query")
+)
+
+// Weatherstack error codes with a typed error of their own; 615 (request
+// failed) maps to ErrCityNotFound
+var weatherstackErrors = map[int]error{
+	101: errInvalidAPIKey,
+	104: ErrQuotaExceeded,
+	601: errMissingQuery,
+}
+
+const weatherstackDefaultURL = "https://api.weatherstack.com"
+
+// Live weather from the Weatherstack API
+type WeatherstackProvider struct {
+	BaseURL string // scheme and host, e.g. https://api.weatherstack.com
+	keys    *keyPool
+	client  *http.Client
+	timeout time.Duration
+}
+
+// Provider for the given base URL, or the public HTTPS endpoint when
+// empty, calling it through client
+func NewWeatherstackProvider(baseURL string, keys *keyPool, client *http.Client) (WeatherstackProvider, error) {
+	if baseURL == "" {
+		baseURL = weatherstackDefaultURL
+	}
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return WeatherstackProvider{}, fmt.Errorf("invalid Weatherstack base URL %q: %v", baseURL, err)
+	}
+	if (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return WeatherstackProvider{}, fmt.Errorf("invalid Weatherstack base URL %q: want http(s)://host", baseURL)
+	}
+	return WeatherstackProvider{BaseURL: strings.TrimSuffix(baseURL, "/"), keys: keys, client: client}, nil
+}
+
+func (p WeatherstackProvider) Timeout() time.Duration { return p.timeout }
+
+// Fetch with the next key in the rotation, moving on to another whenever
+// one turns out to be over quota, invalid or rate limited
+func (p WeatherstackProvider) Current(ctx context.Context, city string) (CityWeatherData, error) {
+	for {
+		idx, apiKey, err := p.keys.current()
+		if err != nil {
+			return CityWeatherData{}, err
+		}
+		data, err := fetchWeatherFromAPI(ctx, p.client, p.BaseURL, apiKey, city)
+		if errors.Is(err, ErrQuotaExceeded) || errors.Is(err, errInvalidAPIKey) || isRateLimited(err) {
+			p.keys.markDead(idx, apiKey, err)
+			continue
+		}
+		return data, err
+	}
+}
+
+// Fetch data from WeatherstackAPI
+func fetchWeatherFromAPI(ctx context.Context, client *http.Client, baseURL, apiKey, city string) (CityWeatherData, error) {
+	// Create the URL for the API request; encoding the query keeps spaces,
+	// unicode and stray '&' or '=' in the city from breaking or extending it
+	query := url.Values{"access_key": {apiKey}, "query": {city}}
+	if lang := languageFrom(ctx); lang != defaultLanguage {
+		query.Set("language", lang)
+	}
+	requestURL := baseURL + "/current?" + query.Encode()
+	/*
+	   Request URL: https://api.weatherstack.com/current?access_key=your_api_key_here&query=London
+	   Raw Response:
+	   {
+	       "location": {
+	           "name": "London",
+	           "country": "United Kingdom",
+	           "region": "England",
+	           "lat": "51.517",
+	           "lon": "-0.106",
+	           "timezone_id": "Europe/London",
+	           "localtime": "2025-03-07 16:00",
+	           "localtime_epoch": 1678209600
+	       },
+	       "current": {
+	           "temperature": 15,
+	           "weather_descriptions": [
+	               "Partly cloudy"
+	           ],
+	           "wind_speed": 14,
+	           "humidity": 82
+	       }
+	   }
+	*/
+	// Make the HTTP request to Weatherstack API
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, requestURL, nil)
+	if err != nil {
+		return CityWeatherData{}, err
+	}
+	resp, err := tracedDo(client, "weatherstack", req)
+	if err != nil {
+		// The URL carries the access key; keep it out of errors and logs
+		var ue *url.Error
+		if errors.As(err, &ue) {
+			ue.URL = baseURL + "/current"
+		}
+		return CityWeatherData{}, classifyTransportError(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return CityWeatherData{}, &StatusError{Code: resp.StatusCode, Status: resp.Status}
+	}
+	// Read and parse the JSON response
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return CityWeatherData{}, classifyTransportError(err)
+	}
+	var apiResponse struct {
+		Success *bool `json:"success"`
+		Error   struct {
+			Code int    `json:"code"`
+			Info string `json:"info"`
+		} `json:"error"`
+		Location *struct {
+			Name       string    `json:"name"`
+			Country    string    `json:"country"`
+			Region     string    `json:"region"`
+			Lat        flexFloat `json:"lat"`
+			Lon        flexFloat `json:"lon"`
+			TimezoneID string    `json:"timezone_id"`
+			Localtime  string    `json:"localtime"`
+			// Epoch of localtime, i.e. when the reading was taken
+			LocaltimeEpoch int64 `json:"localtime_epoch"`
+		} `json:"location"`
+		Current struct {
+			Temperature          float64  `json:"temperature"`
+			Weather_descriptions []string `json:"weather_descriptions"`
+			Humidity             *float64 `json:"humidity"`
+			Precip               float64  `json:"precip"`
+			WeatherCode          int      `json:"weather_code"`
+			WeatherIcons         []string `json:"weather_icons"`
+			WindSpeed            *float64 `json:"wind_speed"`
+			WindDir              string   `json:"wind_dir"`
+			Pressure             *float64 `json:"pressure"`
+			FeelsLike            *float64 `json:"feelslike"`
+		} `json:"current"`
+	}
+
+	if err := json.Unmarshal(body, &apiResponse); err != nil {
+		return CityWeatherData{}, fmt.Errorf("%w: %v", ErrUpstreamBadResponse, err)
+	}
+
+	// Weatherstack reports failures with HTTP 200 and "success": false
+	// Returning an error here keeps the reading out of the cache
+	if apiResponse.Success != nil && !*apiResponse.Success {
+		if apiResponse.Error.Code == 615 {
+			return CityWeatherData{}, fmt.Errorf("%w: %s", ErrCityNotFound, city)
+		}
+		if err, ok := weatherstackErrors[apiResponse.Error.Code]; ok {
+			return CityWeatherData{}, fmt.Errorf("%w: %s", err, apiResponse.Error.Info)
+		}
+		return CityWeatherData{}, fmt.Errorf("API error %d: %s", apiResponse.Error.Code, apiResponse.Error.Info)
+	}
+
+	// Extract temperature and description from the API response
+	temperature := apiResponse.Current.Temperature
+	desc := ""
+	if len(apiResponse.Current.Weather_descriptions) > 0 {
+		desc = apiResponse.Current.Weather_descriptions[0]
+	} else {
+		desc = "No description available"
+	}
+	humidity, hasHumidity := 0.0, apiResponse.Current.Humidity != nil
+	if hasHumidity {
+		humidity = *apiResponse.Current.Humidity
+	}
+	precipType := weatherstackPrecipType(apiResponse.Current.WeatherCode)
+
+	// Display the name Weatherstack resolved rather than the raw query
+	var location *Location
+	if l := apiResponse.Location; l != nil && l.Name != "" {
+		city = l.Name
+		location = &Location{
+			Name:       l.Name,
+			Country:    l.Country,
+			Region:     l.Region,
+			Lat:        float64(l.Lat),
+			Lon:        float64(l.Lon),
+			TimezoneID: l.TimezoneID,
+			Localtime:  l.Localtime,
+		}
+	}
+	icon := ""
+	if len(apiResponse.Current.WeatherIcons) > 0 {
+		icon = apiResponse.Current.WeatherIcons[0]
+	}
+	var observed *time.Time
+	if l := apiResponse.Location; l != nil && l.LocaltimeEpoch > 0 {
+		t := time.Unix(l.LocaltimeEpoch, 0).UTC()
+		observed = &t
+	}
+	timezone := ""
+	if l := apiResponse.Location; l != nil {
+		timezone = l.TimezoneID
+	}
+	return CityWeatherData{
+		City:            city,
+		Temp:            temperature,
+		Desc:            desc,
+		Activity:        recommendActivity(temperature, humidity, hasHumidity, activityDesc(desc, precipType, languageFrom(ctx))),
+		Condition:       weatherstackCondition(apiResponse.Current.WeatherCode),
+		ProviderCode:    apiResponse.Current.WeatherCode,
+		IconURL:         icon,
+		PrecipProb:      currentPrecipProb(precipType, apiResponse.Current.Precip),
+		PrecipMM:        apiResponse.Current.Precip,
+		PrecipType:      precipType,
+		Humidity:        apiResponse.Current.Humidity,
+		WindSpeed:       apiResponse.Current.WindSpeed,
+		WindDir:         apiResponse.Current.WindDir,
+		Pressure:        apiResponse.Current.Pressure,
+		FeelsLike:       apiResponse.Current.FeelsLike,
+		Location:        location,
+		Timezone:        timezone,
+		Source:          "weatherstack",
+		ObservationTime: observed,
+		CacheTime:       time.Now(),
+	}, nil
+}
+
+// Weatherstack sends coordinates as strings ("51.517"); accept numbers too
+type flexFloat float64
+
+func (f *flexFloat) UnmarshalJSON(b []byte) error {
+	s := strings.Trim(string(b), `"`)
+	if s == "" || s == "null" {
+		return nil
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return err
+	}
+	*f = flexFloat(v)
+	return nil
+}
+
+// Weatherstack condition codes (shared with WorldWeatherOnline) that
+// report falling precipitation
+var (
+	weatherstackSnowCodes  = []int{179, 227, 230, 323, 326, 329, 332, 335, 338, 368, 371, 392, 395}
+	weatherstackSleetCodes = []int{182, 185, 281, 284, 311, 314, 317, 320, 350, 362, 365, 374, 377}
+	weatherstackRainCodes  = []int{176, 200, 263, 266, 293, 296, 299, 302, 305, 308, 353, 356, 359, 386, 389}
+)
+
+func weatherstackPrecipType(code int) string {
+	switch {
+	case slices.Contains(weatherstackSnowCodes, code):
+		return "snow"
+	case slices.Contains(weatherstackSleetCodes, code):
+		return "sleet"
+	case slices.Contains(weatherstackRainCodes, code):
+		return "rain"
+	}
+	return ""
+}
+
+// Current conditions carry no forecast probability: it is either
+// precipitating right now or it is not
+func currentPrecipProb(precipType string, mm float64) float64 {
+	if precipType != "" || mm > 0 {
+		return 1
+	}
+	return 0
+}
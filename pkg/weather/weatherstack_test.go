@@ -0,0 +1,247 @@
+package weather
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// A Weatherstack provider with one key, talking to handler
+func weatherstackWith(t *testing.T, handler http.HandlerFunc) WeatherstackProvider {
+	t.Helper()
+	ts := httptest.NewServer(handler)
+	t.Cleanup(ts.Close)
+	p, err := NewWeatherstackProvider(ts.URL, newKeyPool([]string{"test-key"}, time.Minute), ts.Client())
+	if err != nil {
+		t.Fatalf("NewWeatherstackProvider: %v", err)
+	}
+	return p
+}
+
+// A Weatherstack provider answering every request with body
+func weatherstackReplying(t *testing.T, body string) WeatherstackProvider {
+	return weatherstackWith(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+	})
+}
+
+func TestWeatherstackObservationTime(t *testing.T) {
+	tests := []struct {
+		name     string
+		location string
+		want     *time.Time
+	}{
+		{"epoch", `{"name": "London", "localtime_epoch": 1741363200}`, ptr(time.Unix(1741363200, 0).UTC())},
+		{"zero epoch", `{"name": "London", "localtime_epoch": 0}`, nil},
+		{"no epoch", `{"name": "London"}`, nil},
+		{"no location", `null`, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := weatherstackReplying(t, `{"location": `+tt.location+`, "current": {"temperature": 12, "weather_descriptions": ["Sunny"]}}`)
+			data, err := p.Current(context.Background(), "London")
+			if err != nil {
+				t.Fatalf("Current: %v", err)
+			}
+			switch {
+			case tt.want == nil && data.ObservationTime != nil:
+				t.Errorf("ObservationTime = %v, want none", *data.ObservationTime)
+			case tt.want != nil && data.ObservationTime == nil:
+				t.Errorf("ObservationTime missing, want %v", *tt.want)
+			case tt.want != nil && !data.ObservationTime.Equal(*tt.want):
+				t.Errorf("ObservationTime = %v, want %v", *data.ObservationTime, *tt.want)
+			case tt.want != nil && data.ObservationTime.Location() != time.UTC:
+				t.Errorf("ObservationTime in %v, want UTC", data.ObservationTime.Location())
+			}
+			// cache_time is always ours, with or without an observation time
+			if data.CacheTime.IsZero() {
+				t.Error("CacheTime not set")
+			}
+		})
+	}
+}
+
+func ptr[T any](v T) *T { return &v }
+
+// Recorded HTTP 200 error bodies become typed errors and are never cached
+func TestWeatherstackErrorPayloads(t *testing.T) {
+	tests := []struct {
+		file       string
+		want       error
+		wantStatus int
+	}{
+		{"request-failed.json", ErrCityNotFound, http.StatusNotFound},
+		{"invalid-access-key.json", errInvalidAPIKey, http.StatusInternalServerError},
+		{"usage-limit-reached.json", ErrQuotaExceeded, http.StatusServiceUnavailable},
+		{"missing-query.json", errMissingQuery, http.StatusInternalServerError},
+		{"function-access-restricted.json", nil, http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			body, err := os.ReadFile(filepath.Join("testdata", "weatherstack", tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := weatherstackReplying(t, string(body)).Current(context.Background(), "London")
+			if err == nil {
+				t.Fatalf("got %+v, want an error", data)
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+
+			config := DefaultConfig()
+			config.RetryAttempts = 1
+			srv, err := NewServer(weatherstackReplying(t, string(body)), config)
+			if err != nil {
+				t.Fatalf("NewServer: %v", err)
+			}
+			ts := httptest.NewServer(srv.Handler())
+			defer ts.Close()
+			resp, err := http.Get(ts.URL + "/weather?city=London")
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if _, found := srv.cache.getCachedWeatherData("London"); found {
+				t.Error("error payload was cached")
+			}
+			if n := srv.cache.entries.Len(); n != 0 {
+				t.Errorf("cache holds %d entries, want none", n)
+			}
+		})
+	}
+}
+
+func TestWeatherstackEscapesCity(t *testing.T) {
+	tests := []struct {
+		city     string
+		rawQuery string
+	}{
+		{"New York", "access_key=test-key&query=New+York"},
+		{"São Paulo", "access_key=test-key&query=S%C3%A3o+Paulo"},
+		{"Zürich", "access_key=test-key&query=Z%C3%BCrich"},
+		{"Rock & Roll", "access_key=test-key&query=Rock+%26+Roll"},
+		{"C++ville", "access_key=test-key&query=C%2B%2Bville"},
+		{"London&units=f&foo=", "access_key=test-key&query=London%26units%3Df%26foo%3D"},
+		{"London#frag", "access_key=test-key&query=London%23frag"},
+		{"Paris&access_key=stolen", "access_key=test-key&query=Paris%26access_key%3Dstolen"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.city, func(t *testing.T) {
+			var got *url.URL
+			p := weatherstackWith(t, func(w http.ResponseWriter, r *http.Request) {
+				got = r.URL
+				w.Write([]byte(`{"current": {"temperature": 10}}`))
+			})
+			if _, err := p.Current(context.Background(), tt.city); err != nil {
+				t.Fatalf("Current: %v", err)
+			}
+			if got.Path != "/current" || got.RawQuery != tt.rawQuery {
+				t.Errorf("request = %s?%s, want /current?%s", got.Path, got.RawQuery, tt.rawQuery)
+			}
+			// Nothing in the city can add or change a parameter
+			q := got.Query()
+			if len(q) != 2 || q.Get("query") != tt.city || q.Get("access_key") != "test-key" {
+				t.Errorf("parameters = %v, want only access_key and query=%q", q, tt.city)
+			}
+		})
+	}
+}
+
+func TestWeatherstackBaseURL(t *testing.T) {
+	tests := []struct {
+		baseURL string
+		want    string
+		wantErr bool
+	}{
+		{"", "https://api.weatherstack.com", false},
+		{"https://eu.weatherstack.example", "https://eu.weatherstack.example", false},
+		{"http://127.0.0.1:8080/", "http://127.0.0.1:8080", false},
+		{"ftp://api.weatherstack.com", "", true},
+		{"api.weatherstack.com", "", true},
+		{"https://", "", true},
+		{"https://api.weatherstack.com:port", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.baseURL, func(t *testing.T) {
+			p, err := NewWeatherstackProvider(tt.baseURL, newKeyPool([]string{"test-key"}, time.Minute), http.DefaultClient)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if err == nil && p.BaseURL != tt.want {
+				t.Errorf("BaseURL = %q, want %q", p.BaseURL, tt.want)
+			}
+		})
+	}
+
+	// A bad WEATHERSTACK_BASE_URL stops startup
+	t.Setenv("WEATHER_PROVIDERS", "")
+	t.Setenv("WEATHER_PROVIDER", "weatherstack")
+	t.Setenv("WEATHER_FIXTURES", "")
+	t.Setenv("WEATHERSTACK_API_KEY", "test-key")
+	t.Setenv("WEATHERSTACK_BASE_URL", "ftp://api.weatherstack.com")
+	if _, err := newUpstream().newProvider(ModeLive, DefaultConfig()); err == nil {
+		t.Error("newProvider accepted an ftp base URL")
+	}
+}
+
+func TestWeatherstackLocationRoundTrips(t *testing.T) {
+	recorded, err := os.ReadFile("../../testdata/london.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Location{
+		Name:       "London",
+		Country:    "United Kingdom",
+		Region:     "City of London, Greater London",
+		Lat:        51.517,
+		Lon:        -0.106,
+		TimezoneID: "Europe/London",
+		Localtime:  "2025-03-07 16:00",
+	}
+
+	config := DefaultConfig()
+	config.RetryAttempts = 1
+	srv, err := NewServer(weatherstackReplying(t, string(recorded)), config)
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	// Asked for in lower case, named as Weatherstack resolved it, the
+	// second time from the cache
+	for i := 0; i < 2; i++ {
+		resp, err := http.Get(ts.URL + "/weather?city=london")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var data CityWeatherData
+		err = json.NewDecoder(resp.Body).Decode(&data)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if data.City != "London" {
+			t.Errorf("request %d: city = %q, want London", i+1, data.City)
+		}
+		if data.Location == nil || *data.Location != want {
+			t.Errorf("request %d: location = %+v, want %+v", i+1, data.Location, want)
+		}
+	}
+	if cached, found := srv.cache.getCachedWeatherData(srv.resolveCity("london")); !found || cached.Location == nil || *cached.Location != want {
+		t.Errorf("cached location = %+v, want %+v", cached.Location, want)
+	}
+}
@@ -0,0 +1,225 @@
+package weather
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	wsWriteWait  = 10 * time.Second
+	wsPongWait   = 60 * time.Second
+	wsPingPeriod = (wsPongWait * 9) / 10
+)
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+}
+
+// Messages sent by the client
+type wsRequest struct {
+	Subscribe   []string `json:"subscribe"`
+	Unsubscribe []string `json:"unsubscribe"`
+}
+
+// Messages pushed to the client
+type wsMessage struct {
+	Type  string           `json:"type"` // "weather" or "error"
+	City  string           `json:"city,omitempty"`
+	Data  *CityWeatherData `json:"data,omitempty"`
+	Error string           `json:"error,omitempty"`
+}
+
+type wsClient struct {
+	srv     *Server
+	conn    *websocket.Conn
+	updates chan CityWeatherData // fed by the update hub
+	direct  chan wsMessage       // snapshots and errors from the reader
+	quit    chan struct{}        // closed once the writer has stopped
+	v1      bool                 // connected under /v1, so sent the /v1 schema
+
+	mu     sync.Mutex
+	cities map[string]string // lowercased resolved city -> cache key its updates come under
+}
+
+func (s *Server) wsHandler(w http.ResponseWriter, r *http.Request) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader has already replied to the client
+		slog.Warn("WebSocket upgrade failed", "err", err)
+		return
+	}
+
+	c := &wsClient{
+		srv:     s,
+		conn:    conn,
+		updates: s.hub.subscribe(nil),
+		direct:  make(chan wsMessage, 16),
+		quit:    make(chan struct{}),
+		cities:  make(map[string]string),
+		v1:      isV1(r.Context()),
+	}
+	done := make(chan struct{})
+	go func() {
+		c.readLoop(r.Context())
+		close(done)
+	}()
+	c.writeLoop(done)
+
+	close(c.quit)
+	conn.Close()
+	c.mu.Lock()
+	subscribed := make([]string, 0, len(c.cities))
+	for _, key := range c.cities {
+		subscribed = append(subscribed, key)
+	}
+	c.mu.Unlock()
+	s.hub.unsubscribe(c.updates, subscribed)
+}
+
+func (c *wsClient) readLoop(ctx context.Context) {
+	c.conn.SetReadLimit(4096)
+	c.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+
+	for {
+		var req wsRequest
+		if err := c.conn.ReadJSON(&req); err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				slog.Warn("WebSocket read error", "err", err)
+			}
+			return
+		}
+		c.unsubscribe(req.Unsubscribe)
+		c.subscribe(ctx, req.Subscribe)
+	}
+}
+
+// A city named by the client, resolved as /weather resolves it: validated,
+// then alias-resolved so the allowlist and the cache see the same name
+func (c *wsClient) resolve(city string) (string, error) {
+	city, err := ValidateCity(strings.TrimSpace(city))
+	if err != nil {
+		return "", err
+	}
+	city = c.srv.aliases.resolve(city)
+	if !c.srv.allowed.allows(city) {
+		return "", errors.New("city not allowed")
+	}
+	return city, nil
+}
+
+func (c *wsClient) subscribe(ctx context.Context, cities []string) {
+	var added []string
+	var rejected []wsMessage
+	c.mu.Lock()
+	for _, requested := range cities {
+		if strings.TrimSpace(requested) == "" {
+			continue
+		}
+		city, err := c.resolve(requested)
+		if err != nil {
+			rejected = append(rejected, wsMessage{Type: "error", City: requested, Error: err.Error()})
+			continue
+		}
+		name := strings.ToLower(city)
+		if _, ok := c.cities[name]; ok {
+			continue
+		}
+		c.cities[name] = "" // keyed once its snapshot is in hand
+		added = append(added, city)
+	}
+	c.mu.Unlock()
+	for _, msg := range rejected {
+		c.send(msg)
+	}
+
+	// Initial snapshot for each newly subscribed city. The city is added
+	// to the hub once the snapshot is in hand, so a fetch for it is not
+	// pushed twice; a reading cached in between is caught by looking again.
+	for _, city := range added {
+		data, key, err := c.srv.snapshot(ctx, city, defaultLanguage)
+		if ctx.Err() != nil {
+			return
+		}
+		c.mu.Lock()
+		c.cities[strings.ToLower(city)] = key
+		c.mu.Unlock()
+		c.srv.hub.add(c.updates, []string{key})
+		if err != nil {
+			c.send(wsMessage{Type: "error", City: city, Error: err.Error()})
+			continue
+		}
+		c.send(wsMessage{Type: "weather", City: data.City, Data: &data})
+		if latest, ok := c.srv.cache.peek(key); ok && !latest.CacheTime.Equal(data.CacheTime) {
+			c.send(wsMessage{Type: "weather", City: latest.City, Data: &latest})
+		}
+	}
+}
+
+// Queue a message for the writer unless the connection is shutting down
+func (c *wsClient) send(msg wsMessage) {
+	select {
+	case c.direct <- msg:
+	case <-c.quit:
+	}
+}
+
+func (c *wsClient) unsubscribe(cities []string) {
+	var removed []string
+	c.mu.Lock()
+	for _, requested := range cities {
+		city, err := c.resolve(requested)
+		if err != nil {
+			continue
+		}
+		name := strings.ToLower(city)
+		if key, ok := c.cities[name]; ok {
+			delete(c.cities, name)
+			removed = append(removed, key)
+		}
+	}
+	c.mu.Unlock()
+	c.srv.hub.unsubscribe(c.updates, removed)
+}
+
+// All writes happen here so the connection only ever has one writer
+func (c *wsClient) writeLoop(done <-chan struct{}) {
+	ping := time.NewTicker(wsPingPeriod)
+	defer ping.Stop()
+
+	for {
+		var msg wsMessage
+		select {
+		case <-done:
+			return
+		case data := <-c.updates:
+			msg = wsMessage{Type: "weather", City: data.City, Data: &data}
+		case msg = <-c.direct:
+		case <-ping.C:
+			if err := c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteWait)); err != nil {
+				return
+			}
+			continue
+		}
+
+		payload, err := marshalSchema(msg, c.v1)
+		if err != nil {
+			slog.Error("Error encoding WebSocket message", "err", err)
+			continue
+		}
+		c.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+		if err := c.conn.WriteMessage(websocket.TextMessage, payload); err != nil {
+			return
+		}
+	}
+}
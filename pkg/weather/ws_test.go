@@ -0,0 +1,130 @@
+package weather_test
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/deepakg86/weather-api-caching/pkg/weather"
+	"github.com/gorilla/websocket"
+)
+
+type wsMessage struct {
+	Type  string                   `json:"type"`
+	City  string                   `json:"city"`
+	Data  *weather.CityWeatherData `json:"data"`
+	Error string                   `json:"error"`
+}
+
+func dialWS(t *testing.T, url string) *websocket.Conn {
+	t.Helper()
+	conn, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(url, "http")+"/ws", nil)
+	if err != nil {
+		t.Fatalf("dialing /ws: %v", err)
+	}
+	resp.Body.Close()
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func readWS(t *testing.T, conn *websocket.Conn) wsMessage {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var msg wsMessage
+	if err := conn.ReadJSON(&msg); err != nil {
+		t.Fatalf("reading message: %v", err)
+	}
+	return msg
+}
+
+func TestWebSocketPushesAfterForcedRefresh(t *testing.T) {
+	ts := newTestServer(t, &warmingProvider{}, withAdmin)
+	conn := dialWS(t, ts.URL)
+
+	if err := conn.WriteJSON(map[string][]string{"subscribe": {"London", "Paris", "Par1s"}}); err != nil {
+		t.Fatalf("subscribing: %v", err)
+	}
+	snapshot := map[string]float64{}
+	for len(snapshot) < 2 {
+		msg := readWS(t, conn)
+		switch {
+		case msg.Type == "error" && msg.City == "Par1s":
+			continue
+		case msg.Type != "weather" || msg.Data == nil:
+			t.Fatalf("message = %+v, want a weather snapshot", msg)
+		}
+		snapshot[msg.City] = msg.Data.Temp
+	}
+	if snapshot["London"] == 0 || snapshot["Paris"] == 0 {
+		t.Errorf("snapshot = %v, want London and Paris", snapshot)
+	}
+
+	// Overwriting the cached entry pushes it to the subscriber
+	if resp := adminJSON(t, ts, http.MethodPut, "/cache/entry", validEntry(), nil); resp.StatusCode != http.StatusOK {
+		t.Fatalf("PUT /cache/entry: status %d", resp.StatusCode)
+	}
+	if msg := readWS(t, conn); msg.Type != "weather" || msg.City != "Paris" || msg.Data == nil || msg.Data.Temp != 21.5 {
+		t.Errorf("push = %+v, want Paris at 21.5", msg)
+	}
+
+	// The Tokyo snapshot shows the unsubscribe, handled first, has taken
+	// effect: Paris updates stop while London's still arrive
+	if err := conn.WriteJSON(map[string][]string{"unsubscribe": {"paris"}, "subscribe": {"Tokyo"}}); err != nil {
+		t.Fatalf("unsubscribing: %v", err)
+	}
+	if msg := readWS(t, conn); msg.City != "Tokyo" {
+		t.Fatalf("message = %+v, want the Tokyo snapshot", msg)
+	}
+	adminJSON(t, ts, http.MethodPut, "/cache/entry", validEntry(), nil)
+	london := validEntry()
+	london["city"] = "London"
+	adminJSON(t, ts, http.MethodPut, "/cache/entry", london, nil)
+	if msg := readWS(t, conn); msg.City != "London" {
+		t.Errorf("push = %+v after unsubscribing from Paris, want London", msg)
+	}
+}
+
+func TestWebSocketFollowsAliasedCity(t *testing.T) {
+	aliases := filepath.Join(t.TempDir(), "aliases.txt")
+	if err := os.WriteFile(aliases, []byte("NYC = New York City\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ts := newTestServer(t, &warmingProvider{}, func(config *weather.Config) {
+		config.CityAliasesFile = aliases
+		config.CacheTTL = 100 * time.Millisecond
+	})
+	conn := dialWS(t, ts.URL)
+
+	if err := conn.WriteJSON(map[string][]string{"subscribe": {"nyc", "New York City"}}); err != nil {
+		t.Fatalf("subscribing: %v", err)
+	}
+	if msg := readWS(t, conn); msg.City != "New York City" || msg.Data == nil || msg.Data.Temp != 11 {
+		t.Fatalf("snapshot = %+v, want New York City at 11", msg)
+	}
+
+	// A refresh through /weather under the full name is pushed, once,
+	// although both names were subscribed
+	time.Sleep(150 * time.Millisecond)
+	getJSON(t, ts, "/weather?city=New%20York%20City", nil)
+	if msg := readWS(t, conn); msg.City != "New York City" || msg.Data == nil || msg.Data.Temp != 12 {
+		t.Fatalf("push = %+v, want New York City at 12", msg)
+	}
+
+	// Unsubscribing by the alias ends it; Oslo's snapshot shows the
+	// unsubscribe has been handled
+	if err := conn.WriteJSON(map[string][]string{"unsubscribe": {"NYC"}, "subscribe": {"Oslo"}}); err != nil {
+		t.Fatalf("unsubscribing: %v", err)
+	}
+	if msg := readWS(t, conn); msg.City != "Oslo" {
+		t.Fatalf("message = %+v, want the Oslo snapshot", msg)
+	}
+	time.Sleep(150 * time.Millisecond)
+	getJSON(t, ts, "/weather?city=New%20York%20City", nil)
+	getJSON(t, ts, "/weather?city=Oslo", nil)
+	if msg := readWS(t, conn); msg.City != "Oslo" {
+		t.Errorf("push = %+v after unsubscribing from NYC, want Oslo", msg)
+	}
+}
@@ -0,0 +1,216 @@
+package weather
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const zippopotamDefaultURL = "https://api.zippopotam.us"
+
+var (
+	errZipNotFound = errors.New("postal code not found")
+
+	countryCodePattern = regexp.MustCompile(`^[A-Za-z]{2}$`)
+	usZipPattern       = regexp.MustCompile(`^\d{5}$`)
+	postalCodePattern  = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9 -]{1,9}$`)
+)
+
+// Where a postal code lies, as Zippopotam reports it
+type zipPlace struct {
+	Name  string  `json:"place"`
+	State string  `json:"state,omitempty"`
+	Lat   float64 `json:"lat"`
+	Lon   float64 `json:"lon"`
+}
+
+type zipEntry struct {
+	place   zipPlace
+	expires time.Time
+}
+
+// Postal codes resolved to coordinates through Zippopotam, remembered for
+// ttl since they practically never move
+type zipResolver struct {
+	baseURL string
+	ttl     time.Duration
+	client  *http.Client
+
+	mu    sync.Mutex
+	cache map[string]zipEntry
+}
+
+func newZipResolver(baseURL string, ttl time.Duration, client *http.Client) *zipResolver {
+	if baseURL == "" {
+		baseURL = zippopotamDefaultURL
+	}
+	return &zipResolver{baseURL: strings.TrimSuffix(baseURL, "/"), ttl: ttl, client: client, cache: make(map[string]zipEntry)}
+}
+
+// Check a country code and postal code, strictly for US ZIPs
+func validatePostalCode(country, zip string) error {
+	if !countryCodePattern.MatchString(country) {
+		return fmt.Errorf("country must be a two-letter code such as US, got %q", country)
+	}
+	if strings.EqualFold(country, "US") {
+		if !usZipPattern.MatchString(zip) {
+			return fmt.Errorf("US ZIP codes have five digits, got %q", zip)
+		}
+		return nil
+	}
+	if !postalCodePattern.MatchString(zip) {
+		return fmt.Errorf("malformed postal code %q", zip)
+	}
+	return nil
+}
+
+func (z *zipResolver) resolve(ctx context.Context, country, zip string) (zipPlace, error) {
+	key := strings.ToLower(country) + "/" + strings.ToUpper(zip)
+	z.mu.Lock()
+	entry, ok := z.cache[key]
+	z.mu.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.place, nil
+	}
+
+	place, err := z.lookup(ctx, country, zip)
+	if err != nil {
+		return zipPlace{}, err
+	}
+	z.mu.Lock()
+	z.cache[key] = zipEntry{place: place, expires: time.Now().Add(z.ttl)}
+	z.mu.Unlock()
+	return place, nil
+}
+
+func (z *zipResolver) lookup(ctx context.Context, country, zip string) (zipPlace, error) {
+	/*
+	   Request URL: https://api.zippopotam.us/us/10001
+	   Raw Response:
+	   {
+	       "post code": "10001",
+	       "country": "United States",
+	       "places": [
+	           {"place name": "New York City", "longitude": "-73.9967",
+	            "state": "New York", "latitude": "40.7484"}
+	       ]
+	   }
+	*/
+	requestURL := z.baseURL + "/" + url.PathEscape(strings.ToLower(country)) + "/" + url.PathEscape(zip)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, requestURL, nil)
+	if err != nil {
+		return zipPlace{}, err
+	}
+	resp, err := tracedDo(z.client, "zippopotam", req)
+	if err != nil {
+		return zipPlace{}, classifyTransportError(err)
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return zipPlace{}, fmt.Errorf("%w: %s %s", errZipNotFound, strings.ToUpper(country), zip)
+	default:
+		return zipPlace{}, &StatusError{Code: resp.StatusCode, Status: resp.Status}
+	}
+
+	var body struct {
+		Places []struct {
+			Name  string `json:"place name"`
+			State string `json:"state"`
+			Lat   string `json:"latitude"`
+			Lon   string `json:"longitude"`
+		} `json:"places"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return zipPlace{}, fmt.Errorf("%w: %v", ErrUpstreamBadResponse, err)
+	}
+	if len(body.Places) == 0 {
+		return zipPlace{}, fmt.Errorf("%w: %s %s", errZipNotFound, strings.ToUpper(country), zip)
+	}
+	p := body.Places[0]
+	lat, err1 := strconv.ParseFloat(p.Lat, 64)
+	lon, err2 := strconv.ParseFloat(p.Lon, 64)
+	if err1 != nil || err2 != nil {
+		return zipPlace{}, fmt.Errorf("%w: bad coordinates %q, %q", ErrUpstreamBadResponse, p.Lat, p.Lon)
+	}
+	return zipPlace{Name: p.Name, State: p.State, Lat: lat, Lon: lon}, nil
+}
+
+// A provider query for a point, which Weatherstack takes as is and
+// OpenWeatherMap recognizes via parseCoordinates
+func coordinatesQuery(lat, lon float64) string {
+	return strconv.FormatFloat(lat, 'f', 4, 64) + "," + strconv.FormatFloat(lon, 'f', 4, 64)
+}
+
+func parseCoordinates(query string) (lat, lon float64, ok bool) {
+	a, b, found := strings.Cut(query, ",")
+	if !found {
+		return 0, 0, false
+	}
+	lat, err1 := strconv.ParseFloat(a, 64)
+	lon, err2 := strconv.ParseFloat(b, 64)
+	if err1 != nil || err2 != nil || lat < -90 || lat > 90 || lon < -180 || lon > 180 {
+		return 0, 0, false
+	}
+	return lat, lon, true
+}
+
+type nearestWeather struct {
+	Zip     string          `json:"zip"`
+	Country string          `json:"country"`
+	Place   zipPlace        `json:"place"`
+	Weather CityWeatherData `json:"weather"`
+}
+
+// Weather at the place a postal code resolves to, looked up by its
+// coordinates and cached under them
+func (s *Server) nearestHandler(w http.ResponseWriter, r *http.Request) {
+	zip := strings.TrimSpace(r.URL.Query().Get("zip"))
+	if zip == "" {
+		writeProblem(w, http.StatusBadRequest, "", "Zip parameter is required", r.URL.Path)
+		return
+	}
+	country := r.URL.Query().Get("country")
+	if country == "" {
+		country = "US"
+	}
+	if err := validatePostalCode(country, zip); err != nil {
+		writeProblem(w, http.StatusBadRequest, "", fmt.Sprintf("Invalid zip parameter: %v", err), r.URL.Path)
+		return
+	}
+
+	place, err := s.zips.resolve(r.Context(), country, zip)
+	if errors.Is(err, errZipNotFound) {
+		writeProblem(w, http.StatusNotFound, "", fmt.Sprintf("Postal code not found: %s %s", strings.ToUpper(country), zip), r.URL.Path)
+		return
+	}
+	if err != nil {
+		writeProblem(w, upstreamErrorStatus(err), "", fmt.Sprintf("Failed to resolve postal code: %v", err), r.URL.Path)
+		return
+	}
+
+	query := coordinatesQuery(place.Lat, place.Lon)
+	data, err := s.cache.GetOrFetch(r.Context(), query, s.getCityWeatherData)
+	if retryAfter, ok := s.retryAfter(err); ok {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		writeProblem(w, http.StatusServiceUnavailable, "", fmt.Sprintf("Failed to fetch weather data: %v", err), r.URL.Path)
+		return
+	}
+	if err != nil {
+		writeProblem(w, upstreamErrorStatus(err), "", fmt.Sprintf("Failed to fetch weather data: %v", err), r.URL.Path)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(nearestWeather{Zip: zip, Country: strings.ToUpper(country), Place: place, Weather: data})
+}
@@ -1,5 +0,0 @@
-module github.com/deepakg86/realtime-weather-api-caching
-
-go 1.23.4
-
-require github.com/joho/godotenv v1.5.1
@@ -1,3 +0,0 @@
-module github.com/deepakg86/simulated-weather-api-caching
-
-go 1.23.4